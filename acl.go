@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PluginACL restricts clients matching Client to the plugins matching one
+// of the Plugins glob patterns.
+type PluginACL struct {
+	Client  string
+	Plugins []string
+}
+
+// parsePluginACL parses the value of a plugin_acl directive:
+//
+//	plugin_acl <client> <plugin-glob> [<plugin-glob> ...]
+//
+// where client is a CIDR block or an IP regex as used by allow, or
+// cn:<name> for a client that showed a verified TLS certificate for name.
+func parsePluginACL(value string) (PluginACL, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return PluginACL{}, fmt.Errorf("invalid plugin_acl directive: %s", value)
+	}
+	client := fields[0]
+	if strings.HasPrefix(strings.ToLower(client), "cn:") {
+		if len(client) == len("cn:") {
+			return PluginACL{}, fmt.Errorf("invalid plugin_acl directive: %s", value)
+		}
+		client = "cn:" + client[len("cn:"):]
+	}
+	return PluginACL{Client: client, Plugins: fields[1:]}, nil
+}
+
+// matchClient reports whether clientIP matches pattern, which is either a
+// CIDR block or a regular expression.
+func (s *Server) matchClient(pattern string, clientIP string) bool {
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		ip := net.ParseIP(clientIP)
+		return ip != nil && network.Contains(ip)
+	}
+
+	match, err := s.matchPattern(pattern, clientIP)
+	if err != nil {
+		logger.Warn("invalid client pattern", "pattern", pattern, "error", err)
+		return false
+	}
+	return match
+}
+
+// matchPattern reports whether clientIP matches the regular expression
+// pattern, compared as a string if the embedded profile can
+func (s *Server) matchPattern(pattern string, clientIP string) (bool, error) {
+	if s.conf.isEmbedded() {
+		if literal, ok := literalPattern(pattern); ok {
+			return literal == clientIP, nil
+		}
+	}
+	return regexp.MatchString(pattern, clientIP)
+}
+
+// pluginPatternsFor returns the plugin globs the client at clientIP is
+// limited to, commonName being the name on its verified TLS certificate
+// if it showed one. A nil result means no plugin_acl rule matched and the
+// client may use every plugin.
+func (s *Server) pluginPatternsFor(clientIP string, commonName string) []string {
+	var patterns []string
+	for _, acl := range s.conf.PluginACLs {
+		if name, ok := strings.CutPrefix(acl.Client, "cn:"); ok {
+			if commonName == "" || !strings.EqualFold(name, commonName) {
+				continue
+			}
+		} else if !s.matchClient(acl.Client, clientIP) {
+			continue
+		}
+		patterns = append(patterns, acl.Plugins...)
+	}
+	return patterns
+}
+
+func isPluginAllowed(plugin string, patterns []string) bool {
+	if patterns == nil {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if match, _ := filepath.Match(pattern, plugin); match {
+			return true
+		}
+	}
+	return false
+}
+
+// accessFile holds the allow/deny rules read from the file named by the
+// allow_file directive. The file is re-read whenever its mtime changes.
+type accessFile struct {
+	mu      sync.Mutex
+	modTime time.Time
+	allow   []string
+	deny    []string
+}
+
+func readAccessFile(path string) (allow []string, deny []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open allow file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("invalid rule: %s", line)
+		}
+
+		switch fields[0] {
+		case "allow":
+			allow = append(allow, fields[1])
+		case "deny":
+			deny = append(deny, fields[1])
+		default:
+			return nil, nil, fmt.Errorf("invalid rule: %s", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading allow file: %w", err)
+	}
+
+	return allow, deny, nil
+}
+
+// allowFileRules returns the current allow and deny lists, reloading
+// allow_file first if it changed. A file that fails to parse leaves the
+// previous rules in effect.
+func (s *Server) allowFileRules() ([]string, []string) {
+	f := &s.allowFile
+	path := s.conf.AllowFile
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		logger.Error("failed to stat allow file", "path", path, "error", err)
+		s.healthConfig(err)
+		reportError("config", err, map[string]string{"path": path})
+		return f.allow, f.deny
+	}
+
+	if fileInfo.ModTime().Equal(f.modTime) {
+		return f.allow, f.deny
+	}
+
+	allow, deny, err := readAccessFile(path)
+	if err != nil {
+		logger.Error("failed to load allow file, keeping previous rules", "path", path, "error", err)
+		s.healthConfig(err)
+		reportError("config", err, map[string]string{"path": path})
+		return f.allow, f.deny
+	}
+
+	f.modTime = fileInfo.ModTime()
+	f.allow, f.deny = allow, deny
+	logger.Info("loaded allow file", "path", path, "allow", len(allow), "deny", len(deny))
+	s.healthConfig(nil)
+
+	return f.allow, f.deny
+}
+
+// isAllowedClient combines the allow directives from node.conf with the
+// rules from allow_file. Deny rules in allow_file always win.
+func (s *Server) isAllowedClient(clientIP string) bool {
+	if s.conf.AllowFile == "" {
+		return s.isAllowedIP(clientIP, s.conf.AllowedIPs)
+	}
+
+	allow, deny := s.allowFileRules()
+	for _, pattern := range deny {
+		if s.matchClient(pattern, clientIP) {
+			return false
+		}
+	}
+
+	if s.isAllowedIP(clientIP, s.conf.AllowedIPs) {
+		return true
+	}
+
+	for _, pattern := range allow {
+		if s.matchClient(pattern, clientIP) {
+			return true
+		}
+	}
+	return false
+}
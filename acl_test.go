@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePluginACL(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    PluginACL
+		wantErr bool
+	}{
+		{"10.1.0.0/16 nginx_* php_fpm_*", PluginACL{Client: "10.1.0.0/16", Plugins: []string{"nginx_*", "php_fpm_*"}}, false},
+		{`^192\.168\.1\.10$   cpu`, PluginACL{Client: `^192\.168\.1\.10$`, Plugins: []string{"cpu"}}, false},
+		{"10.1.0.0/16", PluginACL{}, true},
+		{"", PluginACL{}, true},
+		{"cn:master.example.com cpu", PluginACL{Client: "cn:master.example.com", Plugins: []string{"cpu"}}, false},
+		{"CN:master.example.com cpu", PluginACL{Client: "cn:master.example.com", Plugins: []string{"cpu"}}, false},
+		{"cn: cpu", PluginACL{}, true},
+	}
+	for _, test := range tests {
+		got, err := parsePluginACL(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePluginACL(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parsePluginACL(%q) = %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestReadAccessFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantAllow []string
+		wantDeny  []string
+		wantErr   bool
+	}{
+		{
+			name:      "rules",
+			content:   "# masters\nallow ^127\\.0\\.0\\.1$\n\n  deny 10.0.0.0/8  \nallow 192.168.0.0/16\n",
+			wantAllow: []string{`^127\.0\.0\.1$`, "192.168.0.0/16"},
+			wantDeny:  []string{"10.0.0.0/8"},
+		},
+		{name: "empty", content: "# nothing yet\n"},
+		{name: "unknown rule", content: "permit 10.0.0.0/8\n", wantErr: true},
+		{name: "missing pattern", content: "allow\n", wantErr: true},
+		{name: "extra field", content: "allow 10.0.0.0/8 cpu\n", wantErr: true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "allow")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		allow, deny, err := readAccessFile(path)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(allow, test.wantAllow) || !reflect.DeepEqual(deny, test.wantDeny) {
+			t.Errorf("%s: got allow %q deny %q, want allow %q deny %q", test.name, allow, deny, test.wantAllow, test.wantDeny)
+		}
+	}
+
+	if _, _, err := readAccessFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("readAccessFile of a missing file succeeded")
+	}
+}
+
+func TestIsAllowedClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allow")
+	if err := os.WriteFile(path, []byte("deny 10.0.0.66/32\nallow 10.0.0.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conf := newNodeConfig()
+	conf.AllowedIPs = []string{`^127\.0\.0\.1$`}
+	conf.AllowFile = path
+	s := newServer(conf)
+
+	tests := []struct {
+		client string
+		want   bool
+	}{
+		{"127.0.0.1", true},
+		{"10.0.0.5", true},
+		{"10.0.0.66", false},
+		{"10.0.1.5", false},
+		{"127.0.0.10", false},
+	}
+	for _, test := range tests {
+		if got := s.isAllowedClient(test.client); got != test.want {
+			t.Errorf("isAllowedClient(%q) = %v, want %v", test.client, got, test.want)
+		}
+	}
+}
+
+func TestPluginPatternsFor(t *testing.T) {
+	conf := newNodeConfig()
+	conf.PluginACLs = []PluginACL{
+		{Client: "10.1.0.0/16", Plugins: []string{"nginx_*"}},
+		{Client: `^10\.1\.2\.3$`, Plugins: []string{"cpu"}},
+		{Client: "cn:billing-poller", Plugins: []string{"billing_*"}},
+	}
+	s := newServer(conf)
+
+	tests := []struct {
+		client     string
+		commonName string
+		plugin     string
+		want       bool
+	}{
+		{"10.1.9.9", "", "nginx_status", true},
+		{"10.1.9.9", "", "cpu", false},
+		{"10.1.2.3", "", "cpu", true},
+		{"10.1.2.3", "", "nginx_request", true},
+		{"10.1.2.3", "", "memory", false},
+		{"192.168.1.1", "", "memory", true},
+		{"192.168.1.1", "billing-poller", "billing_queue", true},
+		{"192.168.1.1", "Billing-Poller", "billing_queue", true},
+		{"192.168.1.1", "billing-poller", "memory", false},
+		{"192.168.1.1", "other-poller", "memory", true},
+		{"10.1.9.9", "billing-poller", "nginx_status", true},
+		{"10.1.9.9", "billing-poller", "billing_queue", true},
+		{"10.1.9.9", "billing-poller", "cpu", false},
+	}
+	for _, test := range tests {
+		patterns := s.pluginPatternsFor(test.client, test.commonName)
+		if got := isPluginAllowed(test.plugin, patterns); got != test.want {
+			t.Errorf("client %s cn %q plugin %s: allowed = %v, want %v", test.client, test.commonName, test.plugin, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// builtinPlugin is a plugin implemented natively inside the node. It is
+// listed and executed like a plugin from the plugins folder, but without
+// forking anything. A file of the same name in the plugins folder takes
+// precedence over the built-in implementation.
+type builtinPlugin struct {
+	// name is the plugin name, or for wildcard plugins the prefix up to
+	// and including the trailing underscore (e.g. "if_")
+	name     string
+	wildcard bool
+
+	// autoconf reports whether the plugin can work on this host. Plugins
+	// that can't are not listed.
+	autoconf func(req *pluginRequest) bool
+	// suggest returns the instances of a wildcard plugin
+	suggest func(req *pluginRequest) ([]string, error)
+	// node returns the virtual node an instance reports for, for plugins
+	// that monitor other hosts. Nil or "" means this node.
+	node func(instance string) string
+
+	config func(req *pluginRequest) (string, error)
+	fetch  func(req *pluginRequest) (string, error)
+}
+
+// pluginRequest carries everything a built-in plugin needs for one run.
+type pluginRequest struct {
+	// name is the full plugin name as requested by the master
+	name string
+	// instance is the part of the name after the wildcard prefix
+	instance string
+	// env is loaded from the server's plugin config on first use when nil
+	env    map[string]string
+	server *Server
+	// ctx is done once the node stops waiting for the plugin
+	ctx context.Context
+}
+
+// getenv returns the env.* setting for key from plugin config, or def if
+// it is not set.
+func (r *pluginRequest) getenv(key string, def string) string {
+	if r.env == nil && r.server != nil {
+		env, _ := r.server.loadPluginConfig(r.name)
+		r.env = envMap(env)
+	}
+	if value, ok := r.env[key]; ok {
+		return value
+	}
+	return def
+}
+
+// related returns the request for another plugin of the same server, such
+// as a per-device section of a wildcard plugin
+func (r *pluginRequest) related(name string) *pluginRequest {
+	return r.server.builtinRequest(r.ctx, name)
+}
+
+// isEmbedded tells whether the server runs the embedded profile
+func (r *pluginRequest) isEmbedded() bool {
+	return r.server != nil && r.server.conf.isEmbedded()
+}
+
+// printThresholds writes the warning and critical limits for field taken
+// from env.<field>_warning and env.<field>_critical, falling back to
+// env.warning and env.critical and then the given defaults, the same way
+// print_warning and print_critical do for shell plugins.
+func (r *pluginRequest) printThresholds(w io.Writer, field string, defWarning string, defCritical string) {
+	warning := r.getenv(field+"_warning", r.getenv("warning", defWarning))
+	critical := r.getenv(field+"_critical", r.getenv("critical", defCritical))
+
+	if warning != "" {
+		fmt.Fprintf(w, "%s.warning %s\n", field, warning)
+	}
+	if critical != "" {
+		fmt.Fprintf(w, "%s.critical %s\n", field, critical)
+	}
+}
+
+var builtinPlugins = map[string]*builtinPlugin{}
+
+func registerBuiltin(plugin *builtinPlugin) {
+	if _, exists := builtinPlugins[plugin.name]; exists {
+		panic("duplicate built-in plugin " + plugin.name)
+	}
+	builtinPlugins[plugin.name] = plugin
+}
+
+// isBuiltinEnabled tells whether the builtins directive, if given, names
+// the plugin. Wildcard plugins are named by their prefix, e.g. "if_".
+func (s *Server) isBuiltinEnabled(plugin *builtinPlugin) bool {
+	if len(s.conf.Builtins) == 0 {
+		return true
+	}
+	for _, name := range s.conf.Builtins {
+		if name == plugin.name {
+			return true
+		}
+	}
+	return false
+}
+
+// findBuiltin resolves a plugin name to a built-in implementation and the
+// wildcard instance, if any.
+func (s *Server) findBuiltin(name string) (*builtinPlugin, string) {
+	if plugin, ok := builtinPlugins[name]; ok && !plugin.wildcard && s.isBuiltinEnabled(plugin) {
+		return plugin, ""
+	}
+
+	// Prefer the longest matching prefix so that if_err_ wins over if_
+	var found *builtinPlugin
+	for _, plugin := range builtinPlugins {
+		if !plugin.wildcard || !strings.HasPrefix(name, plugin.name) || !s.isBuiltinEnabled(plugin) {
+			continue
+		}
+		if found == nil || len(plugin.name) > len(found.name) {
+			found = plugin
+		}
+	}
+
+	if found == nil {
+		return nil, ""
+	}
+
+	instance := strings.TrimPrefix(name, found.name)
+	if instance == "" || strings.Contains(instance, "/") || strings.Contains(instance, "..") {
+		return nil, ""
+	}
+	return found, instance
+}
+
+// listBuiltins returns the names of all built-in plugins usable on this
+// host, from the inventory while it is current.
+func (s *Server) listBuiltins(ctx context.Context) []string {
+	ttl := s.conf.pluginCacheTTL()
+	if ttl == 0 {
+		return s.probeBuiltins(ctx)
+	}
+
+	inv := &s.plugins
+	inv.builtinMu.Lock()
+	defer inv.builtinMu.Unlock()
+
+	if !inv.builtinsRead.IsZero() && time.Since(inv.builtinsRead) < ttl {
+		metricCacheHits.inc("builtins")
+		return inv.builtins
+	}
+	metricCacheMisses.inc("builtins")
+
+	names := s.probeBuiltins(ctx)
+	// Probes cut short by a client leaving tell nothing about the host
+	if ctx.Err() == nil {
+		inv.builtins, inv.builtinsRead = names, time.Now()
+	}
+	return names
+}
+
+// probeBuiltins runs the autoconf of every enabled built-in plugin,
+// expanding wildcard plugins into their suggested instances.
+func (s *Server) probeBuiltins(ctx context.Context) []string {
+	var names []string
+	for _, plugin := range builtinPlugins {
+		if !s.isBuiltinEnabled(plugin) || plugin.autoconf != nil && !plugin.autoconf(s.builtinRequest(ctx, plugin.name)) {
+			continue
+		}
+
+		if !plugin.wildcard {
+			names = append(names, plugin.name)
+			continue
+		}
+
+		instances, err := plugin.suggest(s.builtinRequest(ctx, plugin.name))
+		if err != nil {
+			continue
+		}
+		for _, instance := range instances {
+			names = append(names, plugin.name+instance)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// builtinNode returns the virtual node a built-in plugin reports for, or
+// "" if it reports for this node like any other plugin.
+func (s *Server) builtinNode(name string) string {
+	plugin, instance := s.findBuiltin(name)
+	if plugin == nil || plugin.node == nil {
+		return ""
+	}
+	return plugin.node(instance)
+}
+
+// virtualNodes returns the virtual nodes of all usable built-in plugins.
+func (s *Server) virtualNodes(ctx context.Context) []string {
+	seen := map[string]bool{}
+	var nodes []string
+	for _, name := range s.listBuiltins(ctx) {
+		if node := s.builtinNode(name); node != "" && !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// cleanFieldName turns an arbitrary string into a valid munin field name,
+// like clean_fieldname in Munin::Plugin.
+func cleanFieldName(name string) string {
+	field := []byte(name)
+	for i, c := range field {
+		isLetter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && (i == 0 || !isDigit) {
+			field[i] = '_'
+		}
+	}
+	return string(field)
+}
+
+// percentThreshold turns a percentage setting into an absolute limit of
+// max, returning "" when the setting is empty or invalid.
+func percentThreshold(percent string, max uint64) string {
+	value, err := strconv.ParseFloat(percent, 64)
+	if err != nil || value <= 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(float64(max)*value/100), 10)
+}
+
+// writeReadWritePair writes a read field drawn below the axis and its
+// write counterpart above it.
+func writeReadWritePair(b *strings.Builder, read string, write string, label string, fieldType string) {
+	fmt.Fprintf(b, "%s.label %s\n", read, label)
+	fmt.Fprintf(b, "%s.type %s\n", read, fieldType)
+	fmt.Fprintf(b, "%s.min 0\n", read)
+	fmt.Fprintf(b, "%s.graph no\n", read)
+	fmt.Fprintf(b, "%s.label %s\n", write, label)
+	fmt.Fprintf(b, "%s.type %s\n", write, fieldType)
+	fmt.Fprintf(b, "%s.min 0\n", write)
+	fmt.Fprintf(b, "%s.negative %s\n", write, read)
+}
+
+// runCommand runs an external helper such as smartctl for a built-in
+// plugin, killing it if it takes longer than timeout. Output is returned
+// even if the command exits non-zero, as many tools use the exit status
+// to report findings rather than failure.
+func runCommand(ctx context.Context, timeout time.Duration, name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s timed out after %s", name, timeout)
+	}
+	return output, err
+}
+
+// fetchURL GETs a status page for a built-in plugin, treating any answer
+// other than 200 OK as an error.
+func fetchURL(ctx context.Context, timeout time.Duration, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// builtinHTTPClient returns a client for a built-in plugin talking to an
+// HTTPS API, with the TLS settings of builtinTLSConfig.
+func builtinHTTPClient(req *pluginRequest, timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := builtinTLSConfig(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// builtinTLSConfig returns the TLS settings of a built-in plugin, trusting
+// env.ca_cert in addition to the system roots, or skipping verification
+// altogether with env.insecure.
+func builtinTLSConfig(req *pluginRequest) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if caCert := req.getenv("ca_cert", ""); caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if parseConfigBool(req.getenv("insecure", "no")) {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// builtinRequest builds the request for a built-in plugin outside of a
+// run, for autoconf and suggest. Its plugin config is read when first
+// needed.
+func (s *Server) builtinRequest(ctx context.Context, name string) *pluginRequest {
+	return &pluginRequest{name: name, server: s, ctx: ctx}
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		}
+	}
+	return m
+}
+
+func (s *Server) executeBuiltin(ctx context.Context, plugin *builtinPlugin, name string, instance string, option string) (string, error) {
+	env, err := s.loadPluginConfig(name)
+	if err != nil {
+		return "", err
+	}
+
+	req := &pluginRequest{name: name, instance: instance, env: envMap(env), server: s, ctx: ctx}
+
+	var output string
+	switch option {
+	case "config":
+		output, err = plugin.config(req)
+	case "":
+		output, err = plugin.fetch(req)
+	case "autoconf":
+		if plugin.autoconf == nil || plugin.autoconf(req) {
+			return "yes\n", nil
+		}
+		return "no\n", nil
+	case "suggest":
+		if !plugin.wildcard {
+			return "", nil
+		}
+		var instances []string
+		instances, err = plugin.suggest(req)
+		if len(instances) > 0 {
+			output = strings.Join(instances, "\n") + "\n"
+		}
+	default:
+		return "", fmt.Errorf("unsupported option %s for built-in plugin %s", option, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("built-in plugin %s failed: %w", name, err)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	linuxCapabilityVersion3 = 0x20080522
+
+	prCapBSetDrop        = 24
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+)
+
+var capabilityNames = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_DAC_READ_SEARCH",
+	"CAP_FOWNER",
+	"CAP_FSETID",
+	"CAP_KILL",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETPCAP",
+	"CAP_LINUX_IMMUTABLE",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_NET_BROADCAST",
+	"CAP_NET_ADMIN",
+	"CAP_NET_RAW",
+	"CAP_IPC_LOCK",
+	"CAP_IPC_OWNER",
+	"CAP_SYS_MODULE",
+	"CAP_SYS_RAWIO",
+	"CAP_SYS_CHROOT",
+	"CAP_SYS_PTRACE",
+	"CAP_SYS_PACCT",
+	"CAP_SYS_ADMIN",
+	"CAP_SYS_BOOT",
+	"CAP_SYS_NICE",
+	"CAP_SYS_RESOURCE",
+	"CAP_SYS_TIME",
+	"CAP_SYS_TTY_CONFIG",
+	"CAP_MKNOD",
+	"CAP_LEASE",
+	"CAP_AUDIT_WRITE",
+	"CAP_AUDIT_CONTROL",
+	"CAP_SETFCAP",
+	"CAP_MAC_OVERRIDE",
+	"CAP_MAC_ADMIN",
+	"CAP_SYSLOG",
+	"CAP_WAKE_ALARM",
+	"CAP_BLOCK_SUSPEND",
+	"CAP_AUDIT_READ",
+	"CAP_PERFMON",
+	"CAP_BPF",
+	"CAP_CHECKPOINT_RESTORE",
+}
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+func capabilityNumber(name string) (int, error) {
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "CAP_") {
+		name = "CAP_" + name
+	}
+
+	for i, capName := range capabilityNames {
+		if capName == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown capability %s", name)
+}
+
+// dropCapabilities removes every capability not named in keep from the
+// bounding, ambient, effective, permitted and inheritable sets of all
+// threads, so plugins started afterwards cannot regain them either.
+func dropCapabilities(keep []string) error {
+	var keepMask uint64
+	for _, name := range keep {
+		capNum, err := capabilityNumber(name)
+		if err != nil {
+			return err
+		}
+		keepMask |= 1 << uint(capNum)
+	}
+
+	header := capHeader{version: linuxCapabilityVersion3}
+	var current [2]capData
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&current[0])), 0); errno != 0 {
+		return fmt.Errorf("capget: %w", errno)
+	}
+
+	// An unprivileged process has nothing to drop and could not touch the
+	// bounding set anyway
+	if current[0].permitted == 0 && current[1].permitted == 0 {
+		return nil
+	}
+
+	for capNum := 0; capNum < 64; capNum++ {
+		if keepMask&(1<<uint(capNum)) != 0 {
+			continue
+		}
+		_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prCapBSetDrop, uintptr(capNum), 0)
+		if errno == syscall.EINVAL {
+			// Past the last capability known to this kernel
+			break
+		}
+		if errno == syscall.ENOTSUP {
+			return fmt.Errorf("capability dropping requires a binary built with CGO_ENABLED=0")
+		}
+		if errno != 0 {
+			return fmt.Errorf("failed to drop %d from bounding set: %w", capNum, errno)
+		}
+	}
+
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 && errno != syscall.EINVAL {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", errno)
+	}
+
+	data := [2]capData{
+		{
+			effective: uint32(keepMask) & current[0].permitted,
+			permitted: uint32(keepMask) & current[0].permitted,
+		},
+		{
+			effective: uint32(keepMask>>32) & current[1].permitted,
+			permitted: uint32(keepMask>>32) & current[1].permitted,
+		},
+	}
+	header = capHeader{version: linuxCapabilityVersion3}
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("capset: %w", errno)
+	}
+
+	return nil
+}
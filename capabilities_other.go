@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func dropCapabilities(keep []string) error {
+	return errors.New("capability dropping is only supported on Linux")
+}
@@ -0,0 +1,175 @@
+//go:build !minimal || collector_apache
+// +build !minimal collector_apache
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apacheTimeout    = 10 * time.Second
+	apacheDefaultURL = "http://127.0.0.1:%d/server-status?auto"
+)
+
+type apacheStatus struct {
+	accesses string
+	kbytes   string
+	busy     string
+	idle     string
+	free     string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "apache",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readApacheStatus(req, apachePorts(req)[0])
+			return err == nil
+		},
+		config: apacheConfig,
+		fetch:  apacheFetch,
+	})
+}
+
+// apachePorts returns env.ports, which like in the stock apache_* plugins
+// fills the %d in env.url
+func apachePorts(req *pluginRequest) []int {
+	var ports []int
+	for _, field := range strings.Fields(req.getenv("ports", "80")) {
+		if port, err := strconv.Atoi(field); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		ports = []int{80}
+	}
+	return ports
+}
+
+// readApacheStatus parses the machine readable mod_status page, which has
+// one "Key: value" per line. Free slots are counted from the scoreboard.
+func readApacheStatus(req *pluginRequest, port int) (apacheStatus, error) {
+	url := req.getenv("url", apacheDefaultURL)
+	if strings.Contains(url, "%d") {
+		url = fmt.Sprintf(url, port)
+	}
+
+	body, err := fetchURL(req.ctx, apacheTimeout, url)
+	if err != nil {
+		return apacheStatus{}, fmt.Errorf("unable to read apache status: %w", err)
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(body), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			values[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if _, ok := values["BusyWorkers"]; !ok {
+		return apacheStatus{}, fmt.Errorf("unexpected apache status page")
+	}
+
+	status := apacheStatus{
+		accesses: values["Total Accesses"],
+		kbytes:   values["Total kBytes"],
+		busy:     values["BusyWorkers"],
+		idle:     values["IdleWorkers"],
+		free:     strconv.Itoa(strings.Count(values["Scoreboard"], ".")),
+	}
+	for _, value := range []*string{&status.accesses, &status.kbytes, &status.idle} {
+		if *value == "" {
+			*value = "U"
+		}
+	}
+	return status, nil
+}
+
+// The graphs are named and laid out like the stock apache_accesses,
+// apache_processes and apache_volume plugins, so existing RRDs carry on.
+func apacheConfig(req *pluginRequest) (string, error) {
+	ports := apachePorts(req)
+
+	var b strings.Builder
+	b.WriteString("multigraph apache_accesses\n")
+	b.WriteString("graph_title Apache accesses\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel accesses / ${graph_period}\n")
+	b.WriteString("graph_category webserver\n")
+	for _, port := range ports {
+		field := fmt.Sprintf("accesses%d", port)
+		fmt.Fprintf(&b, "%s.label port %d\n", field, port)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph apache_processes\n")
+	b.WriteString("graph_title Apache processes\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel processes\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("graph_total total\n")
+	for _, port := range ports {
+		fmt.Fprintf(&b, "busy%d.label busy servers %d\n", port, port)
+		fmt.Fprintf(&b, "busy%d.draw AREASTACK\n", port)
+		fmt.Fprintf(&b, "idle%d.label idle servers %d\n", port, port)
+		fmt.Fprintf(&b, "idle%d.draw AREASTACK\n", port)
+		fmt.Fprintf(&b, "free%d.label free slots %d\n", port, port)
+		fmt.Fprintf(&b, "free%d.draw AREASTACK\n", port)
+		req.printThresholds(&b, fmt.Sprintf("busy%d", port), "", "")
+	}
+
+	b.WriteString("multigraph apache_volume\n")
+	b.WriteString("graph_title Apache volume\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bytes per ${graph_period}\n")
+	b.WriteString("graph_category webserver\n")
+	for _, port := range ports {
+		field := fmt.Sprintf("volume%d", port)
+		fmt.Fprintf(&b, "%s.label port %d\n", field, port)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		fmt.Fprintf(&b, "%s.cdef %s,1024,*\n", field, field)
+	}
+
+	return b.String(), nil
+}
+
+func apacheFetch(req *pluginRequest) (string, error) {
+	ports := apachePorts(req)
+
+	statuses := make([]apacheStatus, len(ports))
+	for i, port := range ports {
+		status, err := readApacheStatus(req, port)
+		if err != nil {
+			status = apacheStatus{"U", "U", "U", "U", "U"}
+		}
+		statuses[i] = status
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph apache_accesses\n")
+	for i, port := range ports {
+		fmt.Fprintf(&b, "accesses%d.value %s\n", port, statuses[i].accesses)
+	}
+
+	b.WriteString("multigraph apache_processes\n")
+	for i, port := range ports {
+		fmt.Fprintf(&b, "busy%d.value %s\n", port, statuses[i].busy)
+		fmt.Fprintf(&b, "idle%d.value %s\n", port, statuses[i].idle)
+		fmt.Fprintf(&b, "free%d.value %s\n", port, statuses[i].free)
+	}
+
+	b.WriteString("multigraph apache_volume\n")
+	for i, port := range ports {
+		fmt.Fprintf(&b, "volume%d.value %s\n", port, statuses[i].kbytes)
+	}
+
+	return b.String(), nil
+}
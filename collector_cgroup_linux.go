@@ -0,0 +1,135 @@
+//go:build linux && (!minimal || collector_cgroup)
+// +build linux
+// +build !minimal collector_cgroup
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cgroupGraphs are read from a file in each service's cgroup. Counters are
+// in microseconds and turned into a percentage of one CPU / of wall time.
+var cgroupGraphs = []struct {
+	name    string
+	file    string
+	key     string
+	counter bool
+	title   string
+	vlabel  string
+	info    string
+}{
+	{"cgroup_cpu", "cpu.stat", "usage_usec", true, "Service CPU usage", "%", "CPU time used by each service, 100% being one CPU."},
+	{"cgroup_memory", "memory.current", "", false, "Service memory usage", "Bytes", "Memory charged to each service, page cache included."},
+	{"cgroup_cpu_pressure", "cpu.pressure", "some", true, "Service CPU pressure", "% stalled", "Share of time some task of the service was waiting for a CPU."},
+	{"cgroup_memory_pressure", "memory.pressure", "some", true, "Service memory pressure", "% stalled", "Share of time some task of the service was stalled on memory reclaim."},
+	{"cgroup_io_pressure", "io.pressure", "some", true, "Service IO pressure", "% stalled", "Share of time some task of the service was waiting for IO."},
+}
+
+type cgroupService struct {
+	name string
+	path string
+}
+
+func (s cgroupService) fieldName() string {
+	return cleanFieldName(s.name)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "cgroup",
+		autoconf: func(req *pluginRequest) bool { return fileExists(sysPath("fs", "cgroup", "cgroup.controllers")) },
+		config:   cgroupConfig,
+		fetch:    cgroupFetch,
+	})
+}
+
+// cgroupServices returns the services of the slices in env.slices, by
+// default everything systemd starts under system.slice. Only the unified
+// (v2) hierarchy is supported.
+func cgroupServices(req *pluginRequest) []cgroupService {
+	var services []cgroupService
+	for _, slice := range strings.Fields(req.getenv("slices", "system.slice")) {
+		dirs, _ := filepath.Glob(sysPath("fs", "cgroup", slice, "*.service"))
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			services = append(services, cgroupService{
+				name: strings.TrimSuffix(filepath.Base(dir), ".service"),
+				path: dir,
+			})
+		}
+	}
+	return services
+}
+
+// cgroupValue reads one graph's value for a service. PSI files have the
+// accumulated stall time as "total=" on the line for the key.
+func cgroupValue(service cgroupService, file string, key string) string {
+	path := filepath.Join(service.path, file)
+	if key == "" {
+		value, err := readUintFile(path)
+		if err != nil {
+			return "U"
+		}
+		return strconv.FormatUint(value, 10)
+	}
+
+	fields, err := readKeyedFields(path)
+	if err != nil || len(fields[key]) == 0 {
+		return "U"
+	}
+	for _, field := range fields[key] {
+		if strings.HasPrefix(field, "total=") {
+			return strings.TrimPrefix(field, "total=")
+		}
+	}
+	return fields[key][0]
+}
+
+func cgroupConfig(req *pluginRequest) (string, error) {
+	services := cgroupServices(req)
+
+	var b strings.Builder
+	for _, graph := range cgroupGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		if graph.counter {
+			b.WriteString("graph_args --base 1000 -l 0\n")
+			b.WriteString("graph_scale no\n")
+		} else {
+			b.WriteString("graph_args --base 1024 -l 0\n")
+		}
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category system\n")
+		fmt.Fprintf(&b, "graph_info %s\n", graph.info)
+		for _, service := range services {
+			field := service.fieldName()
+			fmt.Fprintf(&b, "%s.label %s\n", field, service.name)
+			if graph.counter {
+				fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+				fmt.Fprintf(&b, "%s.min 0\n", field)
+				fmt.Fprintf(&b, "%s.cdef %s,10000,/\n", field, field)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+func cgroupFetch(req *pluginRequest) (string, error) {
+	services := cgroupServices(req)
+
+	var b strings.Builder
+	for _, graph := range cgroupGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, service := range services {
+			fmt.Fprintf(&b, "%s.value %s\n", service.fieldName(), cgroupValue(service, graph.file, graph.key))
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,63 @@
+//go:build linux && (!minimal || collector_conntrack)
+// +build linux
+// +build !minimal collector_conntrack
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "conntrack",
+		autoconf: func(req *pluginRequest) bool {
+			return fileExists(procPath("sys", "net", "netfilter", "nf_conntrack_count"))
+		},
+		config: conntrackConfig,
+		fetch:  conntrackFetch,
+	})
+}
+
+func conntrackConfig(req *pluginRequest) (string, error) {
+	max, err := readUintFile(procPath("sys", "net", "netfilter", "nf_conntrack_max"))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Connection tracking table\n")
+	fmt.Fprintf(&b, "graph_args --base 1000 -l 0 --upper-limit %d\n", max)
+	b.WriteString("graph_vlabel entries\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info This graph shows the number of entries in the netfilter connection tracking table. New connections are dropped once it is full.\n")
+	b.WriteString("count.label entries\n")
+	b.WriteString("count.draw AREA\n")
+	b.WriteString("count.min 0\n")
+
+	// Limits are configured as a percentage of nf_conntrack_max
+	warning := percentThreshold(req.getenv("warning_percent", "80"), max)
+	critical := percentThreshold(req.getenv("critical_percent", "90"), max)
+	req.printThresholds(&b, "count", warning, critical)
+
+	b.WriteString("max.label max\n")
+	b.WriteString("max.draw LINE2\n")
+	b.WriteString("max.info nf_conntrack_max\n")
+
+	return b.String(), nil
+}
+
+func conntrackFetch(req *pluginRequest) (string, error) {
+	count, err := readUintFile(procPath("sys", "net", "netfilter", "nf_conntrack_count"))
+	if err != nil {
+		return "", err
+	}
+
+	max, err := readUintFile(procPath("sys", "net", "netfilter", "nf_conntrack_max"))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("count.value %d\nmax.value %d\n", count, max), nil
+}
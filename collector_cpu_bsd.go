@@ -0,0 +1,81 @@
+//go:build (openbsd || netbsd || (darwin && cgo)) && (!minimal || collector_cpu)
+// +build openbsd netbsd darwin,cgo
+// +build !minimal collector_cpu
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "cpu",
+		config: cpuConfig,
+		fetch:  cpuFetch,
+	})
+}
+
+func cpuConfig(req *pluginRequest) (string, error) {
+	limit := runtime.NumCPU() * 100
+
+	var order []string
+	for _, field := range cpuFields {
+		if field.name != "system" {
+			order = append(order, field.name)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title CPU usage\n")
+	fmt.Fprintf(&b, "graph_order system %s\n", strings.Join(order, " "))
+	fmt.Fprintf(&b, "graph_args --base 1000 -r --lower-limit 0 --upper-limit %d\n", limit)
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_info This graph shows how CPU time is spent.\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_period second\n")
+
+	for _, field := range cpuFields {
+		draw := "STACK"
+		if field.name == "system" {
+			draw = "AREA"
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, draw)
+		fmt.Fprintf(&b, "%s.min 0\n", field.name)
+		fmt.Fprintf(&b, "%s.max %d\n", field.name, limit)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field.name)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func cpuFetch(req *pluginRequest) (string, error) {
+	times, err := readCPUTimes()
+	if err != nil {
+		return "", err
+	}
+	stathz, err := statClockRate()
+	if err != nil {
+		return "", err
+	}
+
+	// Scaled to hundredths of a second, so a busy CPU adds up to 100%
+	var b strings.Builder
+	for i, field := range cpuFields {
+		if i >= len(times) {
+			break
+		}
+		value := times[i]
+		if stathz > 0 {
+			value = value * 100 / stathz
+		}
+		fmt.Fprintf(&b, "%s.value %d\n", field.name, value)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,103 @@
+//go:build freebsd && (!minimal || collector_cpu)
+// +build freebsd
+// +build !minimal collector_cpu
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuFields are the kern.cp_time columns in kernel order, with the
+// descriptions of the stock munin cpu plugin for FreeBSD.
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"user", "CPU time spent by normal programs and daemons"},
+	{"nice", "CPU time spent by nice(1)d programs"},
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"interrupt", "CPU time spent by the kernel processing interrupts"},
+	{"idle", "Idle CPU time"},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "cpu",
+		config: cpuConfig,
+		fetch:  cpuFetch,
+	})
+}
+
+func cpuConfig(req *pluginRequest) (string, error) {
+	limit := runtime.NumCPU() * 100
+
+	var b strings.Builder
+	b.WriteString("graph_title CPU usage\n")
+	b.WriteString("graph_order system interrupt user nice idle\n")
+	fmt.Fprintf(&b, "graph_args --base 1000 -r --lower-limit 0 --upper-limit %d\n", limit)
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_info This graph shows how CPU time is spent.\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_period second\n")
+
+	for _, field := range cpuFields {
+		draw := "STACK"
+		if field.name == "system" {
+			draw = "AREA"
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, draw)
+		fmt.Fprintf(&b, "%s.min 0\n", field.name)
+		fmt.Fprintf(&b, "%s.max %d\n", field.name, limit)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field.name)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+// statClockRate returns the rate kern.cp_time ticks at, the stathz
+// member of kern.clockrate's struct clockinfo
+func statClockRate() (uint64, error) {
+	data, err := unix.SysctlRaw("kern.clockrate")
+	if err != nil {
+		return 0, fmt.Errorf("sysctl kern.clockrate: %w", err)
+	}
+	if len(data) < 16 {
+		return 0, fmt.Errorf("sysctl kern.clockrate: unexpected size %d", len(data))
+	}
+	return uint64(binary.NativeEndian.Uint32(data[12:])), nil
+}
+
+func cpuFetch(req *pluginRequest) (string, error) {
+	times, err := sysctlLongs("kern.cp_time")
+	if err != nil {
+		return "", err
+	}
+	stathz, err := statClockRate()
+	if err != nil {
+		return "", err
+	}
+
+	// Scaled to hundredths of a second, so a busy CPU adds up to 100%
+	var b strings.Builder
+	for i, field := range cpuFields {
+		if i >= len(times) {
+			break
+		}
+		value := times[i]
+		if stathz > 0 {
+			value = value * 100 / stathz
+		}
+		fmt.Fprintf(&b, "%s.value %d\n", field.name, value)
+	}
+
+	return b.String(), nil
+}
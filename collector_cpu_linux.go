@@ -0,0 +1,85 @@
+//go:build linux && (!minimal || collector_cpu)
+// +build linux
+// +build !minimal collector_cpu
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// cpuFields are the /proc/stat cpu columns in kernel order, paired with
+// the descriptions used by the stock munin cpu plugin.
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"user", "CPU time spent by normal programs and daemons"},
+	{"nice", "CPU time spent by nice(1)d programs"},
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"idle", "Idle CPU time"},
+	{"iowait", "CPU time spent waiting for I/O operations to finish when there is nothing else to do."},
+	{"irq", "CPU time spent handling interrupts"},
+	{"softirq", "CPU time spent handling \"batched\" interrupts"},
+	{"steal", "The time that a virtual CPU had runnable tasks, but the virtual CPU itself was not running"},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "cpu",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("stat")) },
+		config:   cpuConfig,
+		fetch:    cpuFetch,
+	})
+}
+
+func cpuConfig(req *pluginRequest) (string, error) {
+	limit := runtime.NumCPU() * 100
+
+	var b strings.Builder
+	b.WriteString("graph_title CPU usage\n")
+	b.WriteString("graph_order system user nice idle iowait irq softirq steal\n")
+	fmt.Fprintf(&b, "graph_args --base 1000 -r --lower-limit 0 --upper-limit %d\n", limit)
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_info This graph shows how CPU time is spent.\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_period second\n")
+
+	for _, field := range cpuFields {
+		draw := "STACK"
+		if field.name == "system" {
+			draw = "AREA"
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, draw)
+		fmt.Fprintf(&b, "%s.min 0\n", field.name)
+		fmt.Fprintf(&b, "%s.max %d\n", field.name, limit)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field.name)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func cpuFetch(req *pluginRequest) (string, error) {
+	stat, err := readKeyedFields(procPath("stat"))
+	if err != nil {
+		return "", err
+	}
+
+	values := stat["cpu"]
+
+	var b strings.Builder
+	for i, field := range cpuFields {
+		// Older kernels lack the trailing columns
+		if i >= len(values) {
+			break
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", field.name, values[i])
+	}
+
+	return b.String(), nil
+}
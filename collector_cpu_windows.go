@@ -0,0 +1,84 @@
+//go:build windows && (!minimal || collector_cpu)
+// +build windows
+// +build !minimal collector_cpu
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// cpuFields are the times GetSystemTimes reports, named and described
+// like the matching fields of the stock munin cpu plugin.
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"user", "CPU time spent by normal programs and services"},
+	{"idle", "Idle CPU time"},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "cpu",
+		config: cpuConfig,
+		fetch:  cpuFetch,
+	})
+}
+
+func cpuConfig(req *pluginRequest) (string, error) {
+	limit := runtime.NumCPU() * 100
+
+	var b strings.Builder
+	b.WriteString("graph_title CPU usage\n")
+	b.WriteString("graph_order system user idle\n")
+	fmt.Fprintf(&b, "graph_args --base 1000 -r --lower-limit 0 --upper-limit %d\n", limit)
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_info This graph shows how CPU time is spent.\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_period second\n")
+
+	for _, field := range cpuFields {
+		draw := "STACK"
+		if field.name == "system" {
+			draw = "AREA"
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, draw)
+		fmt.Fprintf(&b, "%s.min 0\n", field.name)
+		fmt.Fprintf(&b, "%s.max %d\n", field.name, limit)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field.name)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+// filetimeTicks returns a FILETIME duration in hundredths of a second, the
+// unit of the Linux counters, so a busy CPU adds up to 100%
+func filetimeTicks(ft windows.Filetime) uint64 {
+	return (uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)) / 100000
+}
+
+func cpuFetch(req *pluginRequest) (string, error) {
+	var idle, kernel, user windows.Filetime
+	ok, _, err := procGetSystemTimes.Call(uintptr(unsafe.Pointer(&idle)), uintptr(unsafe.Pointer(&kernel)), uintptr(unsafe.Pointer(&user)))
+	if ok == 0 {
+		return "", fmt.Errorf("GetSystemTimes failed: %w", err)
+	}
+
+	// Kernel time includes the idle time
+	var b strings.Builder
+	fmt.Fprintf(&b, "system.value %d\n", filetimeTicks(kernel)-filetimeTicks(idle))
+	fmt.Fprintf(&b, "user.value %d\n", filetimeTicks(user))
+	fmt.Fprintf(&b, "idle.value %d\n", filetimeTicks(idle))
+
+	return b.String(), nil
+}
@@ -0,0 +1,108 @@
+//go:build linux && (!minimal || collector_cpufreq)
+// +build linux
+// +build !minimal collector_cpufreq
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "cpufreq",
+		autoconf: func(req *pluginRequest) bool { return len(cpuDirs("cpufreq")) > 0 },
+		config:   cpufreqConfig,
+		fetch:    cpufreqFetch,
+	})
+}
+
+// cpuDirs returns the sysfs directories of all CPUs that have the given
+// subdirectory, in numeric order.
+func cpuDirs(sub string) []string {
+	dirs, _ := filepath.Glob(sysPath("devices", "system", "cpu", "cpu[0-9]*", sub))
+	sort.Slice(dirs, func(i, j int) bool {
+		return cpuNumber(dirs[i]) < cpuNumber(dirs[j])
+	})
+	return dirs
+}
+
+func cpuNumber(dir string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(dir)), "cpu"))
+	return n
+}
+
+func cpufreqConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph cpufreq\n")
+	b.WriteString("graph_title CPU frequency\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel Hz\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info Current frequency of each core. Cores stuck below their nominal speed under load point at thermal or power limits.\n")
+	for _, dir := range cpuDirs("cpufreq") {
+		field := fmt.Sprintf("cpu%d", cpuNumber(dir))
+		fmt.Fprintf(&b, "%s.label %s\n", field, field)
+		if max := readSysScaled(filepath.Join(dir, "cpuinfo_max_freq"), 0.001); max != "" {
+			fmt.Fprintf(&b, "%s.max %s\n", field, max)
+		}
+		req.printThresholds(&b, field, "", "")
+	}
+
+	throttle := cpuDirs("thermal_throttle")
+	if len(throttle) == 0 {
+		return b.String(), nil
+	}
+
+	b.WriteString("multigraph cpufreq.throttle\n")
+	b.WriteString("graph_title CPU thermal throttling\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel events / ${graph_period}\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info Number of times cores and packages were throttled because they ran too hot.\n")
+	for _, dir := range throttle {
+		for _, kind := range []string{"core", "package"} {
+			field := fmt.Sprintf("cpu%d_%s", cpuNumber(dir), kind)
+			fmt.Fprintf(&b, "%s.label cpu%d %s\n", field, cpuNumber(dir), kind)
+			fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+			fmt.Fprintf(&b, "%s.min 0\n", field)
+			req.printThresholds(&b, field, "", "")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func cpufreqFetch(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph cpufreq\n")
+	for _, dir := range cpuDirs("cpufreq") {
+		value := readSysScaled(filepath.Join(dir, "scaling_cur_freq"), 0.001)
+		if value == "" {
+			value = "U"
+		}
+		fmt.Fprintf(&b, "cpu%d.value %s\n", cpuNumber(dir), value)
+	}
+
+	throttle := cpuDirs("thermal_throttle")
+	if len(throttle) == 0 {
+		return b.String(), nil
+	}
+
+	b.WriteString("multigraph cpufreq.throttle\n")
+	for _, dir := range throttle {
+		for _, kind := range []string{"core", "package"} {
+			value := readSysString(filepath.Join(dir, kind+"_throttle_count"))
+			if value == "" {
+				value = "U"
+			}
+			fmt.Fprintf(&b, "cpu%d_%s.value %s\n", cpuNumber(dir), kind, value)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,103 @@
+//go:build (openbsd || netbsd || darwin) && (!minimal || collector_df)
+// +build openbsd netbsd darwin
+// +build !minimal collector_df
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dfDefaultExclude skips pseudo filesystems without real storage
+const dfDefaultExclude = "none unknown cd9660 udf procfs kernfs ptyfs tmpfs mfs fdesc null devfs autofs nullfs"
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "df",
+		config: dfConfig,
+		fetch:  dfFetch,
+	})
+}
+
+// discoverMounts lists mounted filesystems, skipping the fstypes in
+// env.exclude and mountpoints matching env.exclude_re.
+func discoverMounts(req *pluginRequest) ([]mountPoint, error) {
+	excluded := make(map[string]bool)
+	for _, fstype := range strings.Fields(req.getenv("exclude", dfDefaultExclude)) {
+		excluded[fstype] = true
+	}
+
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		var err error
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	all, err := readMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []mountPoint
+	seen := make(map[string]bool)
+	for _, mount := range all {
+		if excluded[mount.fstype] || seen[mount.fieldName()] || mount.blocks == 0 {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(mount.path) {
+			continue
+		}
+
+		seen[mount.fieldName()] = true
+		mounts = append(mounts, mount)
+	}
+
+	return mounts, nil
+}
+
+func dfConfig(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Disk usage in percent\n")
+	b.WriteString("graph_args --upper-limit 100 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category disk\n")
+
+	for _, mount := range mounts {
+		field := mount.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, mount.path)
+		req.printThresholds(&b, field, "92", "98")
+	}
+
+	return b.String(), nil
+}
+
+func dfFetch(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, mount := range mounts {
+		// Same rounding as df: used / (used + available to non-root)
+		used := mount.blocks - mount.bfree
+		total := used + mount.bavail
+		if total == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %.2f\n", mount.fieldName(), float64(used)*100/float64(total))
+	}
+
+	return b.String(), nil
+}
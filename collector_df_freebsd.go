@@ -0,0 +1,141 @@
+//go:build freebsd && (!minimal || collector_df)
+// +build freebsd
+// +build !minimal collector_df
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// dfDefaultExclude is the fstype exclude list of the stock df plugin for
+// FreeBSD
+const dfDefaultExclude = "none unknown iso9660 squashfs udf romfs ramfs debugfs devfs fdescfs procfs linprocfs linsysfs nullfs"
+
+type mountPoint struct {
+	device string
+	path   string
+	fstype string
+	stat   unix.Statfs_t
+}
+
+// fieldName is the munin field name for a mount, derived from the device
+// like the stock df plugin does. ZFS datasets and pseudo devices are
+// named after the mountpoint too, as they could collide otherwise.
+func (m mountPoint) fieldName() string {
+	if !strings.HasPrefix(m.device, "/") {
+		return cleanFieldName(m.device + m.path)
+	}
+	return cleanFieldName(m.device)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "df",
+		config: dfConfig,
+		fetch:  dfFetch,
+	})
+}
+
+// discoverMounts lists mounted filesystems with their cached statistics,
+// skipping the fstypes in env.exclude and mountpoints matching
+// env.exclude_re. MNT_NOWAIT keeps a hung NFS server from stalling the
+// poll, at the price of figures that may be a little behind.
+func discoverMounts(req *pluginRequest) ([]mountPoint, error) {
+	excluded := make(map[string]bool)
+	for _, fstype := range strings.Fields(req.getenv("exclude", dfDefaultExclude)) {
+		excluded[fstype] = true
+	}
+
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		var err error
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	count, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+	stats := make([]unix.Statfs_t, count)
+	count, err = unix.Getfsstat(stats, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+
+	var mounts []mountPoint
+	seen := make(map[string]bool)
+	for _, stat := range stats[:count] {
+		mount := mountPoint{
+			device: unix.ByteSliceToString(stat.Mntfromname[:]),
+			path:   unix.ByteSliceToString(stat.Mntonname[:]),
+			fstype: unix.ByteSliceToString(stat.Fstypename[:]),
+			stat:   stat,
+		}
+
+		if excluded[mount.fstype] || seen[mount.fieldName()] || stat.Blocks == 0 {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(mount.path) {
+			continue
+		}
+
+		seen[mount.fieldName()] = true
+		mounts = append(mounts, mount)
+	}
+
+	return mounts, nil
+}
+
+func dfConfig(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Disk usage in percent\n")
+	b.WriteString("graph_args --upper-limit 100 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category disk\n")
+
+	for _, mount := range mounts {
+		field := mount.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, mount.path)
+		req.printThresholds(&b, field, "92", "98")
+	}
+
+	return b.String(), nil
+}
+
+func dfFetch(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, mount := range mounts {
+		// Same rounding as df: used / (used + available to non-root).
+		// UFS reserves space for root, so bavail can go negative.
+		used := mount.stat.Blocks - mount.stat.Bfree
+		total := used
+		if mount.stat.Bavail > 0 {
+			total += uint64(mount.stat.Bavail)
+		}
+		if total == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %.2f\n", mount.fieldName(), float64(used)*100/float64(total))
+	}
+
+	return b.String(), nil
+}
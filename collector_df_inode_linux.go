@@ -0,0 +1,88 @@
+//go:build linux && (!minimal || collector_df_inode)
+// +build linux
+// +build !minimal collector_df_inode
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "df_inode",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("self", "mounts")) },
+		config:   dfInodeConfig,
+		fetch:    dfInodeFetch,
+	})
+}
+
+// inodeMounts returns the mounts that have an inode table. Filesystems
+// like btrfs or vfat report zero inodes and are left out.
+func inodeMounts(req *pluginRequest) ([]mountPoint, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := dfTimeout(req)
+
+	var result []mountPoint
+	for _, mount := range mounts {
+		stat, err := statfsTimeout(mount.path, timeout)
+		if err != nil || stat.Files == 0 {
+			continue
+		}
+		result = append(result, mount)
+	}
+	return result, nil
+}
+
+func dfInodeConfig(req *pluginRequest) (string, error) {
+	mounts, err := inodeMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Inode usage in percent\n")
+	b.WriteString("graph_args --upper-limit 100 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category disk\n")
+
+	for _, mount := range mounts {
+		field := mount.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, mount.path)
+		req.printThresholds(&b, field, "92", "98")
+	}
+
+	return b.String(), nil
+}
+
+func dfInodeFetch(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := dfTimeout(req)
+
+	var b strings.Builder
+	for _, mount := range mounts {
+		stat, err := statfsTimeout(mount.path, timeout)
+		if err != nil {
+			fmt.Fprintf(&b, "%s.value U\n", mount.fieldName())
+			continue
+		}
+		if stat.Files == 0 {
+			continue
+		}
+
+		used := stat.Files - stat.Ffree
+		fmt.Fprintf(&b, "%s.value %.2f\n", mount.fieldName(), float64(used)*100/float64(stat.Files))
+	}
+
+	return b.String(), nil
+}
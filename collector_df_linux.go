@@ -0,0 +1,94 @@
+//go:build linux && (!minimal || collector_df)
+// +build linux
+// +build !minimal collector_df
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "df",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("self", "mounts")) },
+		config:   dfConfig,
+		fetch:    dfFetch,
+	})
+}
+
+// usableMounts returns the mounts that have real storage behind them,
+// mirroring df's habit of hiding pseudo filesystems.
+func usableMounts(req *pluginRequest) ([]mountPoint, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := dfTimeout(req)
+
+	var usable []mountPoint
+	for _, mount := range mounts {
+		stat, err := statfsTimeout(mount.path, timeout)
+		if err != nil || stat.Blocks == 0 {
+			continue
+		}
+		usable = append(usable, mount)
+	}
+	return usable, nil
+}
+
+func dfConfig(req *pluginRequest) (string, error) {
+	mounts, err := usableMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Disk usage in percent\n")
+	b.WriteString("graph_args --upper-limit 100 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category disk\n")
+
+	for _, mount := range mounts {
+		field := mount.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, mount.path)
+		req.printThresholds(&b, field, "92", "98")
+	}
+
+	return b.String(), nil
+}
+
+func dfFetch(req *pluginRequest) (string, error) {
+	mounts, err := discoverMounts(req)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := dfTimeout(req)
+
+	var b strings.Builder
+	for _, mount := range mounts {
+		stat, err := statfsTimeout(mount.path, timeout)
+		if err != nil {
+			// Report the mount as unknown rather than stalling the fetch
+			fmt.Fprintf(&b, "%s.value U\n", mount.fieldName())
+			continue
+		}
+		if stat.Blocks == 0 {
+			continue
+		}
+
+		// Same rounding as df: used / (used + available to non-root)
+		used := stat.Blocks - stat.Bfree
+		total := used + stat.Bavail
+		if total == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %.2f\n", mount.fieldName(), float64(used)*100/float64(total))
+	}
+
+	return b.String(), nil
+}
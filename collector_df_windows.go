@@ -0,0 +1,115 @@
+//go:build windows && (!minimal || collector_df)
+// +build windows
+// +build !minimal collector_df
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "df",
+		config: dfConfig,
+		fetch:  dfFetch,
+	})
+}
+
+// fixedDrives lists the root paths of local fixed drives, such as C:\,
+// skipping those matching env.exclude_re.
+func fixedDrives(req *pluginRequest) ([]string, error) {
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		var err error
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	buffer := make([]uint16, 254)
+	n, err := windows.GetLogicalDriveStrings(uint32(len(buffer)), &buffer[0])
+	if err != nil {
+		return nil, fmt.Errorf("unable to list drives: %w", err)
+	}
+
+	var drives []string
+	for _, drive := range strings.Split(windows.UTF16ToString(buffer[:n]), "\x00") {
+		if drive == "" {
+			continue
+		}
+		root, err := windows.UTF16PtrFromString(drive)
+		if err != nil || windows.GetDriveType(root) != windows.DRIVE_FIXED {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(drive) {
+			continue
+		}
+		drives = append(drives, drive)
+	}
+	return drives, nil
+}
+
+// driveUsage returns how full a drive is in percent, counting space not
+// available to the node's account as used, like df does for root.
+func driveUsage(drive string) (float64, error) {
+	root, err := windows.UTF16PtrFromString(drive)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(root, &available, &total, &free); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, fmt.Errorf("drive %s has no capacity", drive)
+	}
+	return float64(total-available) * 100 / float64(total), nil
+}
+
+func dfConfig(req *pluginRequest) (string, error) {
+	drives, err := fixedDrives(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Disk usage in percent\n")
+	b.WriteString("graph_args --upper-limit 100 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category disk\n")
+
+	for _, drive := range drives {
+		field := cleanFieldName(drive)
+		fmt.Fprintf(&b, "%s.label %s\n", field, drive)
+		req.printThresholds(&b, field, "92", "98")
+	}
+
+	return b.String(), nil
+}
+
+func dfFetch(req *pluginRequest) (string, error) {
+	drives, err := fixedDrives(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, drive := range drives {
+		usage, err := driveUsage(drive)
+		if err != nil {
+			fmt.Fprintf(&b, "%s.value U\n", cleanFieldName(drive))
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %.2f\n", cleanFieldName(drive), usage)
+	}
+
+	return b.String(), nil
+}
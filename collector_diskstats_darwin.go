@@ -0,0 +1,178 @@
+//go:build darwin && (!minimal || collector_diskstats)
+// +build darwin
+// +build !minimal collector_diskstats
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iostatMaxDisks is passed to iostat -n, which otherwise only reports
+// as many disks as fit in 80 columns
+const iostatMaxDisks = "64"
+
+var diskstatsGraphs = []string{"diskstats_iops", "diskstats_throughput"}
+
+type diskStat struct {
+	name  string
+	xfers uint64
+	bytes uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "diskstats",
+		config: diskstatsConfig,
+		fetch:  diskstatsFetch,
+	})
+}
+
+// readDiskstats returns the totals since boot iostat -I reports for each
+// disk, leaving out those matching env.exclude_re. The IOKit statistics
+// iostat reads do not tell reads from writes, only transfers and
+// megabytes, so neither do the graphs.
+func readDiskstats(req *pluginRequest) ([]diskStat, error) {
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		var err error
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	output, err := runCommand(req.ctx, 5*time.Second, "iostat", "-I", "-d", "-c", "1", "-n", iostatMaxDisks)
+	if err != nil {
+		return nil, fmt.Errorf("iostat: %w", err)
+	}
+
+	// One line naming the disks, one of column headers and one with
+	// KB/t, xfrs and MB for each disk
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("unexpected iostat output")
+	}
+	names := strings.Fields(lines[0])
+	values := strings.Fields(lines[len(lines)-1])
+	if len(values) < 3*len(names) {
+		return nil, fmt.Errorf("unexpected iostat output")
+	}
+
+	var stats []diskStat
+	for i, name := range names {
+		if excludeRe != nil && excludeRe.MatchString(name) {
+			continue
+		}
+		xfers, err := strconv.ParseUint(values[3*i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected iostat output for %s", name)
+		}
+		megabytes, err := strconv.ParseFloat(values[3*i+2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected iostat output for %s", name)
+		}
+		stats = append(stats, diskStat{
+			name:  name,
+			xfers: xfers,
+			bytes: uint64(megabytes * 1024 * 1024),
+		})
+	}
+
+	return stats, nil
+}
+
+func diskstatsConfig(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	graphs := []struct {
+		name       string
+		title      string
+		childTitle string
+		vlabel     string
+		args       string
+		field      string
+	}{
+		{"diskstats_iops", "IOs per device", "IOs for /dev/%s", "IOs/${graph_period}", "--base 1000 -l 0", "io"},
+		{"diskstats_throughput", "Disk throughput per device", "Disk throughput for /dev/%s", "Bytes/${graph_period}", "--base 1024 -l 0", "bytes"},
+	}
+
+	var b strings.Builder
+	for _, graph := range graphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category disk\n")
+		for _, stat := range stats {
+			writeDiskstatsField(&b, cleanFieldName(stat.name)+"_"+graph.field, stat.name)
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, cleanFieldName(stat.name))
+			fmt.Fprintf(&b, "graph_title "+graph.childTitle+"\n", stat.name)
+			fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+			fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+			b.WriteString("graph_category disk\n")
+			writeDiskstatsField(&b, graph.field, stat.name)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func writeDiskstatsField(b *strings.Builder, field, label string) {
+	fmt.Fprintf(b, "%s.label %s\n", field, label)
+	fmt.Fprintf(b, "%s.type DERIVE\n", field)
+	fmt.Fprintf(b, "%s.min 0\n", field)
+}
+
+func diskstatsValues(stat diskStat) []diskstatsValue {
+	return []diskstatsValue{
+		{"diskstats_iops", "io", strconv.FormatUint(stat.xfers, 10)},
+		{"diskstats_throughput", "bytes", strconv.FormatUint(stat.bytes, 10)},
+	}
+}
+
+type diskstatsValue struct {
+	graph string
+	field string
+	value string
+}
+
+func diskstatsFetch(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range diskstatsGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph)
+		for _, stat := range stats {
+			for _, v := range diskstatsValues(stat) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s_%s.value %s\n", cleanFieldName(stat.name), v.field, v.value)
+				}
+			}
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph, cleanFieldName(stat.name))
+			for _, v := range diskstatsValues(stat) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s.value %s\n", v.field, v.value)
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
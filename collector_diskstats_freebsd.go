@@ -0,0 +1,200 @@
+//go:build freebsd && (!minimal || collector_diskstats)
+// +build freebsd
+// +build !minimal collector_diskstats
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskstatsDefaultExclude skips pass-through, optical and memory disks
+const diskstatsDefaultExclude = `^(pass|cd|md)\d+$`
+
+// devstatVersion is the struct devstat layout read from kern.devstat.all,
+// the one used since FreeBSD 5. Offsets are for 64-bit platforms.
+const (
+	devstatVersion    = 6
+	devstatSize       = 288
+	devstatName       = 44
+	devstatNameLen    = 16
+	devstatUnit       = 60
+	devstatBytes      = 64
+	devstatOperations = 96
+	devstatBusyTime   = 192
+
+	// Indexes into the bytes and operations arrays
+	devstatRead  = 1
+	devstatWrite = 2
+)
+
+var diskstatsGraphs = []string{"diskstats_iops", "diskstats_throughput", "diskstats_utilization"}
+
+type diskStat struct {
+	name    string
+	reads   uint64
+	rdbytes uint64
+	writes  uint64
+	wrbytes uint64
+	msIO    uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "diskstats",
+		config: diskstatsConfig,
+		fetch:  diskstatsFetch,
+	})
+}
+
+// readDiskstats returns the devices in kern.devstat.all, a generation
+// number followed by one struct devstat per device, leaving out those
+// matching env.exclude_re.
+func readDiskstats(req *pluginRequest) ([]diskStat, error) {
+	excludeRe, err := regexp.Compile(req.getenv("exclude_re", diskstatsDefaultExclude))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude_re: %w", err)
+	}
+
+	if version, err := unix.SysctlUint32("kern.devstat.version"); err != nil || version != devstatVersion || unsafe.Sizeof(uintptr(0)) != 8 {
+		return nil, fmt.Errorf("unsupported devstat layout")
+	}
+
+	data, err := unix.SysctlRaw("kern.devstat.all")
+	if err != nil {
+		return nil, fmt.Errorf("sysctl kern.devstat.all: %w", err)
+	}
+
+	var stats []diskStat
+	for offset := 8; offset+devstatSize <= len(data); offset += devstatSize {
+		dev := data[offset : offset+devstatSize]
+
+		name := unix.ByteSliceToString(dev[devstatName : devstatName+devstatNameLen])
+		name += strconv.Itoa(int(int32(binary.NativeEndian.Uint32(dev[devstatUnit:]))))
+		if excludeRe.MatchString(name) {
+			continue
+		}
+
+		// busy_time is a struct bintime: seconds and a 64 bit fraction
+		busySec := binary.NativeEndian.Uint64(dev[devstatBusyTime:])
+		busyFrac := binary.NativeEndian.Uint64(dev[devstatBusyTime+8:])
+
+		stats = append(stats, diskStat{
+			name:    name,
+			reads:   binary.NativeEndian.Uint64(dev[devstatOperations+8*devstatRead:]),
+			rdbytes: binary.NativeEndian.Uint64(dev[devstatBytes+8*devstatRead:]),
+			writes:  binary.NativeEndian.Uint64(dev[devstatOperations+8*devstatWrite:]),
+			wrbytes: binary.NativeEndian.Uint64(dev[devstatBytes+8*devstatWrite:]),
+			msIO:    busySec*1000 + (busyFrac>>32)*1000>>32,
+		})
+	}
+
+	return stats, nil
+}
+
+func diskstatsConfig(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	graphs := []struct {
+		name       string
+		title      string
+		childTitle string
+		vlabel     string
+		args       string
+		fields     func(b *strings.Builder, prefix string, label string)
+	}{
+		{"diskstats_iops", "IOs per device", "IOs for /dev/%s", "IOs/${graph_period} read (-) / write (+)", "--base 1000", func(b *strings.Builder, prefix string, label string) {
+			writeReadWritePair(b, prefix+"rdio", prefix+"wrio", label, "DERIVE")
+		}},
+		{"diskstats_throughput", "Disk throughput per device", "Disk throughput for /dev/%s", "Bytes/${graph_period} read (-) / write (+)", "--base 1024", func(b *strings.Builder, prefix string, label string) {
+			writeReadWritePair(b, prefix+"rdbytes", prefix+"wrbytes", label, "DERIVE")
+		}},
+		{"diskstats_utilization", "Disk utilization per device", "Disk utilization for /dev/%s", "% busy", "--base 1000 -l 0 --upper-limit 100", func(b *strings.Builder, prefix string, label string) {
+			fmt.Fprintf(b, "%sutil.label %s\n", prefix, label)
+			fmt.Fprintf(b, "%sutil.type DERIVE\n", prefix)
+			fmt.Fprintf(b, "%sutil.min 0\n", prefix)
+			// ms spent doing IO per second, scaled to percent
+			fmt.Fprintf(b, "%sutil.cdef %sutil,10,/\n", prefix, prefix)
+			req.printThresholds(b, prefix+"util", "", "")
+		}},
+	}
+
+	var b strings.Builder
+	for _, graph := range graphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category disk\n")
+		for _, stat := range stats {
+			graph.fields(&b, cleanFieldName(stat.name)+"_", stat.name)
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, cleanFieldName(stat.name))
+			fmt.Fprintf(&b, "graph_title "+graph.childTitle+"\n", stat.name)
+			fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+			fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+			b.WriteString("graph_category disk\n")
+			graph.fields(&b, "", stat.name)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func diskstatsValues(stat diskStat) []diskstatsValue {
+	return []diskstatsValue{
+		{"diskstats_iops", "rdio", strconv.FormatUint(stat.reads, 10)},
+		{"diskstats_iops", "wrio", strconv.FormatUint(stat.writes, 10)},
+		{"diskstats_throughput", "rdbytes", strconv.FormatUint(stat.rdbytes, 10)},
+		{"diskstats_throughput", "wrbytes", strconv.FormatUint(stat.wrbytes, 10)},
+		{"diskstats_utilization", "util", strconv.FormatUint(stat.msIO, 10)},
+	}
+}
+
+type diskstatsValue struct {
+	graph string
+	field string
+	value string
+}
+
+func diskstatsFetch(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range diskstatsGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph)
+		for _, stat := range stats {
+			for _, v := range diskstatsValues(stat) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s_%s.value %s\n", cleanFieldName(stat.name), v.field, v.value)
+				}
+			}
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph, cleanFieldName(stat.name))
+			for _, v := range diskstatsValues(stat) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s.value %s\n", v.field, v.value)
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,246 @@
+//go:build linux && (!minimal || collector_diskstats)
+// +build linux
+// +build !minimal collector_diskstats
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// diskstatsDefaultExclude skips devices that only add noise to the graphs
+const diskstatsDefaultExclude = `^(ram|loop|fd|sr|zram)\d+$`
+
+// isDiskstatsNoise matches the devices of diskstatsDefaultExclude without
+// compiling it, for the embedded profile
+func isDiskstatsNoise(name string) bool {
+	for _, prefix := range []string{"ram", "loop", "fd", "sr", "zram"} {
+		if number, ok := strings.CutPrefix(name, prefix); ok && number != "" && strings.Trim(number, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
+
+var diskstatsGraphs = []string{"diskstats_iops", "diskstats_throughput", "diskstats_latency", "diskstats_utilization"}
+
+type diskstatsValue struct {
+	graph string
+	field string
+	value string
+}
+
+type diskStat struct {
+	name         string
+	reads        uint64
+	sectorsRead  uint64
+	msReading    uint64
+	writes       uint64
+	sectorsWrite uint64
+	msWriting    uint64
+	msIO         uint64
+}
+
+// diskstatsPrevious keeps the last sample per device. Latency is a ratio
+// of two counters and can't be left to munin's DERIVE handling.
+var diskstatsPrevious = struct {
+	sync.Mutex
+	stats map[string]diskStat
+}{stats: make(map[string]diskStat)}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "diskstats",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("diskstats")) },
+		config:   diskstatsConfig,
+		fetch:    diskstatsFetch,
+	})
+}
+
+// readDiskstats returns whole block devices from /proc/diskstats.
+// Partitions are skipped as they have no entry directly under /sys/block.
+func readDiskstats(req *pluginRequest) ([]diskStat, error) {
+	excluded := isDiskstatsNoise
+	if req.getenv("exclude_re", "") != "" || !req.isEmbedded() {
+		exclude, err := regexp.Compile(req.getenv("exclude_re", diskstatsDefaultExclude))
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+		excluded = exclude.MatchString
+	}
+
+	file, err := os.Open(procPath("diskstats"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open diskstats: %w", err)
+	}
+	defer file.Close()
+
+	var stats []diskStat
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+
+		name := fields[2]
+		if excluded(name) {
+			continue
+		}
+		if !fileExists(sysPath("block", strings.Replace(name, "/", "!", -1))) {
+			continue
+		}
+
+		var counters [11]uint64
+		for i := range counters {
+			counters[i], _ = strconv.ParseUint(fields[3+i], 10, 64)
+		}
+
+		stats = append(stats, diskStat{
+			name:         name,
+			reads:        counters[0],
+			sectorsRead:  counters[2],
+			msReading:    counters[3],
+			writes:       counters[4],
+			sectorsWrite: counters[6],
+			msWriting:    counters[7],
+			msIO:         counters[9],
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+
+	return stats, nil
+}
+
+func diskstatsConfig(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	graphs := []struct {
+		name       string
+		title      string
+		childTitle string
+		vlabel     string
+		args       string
+		fields     func(b *strings.Builder, prefix string, label string)
+	}{
+		{"diskstats_iops", "IOs per device", "IOs for /dev/%s", "IOs/${graph_period} read (-) / write (+)", "--base 1000", func(b *strings.Builder, prefix string, label string) {
+			writeReadWritePair(b, prefix+"rdio", prefix+"wrio", label, "DERIVE")
+		}},
+		{"diskstats_throughput", "Disk throughput per device", "Disk throughput for /dev/%s", "Bytes/${graph_period} read (-) / write (+)", "--base 1024", func(b *strings.Builder, prefix string, label string) {
+			writeReadWritePair(b, prefix+"rdbytes", prefix+"wrbytes", label, "DERIVE")
+		}},
+		{"diskstats_latency", "Disk latency per device", "Average latency for /dev/%s", "Average IO wait (seconds) read (-) / write (+)", "--base 1000", func(b *strings.Builder, prefix string, label string) {
+			writeReadWritePair(b, prefix+"avgrdwait", prefix+"avgwrwait", label, "GAUGE")
+		}},
+		{"diskstats_utilization", "Disk utilization per device", "Disk utilization for /dev/%s", "% busy", "--base 1000 -l 0 --upper-limit 100", func(b *strings.Builder, prefix string, label string) {
+			fmt.Fprintf(b, "%sutil.label %s\n", prefix, label)
+			fmt.Fprintf(b, "%sutil.type DERIVE\n", prefix)
+			fmt.Fprintf(b, "%sutil.min 0\n", prefix)
+			// ms spent doing IO per second, scaled to percent
+			fmt.Fprintf(b, "%sutil.cdef %sutil,10,/\n", prefix, prefix)
+			req.printThresholds(b, prefix+"util", "", "")
+		}},
+	}
+
+	var b strings.Builder
+	for _, graph := range graphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category disk\n")
+		for _, stat := range stats {
+			graph.fields(&b, cleanFieldName(stat.name)+"_", stat.name)
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, cleanFieldName(stat.name))
+			fmt.Fprintf(&b, "graph_title "+graph.childTitle+"\n", stat.name)
+			fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+			fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+			b.WriteString("graph_category disk\n")
+			graph.fields(&b, "", stat.name)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// averageWait returns the mean time per IO in seconds between two samples
+// as a munin value.
+func averageWait(ms uint64, prevMs uint64, ios uint64, prevIos uint64) string {
+	if ios < prevIos || ms < prevMs {
+		return "U"
+	}
+	if ios == prevIos {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(ms-prevMs)/float64(ios-prevIos)/1000, 'f', 6, 64)
+}
+
+func diskstatsValues(stat diskStat, latency [2]string) []diskstatsValue {
+	return []diskstatsValue{
+		{"diskstats_iops", "rdio", strconv.FormatUint(stat.reads, 10)},
+		{"diskstats_iops", "wrio", strconv.FormatUint(stat.writes, 10)},
+		{"diskstats_throughput", "rdbytes", strconv.FormatUint(stat.sectorsRead*512, 10)},
+		{"diskstats_throughput", "wrbytes", strconv.FormatUint(stat.sectorsWrite*512, 10)},
+		{"diskstats_latency", "avgrdwait", latency[0]},
+		{"diskstats_latency", "avgwrwait", latency[1]},
+		{"diskstats_utilization", "util", strconv.FormatUint(stat.msIO, 10)},
+	}
+}
+
+func diskstatsFetch(req *pluginRequest) (string, error) {
+	stats, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	diskstatsPrevious.Lock()
+	latency := make(map[string][2]string, len(stats))
+	for _, stat := range stats {
+		read, write := "U", "U"
+		if prev, ok := diskstatsPrevious.stats[stat.name]; ok {
+			read = averageWait(stat.msReading, prev.msReading, stat.reads, prev.reads)
+			write = averageWait(stat.msWriting, prev.msWriting, stat.writes, prev.writes)
+		}
+		latency[stat.name] = [2]string{read, write}
+		diskstatsPrevious.stats[stat.name] = stat
+	}
+	diskstatsPrevious.Unlock()
+
+	var b strings.Builder
+	for _, graph := range diskstatsGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph)
+		for _, stat := range stats {
+			for _, v := range diskstatsValues(stat, latency[stat.name]) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s_%s.value %s\n", cleanFieldName(stat.name), v.field, v.value)
+				}
+			}
+		}
+
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph, cleanFieldName(stat.name))
+			for _, v := range diskstatsValues(stat, latency[stat.name]) {
+				if v.graph == graph {
+					fmt.Fprintf(&b, "%s.value %s\n", v.field, v.value)
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,156 @@
+//go:build windows && (!minimal || collector_diskstats)
+// +build windows
+// +build !minimal collector_diskstats
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// diskstatsCounters are the PhysicalDisk counters behind each field. Their
+// raw values are running totals, just like /proc/diskstats on Linux.
+var diskstatsCounters = []struct {
+	graph string
+	field string
+	path  string
+}{
+	{"diskstats_iops", "rdio", `\PhysicalDisk(*)\Disk Reads/sec`},
+	{"diskstats_iops", "wrio", `\PhysicalDisk(*)\Disk Writes/sec`},
+	{"diskstats_throughput", "rdbytes", `\PhysicalDisk(*)\Disk Read Bytes/sec`},
+	{"diskstats_throughput", "wrbytes", `\PhysicalDisk(*)\Disk Write Bytes/sec`},
+}
+
+var diskstatsGraphs = []string{"diskstats_iops", "diskstats_throughput"}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "diskstats",
+		config: diskstatsConfig,
+		fetch:  diskstatsFetch,
+	})
+}
+
+// readDiskstats returns the counters of each physical disk, such as
+// "0 C:", by field, skipping disks matching env.exclude_re.
+func readDiskstats(req *pluginRequest) ([]string, map[string]map[string]int64, error) {
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		var err error
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	paths := make([]string, len(diskstatsCounters))
+	for i, counter := range diskstatsCounters {
+		paths[i] = counter.path
+	}
+	counters, err := readPdhCounters(paths...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var disks []string
+	for _, disk := range pdhInstances(counters[diskstatsCounters[0].path]) {
+		if excludeRe == nil || !excludeRe.MatchString(disk) {
+			disks = append(disks, disk)
+		}
+	}
+
+	values := make(map[string]map[string]int64, len(disks))
+	for _, disk := range disks {
+		values[disk] = make(map[string]int64, len(diskstatsCounters))
+		for _, counter := range diskstatsCounters {
+			if value, ok := counters[counter.path][disk]; ok {
+				values[disk][counter.field] = value
+			}
+		}
+	}
+	return disks, values, nil
+}
+
+func diskstatsConfig(req *pluginRequest) (string, error) {
+	disks, _, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	graphs := []struct {
+		name       string
+		title      string
+		childTitle string
+		vlabel     string
+		args       string
+		read       string
+		write      string
+	}{
+		{"diskstats_iops", "IOs per device", "IOs for disk %s", "IOs/${graph_period} read (-) / write (+)", "--base 1000", "rdio", "wrio"},
+		{"diskstats_throughput", "Disk throughput per device", "Disk throughput for disk %s", "Bytes/${graph_period} read (-) / write (+)", "--base 1024", "rdbytes", "wrbytes"},
+	}
+
+	var b strings.Builder
+	for _, graph := range graphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category disk\n")
+		for _, disk := range disks {
+			prefix := cleanFieldName(disk) + "_"
+			writeReadWritePair(&b, prefix+graph.read, prefix+graph.write, disk, "DERIVE")
+		}
+
+		for _, disk := range disks {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, cleanFieldName(disk))
+			fmt.Fprintf(&b, "graph_title "+graph.childTitle+"\n", disk)
+			fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+			fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+			b.WriteString("graph_category disk\n")
+			writeReadWritePair(&b, graph.read, graph.write, disk, "DERIVE")
+		}
+	}
+
+	return b.String(), nil
+}
+
+// diskstatsValue formats the counter behind field, U if PDH had none
+func diskstatsValue(values map[string]int64, field string) string {
+	if value, ok := values[field]; ok {
+		return fmt.Sprintf("%d", value)
+	}
+	return "U"
+}
+
+func diskstatsFetch(req *pluginRequest) (string, error) {
+	disks, values, err := readDiskstats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range diskstatsGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph)
+		for _, disk := range disks {
+			for _, counter := range diskstatsCounters {
+				if counter.graph == graph {
+					fmt.Fprintf(&b, "%s_%s.value %s\n", cleanFieldName(disk), counter.field, diskstatsValue(values[disk], counter.field))
+				}
+			}
+		}
+
+		for _, disk := range disks {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph, cleanFieldName(disk))
+			for _, counter := range diskstatsCounters {
+				if counter.graph == graph {
+					fmt.Fprintf(&b, "%s.value %s\n", counter.field, diskstatsValue(values[disk], counter.field))
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
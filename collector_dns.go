@@ -0,0 +1,191 @@
+//go:build !minimal || collector_dns
+// +build !minimal collector_dns
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTimeout        = 10 * time.Second
+	dnsDefaultBindURL = "http://127.0.0.1:8053/json/v1/server"
+)
+
+var dnsRcodes = []string{"noerror", "nxdomain", "servfail", "refused"}
+
+// dnsStats holds running totals, whichever server they come from
+type dnsStats struct {
+	queries uint64
+	hits    uint64
+	misses  uint64
+	rcodes  map[string]uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "dns",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readDNSStats(req)
+			return err == nil
+		},
+		config: dnsConfig,
+		fetch:  dnsFetch,
+	})
+}
+
+// dnsServer returns env.server, or guesses it from the tools installed
+func dnsServer(req *pluginRequest) string {
+	if server := req.getenv("server", ""); server != "" {
+		return server
+	}
+	if commandExists(req.getenv("unbound_control", "unbound-control")) {
+		return "unbound"
+	}
+	return "bind"
+}
+
+func readDNSStats(req *pluginRequest) (*dnsStats, error) {
+	switch server := dnsServer(req); server {
+	case "bind":
+		return readBindStats(req)
+	case "unbound":
+		return readUnboundStats(req)
+	default:
+		return nil, fmt.Errorf("unsupported dns server %s", server)
+	}
+}
+
+// readBindStats reads the JSON statistics channel of BIND at env.url
+func readBindStats(req *pluginRequest) (*dnsStats, error) {
+	body, err := fetchURL(req.ctx, dnsTimeout, req.getenv("url", dnsDefaultBindURL))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bind statistics: %w", err)
+	}
+
+	var data struct {
+		Opcodes map[string]uint64 `json:"opcodes"`
+		Rcodes  map[string]uint64 `json:"rcodes"`
+		Views   map[string]struct {
+			Resolver struct {
+				Cachestats map[string]uint64 `json:"cachestats"`
+			} `json:"resolver"`
+		} `json:"views"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse bind statistics: %w", err)
+	}
+
+	stats := &dnsStats{queries: data.Opcodes["QUERY"], rcodes: make(map[string]uint64)}
+	for rcode, count := range data.Rcodes {
+		stats.rcodes[strings.ToLower(rcode)] = count
+	}
+	for _, view := range data.Views {
+		stats.hits += view.Resolver.Cachestats["QueryHits"]
+		stats.misses += view.Resolver.Cachestats["QueryMisses"]
+	}
+	return stats, nil
+}
+
+// readUnboundStats runs unbound-control stats_noreset, which unlike stats
+// leaves the counters running for other readers. Answer codes are only
+// counted with extended-statistics enabled.
+func readUnboundStats(req *pluginRequest) (*dnsStats, error) {
+	command := req.getenv("unbound_control", "unbound-control")
+	output, err := runCommand(req.ctx, dnsTimeout, command, "stats_noreset")
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", command, err)
+	}
+
+	stats := &dnsStats{rcodes: make(map[string]uint64)}
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		var value uint64
+		if _, err := fmt.Sscan(parts[1], &value); err != nil {
+			continue
+		}
+
+		switch key := parts[0]; {
+		case key == "total.num.queries":
+			stats.queries = value
+		case key == "total.num.cachehits":
+			stats.hits = value
+		case key == "total.num.cachemiss":
+			stats.misses = value
+		case strings.HasPrefix(key, "num.answer.rcode."):
+			stats.rcodes[strings.ToLower(strings.TrimPrefix(key, "num.answer.rcode."))] = value
+		}
+	}
+	return stats, nil
+}
+
+func dnsConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph dns_queries\n")
+	b.WriteString("graph_title DNS queries\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel queries per ${graph_period}\n")
+	b.WriteString("graph_category dns\n")
+	b.WriteString("queries.label queries\n")
+	b.WriteString("queries.type DERIVE\n")
+	b.WriteString("queries.min 0\n")
+	req.printThresholds(&b, "queries", "", "")
+
+	b.WriteString("multigraph dns_rcodes\n")
+	b.WriteString("graph_title DNS answers by response code\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel answers per ${graph_period}\n")
+	b.WriteString("graph_category dns\n")
+	for _, rcode := range dnsRcodes {
+		fmt.Fprintf(&b, "%s.label %s\n", rcode, strings.ToUpper(rcode))
+		fmt.Fprintf(&b, "%s.type DERIVE\n", rcode)
+		fmt.Fprintf(&b, "%s.min 0\n", rcode)
+		req.printThresholds(&b, rcode, "", "")
+	}
+
+	b.WriteString("multigraph dns_cache\n")
+	b.WriteString("graph_title DNS cache hit ratio\n")
+	b.WriteString("graph_args --base 1000 -l 0 -u 100\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category dns\n")
+	b.WriteString("graph_info Share of queries answered from the cache, over the last interval.\n")
+	b.WriteString("misses.label misses\n")
+	b.WriteString("misses.type DERIVE\n")
+	b.WriteString("misses.min 0\n")
+	b.WriteString("misses.graph no\n")
+	b.WriteString("ratio.label hit ratio\n")
+	b.WriteString("ratio.type DERIVE\n")
+	b.WriteString("ratio.min 0\n")
+	b.WriteString("ratio.cdef ratio,ratio,misses,+,/,100,*\n")
+
+	return b.String(), nil
+}
+
+func dnsFetch(req *pluginRequest) (string, error) {
+	stats, err := readDNSStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph dns_queries\n")
+	fmt.Fprintf(&b, "queries.value %d\n", stats.queries)
+
+	b.WriteString("multigraph dns_rcodes\n")
+	for _, rcode := range dnsRcodes {
+		fmt.Fprintf(&b, "%s.value %d\n", rcode, stats.rcodes[rcode])
+	}
+
+	b.WriteString("multigraph dns_cache\n")
+	fmt.Fprintf(&b, "misses.value %d\n", stats.misses)
+	fmt.Fprintf(&b, "ratio.value %d\n", stats.hits)
+
+	return b.String(), nil
+}
@@ -0,0 +1,177 @@
+//go:build !minimal || collector_dns_query
+// +build !minimal collector_dns_query
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	dnsQueryDefaultTimeout = 2 * time.Second
+	dnsQueryDefaultQueries = "example.com/A"
+)
+
+// dnsQueryResult is what one resolver did with all the queries: the
+// average time of those answered, negative if none was, and how many
+// failed.
+type dnsQueryResult struct {
+	time     float64
+	failures int
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "dns_query",
+		autoconf: func(req *pluginRequest) bool {
+			return len(dnsQueryResolvers(req)) > 0
+		},
+		config: dnsQueryConfig,
+		fetch:  dnsQueryFetch,
+	})
+}
+
+// dnsQueryResolvers returns env.resolvers, or the name servers of
+// /etc/resolv.conf, each with the DNS port added if missing
+func dnsQueryResolvers(req *pluginRequest) []string {
+	resolvers := strings.Fields(req.getenv("resolvers", ""))
+	if len(resolvers) == 0 {
+		if config, err := dns.ClientConfigFromFile("/etc/resolv.conf"); err == nil {
+			resolvers = config.Servers
+		}
+	}
+
+	for i, resolver := range resolvers {
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			resolvers[i] = net.JoinHostPort(strings.Trim(resolver, "[]"), "53")
+		}
+	}
+	return resolvers
+}
+
+// dnsQueryQuestions parses env.queries, a list of name/type pairs where
+// the type defaults to A
+func dnsQueryQuestions(req *pluginRequest) ([]dns.Question, error) {
+	var questions []dns.Question
+	for _, query := range strings.Fields(req.getenv("queries", dnsQueryDefaultQueries)) {
+		name, typeName := query, "A"
+		if i := strings.LastIndex(query, "/"); i >= 0 {
+			name, typeName = query[:i], strings.ToUpper(query[i+1:])
+		}
+		qtype, ok := dns.StringToType[typeName]
+		if !ok {
+			return nil, fmt.Errorf("unknown record type %s in %s", typeName, query)
+		}
+		questions = append(questions, dns.Question{Name: dns.Fqdn(name), Qtype: qtype, Qclass: dns.ClassINET})
+	}
+	return questions, nil
+}
+
+// dnsQueryResolver asks one resolver every question, counting anything but
+// a NOERROR answer as a failure.
+func dnsQueryResolver(client *dns.Client, resolver string, questions []dns.Question) dnsQueryResult {
+	var total time.Duration
+	answered, failures := 0, 0
+	for _, question := range questions {
+		message := new(dns.Msg)
+		message.Id = dns.Id()
+		message.RecursionDesired = true
+		message.Question = []dns.Question{question}
+
+		reply, rtt, err := client.Exchange(message, resolver)
+		if err != nil || reply.Rcode != dns.RcodeSuccess {
+			failures++
+			continue
+		}
+		total += rtt
+		answered++
+	}
+
+	if answered == 0 {
+		return dnsQueryResult{time: -1, failures: failures}
+	}
+	return dnsQueryResult{time: total.Seconds() / float64(answered), failures: failures}
+}
+
+func dnsQueryConfig(req *pluginRequest) (string, error) {
+	resolvers := dnsQueryResolvers(req)
+	questions, err := dnsQueryQuestions(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph dns_query_time\n")
+	b.WriteString("graph_title DNS query time\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category dns\n")
+	fmt.Fprintf(&b, "graph_info Average time each resolver took to answer the %d configured queries.\n", len(questions))
+	for _, resolver := range resolvers {
+		field := cleanFieldName(resolver)
+		fmt.Fprintf(&b, "%s.label %s\n", field, resolver)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph dns_query_failures\n")
+	b.WriteString("graph_title DNS query failures\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel failed queries\n")
+	b.WriteString("graph_category dns\n")
+	b.WriteString("graph_info Queries that timed out or were answered with an error such as SERVFAIL or NXDOMAIN.\n")
+	for _, resolver := range resolvers {
+		field := cleanFieldName(resolver) + "_failures"
+		fmt.Fprintf(&b, "%s.label %s\n", field, resolver)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func dnsQueryFetch(req *pluginRequest) (string, error) {
+	resolvers := dnsQueryResolvers(req)
+	questions, err := dnsQueryQuestions(req)
+	if err != nil {
+		return "", err
+	}
+
+	client := &dns.Client{Net: req.getenv("protocol", "udp"), Timeout: dnsQueryDefaultTimeout}
+	if seconds, err := strconv.ParseFloat(req.getenv("timeout", ""), 64); err == nil && seconds > 0 {
+		client.Timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	results := make([]dnsQueryResult, len(resolvers))
+	var wg sync.WaitGroup
+	for i, resolver := range resolvers {
+		wg.Add(1)
+		go func(i int, resolver string) {
+			defer wg.Done()
+			results[i] = dnsQueryResolver(client, resolver, questions)
+		}(i, resolver)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	b.WriteString("multigraph dns_query_time\n")
+	for i, resolver := range resolvers {
+		value := "U"
+		if results[i].time >= 0 {
+			value = strconv.FormatFloat(results[i].time, 'f', 6, 64)
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(resolver), value)
+	}
+
+	b.WriteString("multigraph dns_query_failures\n")
+	for i, resolver := range resolvers {
+		fmt.Fprintf(&b, "%s_failures.value %d\n", cleanFieldName(resolver), results[i].failures)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,281 @@
+//go:build !minimal || collector_docker
+// +build !minimal collector_docker
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const dockerTimeout = 10 * time.Second
+
+// Podman serves the Docker compatible API on its own socket
+var dockerSockets = []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+
+type dockerContainer struct {
+	ID    string   `json:"Id"`
+	Names []string `json:"Names"`
+}
+
+func (c dockerContainer) name() string {
+	if len(c.Names) == 0 {
+		if len(c.ID) > 12 {
+			return c.ID[:12]
+		}
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+func (c dockerContainer) fieldName() string {
+	return cleanFieldName(c.name())
+}
+
+// dockerStats is the subset of /containers/{id}/stats we care about
+type dockerStats struct {
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+}
+
+type dockerValues struct {
+	cpu      string
+	memory   string
+	rx       string
+	tx       string
+	restarts string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "docker",
+		autoconf: func(req *pluginRequest) bool { return dockerSocket(req) != "" },
+		config:   dockerConfig,
+		fetch:    dockerFetch,
+	})
+}
+
+// dockerSocket returns env.socket, or the first API socket found
+func dockerSocket(req *pluginRequest) string {
+	if socket := req.getenv("socket", ""); socket != "" {
+		return socket
+	}
+	for _, socket := range dockerSockets {
+		if fileExists(socket) {
+			return socket
+		}
+	}
+	return ""
+}
+
+func dockerClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: dockerTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// dockerGet decodes the JSON answer of an API call into result
+func dockerGet(ctx context.Context, client *http.Client, path string, result interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", "http://docker"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// dockerContainers lists the running containers, restricted to those
+// carrying all of the labels in env.label ("key" or "key=value").
+func dockerContainers(req *pluginRequest, client *http.Client) ([]dockerContainer, error) {
+	path := "/containers/json"
+	if labels := strings.Fields(req.getenv("label", "")); len(labels) > 0 {
+		filters, _ := json.Marshal(map[string][]string{"label": labels})
+		path += "?filters=" + url.QueryEscape(string(filters))
+	}
+
+	var containers []dockerContainer
+	if err := dockerGet(req.ctx, client, path, &containers); err != nil {
+		return nil, fmt.Errorf("unable to list containers: %w", err)
+	}
+	return containers, nil
+}
+
+func readDockerValues(ctx context.Context, client *http.Client, container dockerContainer) dockerValues {
+	values := dockerValues{"U", "U", "U", "U", "U"}
+
+	var stats dockerStats
+	if err := dockerGet(ctx, client, "/containers/"+container.ID+"/stats?stream=false&one-shot=true", &stats); err == nil {
+		values.cpu = fmt.Sprint(stats.CPUStats.CPUUsage.TotalUsage)
+
+		// Page cache is reclaimable, leave it out like `docker stats` does
+		memory := stats.MemoryStats.Usage
+		cache := stats.MemoryStats.Stats["inactive_file"]
+		if cache == 0 {
+			cache = stats.MemoryStats.Stats["total_inactive_file"]
+		}
+		if cache < memory {
+			memory -= cache
+		}
+		values.memory = fmt.Sprint(memory)
+
+		if stats.Networks != nil {
+			var rx, tx uint64
+			for _, network := range stats.Networks {
+				rx += network.RxBytes
+				tx += network.TxBytes
+			}
+			values.rx, values.tx = fmt.Sprint(rx), fmt.Sprint(tx)
+		}
+	}
+
+	var inspect struct {
+		RestartCount int `json:"RestartCount"`
+	}
+	if err := dockerGet(ctx, client, "/containers/"+container.ID+"/json", &inspect); err == nil {
+		values.restarts = fmt.Sprint(inspect.RestartCount)
+	}
+
+	return values
+}
+
+func dockerConfig(req *pluginRequest) (string, error) {
+	client := dockerClient(dockerSocket(req))
+	containers, err := dockerContainers(req, client)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph docker_cpu\n")
+	b.WriteString("graph_title Container CPU usage\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category containers\n")
+	b.WriteString("graph_info CPU time used by each container, 100% being one CPU.\n")
+	for _, container := range containers {
+		field := container.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, container.name())
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		fmt.Fprintf(&b, "%s.cdef %s,10000000,/\n", field, field)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph docker_memory\n")
+	b.WriteString("graph_title Container memory usage\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category containers\n")
+	b.WriteString("graph_info Memory used by each container, not counting reclaimable page cache.\n")
+	for _, container := range containers {
+		fmt.Fprintf(&b, "%s.label %s\n", container.fieldName(), container.name())
+	}
+
+	b.WriteString("multigraph docker_network\n")
+	b.WriteString("graph_title Container network traffic\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category containers\n")
+	for _, container := range containers {
+		field := container.fieldName()
+		fmt.Fprintf(&b, "%s_rx.label %s\n", field, container.name())
+		fmt.Fprintf(&b, "%s_rx.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_rx.min 0\n", field)
+		fmt.Fprintf(&b, "%s_rx.graph no\n", field)
+		fmt.Fprintf(&b, "%s_rx.cdef %s_rx,8,*\n", field, field)
+		fmt.Fprintf(&b, "%s_tx.label %s\n", field, container.name())
+		fmt.Fprintf(&b, "%s_tx.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_tx.min 0\n", field)
+		fmt.Fprintf(&b, "%s_tx.negative %s_rx\n", field, field)
+		fmt.Fprintf(&b, "%s_tx.cdef %s_tx,8,*\n", field, field)
+	}
+
+	b.WriteString("multigraph docker_restarts\n")
+	b.WriteString("graph_title Container restarts\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel restarts\n")
+	b.WriteString("graph_category containers\n")
+	b.WriteString("graph_info Number of times the engine has restarted each container.\n")
+	for _, container := range containers {
+		fmt.Fprintf(&b, "%s.label %s\n", container.fieldName(), container.name())
+	}
+
+	return b.String(), nil
+}
+
+func dockerFetch(req *pluginRequest) (string, error) {
+	client := dockerClient(dockerSocket(req))
+	containers, err := dockerContainers(req, client)
+	if err != nil {
+		return "", err
+	}
+
+	// A stats call takes a moment per container, so ask all of them at once
+	values := make([]dockerValues, len(containers))
+	var wg sync.WaitGroup
+	for i, container := range containers {
+		wg.Add(1)
+		go func(i int, container dockerContainer) {
+			defer wg.Done()
+			values[i] = readDockerValues(req.ctx, client, container)
+		}(i, container)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	b.WriteString("multigraph docker_cpu\n")
+	for i, container := range containers {
+		fmt.Fprintf(&b, "%s.value %s\n", container.fieldName(), values[i].cpu)
+	}
+
+	b.WriteString("multigraph docker_memory\n")
+	for i, container := range containers {
+		fmt.Fprintf(&b, "%s.value %s\n", container.fieldName(), values[i].memory)
+	}
+
+	b.WriteString("multigraph docker_network\n")
+	for i, container := range containers {
+		fmt.Fprintf(&b, "%s_rx.value %s\n", container.fieldName(), values[i].rx)
+		fmt.Fprintf(&b, "%s_tx.value %s\n", container.fieldName(), values[i].tx)
+	}
+
+	b.WriteString("multigraph docker_restarts\n")
+	for i, container := range containers {
+		fmt.Fprintf(&b, "%s.value %s\n", container.fieldName(), values[i].restarts)
+	}
+
+	return b.String(), nil
+}
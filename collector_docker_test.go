@@ -0,0 +1,31 @@
+//go:build !minimal || collector_docker
+// +build !minimal collector_docker
+
+package main
+
+import "testing"
+
+func TestDockerContainerName(t *testing.T) {
+	tests := []struct {
+		container dockerContainer
+		want      string
+	}{
+		{dockerContainer{ID: "4f66ad9a0b2ea1f2c3d4e5f60718293a4b5c6d7e8f9a0b1c2d3e4f5a6b7c8d9e"}, "4f66ad9a0b2e"},
+		{dockerContainer{ID: "4f66ad9a"}, "4f66ad9a"},
+		{dockerContainer{}, ""},
+		{dockerContainer{ID: "4f66ad9a0b2ea1f2", Names: []string{"/web-1", "/alias"}}, "web-1"},
+	}
+	for _, test := range tests {
+		if got := test.container.name(); got != test.want {
+			t.Errorf("name of %+v = %q, want %q", test.container, got, test.want)
+		}
+	}
+}
+
+func TestDockerAutoconf(t *testing.T) {
+	// Without env.socket autoconf depends on the host
+	req := &pluginRequest{name: "docker", env: map[string]string{"socket": "/run/user/1000/podman/podman.sock"}}
+	if !builtinPlugins["docker"].autoconf(req) {
+		t.Error("autoconf ignored env.socket")
+	}
+}
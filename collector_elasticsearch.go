@@ -0,0 +1,218 @@
+//go:build !minimal || collector_elasticsearch
+// +build !minimal collector_elasticsearch
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	elasticsearchTimeout    = 10 * time.Second
+	elasticsearchDefaultURL = "http://localhost:9200"
+)
+
+var elasticsearchShardStates = []string{"active_shards", "relocating_shards", "initializing_shards", "unassigned_shards"}
+
+// elasticsearchNode is the part of _nodes/_local/stats we graph
+type elasticsearchNode struct {
+	JVM struct {
+		Mem struct {
+			HeapUsed uint64 `json:"heap_used_in_bytes"`
+			HeapMax  uint64 `json:"heap_max_in_bytes"`
+		} `json:"mem"`
+		GC struct {
+			Collectors map[string]struct {
+				TimeMs uint64 `json:"collection_time_in_millis"`
+			} `json:"collectors"`
+		} `json:"gc"`
+	} `json:"jvm"`
+	Indices struct {
+		Indexing struct {
+			IndexTotal uint64 `json:"index_total"`
+		} `json:"indexing"`
+		Search struct {
+			QueryTotal uint64 `json:"query_total"`
+			FetchTotal uint64 `json:"fetch_total"`
+		} `json:"search"`
+	} `json:"indices"`
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "elasticsearch",
+		autoconf: func(req *pluginRequest) bool {
+			client, err := builtinHTTPClient(req, elasticsearchTimeout)
+			if err != nil {
+				return false
+			}
+			var health map[string]interface{}
+			return elasticsearchGet(req, client, "/_cluster/health", &health) == nil
+		},
+		config: elasticsearchConfig,
+		fetch:  elasticsearchFetch,
+	})
+}
+
+// elasticsearchGet decodes an API answer, authenticating with env.user and
+// env.password, or env.api_key, if set.
+func elasticsearchGet(req *pluginRequest, client *http.Client, path string, result interface{}) error {
+	url := strings.TrimSuffix(req.getenv("url", elasticsearchDefaultURL), "/") + path
+	request, err := http.NewRequestWithContext(req.ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if user := req.getenv("user", ""); user != "" {
+		request.SetBasicAuth(user, req.getenv("password", ""))
+	}
+	if apiKey := req.getenv("api_key", ""); apiKey != "" {
+		request.Header.Set("Authorization", "ApiKey "+apiKey)
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func readElasticsearch(req *pluginRequest) (map[string]interface{}, *elasticsearchNode, error) {
+	client, err := builtinHTTPClient(req, elasticsearchTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var health map[string]interface{}
+	if err := elasticsearchGet(req, client, "/_cluster/health", &health); err != nil {
+		return nil, nil, fmt.Errorf("unable to read cluster health: %w", err)
+	}
+
+	var stats struct {
+		Nodes map[string]*elasticsearchNode `json:"nodes"`
+	}
+	if err := elasticsearchGet(req, client, "/_nodes/_local/stats/jvm,indices", &stats); err != nil {
+		return nil, nil, fmt.Errorf("unable to read node stats: %w", err)
+	}
+
+	for _, node := range stats.Nodes {
+		return health, node, nil
+	}
+	return nil, nil, fmt.Errorf("no local node in node stats")
+}
+
+func elasticsearchConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph elasticsearch_health\n")
+	b.WriteString("graph_title Elasticsearch cluster health\n")
+	b.WriteString("graph_args --base 1000 -l 0 -u 2\n")
+	b.WriteString("graph_vlabel status\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category search\n")
+	b.WriteString("graph_info 0 is green, 1 yellow (replicas missing) and 2 red (primaries missing).\n")
+	b.WriteString("status.label status\n")
+	req.printThresholds(&b, "status", ":0", ":1")
+
+	b.WriteString("multigraph elasticsearch_shards\n")
+	b.WriteString("graph_title Elasticsearch shards\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel shards\n")
+	b.WriteString("graph_category search\n")
+	for _, state := range elasticsearchShardStates {
+		fmt.Fprintf(&b, "%s.label %s\n", state, strings.TrimSuffix(state, "_shards"))
+	}
+	req.printThresholds(&b, "unassigned_shards", "", "")
+
+	b.WriteString("multigraph elasticsearch_heap\n")
+	b.WriteString("graph_title Elasticsearch JVM heap\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category search\n")
+	b.WriteString("used.label used\n")
+	b.WriteString("max.label max\n")
+	req.printThresholds(&b, "used", "", "")
+
+	b.WriteString("multigraph elasticsearch_gc\n")
+	b.WriteString("graph_title Elasticsearch garbage collection\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel ms per ${graph_period}\n")
+	b.WriteString("graph_category search\n")
+	b.WriteString("graph_info Time spent in garbage collection by the local node.\n")
+	for _, collector := range []string{"young", "old"} {
+		fmt.Fprintf(&b, "%s.label %s\n", collector, collector)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", collector)
+		fmt.Fprintf(&b, "%s.min 0\n", collector)
+	}
+
+	b.WriteString("multigraph elasticsearch_ops\n")
+	b.WriteString("graph_title Elasticsearch indexing and search\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel operations per ${graph_period}\n")
+	b.WriteString("graph_category search\n")
+	b.WriteString("graph_info Operations on the shards held by the local node.\n")
+	for _, field := range []string{"index", "query", "fetch"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, field)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	return b.String(), nil
+}
+
+func elasticsearchFetch(req *pluginRequest) (string, error) {
+	health, node, err := readElasticsearch(req)
+	if err != nil {
+		return "", err
+	}
+
+	status := "U"
+	switch health["status"] {
+	case "green":
+		status = "0"
+	case "yellow":
+		status = "1"
+	case "red":
+		status = "2"
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph elasticsearch_health\n")
+	fmt.Fprintf(&b, "status.value %s\n", status)
+
+	b.WriteString("multigraph elasticsearch_shards\n")
+	for _, state := range elasticsearchShardStates {
+		value := "U"
+		if count, ok := health[state].(float64); ok {
+			value = fmt.Sprintf("%.0f", count)
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", state, value)
+	}
+
+	b.WriteString("multigraph elasticsearch_heap\n")
+	fmt.Fprintf(&b, "used.value %d\n", node.JVM.Mem.HeapUsed)
+	fmt.Fprintf(&b, "max.value %d\n", node.JVM.Mem.HeapMax)
+
+	b.WriteString("multigraph elasticsearch_gc\n")
+	for _, collector := range []string{"young", "old"} {
+		value := "U"
+		if gc, ok := node.JVM.GC.Collectors[collector]; ok {
+			value = fmt.Sprint(gc.TimeMs)
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", collector, value)
+	}
+
+	b.WriteString("multigraph elasticsearch_ops\n")
+	fmt.Fprintf(&b, "index.value %d\n", node.Indices.Indexing.IndexTotal)
+	fmt.Fprintf(&b, "query.value %d\n", node.Indices.Search.QueryTotal)
+	fmt.Fprintf(&b, "fetch.value %d\n", node.Indices.Search.FetchTotal)
+
+	return b.String(), nil
+}
@@ -0,0 +1,43 @@
+//go:build linux && (!minimal || collector_entropy)
+// +build linux
+// +build !minimal collector_entropy
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "entropy",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("sys", "kernel", "random", "entropy_avail")) },
+		config:   entropyConfig,
+		fetch:    entropyFetch,
+	})
+}
+
+func entropyConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Available entropy\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel entropy (bytes)\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows the amount of entropy available in the system.\n")
+	b.WriteString("entropy.label entropy\n")
+	b.WriteString("entropy.info The number of random bytes available. This is typically used by cryptographic applications.\n")
+	req.printThresholds(&b, "entropy", "", "")
+
+	return b.String(), nil
+}
+
+func entropyFetch(req *pluginRequest) (string, error) {
+	entropy, err := readUintFile(procPath("sys", "kernel", "random", "entropy_avail"))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("entropy.value %d\n", entropy), nil
+}
@@ -0,0 +1,414 @@
+//go:build !minimal || collector_fail2ban
+// +build !minimal collector_fail2ban
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	fail2banTimeout       = 10 * time.Second
+	fail2banDefaultSocket = "/var/run/fail2ban/fail2ban.sock"
+	fail2banEnd           = "<F2B_END_COMMAND>"
+)
+
+type fail2banJail struct {
+	name            string
+	currentlyFailed int64
+	currentlyBanned int64
+	totalBanned     int64
+}
+
+func (j fail2banJail) fieldName() string {
+	return cleanFieldName(j.name)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "fail2ban",
+		autoconf: func(req *pluginRequest) bool { return fileExists(fail2banDefaultSocket) },
+		config:   fail2banConfig,
+		fetch:    fail2banFetch,
+	})
+}
+
+// pickleList is a Python list while unpickling. Lists are built up by
+// APPEND opcodes after being pushed, so they need to be shared.
+type pickleList struct {
+	items []interface{}
+}
+
+// pickleItems returns the elements of a list or tuple
+func pickleItems(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case *pickleList:
+		return v.items
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+// pickleStrings encodes a list of strings, the only thing the fail2ban
+// server expects from clients, with pickle protocol 2.
+func pickleStrings(args []string) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x80\x02](")
+	for _, arg := range args {
+		b.WriteByte('X')
+		binary.Write(&b, binary.LittleEndian, uint32(len(arg)))
+		b.WriteString(arg)
+	}
+	b.WriteString("e.")
+	return b.Bytes()
+}
+
+// errMalformedPickle is returned for a pickle whose opcodes take values
+// or marks it never pushed
+var errMalformedPickle = errors.New("malformed pickle")
+
+// unpickle decodes the subset of the pickle format fail2ban answers
+// with: nested lists and tuples of strings, numbers, booleans and None.
+func unpickle(data []byte) (interface{}, error) {
+	r := bytes.NewReader(data)
+	var stack []interface{}
+	var marks []int
+	memo := make(map[uint32]interface{})
+
+	readN := func(n int) ([]byte, error) {
+		if n > r.Len() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		buf := make([]byte, n)
+		_, err := io.ReadFull(r, buf)
+		return buf, err
+	}
+	// top, pop and popMark fail on opcodes taking more than the stack
+	// holds, which only a malformed pickle has
+	top := func() (interface{}, error) {
+		if len(stack) == 0 {
+			return nil, errMalformedPickle
+		}
+		return stack[len(stack)-1], nil
+	}
+	pop := func() (interface{}, error) {
+		value, err := top()
+		if err == nil {
+			stack = stack[:len(stack)-1]
+		}
+		return value, err
+	}
+	popMark := func() ([]interface{}, error) {
+		if len(marks) == 0 {
+			return nil, errMalformedPickle
+		}
+		mark := marks[len(marks)-1]
+		marks = marks[:len(marks)-1]
+		if mark > len(stack) {
+			return nil, errMalformedPickle
+		}
+		items := append([]interface{}{}, stack[mark:]...)
+		stack = stack[:mark]
+		return items, nil
+	}
+	// appendTo adds items to the list on top of the stack
+	appendTo := func(items ...interface{}) error {
+		value, err := top()
+		if err != nil {
+			return err
+		}
+		if list, ok := value.(*pickleList); ok {
+			list.items = append(list.items, items...)
+		}
+		return nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated pickle")
+		}
+
+		var buf []byte
+		switch op {
+		case 0x80: // PROTO
+			_, err = readN(1)
+		case 0x95: // FRAME
+			_, err = readN(8)
+		case '.': // STOP
+			if len(stack) != 1 {
+				return nil, errMalformedPickle
+			}
+			return stack[0], nil
+		case '(': // MARK
+			marks = append(marks, len(stack))
+		case ']': // EMPTY_LIST
+			stack = append(stack, &pickleList{})
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, []interface{}{})
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88, 0x89: // NEWTRUE, NEWFALSE
+			stack = append(stack, op == 0x88)
+		case 'K': // BININT1
+			if buf, err = readN(1); err == nil {
+				stack = append(stack, int64(buf[0]))
+			}
+		case 'M': // BININT2
+			if buf, err = readN(2); err == nil {
+				stack = append(stack, int64(binary.LittleEndian.Uint16(buf)))
+			}
+		case 'J': // BININT
+			if buf, err = readN(4); err == nil {
+				stack = append(stack, int64(int32(binary.LittleEndian.Uint32(buf))))
+			}
+		case 0x8a: // LONG1
+			if buf, err = readN(1); err == nil {
+				if buf, err = readN(int(buf[0])); err == nil && len(buf) <= 8 {
+					var n int64
+					for i := len(buf) - 1; i >= 0; i-- {
+						n = n<<8 | int64(buf[i])
+					}
+					if len(buf) > 0 && len(buf) < 8 && buf[len(buf)-1]&0x80 != 0 {
+						n -= 1 << (8 * uint(len(buf)))
+					}
+					stack = append(stack, n)
+				}
+			}
+		case 'G': // BINFLOAT
+			if buf, err = readN(8); err == nil {
+				stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(buf)))
+			}
+		case 0x8c, 'C', 'U': // SHORT_BINUNICODE, SHORT_BINBYTES, SHORT_BINSTRING
+			if buf, err = readN(1); err == nil {
+				if buf, err = readN(int(buf[0])); err == nil {
+					stack = append(stack, string(buf))
+				}
+			}
+		case 'X', 'B', 'T': // BINUNICODE, BINBYTES, BINSTRING
+			if buf, err = readN(4); err == nil {
+				if buf, err = readN(int(binary.LittleEndian.Uint32(buf))); err == nil {
+					stack = append(stack, string(buf))
+				}
+			}
+		case 0x94: // MEMOIZE
+			var value interface{}
+			if value, err = top(); err == nil {
+				memo[uint32(len(memo))] = value
+			}
+		case 'q': // BINPUT
+			var value interface{}
+			if buf, err = readN(1); err == nil {
+				if value, err = top(); err == nil {
+					memo[uint32(buf[0])] = value
+				}
+			}
+		case 'r': // LONG_BINPUT
+			var value interface{}
+			if buf, err = readN(4); err == nil {
+				if value, err = top(); err == nil {
+					memo[binary.LittleEndian.Uint32(buf)] = value
+				}
+			}
+		case 'h': // BINGET
+			if buf, err = readN(1); err == nil {
+				stack = append(stack, memo[uint32(buf[0])])
+			}
+		case 'j': // LONG_BINGET
+			if buf, err = readN(4); err == nil {
+				stack = append(stack, memo[binary.LittleEndian.Uint32(buf)])
+			}
+		case 'a': // APPEND
+			var item interface{}
+			if item, err = pop(); err == nil {
+				err = appendTo(item)
+			}
+		case 'e': // APPENDS
+			var items []interface{}
+			if items, err = popMark(); err == nil {
+				err = appendTo(items...)
+			}
+		case 't': // TUPLE
+			var items []interface{}
+			if items, err = popMark(); err == nil {
+				stack = append(stack, items)
+			}
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op - 0x84)
+			if n > len(stack) {
+				return nil, errMalformedPickle
+			}
+			tuple := append([]interface{}{}, stack[len(stack)-n:]...)
+			stack = append(stack[:len(stack)-n], tuple)
+		default:
+			return nil, fmt.Errorf("unsupported pickle opcode 0x%02x", op)
+		}
+		if err == errMalformedPickle {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("truncated pickle")
+		}
+	}
+}
+
+// fail2banCommand sends one command to the server socket at env.socket
+// and returns the payload of its (code, payload) answer.
+func fail2banCommand(req *pluginRequest, args ...string) (interface{}, error) {
+	conn, err := net.DialTimeout("unix", req.getenv("socket", fail2banDefaultSocket), fail2banTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to fail2ban: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(fail2banTimeout))
+
+	if _, err := conn.Write(append(pickleStrings(args), fail2banEnd...)); err != nil {
+		return nil, err
+	}
+
+	var answer []byte
+	reader := bufio.NewReader(conn)
+	for !bytes.HasSuffix(answer, []byte(fail2banEnd)) {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("incomplete answer from fail2ban: %w", err)
+		}
+		answer = append(answer, b)
+	}
+
+	value, err := unpickle(bytes.TrimSuffix(answer, []byte(fail2banEnd)))
+	if err != nil {
+		return nil, err
+	}
+	result := pickleItems(value)
+	if len(result) != 2 {
+		return nil, fmt.Errorf("unexpected answer from fail2ban")
+	}
+	if code, _ := result[0].(int64); code != 0 {
+		return nil, fmt.Errorf("fail2ban error: %v", result[1])
+	}
+	return result[1], nil
+}
+
+// fail2banPairs flattens a status answer, a nested list of (name, value)
+// pairs, into a map
+func fail2banPairs(value interface{}, pairs map[string]interface{}) {
+	for _, item := range pickleItems(value) {
+		pair := pickleItems(item)
+		if len(pair) != 2 {
+			continue
+		}
+		name, _ := pair[0].(string)
+		pairs[name] = pair[1]
+		fail2banPairs(pair[1], pairs)
+	}
+}
+
+func readFail2ban(req *pluginRequest) ([]fail2banJail, error) {
+	status, err := fail2banCommand(req, "status")
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]interface{})
+	fail2banPairs(status, pairs)
+
+	list, _ := pairs["Jail list"].(string)
+	var jails []fail2banJail
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		status, err := fail2banCommand(req, "status", name)
+		if err != nil {
+			return nil, err
+		}
+		pairs := make(map[string]interface{})
+		fail2banPairs(status, pairs)
+
+		jail := fail2banJail{name: name}
+		jail.currentlyFailed, _ = pairs["Currently failed"].(int64)
+		jail.currentlyBanned, _ = pairs["Currently banned"].(int64)
+		jail.totalBanned, _ = pairs["Total banned"].(int64)
+		jails = append(jails, jail)
+	}
+	return jails, nil
+}
+
+func fail2banConfig(req *pluginRequest) (string, error) {
+	jails, err := readFail2ban(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph fail2ban_banned\n")
+	b.WriteString("graph_title Fail2ban banned hosts\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel hosts\n")
+	b.WriteString("graph_category security\n")
+	b.WriteString("graph_info Hosts currently banned in each jail.\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.label %s\n", jail.fieldName(), jail.name)
+		req.printThresholds(&b, jail.fieldName(), "", "")
+	}
+
+	b.WriteString("multigraph fail2ban_failed\n")
+	b.WriteString("graph_title Fail2ban failing hosts\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel hosts\n")
+	b.WriteString("graph_category security\n")
+	b.WriteString("graph_info Hosts with recent failures in each jail that are not banned yet.\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.label %s\n", jail.fieldName(), jail.name)
+	}
+
+	b.WriteString("multigraph fail2ban_bans\n")
+	b.WriteString("graph_title Fail2ban bans\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel bans per ${graph_period}\n")
+	b.WriteString("graph_category security\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.label %s\n", jail.fieldName(), jail.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", jail.fieldName())
+		fmt.Fprintf(&b, "%s.min 0\n", jail.fieldName())
+	}
+
+	return b.String(), nil
+}
+
+func fail2banFetch(req *pluginRequest) (string, error) {
+	jails, err := readFail2ban(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph fail2ban_banned\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.value %d\n", jail.fieldName(), jail.currentlyBanned)
+	}
+
+	b.WriteString("multigraph fail2ban_failed\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.value %d\n", jail.fieldName(), jail.currentlyFailed)
+	}
+
+	b.WriteString("multigraph fail2ban_bans\n")
+	for _, jail := range jails {
+		fmt.Fprintf(&b, "%s.value %d\n", jail.fieldName(), jail.totalBanned)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,96 @@
+//go:build !minimal || collector_fail2ban
+// +build !minimal collector_fail2ban
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnpickle(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want interface{}
+	}{
+		{"none", "N.", nil},
+		{"true", "\x80\x02\x88.", true},
+		{"small int", "K\x07.", int64(7)},
+		{"int2", "M\x01\x02.", int64(0x0201)},
+		{"negative int", "J\xff\xff\xff\xff.", int64(-1)},
+		{"long1", "\x8a\x02\x00\x80.", int64(-32768)},
+		{"string", "\x8c\x04sshd.", "sshd"},
+		{"binunicode", "X\x04\x00\x00\x00jail.", "jail"},
+		{"tuple2", "K\x00\x8c\x02ok\x86.", []interface{}{int64(0), "ok"}},
+		{"mark tuple", "(K\x01K\x02K\x03t.", []interface{}{int64(1), int64(2), int64(3)}},
+		{"empty tuple", ").", []interface{}{}},
+		{
+			// (0, [('Currently failed', 3), ('Total failed', 9)]) as
+			// fail2ban answers status <jail>
+			name: "status reply",
+			data: "\x80\x04\x95\x00\x00\x00\x00\x00\x00\x00\x00K\x00]\x94(\x8c\x10Currently failed\x94K\x03\x86\x94\x8c\x0cTotal failed\x94K\t\x86\x94e\x86\x94.",
+			want: []interface{}{int64(0), &pickleList{items: []interface{}{
+				[]interface{}{"Currently failed", int64(3)},
+				[]interface{}{"Total failed", int64(9)},
+			}}},
+		},
+		{
+			name: "memo",
+			data: "]q\x01\x8c\x01aq\x02ah\x02a.",
+			want: &pickleList{items: []interface{}{"a", "a"}},
+		},
+	}
+	for _, test := range tests {
+		got, err := unpickle([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: unpickle failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: unpickle = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnpickleStrings(t *testing.T) {
+	args := []string{"status", "sshd"}
+	got, err := unpickle(pickleStrings(args))
+	if err != nil {
+		t.Fatalf("unpickle failed: %v", err)
+	}
+	want := &pickleList{items: []interface{}{"status", "sshd"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unpickle(pickleStrings(%q)) = %#v, want %#v", args, got, want)
+	}
+}
+
+func TestUnpickleMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"append on empty stack", "a.", "malformed pickle"},
+		{"append without list", "K\x01a.", "malformed pickle"},
+		{"appends without mark", "]e.", "malformed pickle"},
+		{"mark popped", "(Na.", "malformed pickle"},
+		{"tuple without mark", "t.", "malformed pickle"},
+		{"tuple3 short", "K\x01K\x02\x87.", "malformed pickle"},
+		{"memoize empty", "\x94.", "malformed pickle"},
+		{"binput empty", "q\x01.", "malformed pickle"},
+		{"long binput empty", "r\x01\x00\x00\x00.", "malformed pickle"},
+		{"stop empty", ".", "malformed pickle"},
+		{"stop with two", "NN.", "malformed pickle"},
+		{"no stop", "N", "truncated pickle"},
+		{"short string", "\x8c\x05ab.", "truncated pickle"},
+		{"huge binunicode", "X\xff\xff\xff\xff.", "truncated pickle"},
+		{"unknown opcode", "c__builtin__\neval\n.", "unsupported pickle opcode 0x63"},
+	}
+	for _, test := range tests {
+		_, err := unpickle([]byte(test.data))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: unpickle error = %v, want %q", test.name, err, test.want)
+		}
+	}
+}
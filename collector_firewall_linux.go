@@ -0,0 +1,189 @@
+//go:build linux && (!minimal || collector_firewall)
+// +build linux
+// +build !minimal collector_firewall
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const firewallTimeout = 10 * time.Second
+
+// iptables-save -c prints rules as "[packets:bytes] -A CHAIN ..."
+var iptablesRuleRe = regexp.MustCompile(`^\[(\d+):(\d+)\] -A \S+ .*--comment (?:"([^"]+)"|(\S+))`)
+
+type firewallCounter struct {
+	name    string
+	packets uint64
+	bytes   uint64
+}
+
+func (c firewallCounter) fieldName() string {
+	return cleanFieldName(c.name)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "firewall",
+		autoconf: func(req *pluginRequest) bool { return commandExists("nft") || commandExists("iptables-save") },
+		config:   firewallConfig,
+		fetch:    firewallFetch,
+	})
+}
+
+// readNftCounters returns the named counter objects of all tables, as
+// family/table/name
+func readNftCounters(req *pluginRequest) ([]firewallCounter, error) {
+	output, err := runCommand(req.ctx, firewallTimeout, req.getenv("nft", "nft"), "-j", "list", "counters")
+	if err != nil {
+		return nil, fmt.Errorf("nft list counters failed: %w", err)
+	}
+
+	var ruleset struct {
+		Nftables []struct {
+			Counter *struct {
+				Family  string `json:"family"`
+				Table   string `json:"table"`
+				Name    string `json:"name"`
+				Packets uint64 `json:"packets"`
+				Bytes   uint64 `json:"bytes"`
+			} `json:"counter"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal(output, &ruleset); err != nil {
+		return nil, fmt.Errorf("failed to parse nft output: %w", err)
+	}
+
+	var counters []firewallCounter
+	for _, object := range ruleset.Nftables {
+		if object.Counter == nil {
+			continue
+		}
+		c := object.Counter
+		counters = append(counters, firewallCounter{
+			name:    c.Family + "/" + c.Table + "/" + c.Name,
+			packets: c.Packets,
+			bytes:   c.Bytes,
+		})
+	}
+	return counters, nil
+}
+
+// readIptablesCounters returns the counters of rules carrying a comment,
+// which names the traffic class. Rules sharing a comment are added up.
+func readIptablesCounters(req *pluginRequest) ([]firewallCounter, error) {
+	output, err := runCommand(req.ctx, firewallTimeout, req.getenv("iptables_save", "iptables-save"), "-c")
+	if err != nil {
+		return nil, fmt.Errorf("iptables-save failed: %w", err)
+	}
+
+	var counters []firewallCounter
+	index := make(map[string]int)
+	table := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "*") {
+			table = strings.TrimPrefix(line, "*")
+			continue
+		}
+
+		match := iptablesRuleRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		var packets, bytes uint64
+		fmt.Sscan(match[1], &packets)
+		fmt.Sscan(match[2], &bytes)
+		name := table + "/" + match[3] + match[4]
+
+		if i, ok := index[name]; ok {
+			counters[i].packets += packets
+			counters[i].bytes += bytes
+			continue
+		}
+		index[name] = len(counters)
+		counters = append(counters, firewallCounter{name: name, packets: packets, bytes: bytes})
+	}
+	return counters, nil
+}
+
+// readFirewallCounters uses the backend in env.backend, nft or iptables,
+// defaulting to nftables where the nft tool is installed.
+func readFirewallCounters(req *pluginRequest) ([]firewallCounter, error) {
+	backend := req.getenv("backend", "")
+	if backend == "" {
+		backend = "iptables"
+		if commandExists(req.getenv("nft", "nft")) {
+			backend = "nft"
+		}
+	}
+
+	switch backend {
+	case "nft", "nftables":
+		return readNftCounters(req)
+	case "iptables":
+		return readIptablesCounters(req)
+	}
+	return nil, fmt.Errorf("unsupported firewall backend %s", backend)
+}
+
+func firewallConfig(req *pluginRequest) (string, error) {
+	counters, err := readFirewallCounters(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph firewall_bytes\n")
+	b.WriteString("graph_title Firewall traffic\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel bits per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info Traffic matched by named nftables counters or commented iptables rules.\n")
+	for _, counter := range counters {
+		field := counter.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, counter.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		fmt.Fprintf(&b, "%s.cdef %s,8,*\n", field, field)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph firewall_packets\n")
+	b.WriteString("graph_title Firewall packets\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel packets per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	for _, counter := range counters {
+		field := counter.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, counter.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	return b.String(), nil
+}
+
+func firewallFetch(req *pluginRequest) (string, error) {
+	counters, err := readFirewallCounters(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph firewall_bytes\n")
+	for _, counter := range counters {
+		fmt.Fprintf(&b, "%s.value %d\n", counter.fieldName(), counter.bytes)
+	}
+
+	b.WriteString("multigraph firewall_packets\n")
+	for _, counter := range counters {
+		fmt.Fprintf(&b, "%s.value %d\n", counter.fieldName(), counter.packets)
+	}
+
+	return b.String(), nil
+}
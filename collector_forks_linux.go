@@ -0,0 +1,50 @@
+//go:build linux && (!minimal || collector_forks)
+// +build linux
+// +build !minimal collector_forks
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "forks",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("stat")) },
+		config:   forksConfig,
+		fetch:    forksFetch,
+	})
+}
+
+func forksConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Fork rate\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel forks / ${graph_period}\n")
+	b.WriteString("graph_category processes\n")
+	b.WriteString("graph_info This graph shows the number of forks (new processes started) per second.\n")
+	b.WriteString("forks.label forks\n")
+	b.WriteString("forks.info The number of forks per second.\n")
+	b.WriteString("forks.type DERIVE\n")
+	b.WriteString("forks.min 0\n")
+	b.WriteString("forks.max 100000\n")
+	req.printThresholds(&b, "forks", "", "")
+
+	return b.String(), nil
+}
+
+func forksFetch(req *pluginRequest) (string, error) {
+	stat, err := readKeyedFields(procPath("stat"))
+	if err != nil {
+		return "", err
+	}
+
+	processes := stat["processes"]
+	if len(processes) == 0 {
+		return "", fmt.Errorf("no processes counter in %s", procPath("stat"))
+	}
+
+	return fmt.Sprintf("forks.value %s\n", processes[0]), nil
+}
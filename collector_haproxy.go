@@ -0,0 +1,218 @@
+//go:build !minimal || collector_haproxy
+// +build !minimal collector_haproxy
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	haproxyTimeout       = 10 * time.Second
+	haproxyDefaultSocket = "/run/haproxy/admin.sock"
+)
+
+var haproxyResponses = []string{"hrsp_1xx", "hrsp_2xx", "hrsp_3xx", "hrsp_4xx", "hrsp_5xx", "hrsp_other"}
+
+// haproxyBackend holds the "show stat" columns of one BACKEND line
+type haproxyBackend map[string]string
+
+func (b haproxyBackend) name() string {
+	return b["pxname"]
+}
+
+func (b haproxyBackend) fieldName() string {
+	return cleanFieldName(b["pxname"])
+}
+
+// value returns a column, "U" where HAProxy leaves it empty
+func (b haproxyBackend) value(column string) string {
+	if b[column] == "" {
+		return "U"
+	}
+	return b[column]
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "haproxy",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readHaproxyStats(req)
+			return err == nil
+		},
+		config: haproxyConfig,
+		fetch:  haproxyFetch,
+	})
+}
+
+// haproxyCSV returns the statistics CSV, from the CSV endpoint at env.url
+// if set, otherwise from the stats socket at env.socket.
+func haproxyCSV(req *pluginRequest) ([]byte, error) {
+	if url := req.getenv("url", ""); url != "" {
+		return fetchURL(req.ctx, haproxyTimeout, url)
+	}
+
+	conn, err := net.DialTimeout("unix", req.getenv("socket", haproxyDefaultSocket), haproxyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(haproxyTimeout))
+	if _, err := conn.Write([]byte("show stat\n")); err != nil {
+		return nil, err
+	}
+
+	// HAProxy closes the connection after answering
+	return ioutil.ReadAll(conn)
+}
+
+// readHaproxyStats returns the backends, in the order HAProxy lists them
+func readHaproxyStats(req *pluginRequest) ([]haproxyBackend, error) {
+	data, err := haproxyCSV(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read haproxy stats: %w", err)
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "# ")))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse haproxy stats: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty haproxy stats")
+	}
+
+	header := records[0]
+	var backends []haproxyBackend
+	for _, record := range records[1:] {
+		backend := make(haproxyBackend)
+		for i, column := range header {
+			if i < len(record) {
+				backend[column] = record[i]
+			}
+		}
+		if backend["svname"] == "BACKEND" {
+			backends = append(backends, backend)
+		}
+	}
+	return backends, nil
+}
+
+func haproxyConfig(req *pluginRequest) (string, error) {
+	backends, err := readHaproxyStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph haproxy_sessions\n")
+	b.WriteString("graph_title HAProxy backend sessions\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel sessions\n")
+	b.WriteString("graph_category loadbalancer\n")
+	b.WriteString("graph_info Current sessions per backend.\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "%s.label %s\n", backend.fieldName(), backend.name())
+	}
+
+	b.WriteString("multigraph haproxy_queue\n")
+	b.WriteString("graph_title HAProxy backend queue\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel requests\n")
+	b.WriteString("graph_category loadbalancer\n")
+	b.WriteString("graph_info Requests waiting for a free server per backend.\n")
+	for _, backend := range backends {
+		field := backend.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, backend.name())
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph haproxy_errors\n")
+	b.WriteString("graph_title HAProxy backend errors\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel errors per ${graph_period}\n")
+	b.WriteString("graph_category loadbalancer\n")
+	b.WriteString("graph_info Connection and response errors talking to the servers of each backend.\n")
+	for _, backend := range backends {
+		field := backend.fieldName()
+		fmt.Fprintf(&b, "%s_econ.label %s connect\n", field, backend.name())
+		fmt.Fprintf(&b, "%s_econ.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_econ.min 0\n", field)
+		fmt.Fprintf(&b, "%s_eresp.label %s response\n", field, backend.name())
+		fmt.Fprintf(&b, "%s_eresp.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_eresp.min 0\n", field)
+	}
+
+	b.WriteString("multigraph haproxy_responses\n")
+	b.WriteString("graph_title HAProxy backend 5xx responses\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel responses per ${graph_period}\n")
+	b.WriteString("graph_category loadbalancer\n")
+	for _, backend := range backends {
+		field := backend.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, backend.name())
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "multigraph haproxy_responses.%s\n", backend.fieldName())
+		fmt.Fprintf(&b, "graph_title HAProxy responses of %s\n", backend.name())
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_vlabel responses per ${graph_period}\n")
+		b.WriteString("graph_category loadbalancer\n")
+		for _, column := range haproxyResponses {
+			fmt.Fprintf(&b, "%s.label %s\n", column, strings.TrimPrefix(column, "hrsp_"))
+			fmt.Fprintf(&b, "%s.type DERIVE\n", column)
+			fmt.Fprintf(&b, "%s.min 0\n", column)
+			fmt.Fprintf(&b, "%s.draw AREASTACK\n", column)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func haproxyFetch(req *pluginRequest) (string, error) {
+	backends, err := readHaproxyStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph haproxy_sessions\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "%s.value %s\n", backend.fieldName(), backend.value("scur"))
+	}
+
+	b.WriteString("multigraph haproxy_queue\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "%s.value %s\n", backend.fieldName(), backend.value("qcur"))
+	}
+
+	b.WriteString("multigraph haproxy_errors\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "%s_econ.value %s\n", backend.fieldName(), backend.value("econ"))
+		fmt.Fprintf(&b, "%s_eresp.value %s\n", backend.fieldName(), backend.value("eresp"))
+	}
+
+	b.WriteString("multigraph haproxy_responses\n")
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "%s.value %s\n", backend.fieldName(), backend.value("hrsp_5xx"))
+	}
+
+	for _, backend := range backends {
+		fmt.Fprintf(&b, "multigraph haproxy_responses.%s\n", backend.fieldName())
+		for _, column := range haproxyResponses {
+			fmt.Fprintf(&b, "%s.value %s\n", column, backend.value(column))
+		}
+	}
+
+	return b.String(), nil
+}
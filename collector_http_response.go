@@ -0,0 +1,182 @@
+//go:build !minimal || collector_http_response
+// +build !minimal collector_http_response
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpResponseTimeout = 30 * time.Second
+
+// httpResponseResult is the outcome of one GET. Times are in seconds and
+// negative when the request failed before getting that far.
+type httpResponseResult struct {
+	total float64
+	ttfb  float64
+	ok    bool
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "http_response",
+		autoconf: func(req *pluginRequest) bool {
+			return req.getenv("urls", "") != ""
+		},
+		config: httpResponseConfig,
+		fetch:  httpResponseFetch,
+	})
+}
+
+// httpResponseField names a URL's fields after the URL without its scheme
+func httpResponseField(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	return cleanFieldName(strings.TrimSuffix(url, "/"))
+}
+
+// httpResponseExpected returns the status codes accepted for a URL, from
+// env.<field>_status or env.status, 200 by default
+func httpResponseExpected(req *pluginRequest, field string) []string {
+	return strings.Fields(req.getenv(field+"_status", req.getenv("status", "200")))
+}
+
+// httpResponseGet times a GET of url, including reading the whole body.
+func httpResponseGet(ctx context.Context, client *http.Client, url string, expected []string) httpResponseResult {
+	result := httpResponseResult{total: -1, ttfb: -1}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return result
+	}
+
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			result.ttfb = time.Since(start).Seconds()
+		},
+	}
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return result
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return result
+	}
+	result.total = time.Since(start).Seconds()
+
+	for _, status := range expected {
+		if status == strconv.Itoa(resp.StatusCode) {
+			result.ok = true
+		}
+	}
+	return result
+}
+
+func httpResponseConfig(req *pluginRequest) (string, error) {
+	urls := strings.Fields(req.getenv("urls", ""))
+
+	var b strings.Builder
+	b.WriteString("multigraph http_response\n")
+	b.WriteString("graph_title HTTP response time\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("graph_info Time to fetch each URL completely, including connecting and the TLS handshake.\n")
+	for _, url := range urls {
+		field := httpResponseField(url)
+		fmt.Fprintf(&b, "%s.label %s\n", field, url)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph http_response_ttfb\n")
+	b.WriteString("graph_title HTTP time to first byte\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("graph_info Time until the first byte of the response arrived.\n")
+	for _, url := range urls {
+		field := httpResponseField(url) + "_ttfb"
+		fmt.Fprintf(&b, "%s.label %s\n", field, url)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph http_response_status\n")
+	b.WriteString("graph_title HTTP response status\n")
+	b.WriteString("graph_args --base 1000 -l 0 --upper-limit 1\n")
+	b.WriteString("graph_vlabel ok\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("graph_info 1 if the URL answered with an expected status code, 0 if not or not at all.\n")
+	for _, url := range urls {
+		field := httpResponseField(url) + "_ok"
+		fmt.Fprintf(&b, "%s.label %s\n", field, url)
+		fmt.Fprintf(&b, "%s.info Expecting status %s\n", field, strings.Join(httpResponseExpected(req, httpResponseField(url)), " or "))
+		req.printThresholds(&b, field, "", "1:")
+	}
+
+	return b.String(), nil
+}
+
+func httpResponseFetch(req *pluginRequest) (string, error) {
+	urls := strings.Fields(req.getenv("urls", ""))
+
+	client, err := builtinHTTPClient(req, httpResponseTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	results := make([]httpResponseResult, len(urls))
+	var wg sync.WaitGroup
+	for i, url := range urls {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = httpResponseGet(req.ctx, client, url, httpResponseExpected(req, httpResponseField(url)))
+		}(i, url)
+	}
+	wg.Wait()
+
+	seconds := func(value float64) string {
+		if value < 0 {
+			return "U"
+		}
+		return strconv.FormatFloat(value, 'f', 6, 64)
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph http_response\n")
+	for i, url := range urls {
+		fmt.Fprintf(&b, "%s.value %s\n", httpResponseField(url), seconds(results[i].total))
+	}
+
+	b.WriteString("multigraph http_response_ttfb\n")
+	for i, url := range urls {
+		fmt.Fprintf(&b, "%s_ttfb.value %s\n", httpResponseField(url), seconds(results[i].ttfb))
+	}
+
+	b.WriteString("multigraph http_response_status\n")
+	for i, url := range urls {
+		ok := 0
+		if results[i].ok {
+			ok = 1
+		}
+		fmt.Fprintf(&b, "%s_ok.value %d\n", httpResponseField(url), ok)
+	}
+
+	return b.String(), nil
+}
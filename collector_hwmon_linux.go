@@ -0,0 +1,139 @@
+//go:build linux && (!minimal || collector_hwmon)
+// +build linux
+// +build !minimal collector_hwmon
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hwmonKinds describes the sensor types graphed from sysfs. Values are
+// exported in milli-units except for fans.
+var hwmonKinds = []struct {
+	prefix  string
+	graph   string
+	title   string
+	vlabel  string
+	divisor float64
+}{
+	{"temp", "hwmon_temp", "Temperatures", "degrees Celsius", 1000},
+	{"fan", "hwmon_fan", "Fans", "RPM", 1},
+	{"in", "hwmon_volt", "Voltages", "Volt", 1000},
+}
+
+type hwmonSensor struct {
+	field    string
+	label    string
+	input    string
+	warning  string
+	critical string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "hwmon",
+		autoconf: hwmonAutoconf,
+		config:   hwmonConfig,
+		fetch:    hwmonFetch,
+	})
+}
+
+func hwmonAutoconf(req *pluginRequest) bool {
+	chips, _ := filepath.Glob(sysPath("class", "hwmon", "hwmon*"))
+	return len(chips) > 0
+}
+
+// hwmonSensors finds every sensor of one kind across all chips, using the
+// chip's own max/crit limits as default thresholds.
+func hwmonSensors(prefix string, divisor float64) []hwmonSensor {
+	chips, _ := filepath.Glob(sysPath("class", "hwmon", "hwmon*"))
+	sort.Strings(chips)
+
+	var sensors []hwmonSensor
+	for _, chip := range chips {
+		chipName := readSysString(filepath.Join(chip, "name"))
+		if chipName == "" {
+			chipName = filepath.Base(chip)
+		}
+
+		// hwmonN numbering depends on probe order, so name fields after
+		// the underlying device where there is one
+		chipID := filepath.Base(chip)
+		if device, err := os.Readlink(filepath.Join(chip, "device")); err == nil {
+			chipID = filepath.Base(device)
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(chip, prefix+"*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			base := strings.TrimSuffix(input, "_input")
+			sensor := strings.TrimPrefix(filepath.Base(base), prefix)
+			if _, err := strconv.Atoi(sensor); err != nil {
+				continue
+			}
+
+			label := readSysString(base + "_label")
+			if label == "" {
+				label = filepath.Base(base)
+			}
+
+			sensors = append(sensors, hwmonSensor{
+				field:    cleanFieldName(chipID + "_" + filepath.Base(base)),
+				label:    chipName + " " + label,
+				input:    input,
+				warning:  readSysScaled(base+"_max", divisor),
+				critical: readSysScaled(base+"_crit", divisor),
+			})
+		}
+	}
+	return sensors
+}
+
+func hwmonConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	for _, kind := range hwmonKinds {
+		sensors := hwmonSensors(kind.prefix, kind.divisor)
+		if len(sensors) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "multigraph %s\n", kind.graph)
+		fmt.Fprintf(&b, "graph_title %s\n", kind.title)
+		b.WriteString("graph_args --base 1000\n")
+		fmt.Fprintf(&b, "graph_vlabel %s\n", kind.vlabel)
+		b.WriteString("graph_category sensors\n")
+		for _, sensor := range sensors {
+			fmt.Fprintf(&b, "%s.label %s\n", sensor.field, sensor.label)
+			req.printThresholds(&b, sensor.field, sensor.warning, sensor.critical)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func hwmonFetch(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	for _, kind := range hwmonKinds {
+		sensors := hwmonSensors(kind.prefix, kind.divisor)
+		if len(sensors) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "multigraph %s\n", kind.graph)
+		for _, sensor := range sensors {
+			value := readSysScaled(sensor.input, kind.divisor)
+			if value == "" {
+				value = "U"
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", sensor.field, value)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,71 @@
+//go:build linux && (!minimal || collector_if_err)
+// +build linux
+// +build !minimal collector_if_err
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "if_err_",
+		wildcard: true,
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("net", "dev")) },
+		suggest:  suggestInterfaces,
+		config:   ifErrConfig,
+		fetch:    ifErrFetch,
+	})
+}
+
+func ifErrConfig(req *pluginRequest) (string, error) {
+	if _, err := interfaceCounters(req); err != nil {
+		return "", err
+	}
+
+	iface := req.instance
+
+	var b strings.Builder
+	b.WriteString("graph_order rcvd trans\n")
+	fmt.Fprintf(&b, "graph_title %s errors\n", iface)
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel packets in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	fmt.Fprintf(&b, "graph_info This graph shows the amount of errors, packet drops, and collisions on the %s network interface.\n", iface)
+	b.WriteString("rcvd.label packets\n")
+	b.WriteString("rcvd.type COUNTER\n")
+	b.WriteString("rcvd.graph no\n")
+	req.printThresholds(&b, "rcvd", "1", "")
+	b.WriteString("trans.label packets\n")
+	b.WriteString("trans.type COUNTER\n")
+	b.WriteString("trans.negative rcvd\n")
+	req.printThresholds(&b, "trans", "1", "")
+	b.WriteString("rxdrop.label Drops\n")
+	b.WriteString("rxdrop.type COUNTER\n")
+	b.WriteString("rxdrop.graph no\n")
+	b.WriteString("txdrop.label Drops\n")
+	b.WriteString("txdrop.type COUNTER\n")
+	b.WriteString("txdrop.negative rxdrop\n")
+	b.WriteString("collisions.label Collisions\n")
+	b.WriteString("collisions.type COUNTER\n")
+
+	return b.String(), nil
+}
+
+func ifErrFetch(req *pluginRequest) (string, error) {
+	counters, err := interfaceCounters(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "rcvd.value %d\n", counters[netDevRxErrs])
+	fmt.Fprintf(&b, "trans.value %d\n", counters[netDevTxErrs])
+	fmt.Fprintf(&b, "rxdrop.value %d\n", counters[netDevRxDrop])
+	fmt.Fprintf(&b, "txdrop.value %d\n", counters[netDevTxDrop])
+	fmt.Fprintf(&b, "collisions.value %d\n", counters[netDevTxColls])
+
+	return b.String(), nil
+}
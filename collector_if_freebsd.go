@@ -0,0 +1,90 @@
+//go:build freebsd && (!minimal || collector_if)
+// +build freebsd
+// +build !minimal collector_if
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "if_",
+		wildcard: true,
+		suggest:  suggestInterfaces,
+		config:   ifConfig,
+		fetch:    ifFetch,
+	})
+}
+
+// suggestInterfaces lists every interface except loopback.
+func suggestInterfaces(req *pluginRequest) ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			names = append(names, iface.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func ifConfig(req *pluginRequest) (string, error) {
+	stats, err := linkCounters(req.instance)
+	if err != nil {
+		return "", err
+	}
+
+	iface := req.instance
+	speed := stats.speed / 1000000
+
+	var b strings.Builder
+	b.WriteString("graph_order down up\n")
+	fmt.Fprintf(&b, "graph_title %s traffic\n", iface)
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	fmt.Fprintf(&b, "graph_info This graph shows the traffic of the %s network interface. Please note that the traffic is shown in bits per second, not bytes.\n", iface)
+	b.WriteString("down.label received\n")
+	b.WriteString("down.type DERIVE\n")
+	b.WriteString("down.graph no\n")
+	b.WriteString("down.cdef down,8,*\n")
+	b.WriteString("down.min 0\n")
+	b.WriteString("up.label bps\n")
+	b.WriteString("up.type DERIVE\n")
+	b.WriteString("up.negative down\n")
+	b.WriteString("up.cdef up,8,*\n")
+	b.WriteString("up.min 0\n")
+
+	if speed > 0 {
+		// max is compared against the raw byte counters, before the cdef
+		fmt.Fprintf(&b, "down.max %d\n", speed*1000000/8)
+		fmt.Fprintf(&b, "up.max %d\n", speed*1000000/8)
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Maximum speed is %d Mb/s.\n", iface, speed)
+	} else {
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Unable to determine interface speed.\n", iface)
+	}
+
+	req.printThresholds(&b, "down", "", "")
+	req.printThresholds(&b, "up", "", "")
+
+	return b.String(), nil
+}
+
+func ifFetch(req *pluginRequest) (string, error) {
+	stats, err := linkCounters(req.instance)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("down.value %d\nup.value %d\n", stats.rxBytes, stats.txBytes), nil
+}
@@ -0,0 +1,88 @@
+//go:build linux && (!minimal || collector_if)
+// +build linux
+// +build !minimal collector_if
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "if_",
+		wildcard: true,
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("net", "dev")) },
+		suggest:  suggestInterfaces,
+		config:   ifConfig,
+		fetch:    ifFetch,
+	})
+}
+
+// interfaceSpeed returns the link speed in Mbit/s, or 0 when the kernel
+// doesn't know it (virtual interfaces, link down).
+func interfaceSpeed(iface string) int64 {
+	data, err := ioutil.ReadFile(sysPath("class", "net", iface, "speed"))
+	if err != nil {
+		return 0
+	}
+
+	speed, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return speed
+}
+
+func ifConfig(req *pluginRequest) (string, error) {
+	if _, err := interfaceCounters(req); err != nil {
+		return "", err
+	}
+
+	iface := req.instance
+	speed := interfaceSpeed(iface)
+
+	var b strings.Builder
+	b.WriteString("graph_order down up\n")
+	fmt.Fprintf(&b, "graph_title %s traffic\n", iface)
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	fmt.Fprintf(&b, "graph_info This graph shows the traffic of the %s network interface. Please note that the traffic is shown in bits per second, not bytes.\n", iface)
+	b.WriteString("down.label received\n")
+	b.WriteString("down.type DERIVE\n")
+	b.WriteString("down.graph no\n")
+	b.WriteString("down.cdef down,8,*\n")
+	b.WriteString("down.min 0\n")
+	b.WriteString("up.label bps\n")
+	b.WriteString("up.type DERIVE\n")
+	b.WriteString("up.negative down\n")
+	b.WriteString("up.cdef up,8,*\n")
+	b.WriteString("up.min 0\n")
+
+	if speed > 0 {
+		// max is compared against the raw byte counters, before the cdef
+		fmt.Fprintf(&b, "down.max %d\n", speed*1000000/8)
+		fmt.Fprintf(&b, "up.max %d\n", speed*1000000/8)
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Maximum speed is %d Mb/s.\n", iface, speed)
+	} else {
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Unable to determine interface speed.\n", iface)
+	}
+
+	req.printThresholds(&b, "down", "", "")
+	req.printThresholds(&b, "up", "", "")
+
+	return b.String(), nil
+}
+
+func ifFetch(req *pluginRequest) (string, error) {
+	counters, err := interfaceCounters(req)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("down.value %d\nup.value %d\n", counters[netDevRxBytes], counters[netDevTxBytes]), nil
+}
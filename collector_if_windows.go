@@ -0,0 +1,119 @@
+//go:build windows && (!minimal || collector_if)
+// +build windows
+// +build !minimal collector_if
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "if_",
+		wildcard: true,
+		suggest:  suggestInterfaces,
+		config:   ifConfig,
+		fetch:    ifFetch,
+	})
+}
+
+// suggestInterfaces lists every interface that is up except loopback,
+// named after their connection name with spaces and such made safe for
+// plugin names, e.g. if_Ethernet_2.
+func suggestInterfaces(req *pluginRequest) ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		names = append(names, cleanFieldName(iface.Name))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// interfaceRow returns the counters for the interface of a wildcard
+// request, failing for interfaces that don't exist.
+func interfaceRow(req *pluginRequest) (string, *windows.MibIfRow2, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, iface := range ifaces {
+		if cleanFieldName(iface.Name) != req.instance {
+			continue
+		}
+		row := &windows.MibIfRow2{InterfaceIndex: uint32(iface.Index)}
+		if err := windows.GetIfEntry2Ex(windows.MibIfEntryNormal, row); err != nil {
+			return "", nil, fmt.Errorf("unable to read counters of %s: %w", iface.Name, err)
+		}
+		return iface.Name, row, nil
+	}
+	return "", nil, fmt.Errorf("no such interface %s", req.instance)
+}
+
+func ifConfig(req *pluginRequest) (string, error) {
+	iface, row, err := interfaceRow(req)
+	if err != nil {
+		return "", err
+	}
+
+	// Link speeds are in bit/s
+	speed := row.ReceiveLinkSpeed
+	if row.TransmitLinkSpeed > speed {
+		speed = row.TransmitLinkSpeed
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_order down up\n")
+	fmt.Fprintf(&b, "graph_title %s traffic\n", iface)
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	fmt.Fprintf(&b, "graph_info This graph shows the traffic of the %s network interface. Please note that the traffic is shown in bits per second, not bytes.\n", iface)
+	b.WriteString("down.label received\n")
+	b.WriteString("down.type DERIVE\n")
+	b.WriteString("down.graph no\n")
+	b.WriteString("down.cdef down,8,*\n")
+	b.WriteString("down.min 0\n")
+	b.WriteString("up.label bps\n")
+	b.WriteString("up.type DERIVE\n")
+	b.WriteString("up.negative down\n")
+	b.WriteString("up.cdef up,8,*\n")
+	b.WriteString("up.min 0\n")
+
+	// Disconnected adapters report an all-ones speed
+	if speed > 0 && speed != ^uint64(0) {
+		fmt.Fprintf(&b, "down.max %d\n", row.ReceiveLinkSpeed/8)
+		fmt.Fprintf(&b, "up.max %d\n", row.TransmitLinkSpeed/8)
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Maximum speed is %d Mb/s.\n", iface, speed/1000000)
+	} else {
+		fmt.Fprintf(&b, "up.info Traffic of the %s interface. Unable to determine interface speed.\n", iface)
+	}
+
+	req.printThresholds(&b, "down", "", "")
+	req.printThresholds(&b, "up", "", "")
+
+	return b.String(), nil
+}
+
+func ifFetch(req *pluginRequest) (string, error) {
+	_, row, err := interfaceRow(req)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("down.value %d\nup.value %d\n", row.InOctets, row.OutOctets), nil
+}
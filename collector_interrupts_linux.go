@@ -0,0 +1,57 @@
+//go:build linux && (!minimal || collector_interrupts)
+// +build linux
+// +build !minimal collector_interrupts
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "interrupts",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("stat")) },
+		config:   interruptsConfig,
+		fetch:    interruptsFetch,
+	})
+}
+
+func interruptsConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Interrupts and context switches\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel interrupts & ctx switches / ${graph_period}\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows the number of interrupts and context switches on the system. These are typically high on a busy system.\n")
+	b.WriteString("intr.info Interrupts are events that alter sequence of instructions executed by a processor. They can come from either hardware (exceptions, NMI, IRQ) or software.\n")
+	b.WriteString("ctx.info A context switch occurs when a multitasking operatings system suspends the currently running process, and starts executing another.\n")
+	b.WriteString("intr.label interrupts\n")
+	b.WriteString("ctx.label context switches\n")
+	b.WriteString("intr.type DERIVE\n")
+	b.WriteString("ctx.type DERIVE\n")
+	b.WriteString("intr.max 100000\n")
+	b.WriteString("ctx.max 100000\n")
+	b.WriteString("intr.min 0\n")
+	b.WriteString("ctx.min 0\n")
+	req.printThresholds(&b, "intr", "", "")
+	req.printThresholds(&b, "ctx", "", "")
+
+	return b.String(), nil
+}
+
+func interruptsFetch(req *pluginRequest) (string, error) {
+	stat, err := readKeyedFields(procPath("stat"))
+	if err != nil {
+		return "", err
+	}
+
+	intr, ctx := stat["intr"], stat["ctxt"]
+	if len(intr) == 0 || len(ctx) == 0 {
+		return "", fmt.Errorf("no interrupt counters in %s", procPath("stat"))
+	}
+
+	// The first intr column is the total, the rest are per IRQ line
+	return fmt.Sprintf("intr.value %s\nctx.value %s\n", intr[0], ctx[0]), nil
+}
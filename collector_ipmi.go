@@ -0,0 +1,251 @@
+//go:build !minimal || collector_ipmi
+// +build !minimal collector_ipmi
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ipmiTimeout      = 60 * time.Second
+	ipmiDefaultCache = 120
+)
+
+// ipmiKinds maps ipmitool units to graphs
+var ipmiKinds = []struct {
+	unit   string
+	graph  string
+	title  string
+	vlabel string
+}{
+	{"degrees C", "ipmi_temp", "IPMI temperatures", "degrees Celsius"},
+	{"RPM", "ipmi_fan", "IPMI fans", "RPM"},
+	{"Volts", "ipmi_volt", "IPMI voltages", "Volt"},
+	{"Watts", "ipmi_power", "IPMI power", "Watt"},
+}
+
+type ipmiSensor struct {
+	field    string
+	label    string
+	unit     string
+	value    string
+	warning  string
+	critical string
+}
+
+// ipmiCache holds the last readings, as a full sensor read over the BMC
+// easily takes several seconds and config and fetch follow each other.
+var ipmiCache = struct {
+	sync.Mutex
+	sensors []ipmiSensor
+	psus    []ipmiSensor
+	updated time.Time
+}{}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "ipmi",
+		autoconf: func(req *pluginRequest) bool { return commandExists("ipmitool") && ipmiDevicePresent() },
+		config:   ipmiConfig,
+		fetch:    ipmiFetch,
+	})
+}
+
+func ipmiDevicePresent() bool {
+	for _, path := range []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"} {
+		if fileExists(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipmiRange turns a lower and upper ipmitool threshold into a munin range,
+// returning "" when neither is available.
+func ipmiRange(lower string, upper string) string {
+	valid := func(s string) string {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return ""
+		}
+		return s
+	}
+
+	lower, upper = valid(lower), valid(upper)
+	if lower == "" && upper == "" {
+		return ""
+	}
+	return lower + ":" + upper
+}
+
+// parseIpmiSensors parses `ipmitool sensor` output:
+// name | value | unit | status | lnr | lc | lnc | unc | uc | unr
+func parseIpmiSensors(output string) []ipmiSensor {
+	var sensors []ipmiSensor
+	for _, line := range strings.Split(output, "\n") {
+		columns := strings.Split(line, "|")
+		if len(columns) < 10 {
+			continue
+		}
+		for i := range columns {
+			columns[i] = strings.TrimSpace(columns[i])
+		}
+
+		value := columns[1]
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			value = "U"
+		}
+
+		sensors = append(sensors, ipmiSensor{
+			field:    cleanFieldName(columns[0]),
+			label:    columns[0],
+			unit:     columns[2],
+			value:    value,
+			warning:  ipmiRange(columns[6], columns[7]),
+			critical: ipmiRange(columns[5], columns[8]),
+		})
+	}
+	return sensors
+}
+
+// parseIpmiPSUs parses `ipmitool sdr type "Power Supply"` output:
+// name | id | status | entity | description
+func parseIpmiPSUs(output string) []ipmiSensor {
+	var psus []ipmiSensor
+	for _, line := range strings.Split(output, "\n") {
+		columns := strings.Split(line, "|")
+		if len(columns) < 3 {
+			continue
+		}
+
+		name := strings.TrimSpace(columns[0])
+		value := "0"
+		if strings.TrimSpace(columns[2]) == "ok" {
+			value = "1"
+		}
+
+		psus = append(psus, ipmiSensor{
+			field: cleanFieldName(name),
+			label: name,
+			value: value,
+		})
+	}
+	return psus
+}
+
+func readIpmi(req *pluginRequest) ([]ipmiSensor, []ipmiSensor, error) {
+	// The embedded profile keeps no readings unless asked to
+	defaultCache := ipmiDefaultCache
+	if req.isEmbedded() {
+		defaultCache = 0
+	}
+	cacheSeconds, err := strconv.Atoi(req.getenv("cache_seconds", strconv.Itoa(defaultCache)))
+	if err != nil {
+		cacheSeconds = defaultCache
+	}
+
+	ipmiCache.Lock()
+	defer ipmiCache.Unlock()
+
+	if time.Since(ipmiCache.updated) < time.Duration(cacheSeconds)*time.Second {
+		return ipmiCache.sensors, ipmiCache.psus, nil
+	}
+
+	ipmitool := req.getenv("ipmitool", "ipmitool")
+	output, err := runCommand(req.ctx, ipmiTimeout, ipmitool, "sensor")
+	if err != nil {
+		return nil, nil, fmt.Errorf("ipmitool sensor failed: %w", err)
+	}
+	sensors := parseIpmiSensors(string(output))
+
+	// PSU status is a discrete sensor, best read from the SDR
+	var psus []ipmiSensor
+	if output, err := runCommand(req.ctx, ipmiTimeout, ipmitool, "sdr", "type", "Power Supply"); err == nil {
+		psus = parseIpmiPSUs(string(output))
+	}
+
+	if cacheSeconds > 0 {
+		ipmiCache.sensors, ipmiCache.psus = sensors, psus
+		ipmiCache.updated = time.Now()
+	}
+
+	return sensors, psus, nil
+}
+
+func ipmiConfig(req *pluginRequest) (string, error) {
+	sensors, psus, err := readIpmi(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, kind := range ipmiKinds {
+		header := false
+		for _, sensor := range sensors {
+			if sensor.unit != kind.unit {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "multigraph %s\n", kind.graph)
+				fmt.Fprintf(&b, "graph_title %s\n", kind.title)
+				b.WriteString("graph_args --base 1000\n")
+				fmt.Fprintf(&b, "graph_vlabel %s\n", kind.vlabel)
+				b.WriteString("graph_category sensors\n")
+				header = true
+			}
+			fmt.Fprintf(&b, "%s.label %s\n", sensor.field, sensor.label)
+			req.printThresholds(&b, sensor.field, sensor.warning, sensor.critical)
+		}
+	}
+
+	if len(psus) > 0 {
+		b.WriteString("multigraph ipmi_psu\n")
+		b.WriteString("graph_title IPMI power supply status\n")
+		b.WriteString("graph_args --base 1000 -l 0 --upper-limit 1\n")
+		b.WriteString("graph_vlabel ok\n")
+		b.WriteString("graph_scale no\n")
+		b.WriteString("graph_category sensors\n")
+		b.WriteString("graph_info 1 means the power supply reports ok, 0 means it does not.\n")
+		for _, psu := range psus {
+			fmt.Fprintf(&b, "%s.label %s\n", psu.field, psu.label)
+			req.printThresholds(&b, psu.field, "", "1:")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func ipmiFetch(req *pluginRequest) (string, error) {
+	sensors, psus, err := readIpmi(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, kind := range ipmiKinds {
+		header := false
+		for _, sensor := range sensors {
+			if sensor.unit != kind.unit {
+				continue
+			}
+			if !header {
+				fmt.Fprintf(&b, "multigraph %s\n", kind.graph)
+				header = true
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", sensor.field, sensor.value)
+		}
+	}
+
+	if len(psus) > 0 {
+		b.WriteString("multigraph ipmi_psu\n")
+		for _, psu := range psus {
+			fmt.Fprintf(&b, "%s.value %s\n", psu.field, psu.value)
+		}
+	}
+
+	return b.String(), nil
+}
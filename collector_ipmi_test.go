@@ -0,0 +1,58 @@
+//go:build !minimal || collector_ipmi
+// +build !minimal collector_ipmi
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIpmiSensors(t *testing.T) {
+	output := "CPU Temp         | 42.000     | degrees C  | ok    | 0.000     | 0.000     | 5.000     | 85.000    | 90.000    | 95.000\n" +
+		"FAN 1            | na         | RPM        | na    | na        | 300.000   | 500.000   | na        | na        | na\n" +
+		"Chassis Intru    | 0x0        | discrete   | 0x0000| na        | na        | na        | na        | na        | na\n" +
+		"PS1 Status       | 0x1        | discrete\n" +
+		"\n"
+	want := []ipmiSensor{
+		{field: "CPU_Temp", label: "CPU Temp", unit: "degrees C", value: "42.000", warning: "5.000:85.000", critical: "0.000:90.000"},
+		{field: "FAN_1", label: "FAN 1", unit: "RPM", value: "U", warning: "500.000:", critical: "300.000:"},
+		{field: "Chassis_Intru", label: "Chassis Intru", unit: "discrete", value: "U"},
+	}
+	if got := parseIpmiSensors(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIpmiSensors = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseIpmiPSUs(t *testing.T) {
+	output := "PS1 Status       | C8h | ok  | 10.1 | Presence detected\n" +
+		"PS2 Status       | C9h | cr  | 10.2 | Presence detected, Failure detected\n" +
+		"PS3 Status       | CAh | ns  | 10.3 | No Reading\n" +
+		"garbage\n"
+	want := []ipmiSensor{
+		{field: "PS1_Status", label: "PS1 Status", value: "1"},
+		{field: "PS2_Status", label: "PS2 Status", value: "0"},
+		{field: "PS3_Status", label: "PS3 Status", value: "0"},
+	}
+	if got := parseIpmiPSUs(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIpmiPSUs = %+v, want %+v", got, want)
+	}
+}
+
+func TestIpmiRange(t *testing.T) {
+	tests := []struct {
+		lower, upper string
+		want         string
+	}{
+		{"5.000", "85.000", "5.000:85.000"},
+		{"na", "85.000", ":85.000"},
+		{"5.000", "na", "5.000:"},
+		{"na", "na", ""},
+		{"", "", ""},
+	}
+	for _, test := range tests {
+		if got := ipmiRange(test.lower, test.upper); got != test.want {
+			t.Errorf("ipmiRange(%q, %q) = %q, want %q", test.lower, test.upper, got, test.want)
+		}
+	}
+}
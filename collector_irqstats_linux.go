@@ -0,0 +1,168 @@
+//go:build linux && (!minimal || collector_irqstats)
+// +build linux
+// +build !minimal collector_irqstats
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type irqLine struct {
+	irq    string
+	label  string
+	perCPU []uint64
+}
+
+func (l irqLine) fieldName() string {
+	return cleanFieldName("i" + l.irq)
+}
+
+func (l irqLine) total() uint64 {
+	var sum uint64
+	for _, count := range l.perCPU {
+		sum += count
+	}
+	return sum
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "irqstats",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("interrupts")) },
+		config:   irqstatsConfig,
+		fetch:    irqstatsFetch,
+	})
+}
+
+// readInterrupts parses /proc/interrupts. The header gives the number of
+// CPU columns; whatever follows them is the interrupt chip, trigger type
+// and device names for numbered IRQs, or a description for the others.
+func readInterrupts() ([]string, []irqLine, error) {
+	file, err := os.Open(procPath("interrupts"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open interrupts: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return nil, nil, fmt.Errorf("empty interrupts file")
+	}
+	cpus := strings.Fields(scanner.Text())
+
+	var lines []irqLine
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		line := irqLine{irq: strings.TrimSuffix(fields[0], ":")}
+		rest := fields[1:]
+		for i := 0; i < len(cpus) && len(rest) > 0; i++ {
+			count, err := strconv.ParseUint(rest[0], 10, 64)
+			if err != nil {
+				break
+			}
+			line.perCPU = append(line.perCPU, count)
+			rest = rest[1:]
+		}
+
+		_, numeric := strconv.Atoi(line.irq)
+		switch {
+		case numeric == nil && len(rest) > 2:
+			line.label = strings.Join(rest[2:], " ")
+		case len(rest) > 0:
+			line.label = strings.Join(rest, " ")
+		default:
+			line.label = line.irq
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("file read error: %w", err)
+	}
+
+	return cpus, lines, nil
+}
+
+func writeIrqFields(b *strings.Builder, req *pluginRequest, lines []irqLine) {
+	for _, line := range lines {
+		field := line.fieldName()
+		fmt.Fprintf(b, "%s.label %s\n", field, line.label)
+		fmt.Fprintf(b, "%s.info Interrupt %s, for device(s): %s\n", field, line.irq, line.label)
+		fmt.Fprintf(b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(b, "%s.min 0\n", field)
+		req.printThresholds(b, field, "", "")
+	}
+}
+
+func irqstatsConfig(req *pluginRequest) (string, error) {
+	cpus, lines, err := readInterrupts()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph irqstats\n")
+	b.WriteString("graph_title Individual interrupts\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel interrupts / ${graph_period}\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info Shows the number of different IRQs received by the kernel. High disk or network traffic can cause a high number of interrupts (with good hardware and drivers this will be less so). Sudden high interrupt activity with no associated higher system activity is not normal.\n")
+	writeIrqFields(&b, req, lines)
+
+	// Per-CPU breakdown shows queue imbalance, but is big on large hosts
+	if parseConfigBool(req.getenv("per_cpu", "no")) {
+		for i, cpu := range cpus {
+			fmt.Fprintf(&b, "multigraph irqstats.%s\n", strings.ToLower(cpu))
+			fmt.Fprintf(&b, "graph_title Individual interrupts on %s\n", cpu)
+			b.WriteString("graph_args --base 1000 -l 0\n")
+			b.WriteString("graph_vlabel interrupts / ${graph_period}\n")
+			b.WriteString("graph_category system\n")
+
+			var cpuLines []irqLine
+			for _, line := range lines {
+				if i < len(line.perCPU) {
+					cpuLines = append(cpuLines, line)
+				}
+			}
+			writeIrqFields(&b, req, cpuLines)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func irqstatsFetch(req *pluginRequest) (string, error) {
+	cpus, lines, err := readInterrupts()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph irqstats\n")
+	for _, line := range lines {
+		fmt.Fprintf(&b, "%s.value %d\n", line.fieldName(), line.total())
+	}
+
+	if parseConfigBool(req.getenv("per_cpu", "no")) {
+		for i, cpu := range cpus {
+			fmt.Fprintf(&b, "multigraph irqstats.%s\n", strings.ToLower(cpu))
+			for _, line := range lines {
+				if i < len(line.perCPU) {
+					fmt.Fprintf(&b, "%s.value %d\n", line.fieldName(), line.perCPU[i])
+				}
+			}
+		}
+	}
+
+	return b.String(), nil
+}
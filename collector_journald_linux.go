@@ -0,0 +1,95 @@
+//go:build linux && (!minimal || collector_journald)
+// +build linux
+// +build !minimal collector_journald
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	journaldTimeout         = 30 * time.Second
+	journaldDefaultInterval = 300
+)
+
+// syslog priorities, in journald's PRIORITY numbering
+var journaldPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "journald",
+		autoconf: func(req *pluginRequest) bool {
+			return commandExists("journalctl") && fileExists("/run/systemd/journal")
+		},
+		config: journaldConfig,
+		fetch:  journaldFetch,
+	})
+}
+
+func journaldInterval(req *pluginRequest) int {
+	interval, err := strconv.Atoi(req.getenv("interval", strconv.Itoa(journaldDefaultInterval)))
+	if err != nil || interval <= 0 {
+		return journaldDefaultInterval
+	}
+	return interval
+}
+
+// countJournalPriorities counts the journal entries of the last
+// env.interval seconds, which should match the master's update rate.
+func countJournalPriorities(req *pluginRequest) ([]int, error) {
+	since := fmt.Sprintf("-%ds", journaldInterval(req))
+	output, err := runCommand(req.ctx, journaldTimeout, req.getenv("journalctl", "journalctl"),
+		"--quiet", "--no-pager", "--since", since, "--output", "json", "--output-fields", "PRIORITY")
+	if output == nil {
+		return nil, fmt.Errorf("journalctl failed: %w", err)
+	}
+
+	counts := make([]int, len(journaldPriorities))
+	for _, line := range strings.Split(string(output), "\n") {
+		var entry struct {
+			Priority string `json:"PRIORITY"`
+		}
+		if line == "" || json.Unmarshal([]byte(line), &entry) != nil {
+			continue
+		}
+		priority, err := strconv.Atoi(entry.Priority)
+		if err != nil || priority < 0 || priority >= len(counts) {
+			continue
+		}
+		counts[priority]++
+	}
+	return counts, nil
+}
+
+func journaldConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Journal messages by priority\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	fmt.Fprintf(&b, "graph_vlabel messages per %ds\n", journaldInterval(req))
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info Number of messages logged to the systemd journal at each priority since the previous run.\n")
+	for _, priority := range journaldPriorities {
+		fmt.Fprintf(&b, "%s.label %s\n", priority, priority)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", priority)
+		req.printThresholds(&b, priority, "", "")
+	}
+	return b.String(), nil
+}
+
+func journaldFetch(req *pluginRequest) (string, error) {
+	counts, err := countJournalPriorities(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, priority := range journaldPriorities {
+		fmt.Fprintf(&b, "%s.value %d\n", priority, counts[i])
+	}
+	return b.String(), nil
+}
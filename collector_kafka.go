@@ -0,0 +1,456 @@
+//go:build !minimal || collector_kafka
+// +build !minimal collector_kafka
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const (
+	kafkaTimeout        = 30 * time.Second
+	kafkaDefaultBrokers = "localhost:9092"
+	// kafkaMaxResponse bounds the size of a response we read, a larger
+	// length most likely being a TLS or HTTP server answering
+	kafkaMaxResponse = 64 << 20
+)
+
+type kafkaGroup struct {
+	name   string
+	topics map[string]int64
+}
+
+func (g kafkaGroup) fieldName() string {
+	return cleanFieldName(g.name)
+}
+
+func (g kafkaGroup) total() int64 {
+	var total int64
+	for _, lag := range g.topics {
+		total += lag
+	}
+	return total
+}
+
+func (g kafkaGroup) topicNames() []string {
+	var names []string
+	for topic := range g.topics {
+		names = append(names, topic)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// kafkaBroker is a broker of the cluster with the number of messages ever
+// appended to the partitions it leads
+type kafkaBroker struct {
+	id       int32
+	address  string
+	messages int64
+}
+
+func (b kafkaBroker) fieldName() string {
+	return fmt.Sprintf("broker_%d", b.id)
+}
+
+type kafkaPartition struct {
+	topic     string
+	partition int32
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "kafka",
+		autoconf: func(req *pluginRequest) bool {
+			ctx, cancel := context.WithTimeout(req.ctx, kafkaTimeout)
+			defer cancel()
+			conn, _, err := kafkaBootstrap(ctx, req)
+			if err != nil {
+				return false
+			}
+			conn.Close()
+			return true
+		},
+		config: kafkaConfig,
+		fetch:  kafkaFetch,
+	})
+}
+
+// kafkaConn is a connection to one broker. Requests use versions from
+// before KIP-482, so headers carry no tagged fields.
+type kafkaConn struct {
+	net.Conn
+	formatter   *kmsg.RequestFormatter
+	correlation int32
+}
+
+// dialKafka connects to the broker at address, over TLS with env.tls and
+// authenticating with SASL PLAIN as env.user if set
+func dialKafka(ctx context.Context, req *pluginRequest, address string) (*kafkaConn, error) {
+	dialer := &net.Dialer{}
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to kafka: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	}
+
+	if parseConfigBool(req.getenv("tls", "no")) {
+		tlsConfig, err := builtinTLSConfig(req)
+		if err != nil {
+			raw.Close()
+			return nil, err
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		raw = tls.Client(raw, tlsConfig)
+	}
+
+	conn := &kafkaConn{Conn: raw, formatter: kmsg.NewRequestFormatter(kmsg.FormatterClientID("munin-node"))}
+	if user := req.getenv("user", ""); user != "" {
+		if err := conn.authenticate(user, req.getenv("password", "")); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *kafkaConn) authenticate(user, password string) error {
+	handshake := kmsg.NewPtrSASLHandshakeRequest()
+	handshake.Version = 1
+	handshake.Mechanism = "PLAIN"
+	resp, err := c.request(handshake)
+	if err != nil {
+		return err
+	}
+	if code := resp.(*kmsg.SASLHandshakeResponse).ErrorCode; code != 0 {
+		return fmt.Errorf("kafka SASL handshake failed with error %d", code)
+	}
+
+	auth := kmsg.NewPtrSASLAuthenticateRequest()
+	auth.SASLAuthBytes = []byte("\x00" + user + "\x00" + password)
+	resp, err = c.request(auth)
+	if err != nil {
+		return err
+	}
+	if reply := resp.(*kmsg.SASLAuthenticateResponse); reply.ErrorCode != 0 {
+		message := ""
+		if reply.ErrorMessage != nil {
+			message = *reply.ErrorMessage
+		}
+		return fmt.Errorf("kafka authentication failed with error %d: %s", reply.ErrorCode, message)
+	}
+	return nil
+}
+
+// request sends r and reads its response
+func (c *kafkaConn) request(r kmsg.Request) (kmsg.Response, error) {
+	c.correlation++
+	if _, err := c.Write(c.formatter.AppendRequest(nil, r, c.correlation)); err != nil {
+		return nil, err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(c, header[:]); err != nil {
+		return nil, err
+	}
+	length := int32(binary.BigEndian.Uint32(header[:4]))
+	if length < 4 || length > kafkaMaxResponse {
+		return nil, fmt.Errorf("invalid kafka response length %d", length)
+	}
+	if correlation := int32(binary.BigEndian.Uint32(header[4:])); correlation != c.correlation {
+		return nil, fmt.Errorf("kafka response to request %d, expected %d", correlation, c.correlation)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(c, body); err != nil {
+		return nil, err
+	}
+
+	resp := r.ResponseKind()
+	if err := resp.ReadFrom(body); err != nil {
+		return nil, fmt.Errorf("invalid kafka response: %w", err)
+	}
+	return resp, nil
+}
+
+// kafkaBootstrap connects to the first reachable broker of env.brokers, a
+// comma or space separated list, and returns the cluster metadata
+func kafkaBootstrap(ctx context.Context, req *pluginRequest) (*kafkaConn, *kmsg.MetadataResponse, error) {
+	var lastErr error
+	for _, address := range strings.FieldsFunc(req.getenv("brokers", kafkaDefaultBrokers), func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		conn, err := dialKafka(ctx, req, address)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		// Without topics, v1 and later list all of them
+		metadata := kmsg.NewPtrMetadataRequest()
+		metadata.Version = 1
+		resp, err := conn.request(metadata)
+		if err != nil {
+			conn.Close()
+			lastErr = fmt.Errorf("kafka metadata request to %s failed: %w", address, err)
+			continue
+		}
+		return conn, resp.(*kmsg.MetadataResponse), nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no kafka brokers in env.brokers")
+	}
+	return nil, nil, lastErr
+}
+
+// readKafka returns the lag of the consumer groups matching the regular
+// expression in env.groups, summed per group and topic, and the brokers of
+// the cluster. Every broker is asked for the groups it coordinates and
+// their committed offsets, and for the high watermarks of the partitions
+// it leads.
+func readKafka(req *pluginRequest) ([]kafkaGroup, []kafkaBroker, error) {
+	var pattern *regexp.Regexp
+	if groups := req.getenv("groups", ""); groups != "" {
+		var err error
+		if pattern, err = regexp.Compile(groups); err != nil {
+			return nil, nil, fmt.Errorf("invalid groups pattern: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(req.ctx, kafkaTimeout)
+	defer cancel()
+
+	bootstrap, metadata, err := kafkaBootstrap(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	bootstrap.Close()
+
+	led := make(map[int32][]kafkaPartition)
+	internal := make(map[string]bool)
+	for _, topic := range metadata.Topics {
+		if topic.Topic == nil || topic.ErrorCode != 0 {
+			continue
+		}
+		internal[*topic.Topic] = topic.IsInternal
+		for _, partition := range topic.Partitions {
+			if partition.Leader >= 0 {
+				led[partition.Leader] = append(led[partition.Leader], kafkaPartition{*topic.Topic, partition.Partition})
+			}
+		}
+	}
+
+	var brokers []kafkaBroker
+	watermarks := make(map[kafkaPartition]int64)
+	committed := make(map[string]map[kafkaPartition]int64)
+	for _, info := range metadata.Brokers {
+		broker := kafkaBroker{id: info.NodeID, address: net.JoinHostPort(info.Host, strconv.Itoa(int(info.Port)))}
+		conn, err := dialKafka(ctx, req, broker.address)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = readKafkaBroker(conn, &broker, led[broker.id], internal, watermarks, committed, pattern)
+		conn.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("kafka broker %s: %w", broker.address, err)
+		}
+		brokers = append(brokers, broker)
+	}
+	sort.Slice(brokers, func(i, j int) bool { return brokers[i].id < brokers[j].id })
+
+	var groups []kafkaGroup
+	for name, offsets := range committed {
+		// Groups that never committed an offset have no lag to show
+		if len(offsets) == 0 {
+			continue
+		}
+		group := kafkaGroup{name: name, topics: make(map[string]int64)}
+		for partition, offset := range offsets {
+			watermark, ok := watermarks[partition]
+			if !ok {
+				continue
+			}
+			lag := watermark - offset
+			if lag < 0 {
+				lag = 0
+			}
+			group.topics[partition.topic] += lag
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups, brokers, nil
+}
+
+// readKafkaBroker reads the high watermarks of the partitions the broker
+// leads and the offsets committed by the groups it coordinates
+func readKafkaBroker(conn *kafkaConn, broker *kafkaBroker, partitions []kafkaPartition, internal map[string]bool,
+	watermarks map[kafkaPartition]int64, committed map[string]map[kafkaPartition]int64, pattern *regexp.Regexp) error {
+	if len(partitions) > 0 {
+		offsets := kmsg.NewPtrListOffsetsRequest()
+		offsets.Version = 1
+		offsets.ReplicaID = -1
+		byTopic := make(map[string]int)
+		for _, p := range partitions {
+			i, ok := byTopic[p.topic]
+			if !ok {
+				i = len(offsets.Topics)
+				byTopic[p.topic] = i
+				offsets.Topics = append(offsets.Topics, kmsg.ListOffsetsRequestTopic{Topic: p.topic})
+			}
+			partition := kmsg.NewListOffsetsRequestTopicPartition()
+			partition.Partition = p.partition
+			partition.Timestamp = -1 // latest
+			offsets.Topics[i].Partitions = append(offsets.Topics[i].Partitions, partition)
+		}
+
+		resp, err := conn.request(offsets)
+		if err != nil {
+			return err
+		}
+		for _, topic := range resp.(*kmsg.ListOffsetsResponse).Topics {
+			for _, partition := range topic.Partitions {
+				if partition.ErrorCode != 0 {
+					continue
+				}
+				watermarks[kafkaPartition{topic.Topic, partition.Partition}] = partition.Offset
+				if !internal[topic.Topic] {
+					broker.messages += partition.Offset
+				}
+			}
+		}
+	}
+
+	list := kmsg.NewPtrListGroupsRequest()
+	list.Version = 1
+	resp, err := conn.request(list)
+	if err != nil {
+		return err
+	}
+	listed := resp.(*kmsg.ListGroupsResponse)
+	if listed.ErrorCode != 0 {
+		return fmt.Errorf("listing groups failed with error %d", listed.ErrorCode)
+	}
+
+	for _, group := range listed.Groups {
+		if pattern != nil && !pattern.MatchString(group.Group) {
+			continue
+		}
+
+		// Without topics, v2 and later return every committed offset
+		fetch := kmsg.NewPtrOffsetFetchRequest()
+		fetch.Version = 3
+		fetch.Group = group.Group
+		resp, err := conn.request(fetch)
+		if err != nil {
+			return err
+		}
+		fetched := resp.(*kmsg.OffsetFetchResponse)
+		if fetched.ErrorCode != 0 {
+			logger.Warn("failed to fetch kafka group offsets", "group", group.Group, "error", fetched.ErrorCode)
+			continue
+		}
+
+		offsets := make(map[kafkaPartition]int64)
+		for _, topic := range fetched.Topics {
+			for _, partition := range topic.Partitions {
+				// Partitions without a committed offset have none to lag behind
+				if partition.ErrorCode == 0 && partition.Offset >= 0 {
+					offsets[kafkaPartition{topic.Topic, partition.Partition}] = partition.Offset
+				}
+			}
+		}
+		committed[group.Group] = offsets
+	}
+	return nil
+}
+
+func kafkaConfig(req *pluginRequest) (string, error) {
+	groups, brokers, err := readKafka(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph kafka_lag\n")
+	b.WriteString("graph_title Kafka consumer group lag\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages\n")
+	b.WriteString("graph_category messaging\n")
+	b.WriteString("graph_info Messages not yet consumed by each consumer group, over all its partitions.\n")
+	for _, group := range groups {
+		field := group.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, group.name)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	for _, group := range groups {
+		fmt.Fprintf(&b, "multigraph kafka_lag.%s\n", group.fieldName())
+		fmt.Fprintf(&b, "graph_title Kafka lag of %s\n", group.name)
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_vlabel messages\n")
+		b.WriteString("graph_category messaging\n")
+		for _, topic := range group.topicNames() {
+			fmt.Fprintf(&b, "%s.label %s\n", cleanFieldName(topic), topic)
+			fmt.Fprintf(&b, "%s.draw AREASTACK\n", cleanFieldName(topic))
+		}
+	}
+
+	b.WriteString("multigraph kafka_messages\n")
+	b.WriteString("graph_title Kafka messages in per broker\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages per ${graph_period}\n")
+	b.WriteString("graph_category messaging\n")
+	b.WriteString("graph_info Messages appended to the partitions each broker leads.\n")
+	for _, broker := range brokers {
+		field := broker.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, broker.address)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", field)
+	}
+
+	return b.String(), nil
+}
+
+func kafkaFetch(req *pluginRequest) (string, error) {
+	groups, brokers, err := readKafka(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph kafka_lag\n")
+	for _, group := range groups {
+		fmt.Fprintf(&b, "%s.value %d\n", group.fieldName(), group.total())
+	}
+
+	for _, group := range groups {
+		fmt.Fprintf(&b, "multigraph kafka_lag.%s\n", group.fieldName())
+		for _, topic := range group.topicNames() {
+			fmt.Fprintf(&b, "%s.value %d\n", cleanFieldName(topic), group.topics[topic])
+		}
+	}
+
+	b.WriteString("multigraph kafka_messages\n")
+	for _, broker := range brokers {
+		fmt.Fprintf(&b, "%s.value %d\n", broker.fieldName(), broker.messages)
+	}
+
+	return b.String(), nil
+}
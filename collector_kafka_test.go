@@ -0,0 +1,75 @@
+//go:build !minimal || collector_kafka
+// +build !minimal collector_kafka
+
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// kafkaReply answers the next request read from conn with body, framed
+// with length and correlation
+func kafkaReply(conn net.Conn, correlation int32, length int32, body []byte) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return
+	}
+	request := make([]byte, binary.BigEndian.Uint32(header[:]))
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return
+	}
+	reply := binary.BigEndian.AppendUint32(nil, uint32(length))
+	reply = binary.BigEndian.AppendUint32(reply, uint32(correlation))
+	conn.Write(append(reply, body...))
+}
+
+func TestKafkaRequest(t *testing.T) {
+	groups := kmsg.NewPtrListGroupsResponse()
+	groups.Version = 1
+	groups.Groups = []kmsg.ListGroupsResponseGroup{{Group: "billing", ProtocolType: "consumer"}}
+	body := groups.AppendTo(nil)
+
+	tests := []struct {
+		name        string
+		correlation int32
+		length      int32
+		body        []byte
+		err         bool
+	}{
+		{"valid", 1, int32(len(body)) + 4, body, false},
+		{"wrong correlation", 2, int32(len(body)) + 4, body, true},
+		{"short length", 1, 3, nil, true},
+		{"huge length", 1, kafkaMaxResponse + 1, nil, true},
+		{"truncated body", 1, int32(len(body)) + 4, body[:len(body)-2], true},
+		{"undecodable body", 1, 5, []byte{0}, true},
+	}
+	for _, test := range tests {
+		client, server := net.Pipe()
+		go func() {
+			kafkaReply(server, test.correlation, test.length, test.body)
+			server.Close()
+		}()
+
+		conn := &kafkaConn{Conn: client, formatter: kmsg.NewRequestFormatter(kmsg.FormatterClientID("munin-node"))}
+		request := kmsg.NewPtrListGroupsRequest()
+		request.Version = 1
+		resp, err := conn.request(request)
+		client.Close()
+		if (err != nil) != test.err {
+			t.Errorf("%s: request error = %v", test.name, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got := resp.(*kmsg.ListGroupsResponse)
+		if len(got.Groups) != 1 || got.Groups[0].Group != "billing" {
+			t.Errorf("%s: request returned groups %+v", test.name, got.Groups)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+//go:build !minimal || collector_kubelet
+// +build !minimal collector_kubelet
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	kubeletTimeout          = 10 * time.Second
+	kubeletDefaultURL       = "https://127.0.0.1:10250"
+	kubeletDefaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// kubeletPod is the part of a pod's entry in /stats/summary we graph.
+// Values are missing while the kubelet has no sample for a pod yet.
+type kubeletPod struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	CPU *struct {
+		UsageCoreNanoSeconds *uint64 `json:"usageCoreNanoSeconds"`
+	} `json:"cpu"`
+	Memory *struct {
+		WorkingSetBytes *uint64 `json:"workingSetBytes"`
+	} `json:"memory"`
+	EphemeralStorage *struct {
+		UsedBytes *uint64 `json:"usedBytes"`
+	} `json:"ephemeral-storage"`
+}
+
+func (p *kubeletPod) label() string {
+	return p.PodRef.Namespace + "/" + p.PodRef.Name
+}
+
+func (p *kubeletPod) fieldName() string {
+	return cleanFieldName(p.PodRef.Namespace + "_" + p.PodRef.Name)
+}
+
+func (p *kubeletPod) values() map[string]string {
+	values := map[string]string{"cpu": "U", "memory": "U", "storage": "U"}
+	if p.CPU != nil && p.CPU.UsageCoreNanoSeconds != nil {
+		values["cpu"] = fmt.Sprint(*p.CPU.UsageCoreNanoSeconds)
+	}
+	if p.Memory != nil && p.Memory.WorkingSetBytes != nil {
+		values["memory"] = fmt.Sprint(*p.Memory.WorkingSetBytes)
+	}
+	if p.EphemeralStorage != nil && p.EphemeralStorage.UsedBytes != nil {
+		values["storage"] = fmt.Sprint(*p.EphemeralStorage.UsedBytes)
+	}
+	return values
+}
+
+var kubeletGraphs = []struct {
+	name   string
+	value  string
+	title  string
+	vlabel string
+	args   string
+	info   string
+}{
+	{"kubelet_cpu", "cpu", "Pod CPU usage", "%", "--base 1000 -l 0", "CPU time used by each pod, where 100% is one core."},
+	{"kubelet_memory", "memory", "Pod memory usage", "bytes", "--base 1024 -l 0", "Working set of each pod, the figure the kubelet evicts pods on."},
+	{"kubelet_storage", "storage", "Pod ephemeral storage", "bytes", "--base 1024 -l 0", "Ephemeral storage used by each pod: writable layers, logs and emptyDir volumes."},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "kubelet",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readKubeletPods(req)
+			return err == nil
+		},
+		config: kubeletConfig,
+		fetch:  kubeletFetch,
+	})
+}
+
+// kubeletToken returns env.token, or the token in env.token_file, which
+// defaults to the service account token when running in a pod.
+func kubeletToken(req *pluginRequest) string {
+	if token := req.getenv("token", ""); token != "" {
+		return token
+	}
+	data, err := ioutil.ReadFile(req.getenv("token_file", kubeletDefaultTokenFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readKubeletPods returns the pods of the kubelet summary API whose
+// namespace matches the regular expression in env.namespaces, sorted by
+// namespace and name.
+func readKubeletPods(req *pluginRequest) ([]*kubeletPod, error) {
+	var pattern *regexp.Regexp
+	if namespaces := req.getenv("namespaces", ""); namespaces != "" {
+		var err error
+		if pattern, err = regexp.Compile(namespaces); err != nil {
+			return nil, fmt.Errorf("invalid namespaces pattern: %w", err)
+		}
+	}
+
+	client, err := builtinHTTPClient(req, kubeletTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimSuffix(req.getenv("url", kubeletDefaultURL), "/") + "/stats/summary"
+	request, err := http.NewRequestWithContext(req.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := kubeletToken(req); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubelet summary: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	var summary struct {
+		Pods []*kubeletPod `json:"pods"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet summary: %w", err)
+	}
+
+	var pods []*kubeletPod
+	for _, pod := range summary.Pods {
+		if pattern == nil || pattern.MatchString(pod.PodRef.Namespace) {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].label() < pods[j].label() })
+	return pods, nil
+}
+
+func kubeletConfig(req *pluginRequest) (string, error) {
+	pods, err := readKubeletPods(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range kubeletGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category kubernetes\n")
+		fmt.Fprintf(&b, "graph_info %s\n", graph.info)
+		for i, pod := range pods {
+			field := pod.fieldName()
+			fmt.Fprintf(&b, "%s.label %s\n", field, pod.label())
+			if graph.value == "cpu" {
+				fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+				fmt.Fprintf(&b, "%s.min 0\n", field)
+				fmt.Fprintf(&b, "%s.cdef %s,10000000,/\n", field, field)
+			}
+			if i == 0 {
+				fmt.Fprintf(&b, "%s.draw AREA\n", field)
+			} else {
+				fmt.Fprintf(&b, "%s.draw STACK\n", field)
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+func kubeletFetch(req *pluginRequest) (string, error) {
+	pods, err := readKubeletPods(req)
+	if err != nil {
+		return "", err
+	}
+
+	values := make([]map[string]string, len(pods))
+	for i, pod := range pods {
+		values[i] = pod.values()
+	}
+
+	var b strings.Builder
+	for _, graph := range kubeletGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for i, pod := range pods {
+			fmt.Fprintf(&b, "%s.value %s\n", pod.fieldName(), values[i][graph.value])
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,230 @@
+//go:build !minimal || collector_libvirt
+// +build !minimal collector_libvirt
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+const libvirtDefaultURI = "qemu:///system"
+
+// libvirtDomain is the usage of one running domain, with disks and
+// interfaces added up
+type libvirtDomain struct {
+	name      string
+	cpuTime   uint64
+	memory    uint64
+	diskRead  uint64
+	diskWrite uint64
+	netRx     uint64
+	netTx     uint64
+}
+
+func (d *libvirtDomain) fieldName() string {
+	return cleanFieldName(d.name)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "libvirt",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readLibvirtDomains(req)
+			return err == nil
+		},
+		config: libvirtConfig,
+		fetch:  libvirtFetch,
+	})
+}
+
+// libvirtUint reads a typed parameter of any of the integer types libvirt
+// uses for statistics
+func libvirtUint(value libvirt.TypedParamValue) uint64 {
+	switch v := value.I.(type) {
+	case uint64:
+		return v
+	case int64:
+		return uint64(v)
+	case uint32:
+		return uint64(v)
+	case int32:
+		return uint64(v)
+	}
+	return 0
+}
+
+// readLibvirtDomains asks libvirtd at env.uri for the bulk statistics of
+// all running domains, the same call `virsh domstats` makes.
+func readLibvirtDomains(req *pluginRequest) ([]*libvirtDomain, error) {
+	uri, err := url.Parse(req.getenv("uri", libvirtDefaultURI))
+	if err != nil {
+		return nil, fmt.Errorf("invalid libvirt uri: %w", err)
+	}
+
+	client, err := libvirt.ConnectToURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect()
+
+	stats := libvirt.DomainStatsCPUTotal | libvirt.DomainStatsBalloon | libvirt.DomainStatsInterface | libvirt.DomainStatsBlock
+	records, err := client.ConnectGetAllDomainStats(nil, uint32(stats), uint32(libvirt.ConnectGetAllDomainsStatsActive))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read domain stats: %w", err)
+	}
+
+	var domains []*libvirtDomain
+	for _, record := range records {
+		domain := &libvirtDomain{name: record.Dom.Name}
+		for _, param := range record.Params {
+			value := libvirtUint(param.Value)
+
+			// Per device stats are named like net.0.rx.bytes
+			key := param.Field
+			if parts := strings.SplitN(key, ".", 3); len(parts) == 3 {
+				if _, err := strconv.Atoi(parts[1]); err == nil {
+					key = parts[0] + "." + parts[2]
+				}
+			}
+
+			switch key {
+			case "cpu.time":
+				domain.cpuTime = value
+			case "balloon.current":
+				domain.memory = value * 1024
+			case "block.rd.bytes":
+				domain.diskRead += value
+			case "block.wr.bytes":
+				domain.diskWrite += value
+			case "net.rx.bytes":
+				domain.netRx += value
+			case "net.tx.bytes":
+				domain.netTx += value
+			}
+		}
+		domains = append(domains, domain)
+	}
+
+	sort.Slice(domains, func(i, j int) bool { return domains[i].name < domains[j].name })
+	return domains, nil
+}
+
+// libvirtPairConfig writes an in/out pair of DERIVE fields per domain,
+// with in drawn below the axis
+func libvirtPairConfig(b *strings.Builder, domains []*libvirtDomain, in string, out string, cdef string) {
+	for _, domain := range domains {
+		field := domain.fieldName()
+		fmt.Fprintf(b, "%s_%s.label %s\n", field, in, domain.name)
+		fmt.Fprintf(b, "%s_%s.type DERIVE\n", field, in)
+		fmt.Fprintf(b, "%s_%s.min 0\n", field, in)
+		fmt.Fprintf(b, "%s_%s.graph no\n", field, in)
+		fmt.Fprintf(b, "%s_%s.label %s\n", field, out, domain.name)
+		fmt.Fprintf(b, "%s_%s.type DERIVE\n", field, out)
+		fmt.Fprintf(b, "%s_%s.min 0\n", field, out)
+		fmt.Fprintf(b, "%s_%s.negative %s_%s\n", field, out, field, in)
+		if cdef != "" {
+			fmt.Fprintf(b, "%s_%s.cdef %s_%s,%s\n", field, in, field, in, cdef)
+			fmt.Fprintf(b, "%s_%s.cdef %s_%s,%s\n", field, out, field, out, cdef)
+		}
+	}
+}
+
+func libvirtConfig(req *pluginRequest) (string, error) {
+	domains, err := readLibvirtDomains(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph libvirt_cpu\n")
+	b.WriteString("graph_title Virtual machine CPU usage\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category virtualization\n")
+	b.WriteString("graph_info CPU time used by each domain, where 100% is one host CPU.\n")
+	for i, domain := range domains {
+		field := domain.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, domain.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+		fmt.Fprintf(&b, "%s.cdef %s,10000000,/\n", field, field)
+		if i == 0 {
+			fmt.Fprintf(&b, "%s.draw AREA\n", field)
+		} else {
+			fmt.Fprintf(&b, "%s.draw STACK\n", field)
+		}
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph libvirt_memory\n")
+	b.WriteString("graph_title Virtual machine memory\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category virtualization\n")
+	b.WriteString("graph_info Memory currently assigned to each domain by the balloon driver.\n")
+	for i, domain := range domains {
+		field := domain.fieldName()
+		fmt.Fprintf(&b, "%s.label %s\n", field, domain.name)
+		if i == 0 {
+			fmt.Fprintf(&b, "%s.draw AREA\n", field)
+		} else {
+			fmt.Fprintf(&b, "%s.draw STACK\n", field)
+		}
+	}
+
+	b.WriteString("multigraph libvirt_disk\n")
+	b.WriteString("graph_title Virtual machine disk I/O\n")
+	b.WriteString("graph_args --base 1024\n")
+	b.WriteString("graph_vlabel bytes read (-) / written (+) per ${graph_period}\n")
+	b.WriteString("graph_category virtualization\n")
+	libvirtPairConfig(&b, domains, "read", "write", "")
+
+	b.WriteString("multigraph libvirt_network\n")
+	b.WriteString("graph_title Virtual machine network traffic\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category virtualization\n")
+	b.WriteString("graph_info Traffic as seen by the domains, so in is what they received.\n")
+	libvirtPairConfig(&b, domains, "rx", "tx", "8,*")
+
+	return b.String(), nil
+}
+
+func libvirtFetch(req *pluginRequest) (string, error) {
+	domains, err := readLibvirtDomains(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph libvirt_cpu\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "%s.value %d\n", domain.fieldName(), domain.cpuTime)
+	}
+
+	b.WriteString("multigraph libvirt_memory\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "%s.value %d\n", domain.fieldName(), domain.memory)
+	}
+
+	b.WriteString("multigraph libvirt_disk\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "%s_read.value %d\n", domain.fieldName(), domain.diskRead)
+		fmt.Fprintf(&b, "%s_write.value %d\n", domain.fieldName(), domain.diskWrite)
+	}
+
+	b.WriteString("multigraph libvirt_network\n")
+	for _, domain := range domains {
+		fmt.Fprintf(&b, "%s_rx.value %d\n", domain.fieldName(), domain.netRx)
+		fmt.Fprintf(&b, "%s_tx.value %d\n", domain.fieldName(), domain.netTx)
+	}
+
+	return b.String(), nil
+}
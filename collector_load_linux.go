@@ -0,0 +1,49 @@
+//go:build linux && (!minimal || collector_load)
+// +build linux
+// +build !minimal collector_load
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "load",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("loadavg")) },
+		config:   loadConfig,
+		fetch:    loadFetch,
+	})
+}
+
+func loadConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Load average\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel load\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("load.label load\n")
+	req.printThresholds(&b, "load", "", "")
+	b.WriteString("graph_info The load average of the machine describes how many processes are in the run-queue (scheduled to run \"immediately\").\n")
+	b.WriteString("load.info 5 minute load average\n")
+
+	return b.String(), nil
+}
+
+func loadFetch(req *pluginRequest) (string, error) {
+	data, err := ioutil.ReadFile(procPath("loadavg"))
+	if err != nil {
+		return "", fmt.Errorf("unable to read loadavg: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return "", fmt.Errorf("unexpected loadavg format: %q", data)
+	}
+
+	return fmt.Sprintf("load.value %s\n", fields[1]), nil
+}
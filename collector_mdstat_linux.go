@@ -0,0 +1,158 @@
+//go:build linux && (!minimal || collector_mdstat)
+// +build linux
+// +build !minimal collector_mdstat
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	mdMembersRe  = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdProgressRe = regexp.MustCompile(`(resync|recovery|reshape|check)\s*=\s*([\d.]+)%`)
+)
+
+type mdArray struct {
+	name     string
+	active   bool
+	devices  int
+	working  int
+	failed   int
+	progress string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "mdstat",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("mdstat")) },
+		config:   mdstatConfig,
+		fetch:    mdstatFetch,
+	})
+}
+
+// readMdstat parses /proc/mdstat into one entry per md device. Progress
+// is 100 unless a resync, recovery, reshape or check is running.
+func readMdstat() ([]mdArray, error) {
+	file, err := os.Open(procPath("mdstat"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open mdstat: %w", err)
+	}
+	defer file.Close()
+
+	var arrays []mdArray
+	var current *mdArray
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+
+		// md0 : active raid1 sdb1[1] sda1[0](F)
+		if len(fields) >= 3 && strings.HasPrefix(fields[0], "md") && fields[1] == ":" {
+			arrays = append(arrays, mdArray{
+				name:     fields[0],
+				active:   fields[2] == "active",
+				failed:   strings.Count(line, "(F)"),
+				progress: "100",
+			})
+			current = &arrays[len(arrays)-1]
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		if match := mdMembersRe.FindStringSubmatch(line); match != nil {
+			current.devices, _ = strconv.Atoi(match[1])
+			current.working, _ = strconv.Atoi(match[2])
+		}
+		if match := mdProgressRe.FindStringSubmatch(line); match != nil {
+			current.progress = match[2]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+	return arrays, nil
+}
+
+var mdGraphs = []struct {
+	name     string
+	title    string
+	vlabel   string
+	info     string
+	warning  string
+	critical string
+}{
+	{"mdstat_degraded", "RAID arrays missing members", "devices", "Number of member devices an array is short of. Any missing member means the array has lost redundancy.", "", ":0"},
+	{"mdstat_failed", "RAID arrays failed members", "devices", "Number of members marked as failed, still present in the array.", ":0", ""},
+	{"mdstat_active", "RAID arrays active", "active", "1 if the array is active, 0 if it is inactive.", "", "1:"},
+	{"mdstat_sync", "RAID resync progress", "%", "Progress of a running resync, recovery, reshape or check. 100 when idle.", "", ""},
+}
+
+func mdValue(graph string, array mdArray) string {
+	switch graph {
+	case "mdstat_degraded":
+		if array.devices == 0 {
+			return "U"
+		}
+		return strconv.Itoa(array.devices - array.working)
+	case "mdstat_failed":
+		return strconv.Itoa(array.failed)
+	case "mdstat_active":
+		if array.active {
+			return "1"
+		}
+		return "0"
+	}
+	return array.progress
+}
+
+func mdstatConfig(req *pluginRequest) (string, error) {
+	arrays, err := readMdstat()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range mdGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_scale no\n")
+		b.WriteString("graph_category disk\n")
+		fmt.Fprintf(&b, "graph_info %s\n", graph.info)
+		for _, array := range arrays {
+			field := cleanFieldName(array.name)
+			fmt.Fprintf(&b, "%s.label %s\n", field, array.name)
+			req.printThresholds(&b, field, graph.warning, graph.critical)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func mdstatFetch(req *pluginRequest) (string, error) {
+	arrays, err := readMdstat()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range mdGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, array := range arrays {
+			fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(array.name), mdValue(graph.name, array))
+		}
+	}
+
+	return b.String(), nil
+}
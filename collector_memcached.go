@@ -0,0 +1,138 @@
+//go:build !minimal || collector_memcached
+// +build !minimal collector_memcached
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	memcachedTimeout     = 10 * time.Second
+	memcachedDefaultHost = "127.0.0.1:11211"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "memcached",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readMemcachedStats(req)
+			return err == nil
+		},
+		config: memcachedConfig,
+		fetch:  memcachedFetch,
+	})
+}
+
+// readMemcachedStats sends "stats" to env.host (or env.socket) and returns
+// the "STAT name value" lines up to END.
+func readMemcachedStats(req *pluginRequest) (map[string]string, error) {
+	network, address := "tcp", req.getenv("host", memcachedDefaultHost)
+	if socket := req.getenv("socket", ""); socket != "" {
+		network, address = "unix", socket
+	}
+
+	conn, err := net.DialTimeout(network, address, memcachedTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to memcached: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(memcachedTimeout))
+
+	if _, err := conn.Write([]byte("stats\r\n")); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]string)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 1 && fields[0] == "END" {
+			return stats, nil
+		}
+		if len(fields) >= 3 && fields[0] == "STAT" {
+			stats[fields[1]] = strings.Join(fields[2:], " ")
+			continue
+		}
+		return nil, fmt.Errorf("unexpected memcached reply %q", scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("memcached closed the connection")
+}
+
+// memcachedCounters are the stats fields that count up from start
+var memcachedCounters = map[string]bool{
+	"get_hits": true, "get_misses": true, "evictions": true, "reclaimed": true, "rejected_connections": true,
+}
+
+var memcachedGraphs = []struct {
+	name   string
+	title  string
+	args   string
+	vlabel string
+	fields []string
+	labels []string
+}{
+	{"memcached_hits", "Memcached lookups", "--base 1000 -l 0", "lookups per ${graph_period}",
+		[]string{"get_hits", "get_misses"},
+		[]string{"hits", "misses"}},
+	{"memcached_evictions", "Memcached evictions", "--base 1000 -l 0", "items per ${graph_period}",
+		[]string{"evictions", "reclaimed"},
+		[]string{"evicted", "reclaimed"}},
+	{"memcached_memory", "Memcached memory usage", "--base 1024 -l 0", "bytes",
+		[]string{"bytes", "limit_maxbytes"},
+		[]string{"used", "limit"}},
+	{"memcached_items", "Memcached items", "--base 1000 -l 0", "items",
+		[]string{"curr_items"},
+		[]string{"items"}},
+	{"memcached_connections", "Memcached connections", "--base 1000 -l 0", "connections",
+		[]string{"curr_connections", "rejected_connections"},
+		[]string{"open", "rejected per ${graph_period}"}},
+}
+
+func memcachedConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	for _, graph := range memcachedGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category db\n")
+		for i, field := range graph.fields {
+			fmt.Fprintf(&b, "%s.label %s\n", field, graph.labels[i])
+			if memcachedCounters[field] {
+				fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+				fmt.Fprintf(&b, "%s.min 0\n", field)
+			}
+			req.printThresholds(&b, field, "", "")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func memcachedFetch(req *pluginRequest) (string, error) {
+	stats, err := readMemcachedStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range memcachedGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, field := range graph.fields {
+			value, ok := stats[field]
+			if !ok {
+				value = "U"
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", field, value)
+		}
+	}
+	return b.String(), nil
+}
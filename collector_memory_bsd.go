@@ -0,0 +1,68 @@
+//go:build (openbsd || netbsd) && (!minimal || collector_memory)
+// +build openbsd netbsd
+// +build !minimal collector_memory
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var memoryFields = []struct {
+	name  string
+	draw  string
+	info  string
+	value func(uvm uvmStats) uint64
+}{
+	{"active", "AREA", "Memory in active use.", func(uvm uvmStats) uint64 { return uvm.active }},
+	{"inactive", "STACK", "Memory not used recently, ready to be reclaimed.", func(uvm uvmStats) uint64 { return uvm.inactive }},
+	{"wired", "STACK", "Memory wired down by the kernel, which cannot be paged out.", func(uvm uvmStats) uint64 { return uvm.wired }},
+	{"free", "STACK", "Memory not used for anything at all.", func(uvm uvmStats) uint64 { return uvm.free }},
+	{"swap", "STACK", "Swap space used.", func(uvm uvmStats) uint64 { return uvm.swapUsed }},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "memory",
+		config: memoryConfig,
+		fetch:  memoryFetch,
+	})
+}
+
+func memoryConfig(req *pluginRequest) (string, error) {
+	uvm, err := readUVM()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Memory usage\n")
+	b.WriteString("graph_order active inactive wired free swap\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", uvm.total)
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows what the machine uses memory for.\n")
+
+	for _, field := range memoryFields {
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, field.draw)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func memoryFetch(req *pluginRequest) (string, error) {
+	uvm, err := readUVM()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, field := range memoryFields {
+		fmt.Fprintf(&b, "%s.value %d\n", field.name, field.value(uvm))
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,111 @@
+//go:build darwin && (!minimal || collector_memory)
+// +build darwin
+// +build !minimal collector_memory
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// memoryFields follow Activity Monitor's breakdown. The counter is the
+// vm_stat line the field is read from.
+var memoryFields = []struct {
+	name    string
+	counter string
+	draw    string
+	info    string
+}{
+	{"wired", "Pages wired down", "AREA", "Memory wired down by the kernel, which cannot be paged out."},
+	{"active", "Pages active", "STACK", "Memory in active use."},
+	{"inactive", "Pages inactive", "STACK", "Memory not used recently, ready to be reclaimed."},
+	{"speculative", "Pages speculative", "STACK", "Memory read ahead from files in case it is needed."},
+	{"compressed", "Pages occupied by compressor", "STACK", "Memory holding compressed pages."},
+	{"free", "Pages free", "STACK", "Memory not used for anything at all."},
+	{"swap", "", "STACK", "Swap space used."},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "memory",
+		config: memoryConfig,
+		fetch:  memoryFetch,
+	})
+}
+
+// readMemoryStats returns the memory fields in bytes, plus physical
+// memory as "total"
+func readMemoryStats(ctx context.Context) (map[string]uint64, error) {
+	counters, err := readVMStat(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]uint64)
+	if total, err := unix.SysctlUint64("hw.memsize"); err == nil {
+		stats["total"] = total
+	}
+	for _, field := range memoryFields {
+		if value, ok := counters[field.counter]; ok {
+			stats[field.name] = value
+		}
+	}
+	if swap, err := readSwapUsage(); err == nil {
+		stats["swap"] = swap.used
+	}
+
+	return stats, nil
+}
+
+func memoryConfig(req *pluginRequest) (string, error) {
+	stats, err := readMemoryStats(req.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Memory usage\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", stats["total"])
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows what the machine uses memory for.\n")
+
+	var order []string
+	for _, field := range memoryFields {
+		if _, ok := stats[field.name]; ok {
+			order = append(order, field.name)
+		}
+	}
+	fmt.Fprintf(&b, "graph_order %s\n", strings.Join(order, " "))
+
+	for _, field := range memoryFields {
+		if _, ok := stats[field.name]; !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, field.draw)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func memoryFetch(req *pluginRequest) (string, error) {
+	stats, err := readMemoryStats(req.ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, field := range memoryFields {
+		if value, ok := stats[field.name]; ok {
+			fmt.Fprintf(&b, "%s.value %d\n", field.name, value)
+		}
+	}
+
+	return b.String(), nil
+}
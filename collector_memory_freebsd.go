@@ -0,0 +1,120 @@
+//go:build freebsd && (!minimal || collector_memory)
+// +build freebsd
+// +build !minimal collector_memory
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// memoryFields follow the stock munin memory plugin for FreeBSD. Laundry
+// pages only exist since FreeBSD 11.1.
+var memoryFields = []struct {
+	name  string
+	count string
+	draw  string
+	info  string
+}{
+	{"active", "v_active_count", "AREA", "Memory in active use."},
+	{"inactive", "v_inactive_count", "STACK", "Memory not used recently, ready to be reclaimed."},
+	{"laundry", "v_laundry_count", "STACK", "Dirty memory waiting to be written to swap before it can be reused."},
+	{"wired", "v_wire_count", "STACK", "Memory wired down by the kernel, which cannot be paged out."},
+	{"buffers", "", "STACK", "Memory used by the buffer cache."},
+	{"free", "v_free_count", "STACK", "Memory not used for anything at all."},
+	{"swap", "", "STACK", "Swap space used."},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "memory",
+		config: memoryConfig,
+		fetch:  memoryFetch,
+	})
+}
+
+// readMemoryStats returns the memory fields in bytes, plus physical
+// memory as "total"
+func readMemoryStats() (map[string]uint64, error) {
+	stats := map[string]uint64{}
+
+	pageSize, err := sysctlCounter("vm.stats.vm.v_page_size")
+	if err != nil {
+		return nil, err
+	}
+	pageCount, err := sysctlCounter("vm.stats.vm.v_page_count")
+	if err != nil {
+		return nil, err
+	}
+	stats["total"] = pageCount * pageSize
+
+	for _, field := range memoryFields {
+		if field.count == "" {
+			continue
+		}
+		pages, err := sysctlCounter("vm.stats.vm." + field.count)
+		if err != nil {
+			continue
+		}
+		stats[field.name] = pages * pageSize
+	}
+
+	if bufspace, err := sysctlCounter("vfs.bufspace"); err == nil {
+		stats["buffers"] = bufspace
+	}
+	if swap, err := readSwapUsage(); err == nil {
+		stats["swap"] = swap.used
+	}
+
+	return stats, nil
+}
+
+func memoryConfig(req *pluginRequest) (string, error) {
+	stats, err := readMemoryStats()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Memory usage\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", stats["total"])
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows what the machine uses memory for.\n")
+
+	var order []string
+	for _, field := range memoryFields {
+		if _, ok := stats[field.name]; ok {
+			order = append(order, field.name)
+		}
+	}
+	fmt.Fprintf(&b, "graph_order %s\n", strings.Join(order, " "))
+
+	for _, field := range memoryFields {
+		if _, ok := stats[field.name]; !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, field.draw)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func memoryFetch(req *pluginRequest) (string, error) {
+	stats, err := readMemoryStats()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, field := range memoryFields {
+		if value, ok := stats[field.name]; ok {
+			fmt.Fprintf(&b, "%s.value %d\n", field.name, value)
+		}
+	}
+
+	return b.String(), nil
+}
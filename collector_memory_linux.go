@@ -0,0 +1,114 @@
+//go:build linux && (!minimal || collector_memory)
+// +build linux
+// +build !minimal collector_memory
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// memoryFields follow the graph order of the stock munin memory plugin so
+// existing RRDs carry on seamlessly.
+var memoryFields = []struct {
+	name  string
+	label string
+	draw  string
+	info  string
+}{
+	{"apps", "apps", "AREA", "Memory used by user-space applications."},
+	{"page_tables", "page_tables", "STACK", "Memory used to map between virtual and physical memory addresses."},
+	{"swap_cache", "swap_cache", "STACK", "A piece of memory that keeps track of pages that have been fetched from swap but not yet been modified."},
+	{"slab", "slab_cache", "STACK", "Memory used by the kernel (major users are caches like inode, dentry, etc)."},
+	{"shmem", "shmem", "STACK", "Shared Memory (SYSV SHM segments, tmpfs)."},
+	{"cached", "cache", "STACK", "Parked file data (file content) cache."},
+	{"buffers", "buffers", "STACK", "Block device (e.g. harddisk) cache. Also where \"dirty\" blocks are stored until written."},
+	{"free", "unused", "STACK", "Wasted memory. Memory that is not used for anything at all."},
+	{"swap", "swap", "STACK", "Swap space used."},
+	{"vmalloc_used", "vmalloc_used", "LINE2", "'VMalloc' (kernel) memory used"},
+	{"committed", "committed", "LINE2", "The amount of memory allocated to programs. Overcommitting is normal, but may indicate memory leaks."},
+	{"mapped", "mapped", "LINE2", "All mmap()ed pages."},
+	{"active", "active", "LINE2", "Memory recently used. Not reclaimed unless absolutely necessary."},
+	{"inactive", "inactive", "LINE2", "Memory not currently used."},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "memory",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("meminfo")) },
+		config:   memoryConfig,
+		fetch:    memoryFetch,
+	})
+}
+
+func memoryConfig(req *pluginRequest) (string, error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", meminfo["MemTotal"])
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_title Memory usage\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows what the machine uses memory for.\n")
+
+	order := make([]string, 0, len(memoryFields))
+	for _, field := range memoryFields {
+		order = append(order, field.name)
+	}
+	fmt.Fprintf(&b, "graph_order %s\n", strings.Join(order, " "))
+
+	for _, field := range memoryFields {
+		fmt.Fprintf(&b, "%s.label %s\n", field.name, field.label)
+		fmt.Fprintf(&b, "%s.draw %s\n", field.name, field.draw)
+		fmt.Fprintf(&b, "%s.info %s\n", field.name, field.info)
+	}
+
+	return b.String(), nil
+}
+
+func memoryFetch(req *pluginRequest) (string, error) {
+	m, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+
+	// The page cache figure includes tmpfs, which is already shown as shmem
+	cached := m["Cached"]
+	if cached >= m["Shmem"] {
+		cached -= m["Shmem"]
+	}
+
+	used := m["MemFree"] + m["Buffers"] + m["Cached"] + m["Slab"] + m["PageTables"] + m["SwapCached"]
+	var apps uint64
+	if m["MemTotal"] > used {
+		apps = m["MemTotal"] - used
+	}
+
+	values := map[string]uint64{
+		"apps":         apps,
+		"page_tables":  m["PageTables"],
+		"swap_cache":   m["SwapCached"],
+		"slab":         m["Slab"],
+		"shmem":        m["Shmem"],
+		"cached":       cached,
+		"buffers":      m["Buffers"],
+		"free":         m["MemFree"],
+		"swap":         m["SwapTotal"] - m["SwapFree"],
+		"vmalloc_used": m["VmallocUsed"],
+		"committed":    m["Committed_AS"],
+		"mapped":       m["Mapped"],
+		"active":       m["Active"],
+		"inactive":     m["Inactive"],
+	}
+
+	var b strings.Builder
+	for _, field := range memoryFields {
+		fmt.Fprintf(&b, "%s.value %d\n", field.name, values[field.name])
+	}
+
+	return b.String(), nil
+}
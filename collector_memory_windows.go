@@ -0,0 +1,86 @@
+//go:build windows && (!minimal || collector_memory)
+// +build windows
+// +build !minimal collector_memory
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// memoryStatusEx is MEMORYSTATUSEX
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "memory",
+		config: memoryConfig,
+		fetch:  memoryFetch,
+	})
+}
+
+func readMemoryStatus() (*memoryStatusEx, error) {
+	status := &memoryStatusEx{}
+	status.Length = uint32(unsafe.Sizeof(*status))
+	if ok, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(status))); ok == 0 {
+		return nil, fmt.Errorf("GlobalMemoryStatusEx failed: %w", err)
+	}
+	return status, nil
+}
+
+func memoryConfig(req *pluginRequest) (string, error) {
+	status, err := readMemoryStatus()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Memory usage\n")
+	b.WriteString("graph_order apps free\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", status.TotalPhys)
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows what the machine uses memory for.\n")
+	b.WriteString("apps.label apps\n")
+	b.WriteString("apps.draw AREA\n")
+	b.WriteString("apps.info Memory in use, not counting the standby list that Windows frees on demand.\n")
+	b.WriteString("free.label unused\n")
+	b.WriteString("free.draw STACK\n")
+	b.WriteString("free.info Memory available to programs without paging, including the standby list.\n")
+	b.WriteString("committed.label committed\n")
+	b.WriteString("committed.draw LINE2\n")
+	b.WriteString("committed.info The commit charge, memory promised to programs and backed by RAM or the page file.\n")
+	b.WriteString("commit_limit.label commit_limit\n")
+	b.WriteString("commit_limit.draw LINE2\n")
+	b.WriteString("commit_limit.info The most memory that can be committed without growing the page file.\n")
+	req.printThresholds(&b, "committed", "", "")
+
+	return b.String(), nil
+}
+
+func memoryFetch(req *pluginRequest) (string, error) {
+	status, err := readMemoryStatus()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "apps.value %d\n", status.TotalPhys-status.AvailPhys)
+	fmt.Fprintf(&b, "free.value %d\n", status.AvailPhys)
+	fmt.Fprintf(&b, "committed.value %d\n", status.TotalPageFile-status.AvailPageFile)
+	fmt.Fprintf(&b, "commit_limit.value %d\n", status.TotalPageFile)
+
+	return b.String(), nil
+}
@@ -0,0 +1,205 @@
+//go:build !minimal || collector_mongodb
+// +build !minimal collector_mongodb
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	mongodbTimeout    = 10 * time.Second
+	mongodbDefaultURI = "mongodb://127.0.0.1:27017"
+)
+
+var mongodbOpcounters = []string{"insert", "query", "update", "delete", "getmore", "command"}
+
+type mongodbStatus struct {
+	server bson.M
+	// lag is how far this member is behind the primary, "U" outside of
+	// a replica set or on the primary itself
+	lag string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "mongodb",
+		autoconf: mongodbAutoconf,
+		config:   mongodbConfig,
+		fetch:    mongodbFetch,
+	})
+}
+
+// mongodbAutoconf only checks that something listens on the configured
+// hosts, as the driver would keep trying to select a server until the
+// full timeout and hold up listing the plugins.
+func mongodbAutoconf(req *pluginRequest) bool {
+	opts := options.Client().ApplyURI(req.getenv("uri", mongodbDefaultURI))
+	for _, host := range opts.Hosts {
+		network := "tcp"
+		if strings.HasSuffix(host, ".sock") {
+			network = "unix"
+		}
+		if conn, err := net.DialTimeout(network, host, time.Second); err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// mongodbNumber formats a numeric BSON value, which depending on size and
+// server version comes as int32, int64 or double.
+func mongodbNumber(value interface{}) string {
+	switch v := value.(type) {
+	case int32, int64:
+		return fmt.Sprint(v)
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return "U"
+}
+
+// mongodbPath looks up a value in nested documents
+func mongodbPath(doc bson.M, path ...string) interface{} {
+	var value interface{} = doc
+	for _, key := range path {
+		m, ok := value.(bson.M)
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+// readMongodbStatus runs serverStatus, and replSetGetStatus for members of
+// a replica set, against the server at env.uri.
+func readMongodbStatus(req *pluginRequest) (*mongodbStatus, error) {
+	ctx, cancel := context.WithTimeout(req.ctx, mongodbTimeout)
+	defer cancel()
+
+	opts := options.Client().
+		ApplyURI(req.getenv("uri", mongodbDefaultURI)).
+		SetDirect(true).
+		SetServerSelectionTimeout(mongodbTimeout)
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to mongodb: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	admin := client.Database("admin")
+	status := &mongodbStatus{lag: "U"}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status.server); err != nil {
+		return nil, fmt.Errorf("serverStatus failed: %w", err)
+	}
+
+	if mongodbPath(status.server, "repl") == nil {
+		return status, nil
+	}
+
+	var replSet struct {
+		Members []struct {
+			StateStr   string    `bson:"stateStr"`
+			OptimeDate time.Time `bson:"optimeDate"`
+			Self       bool      `bson:"self"`
+		} `bson:"members"`
+	}
+	if err := admin.RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&replSet); err != nil {
+		return status, nil
+	}
+
+	var primary, self time.Time
+	for _, member := range replSet.Members {
+		if member.StateStr == "PRIMARY" {
+			primary = member.OptimeDate
+		}
+		if member.Self {
+			self = member.OptimeDate
+		}
+	}
+	if !primary.IsZero() && !self.IsZero() {
+		status.lag = fmt.Sprintf("%.0f", primary.Sub(self).Seconds())
+	}
+	return status, nil
+}
+
+func mongodbConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph mongodb_ops\n")
+	b.WriteString("graph_title MongoDB operations\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel operations per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	for _, op := range mongodbOpcounters {
+		fmt.Fprintf(&b, "%s.label %s\n", op, op)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", op)
+		fmt.Fprintf(&b, "%s.min 0\n", op)
+	}
+
+	b.WriteString("multigraph mongodb_connections\n")
+	b.WriteString("graph_title MongoDB connections\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel connections\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("current.label current\n")
+	b.WriteString("available.label available\n")
+	req.printThresholds(&b, "current", "", "")
+
+	b.WriteString("multigraph mongodb_cache\n")
+	b.WriteString("graph_title MongoDB WiredTiger cache\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("used.label used\n")
+	b.WriteString("dirty.label dirty\n")
+	b.WriteString("max.label configured size\n")
+
+	b.WriteString("multigraph mongodb_replication_lag\n")
+	b.WriteString("graph_title MongoDB replication lag\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info How far this member's oplog is behind the primary.\n")
+	b.WriteString("lag.label lag\n")
+	req.printThresholds(&b, "lag", "", "")
+
+	return b.String(), nil
+}
+
+func mongodbFetch(req *pluginRequest) (string, error) {
+	status, err := readMongodbStatus(req)
+	if err != nil {
+		return "", err
+	}
+	server := status.server
+
+	var b strings.Builder
+	b.WriteString("multigraph mongodb_ops\n")
+	for _, op := range mongodbOpcounters {
+		fmt.Fprintf(&b, "%s.value %s\n", op, mongodbNumber(mongodbPath(server, "opcounters", op)))
+	}
+
+	b.WriteString("multigraph mongodb_connections\n")
+	fmt.Fprintf(&b, "current.value %s\n", mongodbNumber(mongodbPath(server, "connections", "current")))
+	fmt.Fprintf(&b, "available.value %s\n", mongodbNumber(mongodbPath(server, "connections", "available")))
+
+	b.WriteString("multigraph mongodb_cache\n")
+	fmt.Fprintf(&b, "used.value %s\n", mongodbNumber(mongodbPath(server, "wiredTiger", "cache", "bytes currently in the cache")))
+	fmt.Fprintf(&b, "dirty.value %s\n", mongodbNumber(mongodbPath(server, "wiredTiger", "cache", "tracked dirty bytes in the cache")))
+	fmt.Fprintf(&b, "max.value %s\n", mongodbNumber(mongodbPath(server, "wiredTiger", "cache", "maximum bytes configured")))
+
+	b.WriteString("multigraph mongodb_replication_lag\n")
+	fmt.Fprintf(&b, "lag.value %s\n", status.lag)
+
+	return b.String(), nil
+}
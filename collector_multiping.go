@@ -0,0 +1,247 @@
+//go:build !minimal || collector_multiping
+// +build !minimal collector_multiping
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	multipingDefaultCount   = 3
+	multipingDefaultTimeout = 1 * time.Second
+	multipingInterval       = 200 * time.Millisecond
+	multipingProtocolICMP   = 1
+	multipingProtocolICMPv6 = 58
+)
+
+// multipingResult is the outcome of pinging one host. rtt is the average
+// round trip time in seconds, or negative if no reply came back.
+type multipingResult struct {
+	rtt  float64
+	loss float64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "multiping",
+		autoconf: func(req *pluginRequest) bool {
+			return req.getenv("hosts", "") != ""
+		},
+		config: multipingConfig,
+		fetch:  multipingFetch,
+	})
+}
+
+func multipingHosts(req *pluginRequest) []string {
+	seen := map[string]bool{}
+	var hosts []string
+	for _, host := range strings.Fields(req.getenv("hosts", "")) {
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// multipingListen opens a raw ICMP socket, falling back to an unprivileged
+// ping socket (a UDP socket of protocol ICMP, allowed by
+// net.ipv4.ping_group_range on Linux) when not running as root. It reports
+// whether the fallback was used, as the kernel then owns the echo ID.
+func multipingListen(ipv6 bool) (*icmp.PacketConn, bool, error) {
+	raw, datagram, address := "ip4:icmp", "udp4", "0.0.0.0"
+	if ipv6 {
+		raw, datagram, address = "ip6:ipv6-icmp", "udp6", "::"
+	}
+
+	conn, err := icmp.ListenPacket(raw, address)
+	if err == nil {
+		return conn, false, nil
+	}
+	conn, err = icmp.ListenPacket(datagram, address)
+	if err != nil {
+		return nil, false, err
+	}
+	return conn, true, nil
+}
+
+// multipingHost sends count echo requests to host, one after the other,
+// waiting up to timeout for each reply.
+func multipingHost(host string, count int, timeout time.Duration) multipingResult {
+	failed := multipingResult{rtt: -1, loss: 100}
+
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return failed
+	}
+	isIPv6 := addr.IP.To4() == nil
+
+	conn, datagram, err := multipingListen(isIPv6)
+	if err != nil {
+		return failed
+	}
+	defer conn.Close()
+
+	var target net.Addr = addr
+	if datagram {
+		target = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+
+	var echoType, replyType icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	protocol := multipingProtocolICMP
+	if isIPv6 {
+		echoType, replyType = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+		protocol = multipingProtocolICMPv6
+	}
+	id := os.Getpid() & 0xffff
+
+	var total time.Duration
+	received := 0
+	buffer := make([]byte, 1500)
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			time.Sleep(multipingInterval)
+		}
+
+		message := icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("munin-node")},
+		}
+		packet, err := message.Marshal(nil)
+		if err != nil {
+			return failed
+		}
+
+		sent := time.Now()
+		if _, err := conn.WriteTo(packet, target); err != nil {
+			continue
+		}
+
+		// A raw socket sees every ICMP packet for the host, so skip
+		// anything that isn't the reply to this request
+		conn.SetReadDeadline(sent.Add(timeout))
+		for {
+			n, peer, err := conn.ReadFrom(buffer)
+			if err != nil {
+				break
+			}
+			reply, err := icmp.ParseMessage(protocol, buffer[:n])
+			if err != nil || reply.Type != replyType {
+				continue
+			}
+			echo, ok := reply.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq || (!datagram && echo.ID != id) {
+				continue
+			}
+			if !multipingFrom(peer, addr.IP) {
+				continue
+			}
+			total += time.Since(sent)
+			received++
+			break
+		}
+	}
+
+	if received == 0 {
+		return failed
+	}
+	return multipingResult{
+		rtt:  total.Seconds() / float64(received),
+		loss: float64(count-received) * 100 / float64(count),
+	}
+}
+
+// multipingFrom reports whether a packet came from ip, whichever kind of
+// socket received it
+func multipingFrom(peer net.Addr, ip net.IP) bool {
+	switch peer := peer.(type) {
+	case *net.IPAddr:
+		return peer.IP.Equal(ip)
+	case *net.UDPAddr:
+		return peer.IP.Equal(ip)
+	}
+	return false
+}
+
+func multipingConfig(req *pluginRequest) (string, error) {
+	hosts := multipingHosts(req)
+
+	var b strings.Builder
+	b.WriteString("multigraph multiping\n")
+	b.WriteString("graph_title Ping times\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info Average round trip time of the echo requests answered.\n")
+	for _, host := range hosts {
+		field := cleanFieldName(host) + "_rtt"
+		fmt.Fprintf(&b, "%s.label %s\n", field, host)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph multiping_loss\n")
+	b.WriteString("graph_title Ping packet loss\n")
+	b.WriteString("graph_args --base 1000 -l 0 --upper-limit 100\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category network\n")
+	for _, host := range hosts {
+		field := cleanFieldName(host) + "_loss"
+		fmt.Fprintf(&b, "%s.label %s\n", field, host)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func multipingFetch(req *pluginRequest) (string, error) {
+	hosts := multipingHosts(req)
+
+	count, err := strconv.Atoi(req.getenv("count", strconv.Itoa(multipingDefaultCount)))
+	if err != nil || count < 1 {
+		count = multipingDefaultCount
+	}
+	timeout := multipingDefaultTimeout
+	if seconds, err := strconv.ParseFloat(req.getenv("timeout", ""), 64); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	results := make([]multipingResult, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i] = multipingHost(host, count, timeout)
+		}(i, host)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	b.WriteString("multigraph multiping\n")
+	for i, host := range hosts {
+		rtt := "U"
+		if results[i].rtt >= 0 {
+			rtt = strconv.FormatFloat(results[i].rtt, 'f', 6, 64)
+		}
+		fmt.Fprintf(&b, "%s_rtt.value %s\n", cleanFieldName(host), rtt)
+	}
+
+	b.WriteString("multigraph multiping_loss\n")
+	for i, host := range hosts {
+		fmt.Fprintf(&b, "%s_loss.value %s\n", cleanFieldName(host), strconv.FormatFloat(results[i].loss, 'f', -1, 64))
+	}
+
+	return b.String(), nil
+}
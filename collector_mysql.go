@@ -0,0 +1,161 @@
+//go:build !minimal || collector_mysql
+// +build !minimal collector_mysql
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	mysqlTimeout       = 10 * time.Second
+	mysqlDefaultSocket = "/run/mysqld/mysqld.sock"
+)
+
+// mysqlGraphs follow the stock mysql_* plugins. Fields are lower cased
+// SHOW GLOBAL STATUS variables.
+var mysqlGraphs = []struct {
+	name    string
+	title   string
+	vlabel  string
+	counter bool
+	fields  []string
+	labels  []string
+}{
+	{"mysql_queries", "MySQL queries", "queries per ${graph_period}", true,
+		[]string{"com_select", "com_insert", "com_update", "com_delete", "com_replace", "qcache_hits", "questions"},
+		[]string{"select", "insert", "update", "delete", "replace", "cache hits", "total"}},
+	{"mysql_slowqueries", "MySQL slow queries", "slow queries per ${graph_period}", true,
+		[]string{"slow_queries"},
+		[]string{"slow queries"}},
+	{"mysql_threads", "MySQL threads", "threads", false,
+		[]string{"threads_connected", "threads_running", "threads_cached"},
+		[]string{"connected", "running", "cached"}},
+	{"mysql_connections", "MySQL connections", "connections per ${graph_period}", true,
+		[]string{"connections", "aborted_connects", "aborted_clients"},
+		[]string{"connections", "failed attempts", "aborted clients"}},
+	{"mysql_bytes", "MySQL throughput", "bytes per ${graph_period}", true,
+		[]string{"bytes_received", "bytes_sent"},
+		[]string{"received", "sent"}},
+	{"mysql_innodb_bpool", "InnoDB buffer pool", "pages", false,
+		[]string{"innodb_buffer_pool_pages_total", "innodb_buffer_pool_pages_data", "innodb_buffer_pool_pages_dirty", "innodb_buffer_pool_pages_free"},
+		[]string{"pool size", "database pages", "modified pages", "free pages"}},
+	{"mysql_innodb_io", "InnoDB buffer pool activity", "requests per ${graph_period}", true,
+		[]string{"innodb_buffer_pool_read_requests", "innodb_buffer_pool_reads", "innodb_buffer_pool_write_requests", "innodb_buffer_pool_wait_free"},
+		[]string{"read requests", "disk reads", "write requests", "waits for free pages"}},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "mysql",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readMysqlStatus(req)
+			return err == nil
+		},
+		config: mysqlConfig,
+		fetch:  mysqlFetch,
+	})
+}
+
+// mysqlConnConfig returns the connection settings for env.dsn if set, otherwise for
+// env.user/env.password at env.host (host[:port]) or the local socket.
+func mysqlConnConfig(req *pluginRequest) (*mysql.Config, error) {
+	if dsn := req.getenv("dsn", ""); dsn != "" {
+		return mysql.ParseDSN(dsn)
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = req.getenv("user", "munin")
+	cfg.Passwd = req.getenv("password", "")
+	if host := req.getenv("host", ""); host != "" {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, "3306")
+		}
+		cfg.Net, cfg.Addr = "tcp", host
+	} else {
+		cfg.Net, cfg.Addr = "unix", req.getenv("socket", mysqlDefaultSocket)
+	}
+	return cfg, nil
+}
+
+// readMysqlStatus returns SHOW GLOBAL STATUS with lower cased names
+func readMysqlStatus(req *pluginRequest) (map[string]string, error) {
+	cfg, err := mysqlConnConfig(req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mysql dsn: %w", err)
+	}
+	cfg.Timeout, cfg.ReadTimeout, cfg.WriteTimeout = mysqlTimeout, mysqlTimeout, mysqlTimeout
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(req.ctx, mysqlTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "SHOW GLOBAL STATUS")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query mysql status: %w", err)
+	}
+	defer rows.Close()
+
+	status := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		status[strings.ToLower(name)] = value
+	}
+	return status, rows.Err()
+}
+
+func mysqlConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	for _, graph := range mysqlGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category db\n")
+		for i, field := range graph.fields {
+			fmt.Fprintf(&b, "%s.label %s\n", field, graph.labels[i])
+			if graph.counter {
+				fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+				fmt.Fprintf(&b, "%s.min 0\n", field)
+			}
+			req.printThresholds(&b, field, "", "")
+		}
+	}
+	return b.String(), nil
+}
+
+func mysqlFetch(req *pluginRequest) (string, error) {
+	status, err := readMysqlStatus(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range mysqlGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, field := range graph.fields {
+			value, ok := status[field]
+			if !ok {
+				value = "U"
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", field, value)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,119 @@
+//go:build linux && (!minimal || collector_netstat)
+// +build linux
+// +build !minimal collector_netstat
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// tcpStates maps the hex state codes of /proc/net/tcp to field names
+var tcpStates = []struct {
+	code  string
+	field string
+	label string
+}{
+	{"01", "established", "established"},
+	{"02", "syn_sent", "syn_sent"},
+	{"03", "syn_recv", "syn_recv"},
+	{"04", "fin_wait1", "fin_wait1"},
+	{"05", "fin_wait2", "fin_wait2"},
+	{"06", "time_wait", "time_wait"},
+	{"07", "close", "close"},
+	{"08", "close_wait", "close_wait"},
+	{"09", "last_ack", "last_ack"},
+	{"0A", "listen", "listen"},
+	{"0B", "closing", "closing"},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "netstat",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("net", "tcp")) },
+		config:   netstatConfig,
+		fetch:    netstatFetch,
+	})
+}
+
+// countSocketStates tallies the st column of a /proc/net/{tcp,udp}
+// style table. Missing files (e.g. IPv6 disabled) count as empty.
+func countSocketStates(path string, counts map[string]int) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Skip the header line
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		counts[fields[3]]++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("file read error: %w", err)
+	}
+	return nil
+}
+
+func netstatConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Sockets by state\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel sockets\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info This graph shows the number of TCP sockets in each state and the number of UDP sockets, IPv4 and IPv6 combined.\n")
+
+	for _, state := range tcpStates {
+		fmt.Fprintf(&b, "%s.label %s\n", state.field, state.label)
+		fmt.Fprintf(&b, "%s.min 0\n", state.field)
+		req.printThresholds(&b, state.field, "", "")
+	}
+	b.WriteString("udp.label udp\n")
+	b.WriteString("udp.min 0\n")
+	b.WriteString("udp.info Open UDP sockets\n")
+	req.printThresholds(&b, "udp", "", "")
+
+	return b.String(), nil
+}
+
+func netstatFetch(req *pluginRequest) (string, error) {
+	tcp := make(map[string]int)
+	for _, table := range []string{"tcp", "tcp6"} {
+		if err := countSocketStates(procPath("net", table), tcp); err != nil {
+			return "", err
+		}
+	}
+
+	udp := make(map[string]int)
+	for _, table := range []string{"udp", "udp6"} {
+		if err := countSocketStates(procPath("net", table), udp); err != nil {
+			return "", err
+		}
+	}
+
+	var udpTotal int
+	for _, count := range udp {
+		udpTotal += count
+	}
+
+	var b strings.Builder
+	for _, state := range tcpStates {
+		fmt.Fprintf(&b, "%s.value %d\n", state.field, tcp[state.code])
+	}
+	fmt.Fprintf(&b, "udp.value %d\n", udpTotal)
+
+	return b.String(), nil
+}
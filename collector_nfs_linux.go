@@ -0,0 +1,87 @@
+//go:build linux && (!minimal || collector_nfs)
+// +build linux
+// +build !minimal collector_nfs
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nfs3Procs are the NFSv3 operations in the order of the proc3 line of
+// /proc/net/rpc/nfs and nfsd, leading "null" included
+var nfs3Procs = []string{
+	"null", "getattr", "setattr", "lookup", "access", "readlink", "read", "write",
+	"create", "mkdir", "symlink", "mknod", "remove", "rmdir", "rename", "link",
+	"readdir", "readdirplus", "fsstat", "fsinfo", "pathconf", "commit",
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "nfs_client",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("net", "rpc", "nfs")) },
+		config: func(req *pluginRequest) (string, error) {
+			return nfsConfig(req, "NFS Client")
+		},
+		fetch: func(req *pluginRequest) (string, error) {
+			return nfsFetch(procPath("net", "rpc", "nfs"))
+		},
+	})
+	registerBuiltin(&builtinPlugin{
+		name:     "nfsd",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("net", "rpc", "nfsd")) },
+		config: func(req *pluginRequest) (string, error) {
+			return nfsConfig(req, "NFS Server")
+		},
+		fetch: func(req *pluginRequest) (string, error) {
+			return nfsFetch(procPath("net", "rpc", "nfsd"))
+		},
+	})
+}
+
+func nfsConfig(req *pluginRequest, title string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "graph_title %s\n", title)
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel requests / ${graph_period}\n")
+	b.WriteString("graph_total total\n")
+	b.WriteString("graph_category NFS\n")
+
+	// null is a ping and not graphed by the stock plugins
+	for _, proc := range nfs3Procs[1:] {
+		fmt.Fprintf(&b, "%s.label %s\n", proc, proc)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", proc)
+		fmt.Fprintf(&b, "%s.min 0\n", proc)
+		req.printThresholds(&b, proc, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func nfsFetch(path string) (string, error) {
+	stats, err := readKeyedFields(path)
+	if err != nil {
+		return "", err
+	}
+
+	// proc3 <count> <null> <getattr> ...
+	counts := stats["proc3"]
+	if len(counts) > 0 {
+		counts = counts[1:]
+	}
+
+	var b strings.Builder
+	for i, proc := range nfs3Procs {
+		if i == 0 {
+			continue
+		}
+		value := "U"
+		if i < len(counts) {
+			value = counts[i]
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", proc, value)
+	}
+
+	return b.String(), nil
+}
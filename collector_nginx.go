@@ -0,0 +1,151 @@
+//go:build !minimal || collector_nginx
+// +build !minimal collector_nginx
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nginxTimeout    = 10 * time.Second
+	nginxDefaultURL = "http://localhost/nginx_status"
+)
+
+var (
+	nginxActiveRe   = regexp.MustCompile(`Active connections:\s*(\d+)`)
+	nginxCountersRe = regexp.MustCompile(`\n\s*(\d+)\s+(\d+)\s+(\d+)`)
+	nginxStatesRe   = regexp.MustCompile(`Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+)
+
+type nginxStatus struct {
+	active   uint64
+	accepts  uint64
+	handled  uint64
+	requests uint64
+	reading  uint64
+	writing  uint64
+	waiting  uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "nginx",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readNginxStatus(req)
+			return err == nil
+		},
+		config: nginxConfig,
+		fetch:  nginxFetch,
+	})
+}
+
+// readNginxStatus parses the stub_status page at env.url:
+//
+//	Active connections: 291
+//	server accepts handled requests
+//	 16630948 16630948 31070465
+//	Reading: 6 Writing: 179 Waiting: 106
+func readNginxStatus(req *pluginRequest) (nginxStatus, error) {
+	body, err := fetchURL(req.ctx, nginxTimeout, req.getenv("url", nginxDefaultURL))
+	if err != nil {
+		return nginxStatus{}, fmt.Errorf("unable to read nginx status: %w", err)
+	}
+	page := string(body)
+
+	active := nginxActiveRe.FindStringSubmatch(page)
+	counters := nginxCountersRe.FindStringSubmatch(page)
+	states := nginxStatesRe.FindStringSubmatch(page)
+	if active == nil || counters == nil || states == nil {
+		return nginxStatus{}, fmt.Errorf("unexpected nginx status page")
+	}
+
+	// The regexps only match digits, so parsing can't fail
+	number := func(s string) uint64 {
+		n, _ := strconv.ParseUint(s, 10, 64)
+		return n
+	}
+
+	return nginxStatus{
+		active:   number(active[1]),
+		accepts:  number(counters[1]),
+		handled:  number(counters[2]),
+		requests: number(counters[3]),
+		reading:  number(states[1]),
+		writing:  number(states[2]),
+		waiting:  number(states[3]),
+	}, nil
+}
+
+// The graphs are named and laid out like the stock nginx_request and
+// nginx_status plugins, so existing RRDs carry on.
+func nginxConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph nginx_request\n")
+	b.WriteString("graph_title Nginx requests\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel Requests per ${graph_period}\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("request.label requests\n")
+	b.WriteString("request.type DERIVE\n")
+	b.WriteString("request.min 0\n")
+	b.WriteString("request.draw LINE2\n")
+
+	b.WriteString("multigraph nginx_status\n")
+	b.WriteString("graph_title Nginx status\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel Connections\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("total.label Active connections\n")
+	b.WriteString("total.draw LINE2\n")
+	b.WriteString("reading.label Reading\n")
+	b.WriteString("reading.draw LINE2\n")
+	b.WriteString("writing.label Writing\n")
+	b.WriteString("writing.draw LINE2\n")
+	b.WriteString("waiting.label Waiting\n")
+	b.WriteString("waiting.draw LINE2\n")
+	req.printThresholds(&b, "total", "", "")
+
+	b.WriteString("multigraph nginx_connections\n")
+	b.WriteString("graph_title Nginx accepted connections\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel Connections per ${graph_period}\n")
+	b.WriteString("graph_category webserver\n")
+	b.WriteString("graph_info Dropped connections were accepted but not handled, usually because worker_connections was reached.\n")
+	for _, field := range []string{"accepted", "handled", "dropped"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, field)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+	req.printThresholds(&b, "dropped", "", "")
+
+	return b.String(), nil
+}
+
+func nginxFetch(req *pluginRequest) (string, error) {
+	status, err := readNginxStatus(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph nginx_request\n")
+	fmt.Fprintf(&b, "request.value %d\n", status.requests)
+
+	b.WriteString("multigraph nginx_status\n")
+	fmt.Fprintf(&b, "total.value %d\n", status.active)
+	fmt.Fprintf(&b, "reading.value %d\n", status.reading)
+	fmt.Fprintf(&b, "writing.value %d\n", status.writing)
+	fmt.Fprintf(&b, "waiting.value %d\n", status.waiting)
+
+	b.WriteString("multigraph nginx_connections\n")
+	fmt.Fprintf(&b, "accepted.value %d\n", status.accepts)
+	fmt.Fprintf(&b, "handled.value %d\n", status.handled)
+	fmt.Fprintf(&b, "dropped.value %d\n", status.accepts-status.handled)
+
+	return b.String(), nil
+}
@@ -0,0 +1,197 @@
+//go:build !minimal || collector_nut
+// +build !minimal collector_nut
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nutTimeout     = 10 * time.Second
+	nutDefaultHost = "127.0.0.1:3493"
+)
+
+// nutGraphs maps NUT variables to graphs. limit names the variable holding
+// the UPS's own low mark, used as the default critical threshold.
+var nutGraphs = []struct {
+	name     string
+	variable string
+	suffix   string
+	title    string
+	vlabel   string
+	args     string
+	limit    string
+}{
+	{"nut_charge", "battery.charge", "charge", "UPS battery charge", "%", "--base 1000 -l 0 --upper-limit 100", "battery.charge.low"},
+	{"nut_runtime", "battery.runtime", "runtime", "UPS battery runtime", "seconds", "--base 1000 -l 0", "battery.runtime.low"},
+	{"nut_load", "ups.load", "load", "UPS load", "%", "--base 1000 -l 0", ""},
+	{"nut_voltage", "input.voltage", "voltage", "UPS input voltage", "Volt", "--base 1000", ""},
+}
+
+// nutUPS holds the variables of one UPS
+type nutUPS struct {
+	name string
+	vars map[string]string
+}
+
+func (u *nutUPS) fieldName(suffix string) string {
+	return cleanFieldName(u.name + "_" + suffix)
+}
+
+// value returns a variable, "U" where the driver doesn't report it
+func (u *nutUPS) value(variable string) string {
+	if _, err := strconv.ParseFloat(u.vars[variable], 64); err != nil {
+		return "U"
+	}
+	return u.vars[variable]
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "nut",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readNutUPSes(req)
+			return err == nil
+		},
+		config: nutConfig,
+		fetch:  nutFetch,
+	})
+}
+
+// nutList sends a LIST command to upsd and returns the lines between
+// BEGIN and END with the command's own words stripped, so that "VAR ups
+// battery.charge "100"" comes back as "battery.charge "100"".
+func nutList(r *bufio.Reader, w io.Writer, command string) ([]string, error) {
+	if _, err := fmt.Fprintf(w, "LIST %s\n", command); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "ERR "):
+			return nil, fmt.Errorf("upsd: %s", strings.TrimPrefix(line, "ERR "))
+		case strings.HasPrefix(line, "BEGIN LIST "):
+			continue
+		case strings.HasPrefix(line, "END LIST "):
+			return lines, nil
+		}
+		lines = append(lines, strings.TrimPrefix(line, command+" "))
+	}
+}
+
+// nutSplit splits `name "value"` into its two parts
+func nutSplit(line string) (string, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	value, err := strconv.Unquote(parts[1])
+	if err != nil {
+		value = strings.Trim(parts[1], `"`)
+	}
+	return parts[0], value
+}
+
+// readNutUPSes asks upsd at env.host for the variables of the UPSes in
+// env.ups, or of every UPS it knows about.
+func readNutUPSes(req *pluginRequest) ([]*nutUPS, error) {
+	conn, err := net.DialTimeout("tcp", req.getenv("host", nutDefaultHost), nutTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to upsd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(nutTimeout))
+	reader := bufio.NewReader(conn)
+
+	names := strings.Fields(req.getenv("ups", ""))
+	if len(names) == 0 {
+		lines, err := nutList(reader, conn, "UPS")
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			name, _ := nutSplit(line)
+			names = append(names, name)
+		}
+	}
+
+	var upses []*nutUPS
+	for _, name := range names {
+		lines, err := nutList(reader, conn, "VAR "+name)
+		if err != nil {
+			return nil, err
+		}
+		ups := &nutUPS{name: name, vars: map[string]string{}}
+		for _, line := range lines {
+			variable, value := nutSplit(line)
+			ups.vars[variable] = value
+		}
+		upses = append(upses, ups)
+	}
+
+	fmt.Fprint(conn, "LOGOUT\n")
+	return upses, nil
+}
+
+func nutConfig(req *pluginRequest) (string, error) {
+	upses, err := readNutUPSes(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range nutGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category sensors\n")
+		for _, ups := range upses {
+			field := ups.fieldName(graph.suffix)
+			label := ups.name
+			if model := ups.vars["device.model"]; model != "" {
+				label += " (" + model + ")"
+			}
+			fmt.Fprintf(&b, "%s.label %s\n", field, label)
+
+			critical := ""
+			if graph.limit != "" && ups.value(graph.limit) != "U" {
+				critical = ups.value(graph.limit) + ":"
+			}
+			req.printThresholds(&b, field, "", critical)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func nutFetch(req *pluginRequest) (string, error) {
+	upses, err := readNutUPSes(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range nutGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, ups := range upses {
+			fmt.Fprintf(&b, "%s.value %s\n", ups.fieldName(graph.suffix), ups.value(graph.variable))
+		}
+	}
+
+	return b.String(), nil
+}
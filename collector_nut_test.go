@@ -0,0 +1,83 @@
+//go:build !minimal || collector_nut
+// +build !minimal collector_nut
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNutSplit(t *testing.T) {
+	tests := []struct {
+		line  string
+		name  string
+		value string
+	}{
+		{`battery.charge "100"`, "battery.charge", "100"},
+		{`ups.status "OL CHRG"`, "ups.status", "OL CHRG"},
+		{`ups.mfr "APC \"Smart\""`, "ups.mfr", `APC "Smart"`},
+		{`ups "Back-UPS ES`, "ups", "Back-UPS ES"},
+		{`myups`, "myups", ""},
+	}
+	for _, test := range tests {
+		name, value := nutSplit(test.line)
+		if name != test.name || value != test.value {
+			t.Errorf("nutSplit(%q) = %q, %q, want %q, %q", test.line, name, value, test.name, test.value)
+		}
+	}
+}
+
+func TestNutList(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		reply   string
+		want    []string
+		err     string
+	}{
+		{
+			name:    "ups",
+			command: "UPS",
+			reply:   "BEGIN LIST UPS\r\nUPS myups \"Back-UPS\"\r\nUPS other \"\"\r\nEND LIST UPS\r\n",
+			want:    []string{`myups "Back-UPS"`, `other ""`},
+		},
+		{
+			name:    "var",
+			command: "VAR myups",
+			reply:   "BEGIN LIST VAR myups\nVAR myups battery.charge \"100\"\nEND LIST VAR myups\n",
+			want:    []string{`battery.charge "100"`},
+		},
+		{
+			name:    "error",
+			command: "VAR nope",
+			reply:   "ERR UNKNOWN-UPS\n",
+			err:     "upsd: UNKNOWN-UPS",
+		},
+		{
+			name:    "truncated",
+			command: "UPS",
+			reply:   "BEGIN LIST UPS\nUPS myups \"\"\n",
+			err:     "EOF",
+		},
+	}
+	for _, test := range tests {
+		var sent bytes.Buffer
+		got, err := nutList(bufio.NewReader(strings.NewReader(test.reply)), &sent, test.command)
+		if sent.String() != "LIST "+test.command+"\n" {
+			t.Errorf("%s: nutList sent %q", test.name, sent.String())
+		}
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: nutList error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: nutList = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+//go:build !minimal || collector_nvidia
+// +build !minimal collector_nvidia
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const nvidiaTimeout = 30 * time.Second
+
+// nvidiaQuery are the nvidia-smi --query-gpu properties read, in order
+var nvidiaQuery = []string{
+	"index", "name", "utilization.gpu", "utilization.memory",
+	"memory.used", "memory.total", "temperature.gpu", "power.draw", "power.limit",
+}
+
+// nvidiaGraphs lists what is graphed for every GPU. scale converts the
+// nvidia-smi unit to the graphed one. Only temperatures take thresholds,
+// as env.gpu0_warning would be ambiguous otherwise.
+var nvidiaGraphs = []struct {
+	name     string
+	property string
+	title    string
+	vlabel   string
+	args     string
+	scale    float64
+}{
+	{"nvidia_utilization", "utilization.gpu", "GPU utilization", "%", "--base 1000 -l 0 --upper-limit 100", 1},
+	{"nvidia_memory_utilization", "utilization.memory", "GPU memory controller utilization", "%", "--base 1000 -l 0 --upper-limit 100", 1},
+	{"nvidia_memory", "memory.used", "GPU memory used", "bytes", "--base 1024 -l 0", 1024 * 1024},
+	{"nvidia_temperature", "temperature.gpu", "GPU temperature", "degrees Celsius", "--base 1000", 1},
+	{"nvidia_power", "power.draw", "GPU power draw", "Watt", "--base 1000 -l 0", 1},
+}
+
+// nvidiaGPU holds the query results of one GPU by property
+type nvidiaGPU map[string]string
+
+func (g nvidiaGPU) fieldName() string {
+	return "gpu" + g["index"]
+}
+
+func (g nvidiaGPU) label() string {
+	return fmt.Sprintf("GPU %s (%s)", g["index"], g["name"])
+}
+
+// value returns a property scaled for graphing, "U" where the card doesn't
+// support it
+func (g nvidiaGPU) value(property string, scale float64) string {
+	value, err := strconv.ParseFloat(g[property], 64)
+	if err != nil {
+		return "U"
+	}
+	return strconv.FormatFloat(value*scale, 'f', -1, 64)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "nvidia",
+		autoconf: func(req *pluginRequest) bool {
+			if _, err := readNVML(); err == nil {
+				return true
+			}
+			return commandExists("nvidia-smi")
+		},
+		config: nvidiaConfig,
+		fetch:  nvidiaFetch,
+	})
+}
+
+// readNvidiaGPUs queries the GPUs through NVML where the node is built
+// with it and the driver's library loads, or else with nvidia-smi
+func readNvidiaGPUs(req *pluginRequest) ([]nvidiaGPU, error) {
+	gpus, err := readNVML()
+	if err == nil {
+		return gpus, nil
+	}
+	logger.Debug("NVML unavailable, running nvidia-smi", "error", err)
+
+	output, err := runCommand(req.ctx, nvidiaTimeout, req.getenv("nvidia_smi", "nvidia-smi"),
+		"--query-gpu="+strings.Join(nvidiaQuery, ","), "--format=csv,noheader,nounits")
+	if err != nil {
+		return nil, fmt.Errorf("nvidia-smi failed: %w", err)
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(output)))
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nvidia-smi output: %w", err)
+	}
+
+	for _, record := range records {
+		if len(record) != len(nvidiaQuery) {
+			continue
+		}
+		gpu := make(nvidiaGPU)
+		for i, property := range nvidiaQuery {
+			gpu[property] = strings.TrimSpace(record[i])
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+func nvidiaConfig(req *pluginRequest) (string, error) {
+	gpus, err := readNvidiaGPUs(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range nvidiaGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		fmt.Fprintf(&b, "graph_args %s\n", graph.args)
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category sensors\n")
+		for _, gpu := range gpus {
+			field := gpu.fieldName()
+			fmt.Fprintf(&b, "%s.label %s\n", field, gpu.label())
+
+			// Tell what the card's own limits are where nvidia-smi knows
+			switch graph.property {
+			case "memory.used":
+				if total := gpu.value("memory.total", graph.scale); total != "U" {
+					fmt.Fprintf(&b, "%s.max %s\n", field, total)
+					fmt.Fprintf(&b, "%s.info %s bytes in total\n", field, total)
+				}
+			case "power.draw":
+				if limit := gpu.value("power.limit", graph.scale); limit != "U" {
+					fmt.Fprintf(&b, "%s.info Power limit %s W\n", field, limit)
+				}
+			case "temperature.gpu":
+				req.printThresholds(&b, field, "", "")
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+func nvidiaFetch(req *pluginRequest) (string, error) {
+	gpus, err := readNvidiaGPUs(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range nvidiaGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for _, gpu := range gpus {
+			fmt.Fprintf(&b, "%s.value %s\n", gpu.fieldName(), gpu.value(graph.property, graph.scale))
+		}
+	}
+
+	return b.String(), nil
+}
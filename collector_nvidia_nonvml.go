@@ -0,0 +1,13 @@
+//go:build (!linux || !cgo) && (!minimal || collector_nvidia)
+// +build !linux !cgo
+// +build !minimal collector_nvidia
+
+package main
+
+import "errors"
+
+// readNVML needs cgo to load libnvidia-ml, leaving nvidia-smi to other
+// builds
+func readNVML() ([]nvidiaGPU, error) {
+	return nil, errors.New("built without NVML")
+}
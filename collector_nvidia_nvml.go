@@ -0,0 +1,82 @@
+//go:build linux && cgo && (!minimal || collector_nvidia)
+// +build linux
+// +build cgo
+// +build !minimal collector_nvidia
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// NVML is loaded once, as libnvidia-ml is dlopened by nvml.Init, and left
+// loaded for the life of the node
+var (
+	nvmlOnce sync.Once
+	nvmlErr  error
+)
+
+func initNVML() error {
+	nvmlOnce.Do(func() {
+		// nvml.Init panics rather than failing when the library is missing
+		defer func() {
+			if r := recover(); r != nil {
+				nvmlErr = fmt.Errorf("failed to load NVML: %v", r)
+			}
+		}()
+		if ret := nvml.Init(); ret != nvml.SUCCESS {
+			nvmlErr = fmt.Errorf("failed to initialize NVML: %s", nvml.ErrorString(ret))
+		}
+	})
+	return nvmlErr
+}
+
+// readNVML queries every GPU through NVML, giving properties in the units
+// of nvidia-smi --format=csv,nounits. Properties a card doesn't support are
+// left out and graphed as unknown.
+func readNVML() ([]nvidiaGPU, error) {
+	if err := initNVML(); err != nil {
+		return nil, err
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to count GPUs: %s", nvml.ErrorString(ret))
+	}
+
+	gpus := make([]nvidiaGPU, 0, count)
+	for i := 0; i < count; i++ {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to open GPU %d: %s", i, nvml.ErrorString(ret))
+		}
+
+		gpu := nvidiaGPU{"index": strconv.Itoa(i)}
+		if name, ret := device.GetName(); ret == nvml.SUCCESS {
+			gpu["name"] = name
+		}
+		if utilization, ret := device.GetUtilizationRates(); ret == nvml.SUCCESS {
+			gpu["utilization.gpu"] = strconv.FormatUint(uint64(utilization.Gpu), 10)
+			gpu["utilization.memory"] = strconv.FormatUint(uint64(utilization.Memory), 10)
+		}
+		if memory, ret := device.GetMemoryInfo(); ret == nvml.SUCCESS {
+			gpu["memory.used"] = strconv.FormatFloat(float64(memory.Used)/(1024*1024), 'f', -1, 64)
+			gpu["memory.total"] = strconv.FormatFloat(float64(memory.Total)/(1024*1024), 'f', -1, 64)
+		}
+		if temperature, ret := device.GetTemperature(nvml.TEMPERATURE_GPU); ret == nvml.SUCCESS {
+			gpu["temperature.gpu"] = strconv.FormatUint(uint64(temperature), 10)
+		}
+		if power, ret := device.GetPowerUsage(); ret == nvml.SUCCESS {
+			gpu["power.draw"] = strconv.FormatFloat(float64(power)/1000, 'f', -1, 64)
+		}
+		if limit, ret := device.GetEnforcedPowerLimit(); ret == nvml.SUCCESS {
+			gpu["power.limit"] = strconv.FormatFloat(float64(limit)/1000, 'f', -1, 64)
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
@@ -0,0 +1,65 @@
+//go:build linux && (!minimal || collector_open_files)
+// +build linux
+// +build !minimal collector_open_files
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "open_files",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("sys", "fs", "file-nr")) },
+		config:   openFilesConfig,
+		fetch:    openFilesFetch,
+	})
+}
+
+// readFileNr returns the number of open files and the system limit.
+func readFileNr() (uint64, uint64, error) {
+	values, err := readUintFields(procPath("sys", "fs", "file-nr"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(values) < 3 {
+		return 0, 0, fmt.Errorf("unexpected content in %s", procPath("sys", "fs", "file-nr"))
+	}
+
+	// allocated, free (always 0 since 2.6), max
+	return values[0] - values[1], values[2], nil
+}
+
+func openFilesConfig(req *pluginRequest) (string, error) {
+	_, max, err := readFileNr()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title File table usage\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel number of open files\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph monitors the Linux open files table.\n")
+	b.WriteString("used.label open files\n")
+	b.WriteString("used.info The number of currently open files.\n")
+	warning := percentThreshold(req.getenv("warning_percent", "92"), max)
+	critical := percentThreshold(req.getenv("critical_percent", "98"), max)
+	req.printThresholds(&b, "used", warning, critical)
+	b.WriteString("max.label max open files\n")
+	b.WriteString("max.info The maximum supported number of open files. Tune by modifying /proc/sys/fs/file-max.\n")
+
+	return b.String(), nil
+}
+
+func openFilesFetch(req *pluginRequest) (string, error) {
+	used, max, err := readFileNr()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("used.value %d\nmax.value %d\n", used, max), nil
+}
@@ -0,0 +1,48 @@
+//go:build linux && (!minimal || collector_open_inodes)
+// +build linux
+// +build !minimal collector_open_inodes
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "open_inodes",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("sys", "fs", "inode-nr")) },
+		config:   openInodesConfig,
+		fetch:    openInodesFetch,
+	})
+}
+
+func openInodesConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Inode table usage\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel number of open inodes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph monitors the Linux open inode table.\n")
+	b.WriteString("used.label open inodes\n")
+	b.WriteString("used.info The number of currently open inodes.\n")
+	req.printThresholds(&b, "used", "", "")
+	b.WriteString("max.label inode table size\n")
+	b.WriteString("max.info The size of the system inode table. This is dynamically adjusted by the kernel.\n")
+
+	return b.String(), nil
+}
+
+func openInodesFetch(req *pluginRequest) (string, error) {
+	values, err := readUintFields(procPath("sys", "fs", "inode-nr"))
+	if err != nil {
+		return "", err
+	}
+	if len(values) < 2 {
+		return "", fmt.Errorf("unexpected content in %s", procPath("sys", "fs", "inode-nr"))
+	}
+
+	// nr_inodes, nr_free_inodes
+	return fmt.Sprintf("used.value %d\nmax.value %d\n", values[0]-values[1], values[0]), nil
+}
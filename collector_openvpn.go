@@ -0,0 +1,278 @@
+//go:build !minimal || collector_openvpn
+// +build !minimal collector_openvpn
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const openvpnTimeout = 10 * time.Second
+
+// openvpnStatusFiles are where distribution units tell OpenVPN to write
+// its status file, tried in order when env.status_file is not set
+var openvpnStatusFiles = []string{
+	"/run/openvpn-server/status-*.log",
+	"/run/openvpn/*.status",
+	"/var/log/openvpn/openvpn-status.log",
+	"/var/log/openvpn/status.log",
+	"/etc/openvpn/openvpn-status.log",
+}
+
+// openvpnClient is one client common name, with the traffic of all its
+// connections added up
+type openvpnClient struct {
+	name        string
+	connections int
+	received    uint64
+	sent        uint64
+}
+
+func (c *openvpnClient) fieldName() string {
+	return cleanFieldName(c.name)
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "openvpn",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readOpenvpnClients(req)
+			return err == nil
+		},
+		config: openvpnConfig,
+		fetch:  openvpnFetch,
+	})
+}
+
+// openvpnStatusFile returns env.status_file, or the first status file
+// found in the usual places
+func openvpnStatusFile(req *pluginRequest) string {
+	if path := req.getenv("status_file", ""); path != "" {
+		return path
+	}
+	for _, pattern := range openvpnStatusFiles {
+		if matches, _ := filepath.Glob(pattern); len(matches) > 0 {
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+// openvpnManagementStatus asks the management interface at env.management
+// (host:port, or the path of a unix socket) for its status, logging in
+// with env.password if the interface has one.
+func openvpnManagementStatus(req *pluginRequest) (string, error) {
+	address := req.getenv("management", "")
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+
+	conn, err := net.DialTimeout(network, address, openvpnTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(openvpnTimeout))
+
+	if password := req.getenv("password", ""); password != "" {
+		// The password prompt has no line ending, so don't wait for one
+		prompt := make([]byte, len("ENTER PASSWORD:"))
+		if _, err := io.ReadFull(conn, prompt); err != nil {
+			return "", err
+		}
+		if _, err := fmt.Fprintf(conn, "%s\n", password); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := io.WriteString(conn, "status 2\n"); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case line == "END":
+			io.WriteString(conn, "quit\n")
+			return b.String(), nil
+		case strings.HasPrefix(line, "ERROR:"):
+			return "", fmt.Errorf("openvpn management: %s", line)
+		case strings.HasPrefix(line, ">"), strings.HasPrefix(line, "SUCCESS:"):
+			// Banner, notifications and the login answer
+			continue
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+}
+
+// parseOpenvpnStatus reads any of the three status formats. Versions 2
+// and 3 describe their columns in a HEADER line, version 1 has a CLIENT
+// LIST section with a header of its own.
+func parseOpenvpnStatus(status string) []*openvpnClient {
+	clients := map[string]*openvpnClient{}
+	var header []string
+	inClientList := false
+
+	for _, line := range strings.Split(status, "\n") {
+		line = strings.TrimRight(line, "\r")
+		separator := ","
+		if strings.Contains(line, "\t") {
+			separator = "\t"
+		}
+		columns := strings.Split(line, separator)
+
+		var row []string
+		switch {
+		case columns[0] == "HEADER" && len(columns) > 1 && columns[1] == "CLIENT_LIST":
+			header = columns[2:]
+		case columns[0] == "CLIENT_LIST":
+			row = columns[1:]
+		case line == "OpenVPN CLIENT LIST":
+			inClientList = true
+		case line == "ROUTING TABLE":
+			inClientList = false
+		case inClientList && columns[0] == "Common Name":
+			header = columns
+		case inClientList && header != nil:
+			row = columns
+		}
+		if row == nil || header == nil {
+			continue
+		}
+
+		values := map[string]string{}
+		for i, column := range header {
+			if i < len(row) {
+				values[column] = row[i]
+			}
+		}
+
+		name := values["Common Name"]
+		if name == "" || name == "UNDEF" {
+			continue
+		}
+		client, ok := clients[name]
+		if !ok {
+			client = &openvpnClient{name: name}
+			clients[name] = client
+		}
+		received, _ := strconv.ParseUint(values["Bytes Received"], 10, 64)
+		sent, _ := strconv.ParseUint(values["Bytes Sent"], 10, 64)
+		client.connections++
+		client.received += received
+		client.sent += sent
+	}
+
+	result := make([]*openvpnClient, 0, len(clients))
+	for _, client := range clients {
+		result = append(result, client)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].name < result[j].name })
+	return result
+}
+
+// readOpenvpnClients returns the connected clients, from the management
+// interface if env.management is set and from the status file otherwise
+func readOpenvpnClients(req *pluginRequest) ([]*openvpnClient, error) {
+	if req.getenv("management", "") != "" {
+		status, err := openvpnManagementStatus(req)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read openvpn status: %w", err)
+		}
+		return parseOpenvpnStatus(status), nil
+	}
+
+	path := openvpnStatusFile(req)
+	if path == "" {
+		return nil, fmt.Errorf("no openvpn status file found")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read openvpn status: %w", err)
+	}
+	return parseOpenvpnStatus(string(data)), nil
+}
+
+func openvpnConfig(req *pluginRequest) (string, error) {
+	clients, err := readOpenvpnClients(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph openvpn_clients\n")
+	b.WriteString("graph_title OpenVPN clients\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel clients\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("clients.label connected clients\n")
+	req.printThresholds(&b, "clients", "", "")
+	b.WriteString("connections.label connections\n")
+	b.WriteString("connections.info Clients may be connected more than once with the same certificate.\n")
+
+	b.WriteString("multigraph openvpn_traffic\n")
+	b.WriteString("graph_title OpenVPN traffic per client\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info Traffic of the clients connected when the node was last asked. Counters restart with each connection.\n")
+	for _, client := range clients {
+		field := client.fieldName()
+		fmt.Fprintf(&b, "%s_in.label %s\n", field, client.name)
+		fmt.Fprintf(&b, "%s_in.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_in.min 0\n", field)
+		fmt.Fprintf(&b, "%s_in.graph no\n", field)
+		fmt.Fprintf(&b, "%s_in.cdef %s_in,8,*\n", field, field)
+		fmt.Fprintf(&b, "%s_out.label %s\n", field, client.name)
+		fmt.Fprintf(&b, "%s_out.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_out.min 0\n", field)
+		fmt.Fprintf(&b, "%s_out.negative %s_in\n", field, field)
+		fmt.Fprintf(&b, "%s_out.cdef %s_out,8,*\n", field, field)
+	}
+
+	return b.String(), nil
+}
+
+func openvpnFetch(req *pluginRequest) (string, error) {
+	clients, err := readOpenvpnClients(req)
+	if err != nil {
+		return "", err
+	}
+
+	connections := 0
+	for _, client := range clients {
+		connections += client.connections
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph openvpn_clients\n")
+	fmt.Fprintf(&b, "clients.value %d\n", len(clients))
+	fmt.Fprintf(&b, "connections.value %d\n", connections)
+
+	// The server's "received" is what came in from the client
+	b.WriteString("multigraph openvpn_traffic\n")
+	for _, client := range clients {
+		fmt.Fprintf(&b, "%s_in.value %d\n", client.fieldName(), client.received)
+		fmt.Fprintf(&b, "%s_out.value %d\n", client.fieldName(), client.sent)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,68 @@
+//go:build !minimal || collector_openvpn
+// +build !minimal collector_openvpn
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOpenvpnStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   []*openvpnClient
+	}{
+		{
+			name: "version 1",
+			status: "OpenVPN CLIENT LIST\n" +
+				"Updated,Thu Jun 18 08:12:15 2015\n" +
+				"Common Name,Real Address,Bytes Received,Bytes Sent,Connected Since\n" +
+				"bob,10.0.0.2:51234,1000,2000,Thu Jun 18 04:23:03 2015\n" +
+				"alice,10.0.0.3:51235,300,400,Thu Jun 18 04:23:03 2015\n" +
+				"bob,10.0.0.4:51236,10,20,Thu Jun 18 04:23:03 2015\n" +
+				"ROUTING TABLE\n" +
+				"Virtual Address,Common Name,Real Address,Last Ref\n" +
+				"192.168.1.2,bob,10.0.0.2:51234,Thu Jun 18 08:12:09 2015\n" +
+				"GLOBAL STATS\n" +
+				"END\n",
+			want: []*openvpnClient{
+				{name: "alice", connections: 1, received: 300, sent: 400},
+				{name: "bob", connections: 2, received: 1010, sent: 2020},
+			},
+		},
+		{
+			name: "version 2",
+			status: "TITLE,OpenVPN 2.5.1\r\n" +
+				"TIME,Thu Jun 18 08:12:15 2015,1434615135\r\n" +
+				"HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Virtual IPv6 Address,Bytes Received,Bytes Sent,Connected Since\r\n" +
+				"CLIENT_LIST,carol,10.0.0.5:1194,192.168.1.5,,5000,6000,Thu Jun 18 04:23:03 2015\r\n" +
+				"CLIENT_LIST,UNDEF,10.0.0.6:1194,,,1,1,Thu Jun 18 04:23:03 2015\r\n" +
+				"HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref\r\n" +
+				"ROUTING_TABLE,192.168.1.5,carol,10.0.0.5:1194,Thu Jun 18 08:12:09 2015\r\n" +
+				"END\r\n",
+			want: []*openvpnClient{
+				{name: "carol", connections: 1, received: 5000, sent: 6000},
+			},
+		},
+		{
+			name: "version 3",
+			status: "HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tBytes Received\tBytes Sent\n" +
+				"CLIENT_LIST\tdave\t10.0.0.7:1194\t7\t8\n",
+			want: []*openvpnClient{
+				{name: "dave", connections: 1, received: 7, sent: 8},
+			},
+		},
+		{
+			name:   "no clients",
+			status: "OpenVPN CLIENT LIST\nCommon Name,Real Address,Bytes Received,Bytes Sent,Connected Since\nROUTING TABLE\n",
+			want:   []*openvpnClient{},
+		},
+	}
+	for _, test := range tests {
+		if got := parseOpenvpnStatus(test.status); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseOpenvpnStatus = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
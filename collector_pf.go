@@ -0,0 +1,220 @@
+//go:build (freebsd || openbsd || netbsd) && (!minimal || collector_pf)
+// +build freebsd openbsd netbsd
+// +build !minimal collector_pf
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pfTimeout = 10 * time.Second
+
+var pfStateOps = []string{"searches", "inserts", "removals"}
+
+// pfctl -si lists its counters as "  name   total   rate/s"
+var pfCounterRe = regexp.MustCompile(`^\s+([a-z][a-z -]*[a-z])\s+(\d+)`)
+
+// pfctl -sm prints limits as "states   hard limit   10000"
+var pfStateLimitRe = regexp.MustCompile(`^states\s+hard limit\s+(\d+)`)
+
+// pfStatus is what pfctl -si reports: the state table figures and the
+// counters of the section following it, by name.
+type pfStatus struct {
+	states   map[string]uint64
+	counters []string
+	values   map[string]uint64
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "pf",
+		autoconf: func(req *pluginRequest) bool { return commandExists("pfctl") },
+		config:   pfConfig,
+		fetch:    pfFetch,
+	})
+}
+
+func readPfStatus(req *pluginRequest) (*pfStatus, error) {
+	output, err := runCommand(req.ctx, pfTimeout, req.getenv("pfctl", "pfctl"), "-si")
+	if err != nil {
+		return nil, fmt.Errorf("pfctl -si failed: %w", err)
+	}
+
+	status := &pfStatus{states: map[string]uint64{}, values: map[string]uint64{}}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && line[0] != ' ' {
+			section = strings.Fields(line)[0]
+			continue
+		}
+
+		match := pfCounterRe.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		value, _ := strconv.ParseUint(match[2], 10, 64)
+		switch section {
+		case "State":
+			status.states[match[1]] = value
+		case "Counters":
+			status.counters = append(status.counters, match[1])
+			status.values[match[1]] = value
+		}
+	}
+
+	if _, ok := status.states["current entries"]; !ok {
+		return nil, fmt.Errorf("no state table in pfctl output, is pf running?")
+	}
+	return status, nil
+}
+
+// pfStateLimit returns the states hard limit, 0 if pfctl won't tell
+func pfStateLimit(req *pluginRequest) uint64 {
+	output, err := runCommand(req.ctx, pfTimeout, req.getenv("pfctl", "pfctl"), "-sm")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if match := pfStateLimitRe.FindStringSubmatch(line); match != nil {
+			limit, _ := strconv.ParseUint(match[1], 10, 64)
+			return limit
+		}
+	}
+	return 0
+}
+
+// pflogInterfaces lists the pflog(4) interfaces packets are logged to
+func pflogInterfaces() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, iface := range ifaces {
+		if strings.HasPrefix(iface.Name, "pflog") {
+			names = append(names, iface.Name)
+		}
+	}
+	return names
+}
+
+// pfConfig graphs the state table, the rate of state operations, pf's
+// counters and the packets logged to each pflog interface.
+func pfConfig(req *pluginRequest) (string, error) {
+	status, err := readPfStatus(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph pf_states\n")
+	b.WriteString("graph_title pf state table\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel states\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info This graph shows the entries in the pf state table. New connections are dropped once it is full.\n")
+	b.WriteString("states.label states\n")
+	b.WriteString("states.draw AREA\n")
+	b.WriteString("states.min 0\n")
+	// Limits are configured as a percentage of the states hard limit
+	if limit := pfStateLimit(req); limit > 0 {
+		warning := percentThreshold(req.getenv("warning_percent", "80"), limit)
+		critical := percentThreshold(req.getenv("critical_percent", "90"), limit)
+		req.printThresholds(&b, "states", warning, critical)
+		b.WriteString("limit.label limit\n")
+		b.WriteString("limit.draw LINE2\n")
+		b.WriteString("limit.info The states hard limit\n")
+	}
+
+	b.WriteString("multigraph pf_state_ops\n")
+	b.WriteString("graph_title pf state table operations\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel operations per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	for _, op := range pfStateOps {
+		fmt.Fprintf(&b, "%s.label %s\n", op, op)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", op)
+		fmt.Fprintf(&b, "%s.min 0\n", op)
+	}
+
+	b.WriteString("multigraph pf_counters\n")
+	b.WriteString("graph_title pf counters\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel packets per ${graph_period}\n")
+	b.WriteString("graph_category network\n")
+	b.WriteString("graph_info This graph shows how many packets matched a rule and how many were dropped, by reason.\n")
+	for _, counter := range status.counters {
+		field := cleanFieldName(counter)
+		fmt.Fprintf(&b, "%s.label %s\n", field, counter)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	if ifaces := pflogInterfaces(); len(ifaces) > 0 {
+		b.WriteString("multigraph pf_log\n")
+		b.WriteString("graph_title pf logged packets\n")
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_vlabel packets per ${graph_period}\n")
+		b.WriteString("graph_category network\n")
+		b.WriteString("graph_info This graph shows the packets pf rules with the log option passed to each pflog interface.\n")
+		for _, iface := range ifaces {
+			fmt.Fprintf(&b, "%s.label %s\n", iface, iface)
+			fmt.Fprintf(&b, "%s.type DERIVE\n", iface)
+			fmt.Fprintf(&b, "%s.min 0\n", iface)
+		}
+	}
+
+	return b.String(), nil
+}
+
+func pfFetch(req *pluginRequest) (string, error) {
+	status, err := readPfStatus(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph pf_states\n")
+	fmt.Fprintf(&b, "states.value %d\n", status.states["current entries"])
+	if limit := pfStateLimit(req); limit > 0 {
+		fmt.Fprintf(&b, "limit.value %d\n", limit)
+	}
+
+	b.WriteString("multigraph pf_state_ops\n")
+	for _, op := range pfStateOps {
+		if value, ok := status.states[op]; ok {
+			fmt.Fprintf(&b, "%s.value %d\n", op, value)
+		} else {
+			fmt.Fprintf(&b, "%s.value U\n", op)
+		}
+	}
+
+	b.WriteString("multigraph pf_counters\n")
+	for _, counter := range status.counters {
+		fmt.Fprintf(&b, "%s.value %d\n", cleanFieldName(counter), status.values[counter])
+	}
+
+	if ifaces := pflogInterfaces(); len(ifaces) > 0 {
+		b.WriteString("multigraph pf_log\n")
+		for _, iface := range ifaces {
+			value := "U"
+			if stats, err := linkCounters(iface); err == nil {
+				value = strconv.FormatUint(stats.txPackets, 10)
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", iface, value)
+		}
+	}
+
+	return b.String(), nil
+}
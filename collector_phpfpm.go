@@ -0,0 +1,223 @@
+//go:build !minimal || collector_phpfpm
+// +build !minimal collector_phpfpm
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	phpfpmTimeout        = 10 * time.Second
+	phpfpmDefaultFastCGI = "127.0.0.1:9000"
+	phpfpmDefaultPath    = "/status"
+)
+
+// FastCGI record types and roles, from the FastCGI specification
+const (
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiResponder    = 1
+)
+
+// phpfpmStatus is the JSON status page of a pool
+type phpfpmStatus struct {
+	AcceptedConn    uint64 `json:"accepted conn"`
+	ListenQueue     uint64 `json:"listen queue"`
+	IdleProcesses   uint64 `json:"idle processes"`
+	ActiveProcesses uint64 `json:"active processes"`
+	SlowRequests    uint64 `json:"slow requests"`
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "phpfpm",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readPhpfpmStatus(req)
+			return err == nil
+		},
+		config: phpfpmConfig,
+		fetch:  phpfpmFetch,
+	})
+}
+
+func writeFastCGIRecord(w io.Writer, recordType uint8, content []byte) error {
+	header := []byte{1, recordType, 0, 1, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(header[4:], uint16(len(content)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(content)
+	return err
+}
+
+// fastCGIParams encodes name-value pairs, all short enough for the one
+// byte length form
+func fastCGIParams(params map[string]string) []byte {
+	var b bytes.Buffer
+	for name, value := range params {
+		b.WriteByte(byte(len(name)))
+		b.WriteByte(byte(len(value)))
+		b.WriteString(name)
+		b.WriteString(value)
+	}
+	return b.Bytes()
+}
+
+// fastCGIGet runs one responder request against address ("host:port" or
+// "unix:/path") and returns the body of the response, headers stripped.
+func fastCGIGet(address string, path string, query string) ([]byte, error) {
+	network := "tcp"
+	if strings.HasPrefix(address, "unix:") {
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+	}
+
+	conn, err := net.DialTimeout(network, address, phpfpmTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(phpfpmTimeout))
+
+	params := fastCGIParams(map[string]string{
+		"SCRIPT_NAME":     path,
+		"SCRIPT_FILENAME": path,
+		"REQUEST_URI":     path + "?" + query,
+		"QUERY_STRING":    query,
+		"REQUEST_METHOD":  "GET",
+		"SERVER_PROTOCOL": "HTTP/1.1",
+	})
+
+	w := bufio.NewWriter(conn)
+	writeFastCGIRecord(w, fcgiBeginRequest, []byte{0, fcgiResponder, 0, 0, 0, 0, 0, 0})
+	writeFastCGIRecord(w, fcgiParams, params)
+	writeFastCGIRecord(w, fcgiParams, nil)
+	writeFastCGIRecord(w, fcgiStdin, nil)
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	r := bufio.NewReader(conn)
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		content := make([]byte, int(binary.BigEndian.Uint16(header[4:]))+int(header[6]))
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, err
+		}
+		content = content[:binary.BigEndian.Uint16(header[4:])]
+
+		switch header[1] {
+		case fcgiStdout:
+			stdout.Write(content)
+		case fcgiEndRequest:
+			// php-fpm only sends a Status header for errors
+			response := stdout.Bytes()
+			i := bytes.Index(response, []byte("\r\n\r\n"))
+			if i < 0 {
+				return nil, fmt.Errorf("malformed FastCGI response")
+			}
+			for _, line := range strings.Split(string(response[:i]), "\r\n") {
+				if strings.HasPrefix(line, "Status: ") && !strings.HasPrefix(line, "Status: 200") {
+					return nil, fmt.Errorf("%s returned %s", path, strings.TrimPrefix(line, "Status: "))
+				}
+			}
+			return response[i+4:], nil
+		}
+	}
+}
+
+// readPhpfpmStatus reads the pool status over HTTP if env.url is set,
+// otherwise straight from the pool over FastCGI (env.fastcgi, env.path).
+func readPhpfpmStatus(req *pluginRequest) (phpfpmStatus, error) {
+	var body []byte
+	var err error
+	if url := req.getenv("url", ""); url != "" {
+		body, err = fetchURL(req.ctx, phpfpmTimeout, url)
+	} else {
+		body, err = fastCGIGet(req.getenv("fastcgi", phpfpmDefaultFastCGI), req.getenv("path", phpfpmDefaultPath), "json")
+	}
+	if err != nil {
+		return phpfpmStatus{}, fmt.Errorf("unable to read php-fpm status: %w", err)
+	}
+
+	var status phpfpmStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return phpfpmStatus{}, fmt.Errorf("failed to parse php-fpm status: %w", err)
+	}
+	return status, nil
+}
+
+func phpfpmConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph phpfpm_processes\n")
+	b.WriteString("graph_title PHP-FPM processes\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel processes\n")
+	b.WriteString("graph_category appserver\n")
+	b.WriteString("active.label active\n")
+	b.WriteString("active.draw AREASTACK\n")
+	b.WriteString("idle.label idle\n")
+	b.WriteString("idle.draw AREASTACK\n")
+	req.printThresholds(&b, "active", "", "")
+
+	b.WriteString("multigraph phpfpm_queue\n")
+	b.WriteString("graph_title PHP-FPM listen queue\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel connections\n")
+	b.WriteString("graph_category appserver\n")
+	b.WriteString("graph_info Connections waiting for a free worker. A standing queue means pm.max_children is too low.\n")
+	b.WriteString("queue.label queue\n")
+	req.printThresholds(&b, "queue", "", "")
+
+	b.WriteString("multigraph phpfpm_requests\n")
+	b.WriteString("graph_title PHP-FPM requests\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel requests per ${graph_period}\n")
+	b.WriteString("graph_category appserver\n")
+	b.WriteString("accepted.label accepted\n")
+	b.WriteString("accepted.type DERIVE\n")
+	b.WriteString("accepted.min 0\n")
+	b.WriteString("slow.label slow\n")
+	b.WriteString("slow.type DERIVE\n")
+	b.WriteString("slow.min 0\n")
+	b.WriteString("slow.info Requests that ran longer than request_slowlog_timeout.\n")
+	req.printThresholds(&b, "slow", "", "")
+
+	return b.String(), nil
+}
+
+func phpfpmFetch(req *pluginRequest) (string, error) {
+	status, err := readPhpfpmStatus(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph phpfpm_processes\n")
+	fmt.Fprintf(&b, "active.value %d\n", status.ActiveProcesses)
+	fmt.Fprintf(&b, "idle.value %d\n", status.IdleProcesses)
+
+	b.WriteString("multigraph phpfpm_queue\n")
+	fmt.Fprintf(&b, "queue.value %d\n", status.ListenQueue)
+
+	b.WriteString("multigraph phpfpm_requests\n")
+	fmt.Fprintf(&b, "accepted.value %d\n", status.AcceptedConn)
+	fmt.Fprintf(&b, "slow.value %d\n", status.SlowRequests)
+
+	return b.String(), nil
+}
@@ -0,0 +1,175 @@
+//go:build !minimal || collector_postfix
+// +build !minimal collector_postfix
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	postfixDefaultSpool = "/var/spool/postfix"
+	postfixDefaultLog   = "/var/log/mail.log"
+)
+
+var postfixQueues = []string{"incoming", "active", "deferred", "hold", "maildrop"}
+
+var postfixStatuses = []string{"sent", "deferred", "bounced", "expired", "rejected"}
+
+var postfixStatusRe = regexp.MustCompile(`postfix/.*status=(sent|deferred|bounced|expired)`)
+
+var postfixRejectRe = regexp.MustCompile(`postfix/.*: (NOQUEUE: )?reject: `)
+
+// postfixLog follows the mail log between runs, keeping running totals of
+// delivery statuses for munin to DERIVE rates from. Reading starts at the
+// end of the log, so history isn't counted as one big spike.
+var postfixLog = struct {
+	sync.Mutex
+	path   string
+	info   os.FileInfo
+	offset int64
+	counts map[string]uint64
+}{counts: make(map[string]uint64)}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "postfix",
+		autoconf: func(req *pluginRequest) bool { return fileExists(postfixDefaultSpool) },
+		config:   postfixConfig,
+		fetch:    postfixFetch,
+	})
+}
+
+// countQueue counts the files in a queue directory, which for the larger
+// queues is split into hashed subdirectories.
+func countQueue(dir string) (int, error) {
+	count := 0
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Messages come and go while we walk
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// readPostfixLog reads what was appended to the mail log since the last
+// call and returns the updated totals. A replaced or truncated log, as
+// after rotation, is read from the start.
+func readPostfixLog(path string) (map[string]uint64, error) {
+	postfixLog.Lock()
+	defer postfixLog.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open mail log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case postfixLog.info == nil || postfixLog.path != path:
+		postfixLog.offset = info.Size()
+	case !os.SameFile(info, postfixLog.info) || info.Size() < postfixLog.offset:
+		postfixLog.offset = 0
+	}
+	postfixLog.path, postfixLog.info = path, info
+
+	if _, err := file.Seek(postfixLog.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		// Leave a partly written last line for next time
+		if err != nil {
+			break
+		}
+		postfixLog.offset += int64(len(line))
+
+		if match := postfixStatusRe.FindStringSubmatch(line); match != nil {
+			postfixLog.counts[match[1]]++
+		} else if postfixRejectRe.MatchString(line) {
+			postfixLog.counts["rejected"]++
+		}
+	}
+
+	counts := make(map[string]uint64, len(postfixLog.counts))
+	for status, count := range postfixLog.counts {
+		counts[status] = count
+	}
+	return counts, nil
+}
+
+func postfixConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph postfix_mailqueue\n")
+	b.WriteString("graph_title Postfix mail queues\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages\n")
+	b.WriteString("graph_category mail\n")
+	for _, queue := range postfixQueues {
+		fmt.Fprintf(&b, "%s.label %s\n", queue, queue)
+		req.printThresholds(&b, queue, "", "")
+	}
+
+	b.WriteString("multigraph postfix_deliveries\n")
+	b.WriteString("graph_title Postfix deliveries\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages per ${graph_period}\n")
+	b.WriteString("graph_category mail\n")
+	b.WriteString("graph_info Delivery attempts by outcome, and messages rejected at SMTP time, from the mail log.\n")
+	for _, status := range postfixStatuses {
+		fmt.Fprintf(&b, "%s.label %s\n", status, status)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", status)
+		fmt.Fprintf(&b, "%s.min 0\n", status)
+		req.printThresholds(&b, status, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func postfixFetch(req *pluginRequest) (string, error) {
+	spool := req.getenv("spool", postfixDefaultSpool)
+
+	var b strings.Builder
+	b.WriteString("multigraph postfix_mailqueue\n")
+	for _, queue := range postfixQueues {
+		value := "U"
+		if count, err := countQueue(filepath.Join(spool, queue)); err == nil {
+			value = fmt.Sprint(count)
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", queue, value)
+	}
+
+	b.WriteString("multigraph postfix_deliveries\n")
+	counts, err := readPostfixLog(req.getenv("logfile", postfixDefaultLog))
+	for _, status := range postfixStatuses {
+		if err != nil {
+			fmt.Fprintf(&b, "%s.value U\n", status)
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %d\n", status, counts[status])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,339 @@
+//go:build !minimal || collector_postgres
+// +build !minimal collector_postgres
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	postgresTimeout    = 10 * time.Second
+	postgresDefaultDSN = "host=/run/postgresql user=munin dbname=postgres"
+)
+
+var postgresLockModes = []string{
+	"AccessShareLock", "RowShareLock", "RowExclusiveLock", "ShareUpdateExclusiveLock",
+	"ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock",
+}
+
+type postgresDatabase struct {
+	name       string
+	backends   int64
+	commits    int64
+	rollbacks  int64
+	deadlocks  int64
+	tempBytes  int64
+	blocksRead int64
+	blocksHit  int64
+}
+
+func (d postgresDatabase) fieldName() string {
+	return cleanFieldName(d.name)
+}
+
+type postgresReplica struct {
+	name string
+	lag  string
+}
+
+type postgresStats struct {
+	databases []postgresDatabase
+	locks     map[string]int64
+	waiting   int64
+	bgwriter  [3]int64
+	replicas  []postgresReplica
+	// delay is how far a standby's replay is behind, "U" on a primary
+	delay string
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "postgres",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readPostgresStats(req)
+			return err == nil
+		},
+		config: postgresConfig,
+		fetch:  postgresFetch,
+	})
+}
+
+// readPostgresStats gathers everything in one connection to env.dsn, a
+// libpq style connection string or URL.
+func readPostgresStats(req *pluginRequest) (*postgresStats, error) {
+	ctx, cancel := context.WithTimeout(req.ctx, postgresTimeout)
+	defer cancel()
+
+	conn, err := pgx.Connect(ctx, req.getenv("dsn", postgresDefaultDSN))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to postgres: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	stats := &postgresStats{locks: make(map[string]int64), delay: "U"}
+
+	rows, err := conn.Query(ctx, `SELECT datname, numbackends, xact_commit, xact_rollback,
+		deadlocks, temp_bytes, blks_read, blks_hit
+		FROM pg_stat_database
+		WHERE datname IS NOT NULL AND NOT datname LIKE 'template%'
+		ORDER BY datname`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query pg_stat_database: %w", err)
+	}
+	for rows.Next() {
+		var d postgresDatabase
+		if err := rows.Scan(&d.name, &d.backends, &d.commits, &d.rollbacks,
+			&d.deadlocks, &d.tempBytes, &d.blocksRead, &d.blocksHit); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.databases = append(stats.databases, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn.Query(ctx, "SELECT mode, granted, count(*) FROM pg_locks GROUP BY mode, granted")
+	if err != nil {
+		return nil, fmt.Errorf("unable to query pg_locks: %w", err)
+	}
+	for rows.Next() {
+		var mode string
+		var granted bool
+		var count int64
+		if err := rows.Scan(&mode, &granted, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.locks[mode] += count
+		if !granted {
+			stats.waiting += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// These columns are in pg_stat_bgwriter in every supported version
+	if err := conn.QueryRow(ctx, "SELECT buffers_clean, maxwritten_clean, buffers_alloc FROM pg_stat_bgwriter").
+		Scan(&stats.bgwriter[0], &stats.bgwriter[1], &stats.bgwriter[2]); err != nil {
+		return nil, fmt.Errorf("unable to query pg_stat_bgwriter: %w", err)
+	}
+
+	var standby bool
+	if err := conn.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&standby); err != nil {
+		return nil, err
+	}
+
+	if standby {
+		var delay *float64
+		if err := conn.QueryRow(ctx, "SELECT extract(epoch FROM now() - pg_last_xact_replay_timestamp())::float8").
+			Scan(&delay); err == nil && delay != nil {
+			stats.delay = fmt.Sprintf("%.1f", *delay)
+		}
+		return stats, nil
+	}
+
+	rows, err = conn.Query(ctx, `SELECT coalesce(nullif(application_name, ''), host(client_addr), pid::text),
+		pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)::float8
+		FROM pg_stat_replication ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query pg_stat_replication: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		var lag *float64
+		if err := rows.Scan(&name, &lag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		replica := postgresReplica{name: name, lag: "U"}
+		if lag != nil {
+			replica.lag = fmt.Sprintf("%.0f", *lag)
+		}
+		stats.replicas = append(stats.replicas, replica)
+	}
+	return stats, rows.Err()
+}
+
+func postgresConfig(req *pluginRequest) (string, error) {
+	stats, err := readPostgresStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph postgres_connections\n")
+	b.WriteString("graph_title PostgreSQL connections per database\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel connections\n")
+	b.WriteString("graph_category db\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.label %s\n", d.fieldName(), d.name)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", d.fieldName())
+	}
+
+	b.WriteString("multigraph postgres_transactions\n")
+	b.WriteString("graph_title PostgreSQL transactions per database\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel commits (+) / rollbacks (-) per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	for _, d := range stats.databases {
+		field := d.fieldName()
+		fmt.Fprintf(&b, "%s_rollback.label %s\n", field, d.name)
+		fmt.Fprintf(&b, "%s_rollback.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_rollback.min 0\n", field)
+		fmt.Fprintf(&b, "%s_rollback.graph no\n", field)
+		fmt.Fprintf(&b, "%s_commit.label %s\n", field, d.name)
+		fmt.Fprintf(&b, "%s_commit.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s_commit.min 0\n", field)
+		fmt.Fprintf(&b, "%s_commit.negative %s_rollback\n", field, field)
+	}
+
+	b.WriteString("multigraph postgres_cache\n")
+	b.WriteString("graph_title PostgreSQL buffer cache hit ratio\n")
+	b.WriteString("graph_args --base 1000 -l 0 -u 100\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Share of block reads served from shared buffers since the statistics were reset.\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.label %s\n", d.fieldName(), d.name)
+	}
+
+	b.WriteString("multigraph postgres_deadlocks\n")
+	b.WriteString("graph_title PostgreSQL deadlocks\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel deadlocks per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.label %s\n", d.fieldName(), d.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", d.fieldName())
+		fmt.Fprintf(&b, "%s.min 0\n", d.fieldName())
+	}
+
+	b.WriteString("multigraph postgres_tempbytes\n")
+	b.WriteString("graph_title PostgreSQL temporary file usage\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Data written to temporary files by queries that ran out of work_mem.\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.label %s\n", d.fieldName(), d.name)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", d.fieldName())
+		fmt.Fprintf(&b, "%s.min 0\n", d.fieldName())
+	}
+
+	b.WriteString("multigraph postgres_locks\n")
+	b.WriteString("graph_title PostgreSQL locks\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel locks\n")
+	b.WriteString("graph_category db\n")
+	for _, mode := range postgresLockModes {
+		field := strings.ToLower(mode)
+		fmt.Fprintf(&b, "%s.label %s\n", field, mode)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", field)
+	}
+	b.WriteString("waiting.label waiting\n")
+	b.WriteString("waiting.info Lock requests not granted yet.\n")
+	req.printThresholds(&b, "waiting", "", "")
+
+	b.WriteString("multigraph postgres_bgwriter\n")
+	b.WriteString("graph_title PostgreSQL background writer\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel buffers per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	for _, field := range []string{"buffers_clean", "maxwritten_clean", "buffers_alloc"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, strings.Replace(field, "_", " ", -1))
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	b.WriteString("multigraph postgres_replication\n")
+	b.WriteString("graph_title PostgreSQL replication lag\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info WAL not yet replayed by each standby, as seen from the primary.\n")
+	for _, replica := range stats.replicas {
+		field := cleanFieldName(replica.name)
+		fmt.Fprintf(&b, "%s.label %s\n", field, replica.name)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph postgres_replication_delay\n")
+	b.WriteString("graph_title PostgreSQL standby replay delay\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Age of the last transaction replayed on this standby. Grows on an idle primary too.\n")
+	b.WriteString("delay.label delay\n")
+	req.printThresholds(&b, "delay", "", "")
+
+	return b.String(), nil
+}
+
+func postgresFetch(req *pluginRequest) (string, error) {
+	stats, err := readPostgresStats(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph postgres_connections\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.value %d\n", d.fieldName(), d.backends)
+	}
+
+	b.WriteString("multigraph postgres_transactions\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s_rollback.value %d\n", d.fieldName(), d.rollbacks)
+		fmt.Fprintf(&b, "%s_commit.value %d\n", d.fieldName(), d.commits)
+	}
+
+	b.WriteString("multigraph postgres_cache\n")
+	for _, d := range stats.databases {
+		if d.blocksRead+d.blocksHit == 0 {
+			fmt.Fprintf(&b, "%s.value U\n", d.fieldName())
+			continue
+		}
+		fmt.Fprintf(&b, "%s.value %.2f\n", d.fieldName(), float64(d.blocksHit)*100/float64(d.blocksRead+d.blocksHit))
+	}
+
+	b.WriteString("multigraph postgres_deadlocks\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.value %d\n", d.fieldName(), d.deadlocks)
+	}
+
+	b.WriteString("multigraph postgres_tempbytes\n")
+	for _, d := range stats.databases {
+		fmt.Fprintf(&b, "%s.value %d\n", d.fieldName(), d.tempBytes)
+	}
+
+	b.WriteString("multigraph postgres_locks\n")
+	for _, mode := range postgresLockModes {
+		fmt.Fprintf(&b, "%s.value %d\n", strings.ToLower(mode), stats.locks[mode])
+	}
+	fmt.Fprintf(&b, "waiting.value %d\n", stats.waiting)
+
+	b.WriteString("multigraph postgres_bgwriter\n")
+	fmt.Fprintf(&b, "buffers_clean.value %d\n", stats.bgwriter[0])
+	fmt.Fprintf(&b, "maxwritten_clean.value %d\n", stats.bgwriter[1])
+	fmt.Fprintf(&b, "buffers_alloc.value %d\n", stats.bgwriter[2])
+
+	b.WriteString("multigraph postgres_replication\n")
+	for _, replica := range stats.replicas {
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(replica.name), replica.lag)
+	}
+
+	b.WriteString("multigraph postgres_replication_delay\n")
+	fmt.Fprintf(&b, "delay.value %s\n", stats.delay)
+
+	return b.String(), nil
+}
@@ -0,0 +1,95 @@
+//go:build linux && (!minimal || collector_processes)
+// +build linux
+// +build !minimal collector_processes
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// processStates follow the stock processes plugin, keyed by the state
+// letter of /proc/<pid>/stat
+var processStates = []struct {
+	state  byte
+	field  string
+	draw   string
+	colour string
+	info   string
+}{
+	{'S', "sleeping", "AREA", "0022ff", "The number of sleeping processes."},
+	{'I', "idle", "STACK", "4169e1", "The number of idle kernel threads (>= 4.2 kernels only)."},
+	{'T', "stopped", "STACK", "cc0000", "The number of stopped or traced processes."},
+	{'Z', "zombie", "STACK", "990000", "The number of defunct (zombie) processes (process terminated and parent not waiting)."},
+	{'X', "dead", "STACK", "ff0000", "The number of dead processes."},
+	{'W', "paging", "STACK", "00aaaa", "The number of paging processes (<2.6 kernels only)."},
+	{'D', "uninterruptible", "STACK", "ffa500", "The number of uninterruptible processes (usually IO)."},
+	{'R', "runnable", "STACK", "22ff22", "The number of runnable processes (on the run queue)."},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "processes",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("self", "stat")) },
+		config:   processesConfig,
+		fetch:    processesFetch,
+	})
+}
+
+func countProcessStates() (map[byte]int, int, error) {
+	states := make(map[byte]int)
+	total := 0
+	err := walkProcesses(func(fields []string) {
+		states[fields[0][0]]++
+		total++
+	})
+	return states, total, err
+}
+
+func processesConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Processes\n")
+	b.WriteString("graph_info This graph shows the number of processes\n")
+	b.WriteString("graph_category processes\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel Number of processes\n")
+
+	order := make([]string, 0, len(processStates)+1)
+	for _, state := range processStates {
+		order = append(order, state.field)
+	}
+	order = append(order, "processes")
+	fmt.Fprintf(&b, "graph_order %s\n", strings.Join(order, " "))
+
+	for _, state := range processStates {
+		fmt.Fprintf(&b, "%s.label %s\n", state.field, state.field)
+		fmt.Fprintf(&b, "%s.draw %s\n", state.field, state.draw)
+		fmt.Fprintf(&b, "%s.colour %s\n", state.field, state.colour)
+		fmt.Fprintf(&b, "%s.info %s\n", state.field, state.info)
+		req.printThresholds(&b, state.field, "", "")
+	}
+
+	b.WriteString("processes.label total\n")
+	b.WriteString("processes.draw LINE1\n")
+	b.WriteString("processes.colour c0c0c0\n")
+	b.WriteString("processes.info The total number of processes.\n")
+	req.printThresholds(&b, "processes", "", "")
+
+	return b.String(), nil
+}
+
+func processesFetch(req *pluginRequest) (string, error) {
+	states, total, err := countProcessStates()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, state := range processStates {
+		fmt.Fprintf(&b, "%s.value %d\n", state.field, states[state.state])
+	}
+	fmt.Fprintf(&b, "processes.value %d\n", total)
+
+	return b.String(), nil
+}
@@ -0,0 +1,225 @@
+//go:build !minimal || collector_rabbitmq
+// +build !minimal collector_rabbitmq
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	rabbitmqTimeout    = 10 * time.Second
+	rabbitmqDefaultURL = "http://localhost:15672"
+)
+
+type rabbitmqMessageStats struct {
+	Publish    uint64 `json:"publish"`
+	DeliverGet uint64 `json:"deliver_get"`
+	Ack        uint64 `json:"ack"`
+}
+
+type rabbitmqOverview struct {
+	ObjectTotals struct {
+		Connections int `json:"connections"`
+		Channels    int `json:"channels"`
+		Queues      int `json:"queues"`
+		Consumers   int `json:"consumers"`
+	} `json:"object_totals"`
+	MessageStats rabbitmqMessageStats `json:"message_stats"`
+}
+
+type rabbitmqQueue struct {
+	Name         string               `json:"name"`
+	Vhost        string               `json:"vhost"`
+	Ready        uint64               `json:"messages_ready"`
+	Unacked      uint64               `json:"messages_unacknowledged"`
+	Consumers    int                  `json:"consumers"`
+	MessageStats rabbitmqMessageStats `json:"message_stats"`
+}
+
+// label names queues outside the default vhost as vhost/queue
+func (q rabbitmqQueue) label() string {
+	if q.Vhost == "/" {
+		return q.Name
+	}
+	return q.Vhost + "/" + q.Name
+}
+
+func (q rabbitmqQueue) fieldName() string {
+	return cleanFieldName(q.label())
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "rabbitmq",
+		autoconf: func(req *pluginRequest) bool {
+			var overview rabbitmqOverview
+			return rabbitmqGet(req, "/api/overview", &overview) == nil
+		},
+		config: rabbitmqConfig,
+		fetch:  rabbitmqFetch,
+	})
+}
+
+// rabbitmqGet decodes a management API answer, logging in as env.user and
+// env.password (guest/guest by default, which only works from localhost).
+func rabbitmqGet(req *pluginRequest, path string, result interface{}) error {
+	url := strings.TrimSuffix(req.getenv("url", rabbitmqDefaultURL), "/") + path
+	request, err := http.NewRequestWithContext(req.ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(req.getenv("user", "guest"), req.getenv("password", "guest"))
+
+	client := &http.Client{Timeout: rabbitmqTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// rabbitmqQueues returns the queues whose vhost/name label matches the
+// regular expression in env.queues, all of them if it's not set.
+func rabbitmqQueues(req *pluginRequest) ([]rabbitmqQueue, error) {
+	var pattern *regexp.Regexp
+	if queues := req.getenv("queues", ""); queues != "" {
+		var err error
+		if pattern, err = regexp.Compile(queues); err != nil {
+			return nil, fmt.Errorf("invalid queues pattern: %w", err)
+		}
+	}
+
+	var all []rabbitmqQueue
+	if err := rabbitmqGet(req, "/api/queues?columns=name,vhost,messages_ready,messages_unacknowledged,consumers,message_stats", &all); err != nil {
+		return nil, fmt.Errorf("unable to list queues: %w", err)
+	}
+
+	var queues []rabbitmqQueue
+	for _, queue := range all {
+		if pattern == nil || pattern.MatchString(queue.label()) {
+			queues = append(queues, queue)
+		}
+	}
+	return queues, nil
+}
+
+func rabbitmqConfig(req *pluginRequest) (string, error) {
+	queues, err := rabbitmqQueues(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph rabbitmq_objects\n")
+	b.WriteString("graph_title RabbitMQ connections and channels\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel count\n")
+	b.WriteString("graph_category messaging\n")
+	for _, field := range []string{"connections", "channels", "queues", "consumers"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, field)
+		req.printThresholds(&b, field, "", "")
+	}
+
+	b.WriteString("multigraph rabbitmq_messages\n")
+	b.WriteString("graph_title RabbitMQ message rates\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages per ${graph_period}\n")
+	b.WriteString("graph_category messaging\n")
+	for _, field := range []string{"publish", "deliver", "ack"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, field)
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+
+	b.WriteString("multigraph rabbitmq_queue_depth\n")
+	b.WriteString("graph_title RabbitMQ queue depth\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages\n")
+	b.WriteString("graph_category messaging\n")
+	b.WriteString("graph_info Messages waiting in each queue, ready and unacknowledged.\n")
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "%s.label %s\n", queue.fieldName(), queue.label())
+	}
+
+	// Limits go on the per-queue graphs, where env.ready_warning means the
+	// same thing for every queue
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "multigraph rabbitmq_queue_depth.%s\n", queue.fieldName())
+		fmt.Fprintf(&b, "graph_title RabbitMQ queue %s\n", queue.label())
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_vlabel messages\n")
+		b.WriteString("graph_category messaging\n")
+		b.WriteString("ready.label ready\n")
+		b.WriteString("ready.draw AREASTACK\n")
+		b.WriteString("unacked.label unacknowledged\n")
+		b.WriteString("unacked.draw AREASTACK\n")
+		b.WriteString("consumers.label consumers\n")
+		req.printThresholds(&b, "ready", "", "")
+	}
+
+	b.WriteString("multigraph rabbitmq_queue_rates\n")
+	b.WriteString("graph_title RabbitMQ queue publish rates\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel messages per ${graph_period}\n")
+	b.WriteString("graph_category messaging\n")
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "%s.label %s\n", queue.fieldName(), queue.label())
+		fmt.Fprintf(&b, "%s.type DERIVE\n", queue.fieldName())
+		fmt.Fprintf(&b, "%s.min 0\n", queue.fieldName())
+	}
+
+	return b.String(), nil
+}
+
+func rabbitmqFetch(req *pluginRequest) (string, error) {
+	var overview rabbitmqOverview
+	if err := rabbitmqGet(req, "/api/overview", &overview); err != nil {
+		return "", fmt.Errorf("unable to read overview: %w", err)
+	}
+	queues, err := rabbitmqQueues(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph rabbitmq_objects\n")
+	fmt.Fprintf(&b, "connections.value %d\n", overview.ObjectTotals.Connections)
+	fmt.Fprintf(&b, "channels.value %d\n", overview.ObjectTotals.Channels)
+	fmt.Fprintf(&b, "queues.value %d\n", overview.ObjectTotals.Queues)
+	fmt.Fprintf(&b, "consumers.value %d\n", overview.ObjectTotals.Consumers)
+
+	b.WriteString("multigraph rabbitmq_messages\n")
+	fmt.Fprintf(&b, "publish.value %d\n", overview.MessageStats.Publish)
+	fmt.Fprintf(&b, "deliver.value %d\n", overview.MessageStats.DeliverGet)
+	fmt.Fprintf(&b, "ack.value %d\n", overview.MessageStats.Ack)
+
+	b.WriteString("multigraph rabbitmq_queue_depth\n")
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "%s.value %d\n", queue.fieldName(), queue.Ready+queue.Unacked)
+	}
+
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "multigraph rabbitmq_queue_depth.%s\n", queue.fieldName())
+		fmt.Fprintf(&b, "ready.value %d\n", queue.Ready)
+		fmt.Fprintf(&b, "unacked.value %d\n", queue.Unacked)
+		fmt.Fprintf(&b, "consumers.value %d\n", queue.Consumers)
+	}
+
+	b.WriteString("multigraph rabbitmq_queue_rates\n")
+	for _, queue := range queues {
+		fmt.Fprintf(&b, "%s.value %d\n", queue.fieldName(), queue.MessageStats.Publish)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,259 @@
+//go:build !minimal || collector_redis
+// +build !minimal collector_redis
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout     = 10 * time.Second
+	redisDefaultHost = "127.0.0.1:6379"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "redis",
+		autoconf: func(req *pluginRequest) bool {
+			_, err := readRedisInfo(req)
+			return err == nil
+		},
+		config: redisConfig,
+		fetch:  redisFetch,
+	})
+}
+
+// redisCommand sends one command as a RESP array and returns the reply,
+// which for the commands we use is a simple or bulk string.
+func redisCommand(r *bufio.Reader, w io.Writer, args ...string) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return "", err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("redis error: %s", line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return "", fmt.Errorf("unexpected redis reply %q", line)
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data[:length]), nil
+	}
+	return "", fmt.Errorf("unexpected redis reply %q", line)
+}
+
+// readRedisInfo returns the INFO fields of the server at env.host, or at
+// env.socket if set, authenticating with env.password (and env.user for
+// ACL users).
+func readRedisInfo(req *pluginRequest) (map[string]string, error) {
+	network, address := "tcp", req.getenv("host", redisDefaultHost)
+	if socket := req.getenv("socket", ""); socket != "" {
+		network, address = "unix", socket
+	}
+
+	conn, err := net.DialTimeout(network, address, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	r := bufio.NewReader(conn)
+
+	if password := req.getenv("password", ""); password != "" {
+		args := []string{"AUTH", password}
+		if user := req.getenv("user", ""); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := redisCommand(r, conn, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := redisCommand(r, conn, "INFO")
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]string)
+	for _, line := range strings.Split(reply, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+		if len(parts) == 2 {
+			info[parts[0]] = parts[1]
+		}
+	}
+	return info, nil
+}
+
+// redisReplicas returns the replicas a primary lists as
+// "slave0:ip=10.0.0.2,port=6379,state=online,offset=1234,lag=0"
+func redisReplicas(info map[string]string) []map[string]string {
+	var replicas []map[string]string
+	for i := 0; ; i++ {
+		line, ok := info[fmt.Sprintf("slave%d", i)]
+		if !ok {
+			return replicas
+		}
+		replica := make(map[string]string)
+		for _, pair := range strings.Split(line, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) == 2 {
+				replica[parts[0]] = parts[1]
+			}
+		}
+		replicas = append(replicas, replica)
+	}
+}
+
+func redisReplicaName(replica map[string]string) string {
+	return replica["ip"] + ":" + replica["port"]
+}
+
+func redisValue(info map[string]string, key string) string {
+	if value, ok := info[key]; ok {
+		return value
+	}
+	return "U"
+}
+
+func redisConfig(req *pluginRequest) (string, error) {
+	info, err := readRedisInfo(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph redis_memory\n")
+	b.WriteString("graph_title Redis memory usage\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("used_memory.label used\n")
+	b.WriteString("used_memory_rss.label resident\n")
+	b.WriteString("maxmemory.label limit\n")
+	b.WriteString("maxmemory.info Configured maxmemory, 0 meaning no limit.\n")
+	req.printThresholds(&b, "used_memory", "", "")
+
+	b.WriteString("multigraph redis_hitratio\n")
+	b.WriteString("graph_title Redis keyspace hit ratio\n")
+	b.WriteString("graph_args --base 1000 -l 0 -u 100\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Share of key lookups that found the key, over the last interval.\n")
+	b.WriteString("misses.label misses\n")
+	b.WriteString("misses.type DERIVE\n")
+	b.WriteString("misses.min 0\n")
+	b.WriteString("misses.graph no\n")
+	b.WriteString("ratio.label hit ratio\n")
+	b.WriteString("ratio.type DERIVE\n")
+	b.WriteString("ratio.min 0\n")
+	b.WriteString("ratio.cdef ratio,ratio,misses,+,/,100,*\n")
+	req.printThresholds(&b, "ratio", "", "")
+
+	b.WriteString("multigraph redis_clients\n")
+	b.WriteString("graph_title Redis clients\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel clients\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("connected_clients.label connected\n")
+	b.WriteString("blocked_clients.label blocked\n")
+	req.printThresholds(&b, "connected_clients", "", "")
+
+	b.WriteString("multigraph redis_keys\n")
+	b.WriteString("graph_title Redis evicted and expired keys\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel keys per ${graph_period}\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Evictions mean maxmemory was reached and keys were dropped before their time.\n")
+	for _, field := range []string{"evicted_keys", "expired_keys"} {
+		fmt.Fprintf(&b, "%s.label %s\n", field, strings.TrimSuffix(field, "_keys"))
+		fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+		fmt.Fprintf(&b, "%s.min 0\n", field)
+	}
+	req.printThresholds(&b, "evicted_keys", "", "")
+
+	b.WriteString("multigraph redis_replication\n")
+	b.WriteString("graph_title Redis replication\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel bytes\n")
+	b.WriteString("graph_category db\n")
+	b.WriteString("graph_info Replication stream rate, and how far each replica of a primary is behind.\n")
+	b.WriteString("offset.label stream per ${graph_period}\n")
+	b.WriteString("offset.type DERIVE\n")
+	b.WriteString("offset.min 0\n")
+	for _, replica := range redisReplicas(info) {
+		field := cleanFieldName("lag_" + redisReplicaName(replica))
+		fmt.Fprintf(&b, "%s.label %s behind\n", field, redisReplicaName(replica))
+		req.printThresholds(&b, field, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func redisFetch(req *pluginRequest) (string, error) {
+	info, err := readRedisInfo(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph redis_memory\n")
+	for _, field := range []string{"used_memory", "used_memory_rss", "maxmemory"} {
+		fmt.Fprintf(&b, "%s.value %s\n", field, redisValue(info, field))
+	}
+
+	b.WriteString("multigraph redis_hitratio\n")
+	fmt.Fprintf(&b, "misses.value %s\n", redisValue(info, "keyspace_misses"))
+	fmt.Fprintf(&b, "ratio.value %s\n", redisValue(info, "keyspace_hits"))
+
+	b.WriteString("multigraph redis_clients\n")
+	for _, field := range []string{"connected_clients", "blocked_clients"} {
+		fmt.Fprintf(&b, "%s.value %s\n", field, redisValue(info, field))
+	}
+
+	b.WriteString("multigraph redis_keys\n")
+	for _, field := range []string{"evicted_keys", "expired_keys"} {
+		fmt.Fprintf(&b, "%s.value %s\n", field, redisValue(info, field))
+	}
+
+	b.WriteString("multigraph redis_replication\n")
+	fmt.Fprintf(&b, "offset.value %s\n", redisValue(info, "master_repl_offset"))
+	primary, _ := strconv.ParseInt(info["master_repl_offset"], 10, 64)
+	for _, replica := range redisReplicas(info) {
+		lag := "U"
+		if offset, err := strconv.ParseInt(replica["offset"], 10, 64); err == nil {
+			lag = strconv.FormatInt(primary-offset, 10)
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName("lag_"+redisReplicaName(replica)), lag)
+	}
+
+	return b.String(), nil
+}
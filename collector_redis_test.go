@@ -0,0 +1,73 @@
+//go:build !minimal || collector_redis
+// +build !minimal collector_redis
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedisCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+		err   string
+	}{
+		{"simple", "+OK\r\n", "OK", ""},
+		{"bulk", "$12\r\n# Server\r\nab\r\n", "# Server\r\nab", ""},
+		{"empty bulk", "$0\r\n\r\n", "", ""},
+		{"error", "-NOAUTH Authentication required.\r\n", "", "redis error: NOAUTH Authentication required."},
+		{"nil bulk", "$-1\r\n", "", `unexpected redis reply "$-1"`},
+		{"integer", ":1\r\n", "", `unexpected redis reply ":1"`},
+		{"empty", "\r\n", "", "empty redis reply"},
+		{"short bulk", "$10\r\nabc\r\n", "", "unexpected EOF"},
+	}
+	for _, test := range tests {
+		var sent bytes.Buffer
+		got, err := redisCommand(bufio.NewReader(strings.NewReader(test.reply)), &sent, "AUTH", "secret")
+		if want := "*2\r\n$4\r\nAUTH\r\n$6\r\nsecret\r\n"; sent.String() != want {
+			t.Errorf("%s: redisCommand sent %q, want %q", test.name, sent.String(), want)
+		}
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: redisCommand error = %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: redisCommand = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestRedisReplicas(t *testing.T) {
+	tests := []struct {
+		name string
+		info map[string]string
+		want []map[string]string
+	}{
+		{"none", map[string]string{"role": "master", "connected_slaves": "0"}, nil},
+		{
+			name: "two",
+			info: map[string]string{
+				"slave0": "ip=10.0.0.2,port=6379,state=online,offset=1234,lag=0",
+				"slave1": "ip=10.0.0.3,port=6380,state=wait_bgsave,offset=0,lag=1",
+				"slave3": "ip=10.0.0.5,port=6379",
+			},
+			want: []map[string]string{
+				{"ip": "10.0.0.2", "port": "6379", "state": "online", "offset": "1234", "lag": "0"},
+				{"ip": "10.0.0.3", "port": "6380", "state": "wait_bgsave", "offset": "0", "lag": "1"},
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := redisReplicas(test.info); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: redisReplicas = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
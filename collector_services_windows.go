@@ -0,0 +1,132 @@
+//go:build windows && (!minimal || collector_services)
+// +build windows
+// +build !minimal collector_services
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// serviceStates groups the service states into the fields of the graph
+var serviceStates = []struct {
+	name  string
+	info  string
+	draw  string
+	match func(state uint32) bool
+}{
+	{"running", "Services that are running.", "AREA", func(state uint32) bool { return state == windows.SERVICE_RUNNING }},
+	{"stopped", "Services that are stopped.", "STACK", func(state uint32) bool { return state == windows.SERVICE_STOPPED }},
+	{"paused", "Services that are paused.", "STACK", func(state uint32) bool { return state == windows.SERVICE_PAUSED }},
+	{"pending", "Services starting, stopping, pausing or resuming.", "STACK", func(state uint32) bool {
+		return state != windows.SERVICE_RUNNING && state != windows.SERVICE_STOPPED && state != windows.SERVICE_PAUSED
+	}},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "services",
+		config: servicesConfig,
+		fetch:  servicesFetch,
+	})
+}
+
+// readServiceStates returns the current state of every Win32 service by
+// service name.
+func readServiceStates() (map[string]uint32, error) {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_ENUMERATE_SERVICE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the service manager: %w", err)
+	}
+	defer windows.CloseServiceHandle(scm)
+
+	var buffer []byte
+	var needed, count uint32
+	for {
+		var p *byte
+		if len(buffer) > 0 {
+			p = &buffer[0]
+		}
+		err = windows.EnumServicesStatusEx(scm, windows.SC_ENUM_PROCESS_INFO, windows.SERVICE_WIN32, windows.SERVICE_STATE_ALL,
+			p, uint32(len(buffer)), &needed, &count, nil, nil)
+		if err == nil {
+			break
+		}
+		if err != syscall.ERROR_MORE_DATA || needed <= uint32(len(buffer)) {
+			return nil, fmt.Errorf("unable to list services: %w", err)
+		}
+		buffer = make([]byte, needed)
+	}
+
+	states := make(map[string]uint32, count)
+	if count == 0 {
+		return states, nil
+	}
+	for _, service := range unsafe.Slice((*windows.ENUM_SERVICE_STATUS_PROCESS)(unsafe.Pointer(&buffer[0])), count) {
+		states[windows.UTF16PtrToString(service.ServiceName)] = service.ServiceStatusProcess.CurrentState
+	}
+	return states, nil
+}
+
+// servicesConfig graphs services by state, and with env.services a field
+// per named service that is 1 while it runs and critical otherwise.
+func servicesConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Windows services\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel services\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info This graph shows the number of services in each state.\n")
+
+	for _, state := range serviceStates {
+		fmt.Fprintf(&b, "%s.label %s\n", state.name, state.name)
+		fmt.Fprintf(&b, "%s.draw %s\n", state.name, state.draw)
+		fmt.Fprintf(&b, "%s.info %s\n", state.name, state.info)
+	}
+
+	for _, name := range strings.Fields(req.getenv("services", "")) {
+		field := "service_" + cleanFieldName(name)
+		fmt.Fprintf(&b, "%s.label %s\n", field, name)
+		fmt.Fprintf(&b, "%s.draw LINE2\n", field)
+		fmt.Fprintf(&b, "%s.info 1 while the %s service is running.\n", field, name)
+		req.printThresholds(&b, field, "", "1:")
+	}
+
+	return b.String(), nil
+}
+
+func servicesFetch(req *pluginRequest) (string, error) {
+	states, err := readServiceStates()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, state := range serviceStates {
+		count := 0
+		for _, current := range states {
+			if state.match(current) {
+				count++
+			}
+		}
+		fmt.Fprintf(&b, "%s.value %d\n", state.name, count)
+	}
+
+	// Service names are not case sensitive
+	for _, name := range strings.Fields(req.getenv("services", "")) {
+		running := 0
+		for service, current := range states {
+			if strings.EqualFold(service, name) && current == windows.SERVICE_RUNNING {
+				running = 1
+			}
+		}
+		fmt.Fprintf(&b, "service_%s.value %d\n", cleanFieldName(name), running)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,221 @@
+//go:build !minimal || collector_smart
+// +build !minimal collector_smart
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const smartTimeout = 30 * time.Second
+
+// ATA attributes of interest. Wear is reported by vendors under different
+// IDs, all as a normalised "life left" value counting down from 100.
+const (
+	smartAttrReallocated = 5
+	smartAttrPending     = 197
+)
+
+var smartWearAttrs = []int{177, 202, 231, 233}
+
+var smartGraphs = []struct {
+	name   string
+	field  string
+	title  string
+	vlabel string
+	info   string
+}{
+	{"smart_temperature", "temperature", "Disk temperature", "Celsius", "Current drive temperature."},
+	{"smart_reallocated", "reallocated", "Reallocated sectors", "sectors", "Sectors remapped to the spare area after errors. Any growth means the disk is failing."},
+	{"smart_pending", "pending", "Pending sectors", "sectors", "Unstable sectors waiting to be remapped."},
+	{"smart_wear", "wear", "SSD wear level", "% used", "Percentage of the rated endurance used up."},
+}
+
+type smartDevice struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func (d smartDevice) fieldName() string {
+	return cleanFieldName(filepath.Base(d.Name))
+}
+
+type smartAttribute struct {
+	ID    int `json:"id"`
+	Value int `json:"value"`
+	Raw   struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+// smartctlOutput is the subset of `smartctl --json -a` we care about
+type smartctlOutput struct {
+	Temperature *struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	ATAAttributes *struct {
+		Table []smartAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeLog *struct {
+		PercentageUsed int `json:"percentage_used"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "smart",
+		autoconf: func(req *pluginRequest) bool { return commandExists("smartctl") },
+		config:   smartConfig,
+		fetch:    smartFetch,
+	})
+}
+
+// smartDevices returns the devices in env.devices, or whatever
+// `smartctl --scan` finds.
+func smartDevices(req *pluginRequest) ([]smartDevice, error) {
+	if devices := req.getenv("devices", ""); devices != "" {
+		var result []smartDevice
+		for _, name := range strings.Fields(devices) {
+			result = append(result, smartDevice{Name: name})
+		}
+		return result, nil
+	}
+
+	output, err := runCommand(req.ctx, smartTimeout, req.getenv("smartctl", "smartctl"), "--scan", "--json")
+	if output == nil {
+		return nil, fmt.Errorf("device scan failed: %w", err)
+	}
+
+	var scan struct {
+		Devices []smartDevice `json:"devices"`
+	}
+	if err := json.Unmarshal(output, &scan); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl scan: %w", err)
+	}
+	return scan.Devices, nil
+}
+
+// readSmart returns the values of each smartGraphs field for one device,
+// "U" where the device doesn't report it. Disks in standby are not woken
+// up and report nothing.
+func readSmart(req *pluginRequest, device smartDevice) map[string]string {
+	values := map[string]string{}
+	for _, graph := range smartGraphs {
+		values[graph.field] = "U"
+	}
+
+	args := []string{"--json", "-a", "-n", "standby"}
+	if device.Type != "" {
+		args = append(args, "-d", device.Type)
+	}
+	args = append(args, device.Name)
+
+	output, _ := runCommand(req.ctx, smartTimeout, req.getenv("smartctl", "smartctl"), args...)
+
+	var data smartctlOutput
+	if output == nil || json.Unmarshal(output, &data) != nil {
+		return values
+	}
+
+	if data.Temperature != nil {
+		values["temperature"] = strconv.Itoa(data.Temperature.Current)
+	}
+
+	if data.ATAAttributes != nil {
+		for _, attr := range data.ATAAttributes.Table {
+			switch attr.ID {
+			case smartAttrReallocated:
+				values["reallocated"] = strconv.FormatInt(attr.Raw.Value, 10)
+			case smartAttrPending:
+				values["pending"] = strconv.FormatInt(attr.Raw.Value, 10)
+			}
+			for _, id := range smartWearAttrs {
+				if attr.ID == id {
+					values["wear"] = strconv.Itoa(100 - attr.Value)
+				}
+			}
+		}
+	}
+
+	if data.NVMeLog != nil {
+		values["wear"] = strconv.Itoa(data.NVMeLog.PercentageUsed)
+	}
+
+	return values
+}
+
+func smartConfig(req *pluginRequest) (string, error) {
+	devices, err := smartDevices(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, graph := range smartGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		fmt.Fprintf(&b, "graph_title %s\n", graph.title)
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+		b.WriteString("graph_category disk\n")
+		fmt.Fprintf(&b, "graph_info %s\n", graph.info)
+		for _, device := range devices {
+			fmt.Fprintf(&b, "%s.label %s\n", device.fieldName(), device.Name)
+		}
+
+		// Limits go on the per-device graphs, where env.<field>_warning
+		// means the same thing for every disk
+
+		for _, device := range devices {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, device.fieldName())
+			fmt.Fprintf(&b, "graph_title %s of %s\n", graph.title, device.Name)
+			b.WriteString("graph_args --base 1000 -l 0\n")
+			fmt.Fprintf(&b, "graph_vlabel %s\n", graph.vlabel)
+			b.WriteString("graph_category disk\n")
+			fmt.Fprintf(&b, "%s.label %s\n", graph.field, graph.field)
+			fmt.Fprintf(&b, "%s.info %s\n", graph.field, graph.info)
+			req.printThresholds(&b, graph.field, "", "")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func smartFetch(req *pluginRequest) (string, error) {
+	devices, err := smartDevices(req)
+	if err != nil {
+		return "", err
+	}
+
+	// smartctl takes a while per disk, so ask all of them at once
+	values := make([]map[string]string, len(devices))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device smartDevice) {
+			defer wg.Done()
+			values[i] = readSmart(req, device)
+		}(i, device)
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	for _, graph := range smartGraphs {
+		fmt.Fprintf(&b, "multigraph %s\n", graph.name)
+		for i, device := range devices {
+			fmt.Fprintf(&b, "%s.value %s\n", device.fieldName(), values[i][graph.field])
+		}
+
+		for i, device := range devices {
+			fmt.Fprintf(&b, "multigraph %s.%s\n", graph.name, device.fieldName())
+			fmt.Fprintf(&b, "%s.value %s\n", graph.field, values[i][graph.field])
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,379 @@
+//go:build !minimal || collector_snmp
+// +build !minimal collector_snmp
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+const (
+	snmpDefaultTimeout = 5 * time.Second
+	snmpDefaultPort    = 161
+)
+
+const (
+	oidSysUpTime     = ".1.3.6.1.2.1.1.3.0"
+	oidIfDescr       = ".1.3.6.1.2.1.2.2.1.2"
+	oidIfSpeed       = ".1.3.6.1.2.1.2.2.1.5"
+	oidIfOperStatus  = ".1.3.6.1.2.1.2.2.1.8"
+	oidIfInOctets    = ".1.3.6.1.2.1.2.2.1.10"
+	oidIfOutOctets   = ".1.3.6.1.2.1.2.2.1.16"
+	oidIfHCInOctets  = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfHighSpeed   = ".1.3.6.1.2.1.31.1.1.1.15"
+	oidIfAlias       = ".1.3.6.1.2.1.31.1.1.1.18"
+	// UCD-SNMP-MIB laLoad.2, the five minute load average
+	oidLaLoad5 = ".1.3.6.1.4.1.2021.10.1.3.2"
+)
+
+var snmpAuthProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"md5":    gosnmp.MD5,
+	"sha":    gosnmp.SHA,
+	"sha224": gosnmp.SHA224,
+	"sha256": gosnmp.SHA256,
+	"sha384": gosnmp.SHA384,
+	"sha512": gosnmp.SHA512,
+}
+
+var snmpPrivProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"des":    gosnmp.DES,
+	"aes":    gosnmp.AES,
+	"aes192": gosnmp.AES192,
+	"aes256": gosnmp.AES256,
+}
+
+// The snmp_ plugins follow the naming of Munin's snmp__* family: the
+// remote device goes between the prefix and the check, as in
+// snmp_switch1.example.com_if_3. Their graphs are reported under the
+// device as a virtual node.
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "snmp_",
+		wildcard: true,
+		autoconf: func(req *pluginRequest) bool {
+			return len(snmpHosts(req)) > 0
+		},
+		suggest: snmpSuggest,
+		node: func(instance string) string {
+			host, _ := snmpSplitInstance(instance)
+			return host
+		},
+		config: snmpConfig,
+		fetch:  snmpFetch,
+	})
+}
+
+// snmpHosts returns the devices declared in env.hosts of [snmp_*]
+func snmpHosts(req *pluginRequest) []string {
+	return strings.Fields(req.related("snmp_").getenv("hosts", ""))
+}
+
+// snmpSplitInstance splits an instance into the device and the check.
+// Host names can't contain underscores, so the first one ends the host.
+func snmpSplitInstance(instance string) (string, string) {
+	parts := strings.SplitN(instance, "_", 2)
+	if len(parts) < 2 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// snmpClient connects to host with the settings in env.version (1, 2c or
+// 3), env.community, env.port, env.timeout, and for SNMPv3 env.v3username,
+// env.v3authprotocol, env.v3authpassword, env.v3privprotocol and
+// env.v3privpassword, which [snmp_<host>_*] sections can set per device.
+func snmpClient(req *pluginRequest, host string) (*gosnmp.GoSNMP, error) {
+	port, err := strconv.ParseUint(req.getenv("port", strconv.Itoa(snmpDefaultPort)), 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snmp port: %w", err)
+	}
+	timeout := snmpDefaultTimeout
+	if seconds, err := strconv.ParseFloat(req.getenv("timeout", ""), 64); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(port),
+		Community: req.getenv("community", "public"),
+		Timeout:   timeout,
+		Retries:   1,
+		Context:   req.ctx,
+	}
+
+	switch version := req.getenv("version", "2c"); version {
+	case "1":
+		client.Version = gosnmp.Version1
+	case "2", "2c":
+		client.Version = gosnmp.Version2c
+	case "3":
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		params := &gosnmp.UsmSecurityParameters{
+			UserName:               req.getenv("v3username", ""),
+			AuthenticationProtocol: gosnmp.NoAuth,
+			PrivacyProtocol:        gosnmp.NoPriv,
+		}
+		client.MsgFlags = gosnmp.NoAuthNoPriv
+
+		if name := req.getenv("v3authprotocol", ""); name != "" {
+			protocol, ok := snmpAuthProtocols[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown snmp auth protocol %s", name)
+			}
+			params.AuthenticationProtocol = protocol
+			params.AuthenticationPassphrase = req.getenv("v3authpassword", "")
+			client.MsgFlags = gosnmp.AuthNoPriv
+		}
+		if name := req.getenv("v3privprotocol", ""); name != "" {
+			protocol, ok := snmpPrivProtocols[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown snmp privacy protocol %s", name)
+			}
+			params.PrivacyProtocol = protocol
+			params.PrivacyPassphrase = req.getenv("v3privpassword", "")
+			client.MsgFlags = gosnmp.AuthPriv
+		}
+		client.SecurityParameters = params
+	default:
+		return nil, fmt.Errorf("unsupported snmp version %s", version)
+	}
+
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("unable to connect to %s: %w", host, err)
+	}
+	return client, nil
+}
+
+// snmpGet returns the values of oids that the device has, by OID
+func snmpGet(client *gosnmp.GoSNMP, oids ...string) (map[string]gosnmp.SnmpPDU, error) {
+	result, err := client.Get(oids)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]gosnmp.SnmpPDU, len(oids))
+	for _, pdu := range result.Variables {
+		switch pdu.Type {
+		case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+			continue
+		}
+		values[pdu.Name] = pdu
+	}
+	return values, nil
+}
+
+// snmpString returns an OctetString value as text
+func snmpString(pdu gosnmp.SnmpPDU) string {
+	if data, ok := pdu.Value.([]byte); ok {
+		return strings.TrimSpace(string(data))
+	}
+	return fmt.Sprint(pdu.Value)
+}
+
+func snmpNumber(pdu gosnmp.SnmpPDU) *big.Int {
+	return gosnmp.ToBigInt(pdu.Value)
+}
+
+// snmpInterfaceOIDs returns the OIDs of an interface's octet counters,
+// preferring the 64 bit ones, which don't wrap within minutes on fast
+// links. SNMPv1 has no 64 bit counters.
+func snmpInterfaceOIDs(client *gosnmp.GoSNMP, index string) (string, string) {
+	if client.Version != gosnmp.Version1 {
+		in, out := oidIfHCInOctets+"."+index, oidIfHCOutOctets+"."+index
+		if values, err := snmpGet(client, in, out); err == nil && len(values) == 2 {
+			return in, out
+		}
+	}
+	return oidIfInOctets + "." + index, oidIfOutOctets + "." + index
+}
+
+// snmpSuggest lists uptime and, where the device has them, the load
+// average and every interface that is up, for each device in env.hosts.
+func snmpSuggest(req *pluginRequest) ([]string, error) {
+	var instances []string
+	for _, host := range snmpHosts(req) {
+		client, err := snmpClient(req.related("snmp_"+host+"_"), host)
+		if err != nil {
+			continue
+		}
+
+		values, err := snmpGet(client, oidSysUpTime, oidLaLoad5)
+		if err != nil {
+			client.Conn.Close()
+			continue
+		}
+		instances = append(instances, host+"_uptime")
+		if _, ok := values[oidLaLoad5]; ok {
+			instances = append(instances, host+"_load")
+		}
+
+		// GETBULK is SNMPv2 and later
+		walk := client.BulkWalkAll
+		if client.Version == gosnmp.Version1 {
+			walk = client.WalkAll
+		}
+		statuses, _ := walk(oidIfOperStatus)
+		var indexes []int
+		for _, pdu := range statuses {
+			index, err := strconv.Atoi(strings.TrimPrefix(pdu.Name, oidIfOperStatus+"."))
+			if err == nil && snmpNumber(pdu).Int64() == 1 {
+				indexes = append(indexes, index)
+			}
+		}
+		sort.Ints(indexes)
+		for _, index := range indexes {
+			instances = append(instances, fmt.Sprintf("%s_if_%d", host, index))
+		}
+
+		client.Conn.Close()
+	}
+	return instances, nil
+}
+
+func snmpConfig(req *pluginRequest) (string, error) {
+	host, check := snmpSplitInstance(req.instance)
+	client, err := snmpClient(req, host)
+	if err != nil {
+		return "", err
+	}
+	defer client.Conn.Close()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "host_name %s\n", host)
+
+	switch {
+	case check == "uptime":
+		b.WriteString("graph_title Uptime\n")
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_scale no\n")
+		b.WriteString("graph_vlabel uptime in days\n")
+		b.WriteString("graph_category system\n")
+		b.WriteString("uptime.label uptime\n")
+		b.WriteString("uptime.draw AREA\n")
+		req.printThresholds(&b, "uptime", "", "")
+
+	case check == "load":
+		b.WriteString("graph_title Load average\n")
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_scale no\n")
+		b.WriteString("graph_vlabel load\n")
+		b.WriteString("graph_category system\n")
+		b.WriteString("graph_info The five minute load average reported by the device.\n")
+		b.WriteString("load.label load\n")
+		req.printThresholds(&b, "load", "", "")
+
+	case strings.HasPrefix(check, "if_"):
+		index := strings.TrimPrefix(check, "if_")
+		values, err := snmpGet(client, oidIfDescr+"."+index, oidIfAlias+"."+index, oidIfSpeed+"."+index, oidIfHighSpeed+"."+index)
+		if err != nil {
+			return "", err
+		}
+		name, ok := values[oidIfDescr+"."+index]
+		if !ok {
+			return "", fmt.Errorf("no interface %s on %s", index, host)
+		}
+		description := snmpString(name)
+		if alias, ok := values[oidIfAlias+"."+index]; ok && snmpString(alias) != "" {
+			description += " (" + snmpString(alias) + ")"
+		}
+
+		// ifSpeed tops out at 4 Gbit/s, ifHighSpeed is in Mbit/s
+		var speed *big.Int
+		if pdu, ok := values[oidIfHighSpeed+"."+index]; ok && snmpNumber(pdu).Sign() > 0 {
+			speed = new(big.Int).Mul(snmpNumber(pdu), big.NewInt(1000000))
+		} else if pdu, ok := values[oidIfSpeed+"."+index]; ok && snmpNumber(pdu).Sign() > 0 {
+			speed = snmpNumber(pdu)
+		}
+
+		fmt.Fprintf(&b, "graph_title Interface %s traffic\n", description)
+		b.WriteString("graph_order recv send\n")
+		b.WriteString("graph_args --base 1000\n")
+		b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+		b.WriteString("graph_category network\n")
+		fmt.Fprintf(&b, "graph_info Traffic of interface %s (index %s).\n", description, index)
+		for _, field := range []string{"recv", "send"} {
+			fmt.Fprintf(&b, "%s.label bps\n", field)
+			fmt.Fprintf(&b, "%s.type DERIVE\n", field)
+			fmt.Fprintf(&b, "%s.min 0\n", field)
+			fmt.Fprintf(&b, "%s.cdef %s,8,*\n", field, field)
+			if speed != nil {
+				// max is in the unit of the raw counter, bytes
+				fmt.Fprintf(&b, "%s.max %s\n", field, new(big.Int).Div(speed, big.NewInt(8)))
+			}
+			req.printThresholds(&b, field, "", "")
+		}
+		b.WriteString("recv.graph no\n")
+		b.WriteString("send.negative recv\n")
+
+	default:
+		return "", fmt.Errorf("unknown snmp check %s", check)
+	}
+
+	return b.String(), nil
+}
+
+func snmpFetch(req *pluginRequest) (string, error) {
+	host, check := snmpSplitInstance(req.instance)
+	client, err := snmpClient(req, host)
+	if err != nil {
+		return "", err
+	}
+	defer client.Conn.Close()
+
+	var b strings.Builder
+	switch {
+	case check == "uptime":
+		values, err := snmpGet(client, oidSysUpTime)
+		if err != nil {
+			return "", err
+		}
+		uptime := "U"
+		if pdu, ok := values[oidSysUpTime]; ok {
+			// sysUpTime counts hundredths of a second
+			days := float64(snmpNumber(pdu).Int64()) / 100 / 86400
+			uptime = strconv.FormatFloat(days, 'f', 2, 64)
+		}
+		fmt.Fprintf(&b, "uptime.value %s\n", uptime)
+
+	case check == "load":
+		values, err := snmpGet(client, oidLaLoad5)
+		if err != nil {
+			return "", err
+		}
+		load := "U"
+		if pdu, ok := values[oidLaLoad5]; ok {
+			if _, err := strconv.ParseFloat(snmpString(pdu), 64); err == nil {
+				load = snmpString(pdu)
+			}
+		}
+		fmt.Fprintf(&b, "load.value %s\n", load)
+
+	case strings.HasPrefix(check, "if_"):
+		in, out := snmpInterfaceOIDs(client, strings.TrimPrefix(check, "if_"))
+		values, err := snmpGet(client, in, out)
+		if err != nil {
+			return "", err
+		}
+		for field, oid := range map[string]string{"recv": in, "send": out} {
+			value := "U"
+			if pdu, ok := values[oid]; ok {
+				value = snmpNumber(pdu).String()
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", field, value)
+		}
+
+	default:
+		return "", fmt.Errorf("unknown snmp check %s", check)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,81 @@
+//go:build freebsd && (!minimal || collector_swap)
+// +build freebsd
+// +build !minimal collector_swap
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "swap",
+		config: swapConfig,
+		fetch:  swapFetch,
+	})
+}
+
+// swapConfig emits the stock swap graph as the parent graph and adds swap
+// usage as a child graph, like on Linux.
+func swapConfig(req *pluginRequest) (string, error) {
+	usage, err := readSwapUsage()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph swap\n")
+	b.WriteString("graph_title Swap in/out\n")
+	b.WriteString("graph_args -l 0 --base 1000\n")
+	b.WriteString("graph_vlabel pages per ${graph_period} in (-) / out (+)\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("swap_in.label swap\n")
+	b.WriteString("swap_in.type DERIVE\n")
+	b.WriteString("swap_in.max 100000\n")
+	b.WriteString("swap_in.min 0\n")
+	b.WriteString("swap_in.graph no\n")
+	b.WriteString("swap_out.label swap\n")
+	b.WriteString("swap_out.type DERIVE\n")
+	b.WriteString("swap_out.max 100000\n")
+	b.WriteString("swap_out.min 0\n")
+	b.WriteString("swap_out.negative swap_in\n")
+
+	b.WriteString("multigraph swap.usage\n")
+	b.WriteString("graph_title Swap usage\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", usage.total)
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("used.label used\n")
+	b.WriteString("used.draw AREA\n")
+	b.WriteString("used.info Swap space in use.\n")
+	b.WriteString("total.label total\n")
+	b.WriteString("total.draw LINE2\n")
+	b.WriteString("total.info Total swap space.\n")
+
+	return b.String(), nil
+}
+
+func swapFetch(req *pluginRequest) (string, error) {
+	counters, err := sysctlCounters("vm.stats.vm.", "v_swappgsin", "v_swappgsout")
+	if err != nil {
+		return "", err
+	}
+
+	usage, err := readSwapUsage()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph swap\n")
+	fmt.Fprintf(&b, "swap_in.value %d\n", counters["v_swappgsin"])
+	fmt.Fprintf(&b, "swap_out.value %d\n", counters["v_swappgsout"])
+
+	b.WriteString("multigraph swap.usage\n")
+	fmt.Fprintf(&b, "used.value %d\n", usage.used)
+	fmt.Fprintf(&b, "total.value %d\n", usage.total)
+
+	return b.String(), nil
+}
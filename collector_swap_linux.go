@@ -0,0 +1,87 @@
+//go:build linux && (!minimal || collector_swap)
+// +build linux
+// +build !minimal collector_swap
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "swap",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("vmstat")) },
+		config:   swapConfig,
+		fetch:    swapFetch,
+	})
+}
+
+// swapConfig emits the stock swap graph unchanged as the parent graph, so
+// existing RRDs are reused, and adds swap usage as a child graph.
+func swapConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph swap\n")
+	b.WriteString("graph_title Swap in/out\n")
+	b.WriteString("graph_args -l 0 --base 1000\n")
+	b.WriteString("graph_vlabel pages per ${graph_period} in (-) / out (+)\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("swap_in.label swap\n")
+	b.WriteString("swap_in.type DERIVE\n")
+	b.WriteString("swap_in.max 100000\n")
+	b.WriteString("swap_in.min 0\n")
+	b.WriteString("swap_in.graph no\n")
+	b.WriteString("swap_out.label swap\n")
+	b.WriteString("swap_out.type DERIVE\n")
+	b.WriteString("swap_out.max 100000\n")
+	b.WriteString("swap_out.min 0\n")
+	b.WriteString("swap_out.negative swap_in\n")
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+
+	b.WriteString("multigraph swap.usage\n")
+	b.WriteString("graph_title Swap usage\n")
+	fmt.Fprintf(&b, "graph_args --base 1024 -l 0 --upper-limit %d\n", meminfo["SwapTotal"])
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("used.label used\n")
+	b.WriteString("used.draw AREA\n")
+	b.WriteString("used.info Swap space in use.\n")
+	b.WriteString("total.label total\n")
+	b.WriteString("total.draw LINE2\n")
+	b.WriteString("total.info Total swap space.\n")
+
+	return b.String(), nil
+}
+
+func swapFetch(req *pluginRequest) (string, error) {
+	vmstat, err := readKeyedFields(procPath("vmstat"))
+	if err != nil {
+		return "", err
+	}
+
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph swap\n")
+	for _, field := range []struct{ name, key string }{{"swap_in", "pswpin"}, {"swap_out", "pswpout"}} {
+		value := "U"
+		if values := vmstat[field.key]; len(values) > 0 {
+			value = values[0]
+		}
+		fmt.Fprintf(&b, "%s.value %s\n", field.name, value)
+	}
+
+	b.WriteString("multigraph swap.usage\n")
+	fmt.Fprintf(&b, "used.value %d\n", meminfo["SwapTotal"]-meminfo["SwapFree"])
+	fmt.Fprintf(&b, "total.value %d\n", meminfo["SwapTotal"])
+
+	return b.String(), nil
+}
@@ -0,0 +1,143 @@
+//go:build linux && (!minimal || collector_systemd)
+// +build linux
+// +build !minimal collector_systemd
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+const systemdTimeout = 10 * time.Second
+
+var systemdStates = []string{"active", "activating", "deactivating", "inactive", "failed"}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "systemd",
+		autoconf: func(req *pluginRequest) bool { return fileExists("/run/systemd/system") },
+		config:   systemdConfig,
+		fetch:    systemdFetch,
+	})
+}
+
+// countUnitStates counts loaded units by active state, as listed by the
+// manager over D-Bus
+func countUnitStates(ctx context.Context, conn *dbus.Conn) (map[string]int, error) {
+	units, err := conn.ListUnitsContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list systemd units: %w", err)
+	}
+
+	counts := make(map[string]int)
+	for _, unit := range units {
+		counts[unit.ActiveState]++
+	}
+	return counts, nil
+}
+
+// watchedUnitStates returns the active state of each unit in env.units.
+// A name without a type suffix is a service, as with systemctl.
+func watchedUnitStates(ctx context.Context, conn *dbus.Conn, units []string) []string {
+	names := make([]string, len(units))
+	for i, unit := range units {
+		names[i] = unit
+		if !strings.Contains(unit, ".") {
+			names[i] = unit + ".service"
+		}
+	}
+
+	states := make([]string, len(units))
+	for i := range states {
+		states[i] = "unknown"
+	}
+	statuses, err := conn.ListUnitsByNamesContext(ctx, names)
+	if err != nil {
+		logger.Warn("failed to get systemd unit states", "error", err)
+		return states
+	}
+	byName := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		byName[status.Name] = status.ActiveState
+	}
+	for i, name := range names {
+		if state, ok := byName[name]; ok && state != "" {
+			states[i] = state
+		}
+	}
+	return states
+}
+
+func systemdConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph systemd_units\n")
+	b.WriteString("graph_title Systemd units by state\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel units\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_info Number of loaded units in each state.\n")
+	for _, state := range systemdStates {
+		fmt.Fprintf(&b, "%s.label %s\n", state, state)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", state)
+	}
+	req.printThresholds(&b, "failed", "", ":0")
+
+	units := strings.Fields(req.getenv("units", ""))
+	if len(units) > 0 {
+		b.WriteString("multigraph systemd_units.watched\n")
+		b.WriteString("graph_title Watched systemd units\n")
+		b.WriteString("graph_args --base 1000 -l 0 -u 1\n")
+		b.WriteString("graph_vlabel active\n")
+		b.WriteString("graph_category system\n")
+		b.WriteString("graph_info 1 if the unit is active, 0 otherwise.\n")
+		for _, unit := range units {
+			field := cleanFieldName(unit)
+			fmt.Fprintf(&b, "%s.label %s\n", field, unit)
+			req.printThresholds(&b, field, "", "1:")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func systemdFetch(req *pluginRequest) (string, error) {
+	ctx, cancel := context.WithTimeout(req.ctx, systemdTimeout)
+	defer cancel()
+
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	counts, err := countUnitStates(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph systemd_units\n")
+	for _, state := range systemdStates {
+		fmt.Fprintf(&b, "%s.value %d\n", state, counts[state])
+	}
+
+	units := strings.Fields(req.getenv("units", ""))
+	if len(units) > 0 {
+		b.WriteString("multigraph systemd_units.watched\n")
+		for i, state := range watchedUnitStates(ctx, conn, units) {
+			value := 0
+			if state == "active" {
+				value = 1
+			}
+			fmt.Fprintf(&b, "%s.value %d\n", cleanFieldName(units[i]), value)
+			fmt.Fprintf(&b, "%s.extinfo %s\n", cleanFieldName(units[i]), state)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,67 @@
+//go:build linux && (!minimal || collector_threads)
+// +build linux
+// +build !minimal collector_threads
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statNumThreads is the index of num_threads in the /proc/<pid>/stat
+// fields handed out by walkProcesses
+const statNumThreads = 17
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "threads",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("sys", "kernel", "threads-max")) },
+		config:   threadsConfig,
+		fetch:    threadsFetch,
+	})
+}
+
+func threadsConfig(req *pluginRequest) (string, error) {
+	max, err := readUintFile(procPath("sys", "kernel", "threads-max"))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("graph_title Number of threads\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel number of threads\n")
+	b.WriteString("graph_category processes\n")
+	b.WriteString("graph_info This graph shows the number of threads on the system. A steady climb usually means an application is leaking threads.\n")
+	b.WriteString("threads.label threads\n")
+	b.WriteString("threads.info The total number of threads of all processes.\n")
+	warning := percentThreshold(req.getenv("warning_percent", ""), max)
+	critical := percentThreshold(req.getenv("critical_percent", ""), max)
+	req.printThresholds(&b, "threads", warning, critical)
+	b.WriteString("max.label threads-max\n")
+	b.WriteString("max.info The system-wide limit on the number of threads (kernel.threads-max).\n")
+
+	return b.String(), nil
+}
+
+func threadsFetch(req *pluginRequest) (string, error) {
+	max, err := readUintFile(procPath("sys", "kernel", "threads-max"))
+	if err != nil {
+		return "", err
+	}
+
+	var threads uint64
+	err = walkProcesses(func(fields []string) {
+		if len(fields) > statNumThreads {
+			count, _ := strconv.ParseUint(fields[statNumThreads], 10, 64)
+			threads += count
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("threads.value %d\nmax.value %d\n", threads, max), nil
+}
@@ -0,0 +1,318 @@
+//go:build !minimal || collector_timesync
+// +build !minimal collector_timesync
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chronyDefaultAddress = "127.0.0.1:323"
+	ntpdDefaultAddress   = "127.0.0.1:123"
+	timesyncTimeout      = 2 * time.Second
+
+	chronyProtoVersion = 6
+	chronyPktRequest   = 1
+	chronyPktReply     = 2
+	chronyReqTracking  = 33
+	chronyRpyTracking  = 5
+	chronyHeaderLength = 20
+	chronyReplyHeader  = 28
+	chronyTrackingBody = 76
+
+	ntpModeControl = 6
+	ntpOpReadVar   = 2
+)
+
+// timesyncConfigFiles hint at a time daemon being installed
+var timesyncConfigFiles = []string{
+	"/etc/chrony.conf",
+	"/etc/chrony/chrony.conf",
+	"/etc/ntp.conf",
+	"/etc/ntpsec/ntp.conf",
+}
+
+// timeStatus is what both chronyd and ntpd can tell us. Offset and jitter
+// are in seconds.
+type timeStatus struct {
+	offset  float64
+	jitter  float64
+	stratum int
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "timesync",
+		autoconf: func(req *pluginRequest) bool {
+			for _, path := range timesyncConfigFiles {
+				if fileExists(path) {
+					return true
+				}
+			}
+			return false
+		},
+		config: timesyncConfig,
+		fetch:  timesyncFetch,
+	})
+}
+
+// chronyFloat decodes the 32 bit float format of the chrony command
+// protocol: a 7 bit signed exponent followed by a 25 bit signed
+// coefficient.
+func chronyFloat(x uint32) float64 {
+	exp := int32(x >> 25)
+	if exp >= 1<<6 {
+		exp -= 1 << 7
+	}
+	exp -= 25
+
+	coef := int32(x % (1 << 25))
+	if coef >= 1<<24 {
+		coef -= 1 << 25
+	}
+
+	return float64(coef) * math.Pow(2, float64(exp))
+}
+
+// dialChrony connects to chronyd over UDP, or over its Unix datagram
+// socket when address is a path. The latter needs a bound client socket
+// for chronyd to reply to.
+func dialChrony(address string) (net.Conn, func(), error) {
+	if !strings.HasPrefix(address, "/") {
+		conn, err := net.Dial("udp", address)
+		return conn, func() {}, err
+	}
+
+	dir, err := ioutil.TempDir("", "munin-node-chrony")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	local := &net.UnixAddr{Name: filepath.Join(dir, "client.sock"), Net: "unixgram"}
+	remote := &net.UnixAddr{Name: address, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", local, remote)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return conn, cleanup, nil
+}
+
+func queryChrony(address string) (timeStatus, error) {
+	conn, cleanup, err := dialChrony(address)
+	if err != nil {
+		return timeStatus{}, fmt.Errorf("failed to connect to chronyd: %w", err)
+	}
+	defer cleanup()
+	defer conn.Close()
+
+	// Requests are padded to the reply length so chronyd can't be used
+	// for amplification
+	request := make([]byte, chronyReplyHeader+chronyTrackingBody)
+	request[0] = chronyProtoVersion
+	request[1] = chronyPktRequest
+	binary.BigEndian.PutUint16(request[4:], chronyReqTracking)
+	sequence := uint32(time.Now().UnixNano())
+	binary.BigEndian.PutUint32(request[8:], sequence)
+
+	conn.SetDeadline(time.Now().Add(timesyncTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return timeStatus{}, fmt.Errorf("failed to query chronyd: %w", err)
+	}
+
+	reply := make([]byte, 1024)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return timeStatus{}, fmt.Errorf("failed to read chronyd reply: %w", err)
+	}
+	reply = reply[:n]
+
+	if n < chronyReplyHeader+chronyTrackingBody || reply[1] != chronyPktReply {
+		return timeStatus{}, errors.New("short or malformed reply from chronyd")
+	}
+	if status := binary.BigEndian.Uint16(reply[8:]); status != 0 {
+		return timeStatus{}, fmt.Errorf("chronyd returned status %d", status)
+	}
+	if binary.BigEndian.Uint16(reply[6:]) != chronyRpyTracking || binary.BigEndian.Uint32(reply[16:]) != sequence {
+		return timeStatus{}, errors.New("unexpected reply from chronyd")
+	}
+
+	// RPY_Tracking: ref_id(4) ip_addr(20) stratum(2) leap_status(2)
+	// ref_time(12) current_correction last_offset rms_offset ...
+	body := reply[chronyReplyHeader:]
+	return timeStatus{
+		stratum: int(binary.BigEndian.Uint16(body[24:])),
+		offset:  chronyFloat(binary.BigEndian.Uint32(body[44:])),
+		jitter:  chronyFloat(binary.BigEndian.Uint32(body[48:])),
+	}, nil
+}
+
+// queryNtpd reads the system variables of ntpd with a mode 6 READVAR
+// request, reassembling fragmented responses.
+func queryNtpd(address string) (timeStatus, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return timeStatus{}, fmt.Errorf("failed to connect to ntpd: %w", err)
+	}
+	defer conn.Close()
+
+	sequence := uint16(time.Now().UnixNano())
+	request := make([]byte, 12)
+	request[0] = 2<<3 | ntpModeControl
+	request[1] = ntpOpReadVar
+	binary.BigEndian.PutUint16(request[2:], sequence)
+
+	conn.SetDeadline(time.Now().Add(timesyncTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return timeStatus{}, fmt.Errorf("failed to query ntpd: %w", err)
+	}
+
+	fragments := make(map[int][]byte)
+	received, total := 0, -1
+	buffer := make([]byte, 1024)
+	for total < 0 || received < total {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return timeStatus{}, fmt.Errorf("failed to read ntpd reply: %w", err)
+		}
+		if n < 12 || binary.BigEndian.Uint16(buffer[2:]) != sequence {
+			continue
+		}
+		if buffer[1]&0x40 != 0 {
+			return timeStatus{}, errors.New("ntpd returned an error")
+		}
+
+		offset := int(binary.BigEndian.Uint16(buffer[8:]))
+		count := int(binary.BigEndian.Uint16(buffer[10:]))
+		if 12+count > n {
+			return timeStatus{}, errors.New("malformed reply from ntpd")
+		}
+		if _, seen := fragments[offset]; !seen {
+			fragments[offset] = append([]byte(nil), buffer[12:12+count]...)
+			received += count
+		}
+
+		// The last fragment has the more bit cleared
+		if buffer[1]&0x20 == 0 {
+			total = offset + count
+		}
+	}
+
+	data := make([]byte, total)
+	for offset, fragment := range fragments {
+		copy(data[offset:], fragment)
+	}
+
+	return parseNtpVars(string(data))
+}
+
+// parseNtpVars picks offset and jitter (in milliseconds) and stratum out
+// of a comma separated ntpd variable list.
+func parseNtpVars(vars string) (timeStatus, error) {
+	var status timeStatus
+	found := 0
+	for _, item := range strings.Split(vars, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.Trim(parts[1], "\""), 64)
+		if err != nil {
+			continue
+		}
+
+		switch parts[0] {
+		case "offset":
+			status.offset = value / 1000
+			found++
+		case "sys_jitter", "jitter":
+			status.jitter = value / 1000
+			found++
+		case "stratum":
+			status.stratum = int(value)
+			found++
+		}
+	}
+
+	if found == 0 {
+		return status, errors.New("no time variables in ntpd reply")
+	}
+	return status, nil
+}
+
+// queryTimeDaemon asks the daemon selected by env.source, or tries chronyd
+// and then ntpd.
+func queryTimeDaemon(req *pluginRequest) (timeStatus, error) {
+	chronyAddress := req.getenv("chrony_address", chronyDefaultAddress)
+	ntpdAddress := req.getenv("ntpd_address", ntpdDefaultAddress)
+
+	switch req.getenv("source", "auto") {
+	case "chrony":
+		return queryChrony(chronyAddress)
+	case "ntpd":
+		return queryNtpd(ntpdAddress)
+	}
+
+	status, err := queryChrony(chronyAddress)
+	if err == nil {
+		return status, nil
+	}
+	return queryNtpd(ntpdAddress)
+}
+
+func timesyncConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph timesync\n")
+	b.WriteString("graph_title Clock offset\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel seconds\n")
+	b.WriteString("graph_category time\n")
+	b.WriteString("graph_info Offset of the system clock from its time sources as reported by chronyd or ntpd.\n")
+	b.WriteString("offset.label offset\n")
+	b.WriteString("offset.info Estimated offset of the system clock at the last update.\n")
+	req.printThresholds(&b, "offset", "", "")
+	b.WriteString("jitter.label jitter\n")
+	b.WriteString("jitter.info RMS of recent offsets (chronyd) or system jitter (ntpd).\n")
+	req.printThresholds(&b, "jitter", "", "")
+
+	b.WriteString("multigraph timesync.stratum\n")
+	b.WriteString("graph_title Clock stratum\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel stratum\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category time\n")
+	b.WriteString("stratum.label stratum\n")
+	b.WriteString("stratum.info Distance from the reference clock. 16 means unsynchronised.\n")
+	req.printThresholds(&b, "stratum", "", "16")
+
+	return b.String(), nil
+}
+
+func timesyncFetch(req *pluginRequest) (string, error) {
+	status, err := queryTimeDaemon(req)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph timesync\n")
+	fmt.Fprintf(&b, "offset.value %.9f\n", status.offset)
+	fmt.Fprintf(&b, "jitter.value %.9f\n", status.jitter)
+	b.WriteString("multigraph timesync.stratum\n")
+	fmt.Fprintf(&b, "stratum.value %d\n", status.stratum)
+
+	return b.String(), nil
+}
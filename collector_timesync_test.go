@@ -0,0 +1,55 @@
+//go:build !minimal || collector_timesync
+// +build !minimal collector_timesync
+
+package main
+
+import "testing"
+
+func TestChronyFloat(t *testing.T) {
+	tests := []struct {
+		x    uint32
+		want float64
+	}{
+		{0, 0},
+		{1 << 23, 0.25},
+		{1<<25 | 1<<23, 0.5},
+		{127<<25 | 1<<23, 0.125},
+		{1<<25 - 1<<23, -0.25},
+		{25<<25 | 3, 3},
+	}
+	for _, test := range tests {
+		if got := chronyFloat(test.x); got != test.want {
+			t.Errorf("chronyFloat(%#x) = %v, want %v", test.x, got, test.want)
+		}
+	}
+}
+
+func TestParseNtpVars(t *testing.T) {
+	tests := []struct {
+		vars    string
+		want    timeStatus
+		wantErr bool
+	}{
+		{
+			vars: `version="ntpd 4.2.8p15", leap=00, stratum=2, precision=-23, offset=1.5, sys_jitter=0.250, clk_jitter=0.1`,
+			want: timeStatus{offset: 0.0015, jitter: 0.00025, stratum: 2},
+		},
+		{
+			vars: "stratum=3,\r\noffset=-12,\r\njitter=\"4\"",
+			want: timeStatus{offset: -0.012, jitter: 0.004, stratum: 3},
+		},
+		{vars: "stratum=16", want: timeStatus{stratum: 16}},
+		{vars: `version="ntpd", offset=bogus`, wantErr: true},
+		{vars: "", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseNtpVars(test.vars)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseNtpVars(%q) error = %v, want error %v", test.vars, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && got != test.want {
+			t.Errorf("parseNtpVars(%q) = %+v, want %+v", test.vars, got, test.want)
+		}
+	}
+}
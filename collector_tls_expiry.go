@@ -0,0 +1,108 @@
+//go:build !minimal || collector_tls_expiry
+// +build !minimal collector_tls_expiry
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tlsExpiryTimeout         = 10 * time.Second
+	tlsExpiryDefaultWarning  = "14:"
+	tlsExpiryDefaultCritical = "7:"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "tls_expiry",
+		autoconf: func(req *pluginRequest) bool {
+			return req.getenv("hosts", "") != ""
+		},
+		config: tlsExpiryConfig,
+		fetch:  tlsExpiryFetch,
+	})
+}
+
+// tlsExpiryAddress adds the HTTPS port to a host without one
+func tlsExpiryAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), "443")
+}
+
+// tlsExpiryDays connects to address, sending host as SNI, and returns the
+// days left until the server's certificate expires. The certificate is not
+// verified: an expired or untrusted certificate should show up on the graph
+// rather than as a missing value.
+func tlsExpiryDays(address string) (float64, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0, err
+	}
+
+	dialer := &net.Dialer{Timeout: tlsExpiryTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return 0, fmt.Errorf("%s sent no certificate", address)
+	}
+	return time.Until(certificates[0].NotAfter).Hours() / 24, nil
+}
+
+func tlsExpiryConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title TLS certificate expiry\n")
+	b.WriteString("graph_args --base 1000\n")
+	b.WriteString("graph_vlabel days left\n")
+	b.WriteString("graph_category security\n")
+	b.WriteString("graph_info Days until the certificate each server presents expires.\n")
+	for _, host := range strings.Fields(req.getenv("hosts", "")) {
+		address := tlsExpiryAddress(host)
+		field := cleanFieldName(address)
+		fmt.Fprintf(&b, "%s.label %s\n", field, address)
+		req.printThresholds(&b, field, tlsExpiryDefaultWarning, tlsExpiryDefaultCritical)
+	}
+
+	return b.String(), nil
+}
+
+func tlsExpiryFetch(req *pluginRequest) (string, error) {
+	hosts := strings.Fields(req.getenv("hosts", ""))
+
+	values := make([]string, len(hosts))
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, address string) {
+			defer wg.Done()
+			values[i] = "U"
+			if days, err := tlsExpiryDays(address); err == nil {
+				values[i] = strconv.FormatFloat(days, 'f', 2, 64)
+			}
+		}(i, tlsExpiryAddress(host))
+	}
+	wg.Wait()
+
+	var b strings.Builder
+	for i, host := range hosts {
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(tlsExpiryAddress(host)), values[i])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,54 @@
+//go:build linux && (!minimal || collector_uptime)
+// +build linux
+// +build !minimal collector_uptime
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "uptime",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("uptime")) },
+		config:   uptimeConfig,
+		fetch:    uptimeFetch,
+	})
+}
+
+func uptimeConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Uptime\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_vlabel uptime in days\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("uptime.label uptime\n")
+	b.WriteString("uptime.draw AREA\n")
+	req.printThresholds(&b, "uptime", "", "")
+
+	return b.String(), nil
+}
+
+func uptimeFetch(req *pluginRequest) (string, error) {
+	data, err := ioutil.ReadFile(procPath("uptime"))
+	if err != nil {
+		return "", fmt.Errorf("unable to read uptime: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unexpected uptime format: %q", data)
+	}
+
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", fmt.Errorf("unexpected uptime format: %w", err)
+	}
+
+	return fmt.Sprintf("uptime.value %.2f\n", seconds/86400), nil
+}
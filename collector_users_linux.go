@@ -0,0 +1,165 @@
+//go:build linux && (!minimal || collector_users)
+// +build linux
+// +build !minimal collector_users
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// Layout of struct utmp as written by glibc on Linux
+const (
+	utmpRecordSize  = 384
+	utmpLineOffset  = 8
+	utmpLineSize    = 32
+	utmpHostOffset  = 76
+	utmpHostSize    = 256
+	utmpUserProcess = 7
+)
+
+const defaultUtmpPath = "/var/run/utmp"
+
+var userSessionTypes = []struct {
+	field  string
+	label  string
+	colour string
+	info   string
+}{
+	{"tty", "tty", "00FF00", ""},
+	{"pty", "pty", "0000FF", ""},
+	{"pts", "pts", "00FFFF", ""},
+	{"X", "X displays", "000000", "Users logged in on an X display"},
+	{"other", "Other users", "FF0000", "Users logged in by indeterminate method"},
+}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:   "users",
+		config: usersConfig,
+		fetch:  usersFetch,
+	})
+}
+
+type userSession struct {
+	line string
+	host string
+}
+
+// classifySession buckets a login the same way the stock users plugin
+// does.
+func classifySession(session userSession) string {
+	switch {
+	case strings.HasPrefix(session.line, ":") || strings.HasPrefix(session.host, ":"):
+		return "X"
+	case strings.HasPrefix(session.line, "pty") || strings.HasPrefix(session.line, "ttyp"):
+		return "pty"
+	case strings.HasPrefix(session.line, "tty"):
+		return "tty"
+	case strings.HasPrefix(session.line, "pts"):
+		return "pts"
+	}
+	return "other"
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func readUtmp(path string) ([]userSession, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	var sessions []userSession
+	for offset := 0; offset+utmpRecordSize <= len(data); offset += utmpRecordSize {
+		record := data[offset : offset+utmpRecordSize]
+		// ut_type is a native endian short, no other type value is
+		// ambiguous between the two byte orders
+		if binary.LittleEndian.Uint16(record) != utmpUserProcess && binary.BigEndian.Uint16(record) != utmpUserProcess {
+			continue
+		}
+		sessions = append(sessions, userSession{
+			line: cString(record[utmpLineOffset : utmpLineOffset+utmpLineSize]),
+			host: cString(record[utmpHostOffset : utmpHostOffset+utmpHostSize]),
+		})
+	}
+	return sessions, nil
+}
+
+// readWho is the fallback for systems without a readable utmp file, e.g.
+// musl based distributions.
+func readWho() ([]userSession, error) {
+	output, err := exec.Command("who").Output()
+	if err != nil {
+		return nil, fmt.Errorf("who failed: %w", err)
+	}
+
+	var sessions []userSession
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		session := userSession{line: fields[1]}
+		if last := fields[len(fields)-1]; strings.HasPrefix(last, "(") && strings.HasSuffix(last, ")") {
+			session.host = strings.Trim(last, "()")
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+func usersConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("graph_title Logged in users\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel Users\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category system\n")
+	b.WriteString("graph_printf %3.0lf\n")
+
+	for _, sessionType := range userSessionTypes {
+		fmt.Fprintf(&b, "%s.label %s\n", sessionType.field, sessionType.label)
+		fmt.Fprintf(&b, "%s.draw AREASTACK\n", sessionType.field)
+		fmt.Fprintf(&b, "%s.colour %s\n", sessionType.field, sessionType.colour)
+		if sessionType.info != "" {
+			fmt.Fprintf(&b, "%s.info %s\n", sessionType.field, sessionType.info)
+		}
+		req.printThresholds(&b, sessionType.field, "", "")
+	}
+
+	return b.String(), nil
+}
+
+func usersFetch(req *pluginRequest) (string, error) {
+	sessions, err := readUtmp(req.getenv("utmp", defaultUtmpPath))
+	if err != nil {
+		sessions, err = readWho()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, session := range sessions {
+		counts[classifySession(session)]++
+	}
+
+	var b strings.Builder
+	for _, sessionType := range userSessionTypes {
+		fmt.Fprintf(&b, "%s.value %d\n", sessionType.field, counts[sessionType.field])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,158 @@
+//go:build linux && (!minimal || collector_wireguard)
+// +build linux
+// +build !minimal collector_wireguard
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// A peer that hasn't completed a handshake for this long is considered
+// gone; WireGuard rekeys every two minutes while there's traffic.
+const wireguardActiveHandshake = 3 * time.Minute
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name: "wireguard",
+		autoconf: func(req *pluginRequest) bool {
+			devices, err := readWireguard()
+			return err == nil && len(devices) > 0
+		},
+		config: wireguardConfig,
+		fetch:  wireguardFetch,
+	})
+}
+
+func readWireguard() ([]*wgtypes.Device, error) {
+	client, err := wgctrl.New()
+	if err != nil {
+		return nil, fmt.Errorf("unable to open wireguard control: %w", err)
+	}
+	defer client.Close()
+
+	devices, err := client.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list wireguard devices: %w", err)
+	}
+	return devices, nil
+}
+
+// wireguardPeerField shortens the public key, which is unique enough in
+// its first dozen characters
+func wireguardPeerField(peer wgtypes.Peer) string {
+	return cleanFieldName("p" + peer.PublicKey.String()[:12])
+}
+
+// wireguardPeerLabel names a peer after its first allowed IP, which is
+// usually what operators know it by
+func wireguardPeerLabel(peer wgtypes.Peer) string {
+	if len(peer.AllowedIPs) > 0 {
+		return peer.AllowedIPs[0].String()
+	}
+	return peer.PublicKey.String()[:12]
+}
+
+func wireguardConfig(req *pluginRequest) (string, error) {
+	devices, err := readWireguard()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph wireguard_peers\n")
+	b.WriteString("graph_title WireGuard peers\n")
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	b.WriteString("graph_vlabel peers\n")
+	b.WriteString("graph_category network\n")
+	fmt.Fprintf(&b, "graph_info Configured peers per interface, and those with a handshake in the last %d minutes.\n", int(wireguardActiveHandshake.Minutes()))
+	for _, device := range devices {
+		field := cleanFieldName(device.Name)
+		fmt.Fprintf(&b, "%s_total.label %s configured\n", field, device.Name)
+		fmt.Fprintf(&b, "%s_active.label %s active\n", field, device.Name)
+		req.printThresholds(&b, field+"_active", "", "")
+	}
+
+	for _, device := range devices {
+		fmt.Fprintf(&b, "multigraph wireguard_traffic_%s\n", cleanFieldName(device.Name))
+		fmt.Fprintf(&b, "graph_title WireGuard traffic on %s\n", device.Name)
+		b.WriteString("graph_args --base 1000\n")
+		b.WriteString("graph_vlabel bits in (-) / out (+) per ${graph_period}\n")
+		b.WriteString("graph_category network\n")
+		for _, peer := range device.Peers {
+			field := wireguardPeerField(peer)
+			label := wireguardPeerLabel(peer)
+			fmt.Fprintf(&b, "%s_rx.label %s\n", field, label)
+			fmt.Fprintf(&b, "%s_rx.type DERIVE\n", field)
+			fmt.Fprintf(&b, "%s_rx.min 0\n", field)
+			fmt.Fprintf(&b, "%s_rx.graph no\n", field)
+			fmt.Fprintf(&b, "%s_rx.cdef %s_rx,8,*\n", field, field)
+			fmt.Fprintf(&b, "%s_tx.label %s\n", field, label)
+			fmt.Fprintf(&b, "%s_tx.type DERIVE\n", field)
+			fmt.Fprintf(&b, "%s_tx.min 0\n", field)
+			fmt.Fprintf(&b, "%s_tx.negative %s_rx\n", field, field)
+			fmt.Fprintf(&b, "%s_tx.cdef %s_tx,8,*\n", field, field)
+			fmt.Fprintf(&b, "%s_tx.info Peer %s\n", field, peer.PublicKey)
+		}
+
+		fmt.Fprintf(&b, "multigraph wireguard_handshake_%s\n", cleanFieldName(device.Name))
+		fmt.Fprintf(&b, "graph_title WireGuard handshake age on %s\n", device.Name)
+		b.WriteString("graph_args --base 1000 -l 0\n")
+		b.WriteString("graph_vlabel seconds\n")
+		b.WriteString("graph_category network\n")
+		b.WriteString("graph_info Time since the last handshake with each peer. Unknown for peers that never connected.\n")
+		for _, peer := range device.Peers {
+			field := wireguardPeerField(peer)
+			fmt.Fprintf(&b, "%s.label %s\n", field, wireguardPeerLabel(peer))
+			req.printThresholds(&b, field, "", "")
+		}
+	}
+
+	return b.String(), nil
+}
+
+func wireguardFetch(req *pluginRequest) (string, error) {
+	devices, err := readWireguard()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("multigraph wireguard_peers\n")
+	for _, device := range devices {
+		active := 0
+		for _, peer := range device.Peers {
+			if !peer.LastHandshakeTime.IsZero() && time.Since(peer.LastHandshakeTime) < wireguardActiveHandshake {
+				active++
+			}
+		}
+		field := cleanFieldName(device.Name)
+		fmt.Fprintf(&b, "%s_total.value %d\n", field, len(device.Peers))
+		fmt.Fprintf(&b, "%s_active.value %d\n", field, active)
+	}
+
+	for _, device := range devices {
+		fmt.Fprintf(&b, "multigraph wireguard_traffic_%s\n", cleanFieldName(device.Name))
+		for _, peer := range device.Peers {
+			field := wireguardPeerField(peer)
+			fmt.Fprintf(&b, "%s_rx.value %d\n", field, peer.ReceiveBytes)
+			fmt.Fprintf(&b, "%s_tx.value %d\n", field, peer.TransmitBytes)
+		}
+
+		fmt.Fprintf(&b, "multigraph wireguard_handshake_%s\n", cleanFieldName(device.Name))
+		for _, peer := range device.Peers {
+			age := "U"
+			if !peer.LastHandshakeTime.IsZero() {
+				age = fmt.Sprintf("%.0f", time.Since(peer.LastHandshakeTime).Seconds())
+			}
+			fmt.Fprintf(&b, "%s.value %s\n", wireguardPeerField(peer), age)
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,268 @@
+//go:build linux && (!minimal || collector_zfs)
+// +build linux
+// +build !minimal collector_zfs
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const zpoolTimeout = 30 * time.Second
+
+// zpoolHealth maps pool states to values for the health graph; anything
+// but ONLINE and DEGRADED means the pool is unusable
+var zpoolHealth = map[string]int{
+	"ONLINE":   0,
+	"DEGRADED": 1,
+}
+
+type zpoolStatus struct {
+	name          string
+	capacity      string
+	fragmentation string
+	health        string
+}
+
+// arcPrevious keeps the last hit and miss counters to compute the hit
+// ratio over the poll interval.
+var arcPrevious = struct {
+	sync.Mutex
+	hits   uint64
+	misses uint64
+	valid  bool
+}{}
+
+func init() {
+	registerBuiltin(&builtinPlugin{
+		name:     "zfs",
+		autoconf: func(req *pluginRequest) bool { return fileExists(procPath("spl", "kstat", "zfs", "arcstats")) },
+		config:   zfsConfig,
+		fetch:    zfsFetch,
+	})
+}
+
+// readArcstats parses the kstat table in /proc/spl/kstat/zfs/arcstats:
+// two header lines followed by "name type data".
+func readArcstats() (map[string]uint64, error) {
+	file, err := os.Open(procPath("spl", "kstat", "zfs", "arcstats"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open arcstats: %w", err)
+	}
+	defer file.Close()
+
+	stats := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			stats[fields[0]] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+	return stats, nil
+}
+
+// zpoolProperty reads a property value from `zpool list -j`, which may be
+// a number or a string like "12%" depending on --json-int support.
+func zpoolProperty(raw json.RawMessage) string {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "U"
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return strings.TrimSuffix(v, "%")
+	}
+	return "U"
+}
+
+// listZpoolsJSON uses the JSON output of OpenZFS 2.3 and later.
+func listZpoolsJSON(ctx context.Context, zpool string) ([]zpoolStatus, error) {
+	output, err := runCommand(ctx, zpoolTimeout, zpool, "list", "-j", "--json-int")
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Pools map[string]struct {
+			Name       string `json:"name"`
+			Properties map[string]struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"properties"`
+		} `json:"pools"`
+	}
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse zpool output: %w", err)
+	}
+
+	var pools []zpoolStatus
+	for name, pool := range list.Pools {
+		pools = append(pools, zpoolStatus{
+			name:          name,
+			capacity:      zpoolProperty(pool.Properties["capacity"].Value),
+			fragmentation: zpoolProperty(pool.Properties["fragmentation"].Value),
+			health:        strings.Trim(string(pool.Properties["health"].Value), "\""),
+		})
+	}
+	return pools, nil
+}
+
+// listZpoolsText is the fallback for older releases without -j.
+func listZpoolsText(ctx context.Context, zpool string) ([]zpoolStatus, error) {
+	output, err := runCommand(ctx, zpoolTimeout, zpool, "list", "-Hp", "-o", "name,capacity,fragmentation,health")
+	if err != nil {
+		return nil, fmt.Errorf("zpool list failed: %w", err)
+	}
+
+	var pools []zpoolStatus
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+
+		pool := zpoolStatus{name: fields[0], capacity: fields[1], fragmentation: fields[2], health: fields[3]}
+		if pool.fragmentation == "-" {
+			pool.fragmentation = "U"
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+func listZpools(req *pluginRequest) []zpoolStatus {
+	zpool := req.getenv("zpool", "zpool")
+	if !commandExists(zpool) {
+		return nil
+	}
+
+	pools, err := listZpoolsJSON(req.ctx, zpool)
+	if err != nil {
+		pools, err = listZpoolsText(req.ctx, zpool)
+		if err != nil {
+			return nil
+		}
+	}
+
+	sort.Slice(pools, func(i, j int) bool { return pools[i].name < pools[j].name })
+	return pools
+}
+
+func writeZpoolGraph(b *strings.Builder, req *pluginRequest, pools []zpoolStatus, name string, title string, vlabel string, warning string, critical string) {
+	fmt.Fprintf(b, "multigraph %s\n", name)
+	fmt.Fprintf(b, "graph_title %s\n", title)
+	b.WriteString("graph_args --base 1000 -l 0\n")
+	fmt.Fprintf(b, "graph_vlabel %s\n", vlabel)
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category fs\n")
+	for _, pool := range pools {
+		field := cleanFieldName(pool.name)
+		fmt.Fprintf(b, "%s.label %s\n", field, pool.name)
+		req.printThresholds(b, field, warning, critical)
+	}
+}
+
+func zfsConfig(req *pluginRequest) (string, error) {
+	var b strings.Builder
+	b.WriteString("multigraph zfs_arc_size\n")
+	b.WriteString("graph_title ZFS ARC size\n")
+	b.WriteString("graph_args --base 1024 -l 0\n")
+	b.WriteString("graph_vlabel Bytes\n")
+	b.WriteString("graph_category fs\n")
+	b.WriteString("size.label size\n")
+	b.WriteString("size.draw AREA\n")
+	b.WriteString("size.info Current size of the ARC.\n")
+	b.WriteString("c.label target size\n")
+	b.WriteString("c.info Size the ARC is currently aiming for.\n")
+	b.WriteString("c_max.label max size\n")
+	b.WriteString("c_max.info Upper limit of the ARC size.\n")
+
+	b.WriteString("multigraph zfs_arc_hitratio\n")
+	b.WriteString("graph_title ZFS ARC hit ratio\n")
+	b.WriteString("graph_args --base 1000 -l 0 --upper-limit 100\n")
+	b.WriteString("graph_vlabel %\n")
+	b.WriteString("graph_scale no\n")
+	b.WriteString("graph_category fs\n")
+	b.WriteString("hitratio.label hit ratio\n")
+	b.WriteString("hitratio.info Share of ARC lookups served from memory since the last poll.\n")
+	req.printThresholds(&b, "hitratio", "", "")
+
+	pools := listZpools(req)
+	if len(pools) > 0 {
+		writeZpoolGraph(&b, req, pools, "zfs_pool_capacity", "ZFS pool capacity", "% used", "80", "90")
+		writeZpoolGraph(&b, req, pools, "zfs_pool_fragmentation", "ZFS pool fragmentation", "%", "", "")
+		writeZpoolGraph(&b, req, pools, "zfs_pool_health", "ZFS pool health", "0 online, 1 degraded, 2 faulted", ":0", ":1")
+	}
+
+	return b.String(), nil
+}
+
+func zfsFetch(req *pluginRequest) (string, error) {
+	arc, err := readArcstats()
+	if err != nil {
+		return "", err
+	}
+
+	hitratio := "U"
+	arcPrevious.Lock()
+	if arcPrevious.valid && arc["hits"] >= arcPrevious.hits && arc["misses"] >= arcPrevious.misses {
+		hits := arc["hits"] - arcPrevious.hits
+		lookups := hits + arc["misses"] - arcPrevious.misses
+		if lookups > 0 {
+			hitratio = strconv.FormatFloat(float64(hits)*100/float64(lookups), 'f', 2, 64)
+		}
+	}
+	arcPrevious.hits, arcPrevious.misses, arcPrevious.valid = arc["hits"], arc["misses"], true
+	arcPrevious.Unlock()
+
+	var b strings.Builder
+	b.WriteString("multigraph zfs_arc_size\n")
+	fmt.Fprintf(&b, "size.value %d\n", arc["size"])
+	fmt.Fprintf(&b, "c.value %d\n", arc["c"])
+	fmt.Fprintf(&b, "c_max.value %d\n", arc["c_max"])
+	b.WriteString("multigraph zfs_arc_hitratio\n")
+	fmt.Fprintf(&b, "hitratio.value %s\n", hitratio)
+
+	pools := listZpools(req)
+	if len(pools) == 0 {
+		return b.String(), nil
+	}
+
+	b.WriteString("multigraph zfs_pool_capacity\n")
+	for _, pool := range pools {
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(pool.name), pool.capacity)
+	}
+	b.WriteString("multigraph zfs_pool_fragmentation\n")
+	for _, pool := range pools {
+		fmt.Fprintf(&b, "%s.value %s\n", cleanFieldName(pool.name), pool.fragmentation)
+	}
+	b.WriteString("multigraph zfs_pool_health\n")
+	for _, pool := range pools {
+		health, ok := zpoolHealth[pool.health]
+		if !ok {
+			health = 2
+		}
+		fmt.Fprintf(&b, "%s.value %d\n", cleanFieldName(pool.name), health)
+	}
+
+	return b.String(), nil
+}
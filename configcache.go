@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configKey identifies the config output of a plugin file: it is reused
+// while the file and the env.* settings it runs with are unchanged
+type configKey struct {
+	modTime int64
+	size    int64
+	env     [sha256.Size]byte
+}
+
+type configOutput struct {
+	key    configKey
+	output string
+	stored time.Time
+}
+
+// configCacheTable holds the last config output by plugin
+type configCacheTable struct {
+	sync.Mutex
+	configs map[string]*configOutput
+}
+
+// newConfigKey returns the key of the plugin file at path run with env
+func newConfigKey(path string, env []string) (configKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return configKey{}, err
+	}
+	return configKey{
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+		env:     sha256.Sum256([]byte(strings.Join(env, "\x00"))),
+	}, nil
+}
+
+// cachedConfig returns the config output stored for plugin under key,
+// if it is not older than config_cache_ttl.
+func (s *Server) cachedConfig(plugin string, key configKey) (string, bool) {
+	s.configCache.Lock()
+	defer s.configCache.Unlock()
+
+	config, ok := s.configCache.configs[plugin]
+	if !ok || config.key != key || time.Since(config.stored) >= s.conf.ConfigCacheTTL {
+		metricCacheMisses.inc("config")
+		return "", false
+	}
+	metricCacheHits.inc("config")
+	return config.output, true
+}
+
+func (s *Server) storeConfig(plugin string, key configKey, output string) {
+	s.configCache.Lock()
+	defer s.configCache.Unlock()
+
+	s.configCache.configs[plugin] = &configOutput{key: key, output: output, stored: time.Now()}
+}
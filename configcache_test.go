@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewConfigKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"MUNIN_PLUGSTATE=/tmp", "warning=80"}
+	base, err := newConfigKey(path, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func() []string
+		same   bool
+	}{
+		{"unchanged", func() []string { return env }, true},
+		{"env", func() []string { return []string{"MUNIN_PLUGSTATE=/tmp", "warning=90"} }, false},
+		{"mtime", func() []string {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(path, later, later); err != nil {
+				t.Fatal(err)
+			}
+			return env
+		}, false},
+		{"size", func() []string {
+			if err := os.WriteFile(path, []byte("#!/bin/sh\necho\n"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			return env
+		}, false},
+	}
+	for _, test := range tests {
+		key, err := newConfigKey(path, test.change())
+		if err != nil {
+			t.Fatalf("%s: newConfigKey failed: %v", test.name, err)
+		}
+		if (key == base) != test.same {
+			t.Errorf("%s: key unchanged = %v, want %v", test.name, key == base, test.same)
+		}
+		base = key
+	}
+
+	if _, err := newConfigKey(filepath.Join(filepath.Dir(path), "missing"), env); err == nil {
+		t.Error("newConfigKey of a missing plugin succeeded")
+	}
+}
+
+func TestCachedConfig(t *testing.T) {
+	key := configKey{modTime: 1, size: 2}
+	other := configKey{modTime: 1, size: 3}
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		store bool
+		key   configKey
+		hit   bool
+	}{
+		{"hit", time.Hour, true, key, true},
+		{"not stored", time.Hour, false, key, false},
+		{"other key", time.Hour, true, other, false},
+		{"disabled", 0, true, key, false},
+	}
+	for _, test := range tests {
+		conf := newNodeConfig()
+		conf.ConfigCacheTTL = test.ttl
+		s := newServer(conf)
+		if test.store {
+			s.storeConfig("cpu", key, "graph_title CPU\n")
+		}
+		output, ok := s.cachedConfig("cpu", test.key)
+		if ok != test.hit {
+			t.Errorf("%s: cachedConfig hit = %v, want %v", test.name, ok, test.hit)
+		}
+		if ok && output != "graph_title CPU\n" {
+			t.Errorf("%s: cachedConfig = %q", test.name, output)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// containerEnv turns on container mode, in which node.conf is optional
+// and every directive can be given as a MUNIN_NODE_<DIRECTIVE> variable
+const (
+	containerEnv       = "MUNIN_NODE_CONTAINER"
+	containerEnvPrefix = "MUNIN_NODE_"
+)
+
+// Where plugins are looked for in container mode, for images to put
+// them at
+const (
+	containerPluginFolder = "/etc/munin/plugins"
+	containerPluginConfig = "/etc/munin/plugin-conf.d/munin-node"
+)
+
+func isContainerMode() bool {
+	return parseConfigBool(os.Getenv(containerEnv))
+}
+
+// loadNodeConfig reads node.conf, and in container mode the environment
+// on top of it. The configuration is returned as far as it was read even
+// when that failed, for the error to be reported with.
+func loadNodeConfig() (*NodeConfig, error) {
+	conf := newNodeConfig()
+	if !isContainerMode() {
+		return conf, conf.read(nodeConfigPath)
+	}
+
+	conf.Port = "4949"
+	conf.PluginFolder = containerPluginFolder
+	conf.PluginConfig = containerPluginConfig
+	conf.LogFormat = "json"
+	if hostname, err := os.Hostname(); err == nil {
+		conf.HostName = hostname
+	}
+
+	if _, err := os.Stat(nodeConfigPath); err == nil {
+		if err := conf.read(nodeConfigPath); err != nil {
+			return conf, err
+		}
+	}
+	return conf, conf.readEnv()
+}
+
+// containerInternalEnv are the MUNIN_NODE_* variables the node passes to
+// the processes it starts itself when upgrading or daemonizing
+var containerInternalEnv = map[string]bool{
+	"MUNIN_NODE_LISTENERS": true,
+	"MUNIN_NODE_PARENT":    true,
+	"MUNIN_NODE_PID_FD":    true,
+	"MUNIN_NODE_DAEMON":    true,
+	"MUNIN_NODE_READY_FD":  true,
+}
+
+// readEnv applies the MUNIN_NODE_* variables as node.conf directives,
+// e.g. MUNIN_NODE_HOST_NAME for host_name. A variable holding several
+// lines repeats the directive once per line, as for allow. A variable
+// naming no directive is an error, as it is most likely misspelt.
+func (c *NodeConfig) readEnv() error {
+	var names []string
+	values := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, containerEnvPrefix) || name == containerEnv || containerInternalEnv[name] {
+			continue
+		}
+		names = append(names, name)
+		values[name] = value
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimPrefix(name, containerEnvPrefix))
+		for _, value := range strings.Split(values[name], "\n") {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if err := c.apply(key, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// A node put in the background starts its executable again in a new
+// session, with standard input from /dev/null and its output going to
+// log_file, and waits on a pipe until that node serves clients or exits.
+const (
+	// daemonEnv marks a node already running in the background, including
+	// those later started from it by an upgrade
+	daemonEnv = "MUNIN_NODE_DAEMON"
+	// daemonReadyEnv is the file descriptor of the pipe to report
+	// readiness on
+	daemonReadyEnv = "MUNIN_NODE_READY_FD"
+)
+
+// daemonReady is the pipe the node reports readiness on when it was put
+// in the background
+var daemonReady *os.File
+
+// daemonize puts the node in the background. It returns false in the
+// background node, which carries on starting, and true with the exit
+// status in the process that started it.
+func daemonize(conf *NodeConfig) (int, bool) {
+	if os.Getenv(daemonEnv) != "" {
+		if fd, err := strconv.Atoi(os.Getenv(daemonReadyEnv)); err == nil {
+			syscall.CloseOnExec(fd)
+			daemonReady = os.NewFile(uintptr(fd), "ready")
+		}
+		return 0, false
+	}
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		logger.Error("failed to find executable", "error", err)
+		return 1, true
+	}
+
+	// Output written before logging is set up, and panics, end up in
+	// log_file too
+	output, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if conf.LogFile != "" {
+		output, err = os.OpenFile(conf.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	}
+	if err != nil {
+		logger.Error("failed to open log file", "error", err)
+		return 1, true
+	}
+	defer output.Close()
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		logger.Error("failed to create pipe", "error", err)
+		return 1, true
+	}
+	defer ready.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(inheritableEnviron(), daemonEnv+"=1", daemonReadyEnv+"=3")
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.ExtraFiles = []*os.File{readyWriter}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		logger.Error("failed to start node in the background", "error", err)
+		return 1, true
+	}
+
+	// The pipe closes without a byte written if the node exits first
+	if n, _ := ready.Read(make([]byte, 1)); n == 0 {
+		cmd.Wait()
+		logger.Error("node failed to start in the background", "exit_code", cmd.ProcessState.ExitCode(), "log_file", conf.LogFile)
+		return 1, true
+	}
+
+	logger.Info("node started in the background", "pid", cmd.Process.Pid)
+	return 0, true
+}
+
+// notifyDaemonReady tells the process that put the node in the background
+// that it is serving clients
+func notifyDaemonReady() {
+	if daemonReady == nil {
+		return
+	}
+	daemonReady.Write([]byte{1})
+	daemonReady.Close()
+	daemonReady = nil
+}
@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+// daemonize leaves the node in the foreground, as on Windows it runs in
+// the background as a service instead
+func daemonize(conf *NodeConfig) (int, bool) {
+	logger.Warn("background is not supported on Windows, install the node as a service instead")
+	return 0, false
+}
+
+func notifyDaemonReady() {}
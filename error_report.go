@@ -0,0 +1,279 @@
+//go:build !minimal || error_reports
+// +build !minimal error_reports
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	errorReportTimeout = 10 * time.Second
+
+	// errorReportInterval is how long an identical report is held back,
+	// so a broken allow_file checked on every connection is sent once
+	errorReportInterval = time.Hour
+
+	// errorReportsMax bounds both the reports held back and the plugins
+	// whose failures are counted, so errors whose messages keep changing
+	// cannot grow them without limit
+	errorReportsMax = 1024
+)
+
+// errorReport is one error sent to Sentry or error_webhook. Kind is panic,
+// plugin or config.
+type errorReport struct {
+	Kind    string            `json:"kind"`
+	Node    string            `json:"node"`
+	Message string            `json:"message"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Stack   string            `json:"stack,omitempty"`
+	Time    time.Time         `json:"time"`
+}
+
+// pluginFailures counts the consecutive failures of a plugin and option
+type pluginFailures struct {
+	count int
+	last  time.Time
+}
+
+// errorReports holds the sinks set by configureErrorReports, which are
+// shared by the whole process, and what was reported so far
+var errorReports = struct {
+	sync.Mutex
+	wg        sync.WaitGroup
+	node      string
+	sentryDSN string
+	webhook   string
+	threshold int
+	limit     int
+	sent      map[string]time.Time
+	failures  map[string]*pluginFailures
+}{
+	threshold: defaultErrorPluginThreshold,
+	limit:     errorReportsMax,
+	sent:      map[string]time.Time{},
+	failures:  map[string]*pluginFailures{},
+}
+
+var errorReportClient = &http.Client{Timeout: errorReportTimeout}
+
+// configureErrorReports sends error reports to the sinks of conf
+func configureErrorReports(conf *NodeConfig) {
+	errorReports.Lock()
+	defer errorReports.Unlock()
+
+	errorReports.node = conf.HostName
+	errorReports.sentryDSN = conf.ErrorSentryDSN
+	errorReports.webhook = conf.ErrorWebhook
+	errorReports.threshold = conf.ErrorPluginThreshold
+	errorReports.limit = errorReportsMax
+	if conf.isEmbedded() {
+		errorReports.limit = embeddedErrorReports
+	}
+}
+
+// reportError sends an error to the configured sinks in the background.
+func reportError(kind string, err error, tags map[string]string) {
+	sendErrorReport(errorReport{Kind: kind, Message: err.Error(), Tags: tags})
+}
+
+// reportPanic is deferred by connection handlers: it recovers a panic,
+// logs and reports it with its stack, and lets the node carry on with
+// the other connections.
+func reportPanic() {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	stack := string(debug.Stack())
+	logger.Error("panic while serving connection", "panic", value, "stack", stack)
+	sendErrorReport(errorReport{Kind: "panic", Message: fmt.Sprint(value), Stack: stack})
+}
+
+// reportPluginResult counts consecutive failures of a plugin and reports
+// the failure that reaches error_plugin_threshold. A success starts the
+// count again. When the count is kept for too many plugins already, the
+// one that failed longest ago makes room.
+func reportPluginResult(plugin, option string, err error) {
+	key := plugin + " " + metricOption(option)
+
+	errorReports.Lock()
+	if err == nil {
+		delete(errorReports.failures, key)
+		errorReports.Unlock()
+		return
+	}
+	counted := errorReports.failures[key]
+	if counted == nil {
+		if len(errorReports.failures) >= errorReports.limit {
+			var oldest string
+			for name, f := range errorReports.failures {
+				if oldest == "" || f.last.Before(errorReports.failures[oldest].last) {
+					oldest = name
+				}
+			}
+			delete(errorReports.failures, oldest)
+		}
+		counted = &pluginFailures{}
+		errorReports.failures[key] = counted
+	}
+	counted.count++
+	counted.last = time.Now()
+	failures := counted.count
+	threshold := errorReports.threshold
+	errorReports.Unlock()
+
+	if failures == threshold {
+		reportError("plugin", err, map[string]string{
+			"plugin":   plugin,
+			"option":   metricOption(option),
+			"failures": fmt.Sprint(failures),
+		})
+	}
+}
+
+// flushErrorReports waits for reports still being sent, for use before
+// the node exits.
+func flushErrorReports() {
+	done := make(chan struct{})
+	go func() {
+		errorReports.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(errorReportTimeout):
+	}
+}
+
+// sendErrorReport sends report unless the same one was sent within
+// errorReportInterval. When too many reports are held back already, the
+// one sent longest ago makes room.
+func sendErrorReport(report errorReport) {
+	key := report.Kind + " " + report.Message
+	errorReports.Lock()
+	sentryDSN, webhook := errorReports.sentryDSN, errorReports.webhook
+	if sentryDSN == "" && webhook == "" {
+		errorReports.Unlock()
+		return
+	}
+	last, ok := errorReports.sent[key]
+	if ok && time.Since(last) < errorReportInterval {
+		errorReports.Unlock()
+		return
+	}
+	if !ok && len(errorReports.sent) >= errorReports.limit {
+		var oldest string
+		for k, t := range errorReports.sent {
+			if oldest == "" || t.Before(errorReports.sent[oldest]) {
+				oldest = k
+			}
+		}
+		delete(errorReports.sent, oldest)
+	}
+	errorReports.sent[key] = time.Now()
+	report.Node = errorReports.node
+	errorReports.Unlock()
+
+	report.Time = time.Now().UTC()
+
+	errorReports.wg.Add(1)
+	go func() {
+		defer errorReports.wg.Done()
+
+		if sentryDSN != "" {
+			if err := sendSentry(sentryDSN, report); err != nil {
+				logger.Warn("failed to report error to Sentry", "error", err)
+			}
+		}
+		if webhook != "" {
+			if err := postJSON(webhook, report, nil); err != nil {
+				logger.Warn("failed to report error to webhook", "url", webhook, "error", err)
+			}
+		}
+	}()
+}
+
+// sendSentry stores report as an event through Sentry's store API, using
+// the key and project of dsn, https://<key>@<host>/<project>.
+func sendSentry(dsn string, report errorReport) error {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return fmt.Errorf("invalid Sentry DSN")
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	endpoint := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project)
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	tags := map[string]string{"kind": report.Kind}
+	for k, v := range report.Tags {
+		tags[k] = v
+	}
+	level := "error"
+	if report.Kind == "panic" {
+		level = "fatal"
+	}
+	event := map[string]interface{}{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   report.Time.Format(time.RFC3339),
+		"level":       level,
+		"logger":      "munin-node",
+		"platform":    "go",
+		"server_name": report.Node,
+		"release":     version,
+		"message":     report.Message,
+		"tags":        tags,
+	}
+	if report.Stack != "" {
+		event["extra"] = map[string]string{"stack": report.Stack}
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=munin-node-go/%s, sentry_key=%s", version, u.User.Username())
+	return postJSON(endpoint, event, map[string]string{"X-Sentry-Auth": auth})
+}
+
+func postJSON(endpoint string, body interface{}, headers map[string]string) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := errorReportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build minimal && !error_reports
+// +build minimal,!error_reports
+
+package main
+
+import "runtime/debug"
+
+// Without the error_reports tag a minimal build only logs errors, and
+// error_sentry_dsn and error_webhook are ignored with a warning.
+
+func configureErrorReports(conf *NodeConfig) {
+	if conf.ErrorSentryDSN != "" || conf.ErrorWebhook != "" {
+		logger.Warn("error reports need a build with the error_reports tag, not sending any")
+	}
+}
+
+func reportError(kind string, err error, tags map[string]string) {}
+
+// reportPanic is deferred by connection handlers: it recovers a panic,
+// logs it with its stack, and lets the node carry on with the other
+// connections.
+func reportPanic() {
+	value := recover()
+	if value == nil {
+		return
+	}
+	logger.Error("panic while serving connection", "panic", value, "stack", string(debug.Stack()))
+}
+
+func reportPluginResult(plugin, option string, err error) {}
+
+func flushErrorReports() {}
@@ -0,0 +1,56 @@
+//go:build !minimal || error_reports
+// +build !minimal error_reports
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestErrorReportLimit(t *testing.T) {
+	var posts atomic.Int64
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+	}))
+	defer sink.Close()
+
+	conf := newNodeConfig()
+	conf.Profile = profileEmbedded
+	conf.ErrorWebhook = sink.URL
+	conf.ErrorPluginThreshold = 2
+	configureErrorReports(conf)
+	defer configureErrorReports(newNodeConfig())
+
+	for i := 0; i < 2*embeddedErrorReports; i++ {
+		reportError("config", fmt.Errorf("allow file %d", i), nil)
+		reportPluginResult(fmt.Sprintf("plugin%d", i), "", errors.New("failed"))
+	}
+	flushErrorReports()
+
+	errorReports.Lock()
+	sent, failures := len(errorReports.sent), len(errorReports.failures)
+	_, newest := errorReports.sent["config allow file "+fmt.Sprint(2*embeddedErrorReports-1)]
+	_, oldest := errorReports.sent["config allow file 0"]
+	errorReports.Unlock()
+	if sent != embeddedErrorReports || failures != embeddedErrorReports {
+		t.Errorf("remembered %d reports and %d failing plugins, want %d", sent, failures, embeddedErrorReports)
+	}
+	if !newest || oldest {
+		t.Errorf("newest report kept %v, oldest report kept %v", newest, oldest)
+	}
+	if got := posts.Load(); got != 2*embeddedErrorReports {
+		t.Errorf("posted %d reports, want %d", got, 2*embeddedErrorReports)
+	}
+
+	// A failure count that made room starts again
+	reportPluginResult("plugin0", "", errors.New("failed"))
+	flushErrorReports()
+	if got := posts.Load(); got != 2*embeddedErrorReports {
+		t.Errorf("first failure of an evicted plugin was reported")
+	}
+}
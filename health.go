@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	healthPath    = "/healthz"
+	healthTimeout = 5 * time.Second
+)
+
+// healthState is what /healthz reports. A server is healthy while every
+// listener is up and the configuration, including allow_file, loaded.
+type healthState struct {
+	mu          sync.Mutex
+	listeners   map[string]string
+	configError string
+	lastPlugin  string
+	lastSuccess time.Time
+}
+
+// healthReport is the JSON body of /healthz
+type healthReport struct {
+	Status            string            `json:"status"`
+	Listeners         map[string]string `json:"listeners"`
+	Config            string            `json:"config"`
+	LastPlugin        string            `json:"last_plugin,omitempty"`
+	LastPluginSuccess *time.Time        `json:"last_plugin_success,omitempty"`
+	Uptime            float64           `json:"uptime_seconds"`
+}
+
+// healthListener records whether the listener for a protocol address is
+// accepting connections, err being the reason if not.
+func (s *Server) healthListener(address string, err error) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	s.health.listeners[address] = "ok"
+	if err != nil {
+		s.health.listeners[address] = err.Error()
+	}
+}
+
+// healthConfig records the result of the last configuration load
+func (s *Server) healthConfig(err error) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	s.health.configError = ""
+	if err != nil {
+		s.health.configError = err.Error()
+	}
+}
+
+// healthPluginSuccess records a plugin run that succeeded
+func (s *Server) healthPluginSuccess(plugin string) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	s.health.lastPlugin = plugin
+	s.health.lastSuccess = time.Now()
+}
+
+func (s *Server) currentHealth() healthReport {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	report := healthReport{
+		Status:    "ok",
+		Listeners: map[string]string{},
+		Config:    "ok",
+		Uptime:    time.Since(metricStartTime).Seconds(),
+	}
+	for address, status := range s.health.listeners {
+		report.Listeners[address] = status
+		if status != "ok" {
+			report.Status = "failing"
+		}
+	}
+	if s.health.configError != "" {
+		report.Config = s.health.configError
+		report.Status = "failing"
+	}
+	if !s.health.lastSuccess.IsZero() {
+		success := s.health.lastSuccess
+		report.LastPlugin = s.health.lastPlugin
+		report.LastPluginSuccess = &success
+	}
+
+	return report
+}
+
+// listenersHealthy tells whether every listener accepted its last connection
+func (s *Server) listenersHealthy() bool {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	for _, status := range s.health.listeners {
+		if status != "ok" {
+			return false
+		}
+	}
+	return true
+}
+
+// serveHealth answers /healthz with the health report, 503 when failing
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	report := s.currentHealth()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// runHealthCheck is the health subcommand: it asks the running node's
+// /healthz, prints the report and tells by its exit status whether the
+// node is healthy, for container and systemd probes.
+func runHealthCheck() int {
+	conf, err := loadNodeConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 2
+	}
+	if conf.MetricsListen == "" {
+		return checkGreeting(conf)
+	}
+
+	// A wildcard listen address is reached on loopback
+	host, port, err := net.SplitHostPort(conf.MetricsListen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid metrics_listen address %s: %v\n", conf.MetricsListen, err)
+		return 2
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{Timeout: healthTimeout}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + healthPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	fmt.Print(string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
+
+// checkGreeting is the health check without a health endpoint: the node
+// is taken to be healthy if its munin port greets.
+func checkGreeting(conf *NodeConfig) int {
+	host := conf.Host
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	address := net.JoinHostPort(host, conf.Port)
+
+	conn, err := net.DialTimeout("tcp", address, healthTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(healthTimeout))
+
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.HasPrefix(greeting, "# munin node at ") {
+		fmt.Fprintf(os.Stderr, "health check failed: no greeting from %s\n", address)
+		return 1
+	}
+	fmt.Fprintf(conn, "quit\n")
+	fmt.Print(greeting)
+	return 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPluginCacheTTL is how long the plugin folder is trusted without
+// plugin_cache_ttl
+const defaultPluginCacheTTL = time.Minute
+
+// pluginFile is an entry of the plugin folder
+type pluginFile struct {
+	name string
+	// runnable is false for files the node refuses or fails to run:
+	// symbolic links and files without an execute bit
+	runnable bool
+	// wildcard is set for a wildcard plugin installed under its prefix,
+	// e.g. if_, which needs an instance in its name to work
+	wildcard bool
+}
+
+// pluginInventory holds the content of the plugin folder. It is read again
+// when the folder's mtime changes, as adding, removing or renaming a
+// plugin does, and at the latest after plugin_cache_ttl, which catches a
+// plugin made executable in place.
+type pluginInventory struct {
+	mu      sync.Mutex
+	files   []pluginFile
+	modTime time.Time
+	read    time.Time
+
+	// builtins are the usable built-in plugins, kept for plugin_cache_ttl
+	// too as their autoconf and suggest probe the host and network
+	builtinMu    sync.Mutex
+	builtins     []string
+	builtinsRead time.Time
+}
+
+// pluginCacheTTL is plugin_cache_ttl, by default defaultPluginCacheTTL or
+// no caching at all with the embedded profile
+func (c *NodeConfig) pluginCacheTTL() time.Duration {
+	if c.PluginCacheTTL >= 0 {
+		return c.PluginCacheTTL
+	}
+	if c.isEmbedded() {
+		return 0
+	}
+	return defaultPluginCacheTTL
+}
+
+// pluginFiles returns the entries of the plugin folder other than
+// directories, from the inventory while it is current.
+func (s *Server) pluginFiles() []pluginFile {
+	folder := s.conf.PluginFolder
+	ttl := s.conf.pluginCacheTTL()
+	if ttl == 0 {
+		files, _ := readPluginFolder(folder)
+		return files
+	}
+
+	inv := &s.plugins
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	info, err := os.Stat(folder)
+	if err != nil {
+		logger.Error("failed to read plugin directory", "path", folder, "error", err)
+		return nil
+	}
+	if info.ModTime().Equal(inv.modTime) && time.Since(inv.read) < ttl {
+		metricCacheHits.inc("plugins")
+		return inv.files
+	}
+	metricCacheMisses.inc("plugins")
+
+	files, err := readPluginFolder(folder)
+	if err != nil {
+		return nil
+	}
+	inv.files, inv.modTime, inv.read = files, info.ModTime(), time.Now()
+	return files
+}
+
+func readPluginFolder(folder string) ([]pluginFile, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		logger.Error("failed to read plugin directory", "path", folder, "error", err)
+		return nil, err
+	}
+
+	files := make([]pluginFile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := pluginFile{name: entry.Name(), wildcard: strings.HasSuffix(entry.Name(), "_")}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				file.runnable = isExecutable(info.Mode())
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// isExecutable tells whether a plugin file may be run. Windows has no
+// execute bit and runs plugins by their extension.
+func isExecutable(mode os.FileMode) bool {
+	return runtime.GOOS == "windows" || mode&0111 != 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultLogBackups = 7
+
+// logFile is a log file that rotates itself once it grows past maxSize
+// bytes or has been open for interval, keeping backups old files as
+// path.1 (newest) to path.N. A zero maxSize or interval disables that
+// trigger. It can also be reopened from outside, for logrotate.
+type logFile struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	opened   time.Time
+	maxSize  int64
+	interval time.Duration
+	backups  int
+}
+
+func openLogFile(path string, maxSize int64, interval time.Duration, backups int) (*logFile, error) {
+	l := &logFile{path: path, maxSize: maxSize, interval: interval, backups: backups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens path for appending. Callers hold mu, except openLogFile.
+func (l *logFile) open() error {
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", l.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", l.path, err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	l.opened = time.Now()
+	return nil
+}
+
+func (l *logFile) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && ((l.maxSize > 0 && l.size+int64(len(p)) > l.maxSize) ||
+		(l.interval > 0 && time.Since(l.opened) >= l.interval)) {
+		// A failed rotation keeps writing to the current file rather
+		// than losing the record.
+		if err := l.rotate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 to path.N and so on, moves the current file to
+// path.1 and starts a new one.
+func (l *logFile) rotate() error {
+	if l.backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.backups))
+		for i := l.backups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate log file %s: %w", l.path, err)
+		}
+	} else if err := os.Truncate(l.path, 0); err != nil {
+		return fmt.Errorf("failed to truncate log file %s: %w", l.path, err)
+	}
+
+	return l.reopenLocked()
+}
+
+// Reopen closes the file and opens path again, picking up a new file
+// after an external tool such as logrotate has moved the old one away.
+func (l *logFile) Reopen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reopenLocked()
+}
+
+func (l *logFile) reopenLocked() error {
+	old := l.file
+	if err := l.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
+}
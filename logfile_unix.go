@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reopenLogOnSignal reopens the log file whenever SIGUSR1 arrives, which
+// is what a logrotate postrotate script sends after moving it away.
+func reopenLogOnSignal(l *logFile) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	go func() {
+		for range signals {
+			if err := l.Reopen(); err != nil {
+				logger.Error("failed to reopen log file", "error", err)
+				continue
+			}
+			logger.Info("reopened log file", "path", l.path)
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+// +build windows
+
+package main
+
+// reopenLogOnSignal does nothing on Windows, which has no SIGUSR1; the
+// size and interval rotation still apply.
+func reopenLogOnSignal(l *logFile) {}
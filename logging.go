@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logIdentifier tags records sent to syslog and journald
+const logIdentifier = "munin-node"
+
+// logLevel is shared by every handler, so the level can be set once the
+// config has been read without rebuilding the logger.
+var logLevel = new(slog.LevelVar)
+
+// logger is the daemon's log. Until configureLogging runs it writes text
+// at info level to standard output, so config errors are still reported.
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+
+// parseLogLevel accepts the level names of log_level.
+func parseLogLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", value)
+}
+
+// configureLogging sets up the logger from the log_level, log_format and
+// log_destination of conf.
+func configureLogging(conf *NodeConfig) error {
+	level, err := parseLogLevel(conf.LogLevel)
+	if err != nil {
+		return err
+	}
+	logLevel.Set(level)
+
+	format := strings.ToLower(conf.LogFormat)
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q", conf.LogFormat)
+	}
+
+	destination := strings.ToLower(conf.LogDestination)
+	if destination == "" {
+		destination = "stdout"
+		if conf.LogFile != "" {
+			destination = "file"
+		}
+	}
+
+	var output io.Writer
+	switch destination {
+	case "stdout":
+		output = os.Stdout
+	case "file":
+		if conf.LogFile == "" {
+			return fmt.Errorf("log_destination file needs log_file")
+		}
+		file, err := openLogFile(conf.LogFile, conf.LogMaxSize, conf.LogRotateInterval, conf.LogBackups)
+		if err != nil {
+			return err
+		}
+		reopenLogOnSignal(file)
+		output = file
+	case "syslog":
+		formatLine := formatLogLine
+		if format == "json" {
+			formatLine = formatLogJSON
+		}
+		handler, err := newSyslogHandler(conf.LogFacility, formatLine, logLevel)
+		if err != nil {
+			return err
+		}
+		logger = slog.New(handler)
+		return nil
+	case "journald":
+		handler, err := newJournaldHandler(logLevel)
+		if err != nil {
+			return err
+		}
+		logger = slog.New(handler)
+		// Journal entries keep every attribute as a field of its own
+		if format == "json" {
+			logger.Warn("log_format json is ignored with log_destination journald")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown log destination %q", conf.LogDestination)
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	if format == "json" {
+		logger = slog.New(slog.NewJSONHandler(output, options))
+	} else {
+		logger = slog.New(slog.NewTextHandler(output, options))
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// logField is one attribute of a record, its key prefixed by any groups
+// it was nested in.
+type logField struct {
+	key   string
+	value string
+}
+
+// fieldHandler is a slog.Handler for backends that take a message and a
+// flat list of fields rather than a byte stream, such as syslog and
+// journald. emit does the actual writing.
+type fieldHandler struct {
+	level  slog.Leveler
+	fields []logField
+	prefix string
+	emit   func(level slog.Level, msg string, fields []logField) error
+}
+
+func (h *fieldHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *fieldHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := append([]logField(nil), h.fields...)
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendLogField(fields, h.prefix, attr)
+		return true
+	})
+	return h.emit(r.Level, r.Message, fields)
+}
+
+func (h *fieldHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.fields = append([]logField(nil), h.fields...)
+	for _, attr := range attrs {
+		clone.fields = appendLogField(clone.fields, h.prefix, attr)
+	}
+	return &clone
+}
+
+func (h *fieldHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// appendLogField flattens attr, expanding groups into dotted keys.
+func appendLogField(fields []logField, prefix string, attr slog.Attr) []logField {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			fields = appendLogField(fields, prefix, member)
+		}
+		return fields
+	}
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	return append(fields, logField{key: prefix + attr.Key, value: attr.Value.String()})
+}
+
+// formatLogLine renders a message and its fields as one text line in the
+// key=value style of the text handler.
+func formatLogLine(msg string, fields []logField) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, field := range fields {
+		value := field.value
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(" " + field.key + "=" + value)
+	}
+	return b.String()
+}
+
+// formatLogJSON renders a message and its fields as one JSON object, keyed
+// like the output of the JSON handler.
+func formatLogJSON(msg string, fields []logField) string {
+	var b strings.Builder
+	b.WriteString(`{"msg":`)
+	writeJSONString(&b, msg)
+	for _, field := range fields {
+		b.WriteByte(',')
+		writeJSONString(&b, field.key)
+		b.WriteByte(':')
+		writeJSONString(&b, field.value)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	encoded, _ := json.Marshal(s)
+	b.Write(encoded)
+}
@@ -0,0 +1,85 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+const journaldSocket = "/run/systemd/journal/socket"
+
+// newJournaldHandler logs to journald over its native protocol, so every
+// attribute becomes a journal field, e.g. plugin=cpu as PLUGIN=cpu, and
+// can be matched with journalctl PLUGIN=cpu.
+func newJournaldHandler(level slog.Leveler) (slog.Handler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+
+	return &fieldHandler{
+		level: level,
+		emit: func(level slog.Level, msg string, fields []logField) error {
+			var b bytes.Buffer
+			writeJournaldField(&b, "MESSAGE", msg)
+			writeJournaldField(&b, "PRIORITY", journaldPriority(level))
+			writeJournaldField(&b, "SYSLOG_IDENTIFIER", logIdentifier)
+			for _, field := range fields {
+				writeJournaldField(&b, journaldFieldName(field.key), field.value)
+			}
+			_, err := conn.Write(b.Bytes())
+			return err
+		},
+	}, nil
+}
+
+// journaldPriority maps a level to its syslog severity
+func journaldPriority(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "3"
+	case level >= slog.LevelWarn:
+		return "4"
+	case level >= slog.LevelInfo:
+		return "6"
+	}
+	return "7"
+}
+
+// journaldFieldName turns a key into a valid journal field name: upper
+// case letters, digits and underscores, not starting with an underscore,
+// which journald reserves for its own fields, or a digit.
+func journaldFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || name[0] == '_' || (name[0] >= '0' && name[0] <= '9') {
+		name = "F" + name
+	}
+	return name
+}
+
+// writeJournaldField appends one field in the native protocol, using the
+// length-prefixed form for values that contain a newline.
+func writeJournaldField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteString("=" + value + "\n")
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+func newJournaldHandler(level slog.Leveler) (slog.Handler, error) {
+	return nil, errors.New("journald logging is only supported on Linux")
+}
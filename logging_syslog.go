@@ -0,0 +1,64 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"log/syslog"
+	"strings"
+)
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// newSyslogHandler logs to the local syslog daemon under facility, each
+// record as one line rendered by format at the matching syslog severity.
+func newSyslogHandler(facility string, format func(msg string, fields []logField) string, level slog.Leveler) (slog.Handler, error) {
+	priority, ok := syslogFacilities[strings.ToLower(facility)]
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+
+	writer, err := syslog.New(priority|syslog.LOG_INFO, logIdentifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+
+	return &fieldHandler{
+		level: level,
+		emit: func(level slog.Level, msg string, fields []logField) error {
+			line := format(msg, fields)
+			switch {
+			case level >= slog.LevelError:
+				return writer.Err(line)
+			case level >= slog.LevelWarn:
+				return writer.Warning(line)
+			case level >= slog.LevelInfo:
+				return writer.Info(line)
+			}
+			return writer.Debug(line)
+		},
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+func newSyslogHandler(facility string, format func(msg string, fields []logField) string, level slog.Leveler) (slog.Handler, error) {
+	return nil, errors.New("syslog logging is not supported on this platform")
+}
@@ -0,0 +1,52 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package main
+
+/*
+#include <mach/mach.h>
+#include <unistd.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// cpuFields are the host_cpu_load_info columns in CPU_STATE order
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"user", "CPU time spent by normal programs and daemons"},
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"idle", "Idle CPU time"},
+	{"nice", "CPU time spent by nice(1)d programs"},
+}
+
+// readCPUTimes returns the ticks all CPUs spent in each state, as Mach
+// has no kern.cp_time to read through sysctl
+func readCPUTimes() ([]uint64, error) {
+	var info C.host_cpu_load_info_data_t
+	count := C.mach_msg_type_number_t(C.HOST_CPU_LOAD_INFO_COUNT)
+
+	host := C.mach_host_self()
+	defer C.mach_port_deallocate(C.mach_task_self_, host)
+
+	ret := C.host_statistics(host, C.HOST_CPU_LOAD_INFO, C.host_info_t(unsafe.Pointer(&info)), &count)
+	if ret != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("host_statistics: kern_return_t %d", int(ret))
+	}
+
+	times := make([]uint64, C.CPU_STATE_MAX)
+	for i := range times {
+		times[i] = uint64(info.cpu_ticks[i])
+	}
+	return times, nil
+}
+
+// statClockRate returns the rate the Mach CPU ticks count at
+func statClockRate() (uint64, error) {
+	return uint64(C.sysconf(C._SC_CLK_TCK)), nil
+}
@@ -0,0 +1,263 @@
+//go:build !minimal || metrics
+// +build !minimal metrics
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPath is where metrics_listen serves the node's own metrics
+const metricsPath = "/internal/metrics"
+
+// metricDurationBuckets are the histogram buckets, in seconds, for command
+// and plugin timings: from a cached builtin to a plugin near its timeout.
+var metricDurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric is one metric family that can write itself in the Prometheus text
+// exposition format.
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+var metricRegistry []metric
+
+// metricLabels renders label names and values as {a="x",b="y"}.
+func metricLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%q", name, values[i])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// metricCounter is a counter, or with kind "gauge" a gauge, partitioned by
+// labels.
+type metricCounter struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	values []string
+	value  float64
+}
+
+func newCounter(name, help string, labels ...string) *metricCounter {
+	c := &metricCounter{name: name, help: help, kind: "counter", labels: labels, series: map[string]*counterSeries{}}
+	metricRegistry = append(metricRegistry, c)
+	return c
+}
+
+func newGauge(name, help string, labels ...string) *metricCounter {
+	c := newCounter(name, help, labels...)
+	c.kind = "gauge"
+	return c
+}
+
+func (c *metricCounter) add(delta float64, values ...string) {
+	key := metricLabels(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	series := c.series[key]
+	if series == nil {
+		series = &counterSeries{values: values}
+		c.series[key] = series
+	}
+	series.value += delta
+}
+
+func (c *metricCounter) inc(values ...string) {
+	c.add(1, values...)
+}
+
+func (c *metricCounter) dec(values ...string) {
+	c.add(-1, values...)
+}
+
+// each calls fn with the label values and value of every series, in the
+// order of their labels.
+func (c *metricCounter) each(fn func(values []string, value float64)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(c.series[key].values, c.series[key].value)
+	}
+}
+
+func (c *metricCounter) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, c.help, c.name, c.kind)
+	c.each(func(values []string, value float64) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, metricLabels(c.labels, values), strconv.FormatFloat(value, 'g', -1, 64))
+	})
+}
+
+// metricHistogram is a histogram partitioned by labels.
+type metricHistogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *metricHistogram {
+	h := &metricHistogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	metricRegistry = append(metricRegistry, h)
+	return h
+}
+
+func (h *metricHistogram) observe(value float64, values ...string) {
+	key := metricLabels(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series := h.series[key]
+	if series == nil {
+		series = &histogramSeries{values: values, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// since observes the seconds elapsed since start
+func (h *metricHistogram) since(start time.Time, values ...string) {
+	h.observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *metricHistogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range keys {
+		series := h.series[key]
+		values := append(append([]string(nil), series.values...), "")
+		for i, bound := range h.buckets {
+			values[len(values)-1] = strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, metricLabels(labels, values), series.counts[i])
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, metricLabels(labels, values), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, strconv.FormatFloat(series.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, series.count)
+	}
+}
+
+var (
+	metricConnections = newCounter("munin_node_connections_total",
+		"Connections accepted, by listener.", "listener")
+	metricConnectionsDenied = newCounter("munin_node_connections_denied_total",
+		"Connections refused by the access rules, by listener.", "listener")
+	metricConnectionsActive = newGauge("munin_node_connections_active",
+		"Connections currently being served.")
+	metricCommands = newCounter("munin_node_commands_total",
+		"Protocol commands received, by command.", "command")
+	metricCommandDuration = newHistogram("munin_node_command_duration_seconds",
+		"Time taken to answer a protocol command, by command.", metricDurationBuckets, "command")
+	metricPluginDuration = newHistogram("munin_node_plugin_duration_seconds",
+		"Time taken to run a plugin, by plugin and option.", metricDurationBuckets, "plugin", "option")
+	metricPluginErrors = newCounter("munin_node_plugin_errors_total",
+		"Plugin runs that failed, by plugin and option.", "plugin", "option")
+	metricErrors = newCounter("munin_node_errors_total",
+		"Errors outside plugins, by kind.", "kind")
+	metricCacheHits = newCounter("munin_node_cache_hits_total",
+		"Lookups answered from a cache, by cache.", "cache")
+	metricCacheMisses = newCounter("munin_node_cache_misses_total",
+		"Lookups a cache could not answer, by cache.", "cache")
+)
+
+// writeMetrics writes every registered metric, plus the process figures
+// that are read rather than counted.
+func writeMetrics(w io.Writer) {
+	for _, m := range metricRegistry {
+		m.writeTo(w)
+	}
+
+	fmt.Fprintf(w, "# HELP munin_node_start_time_seconds Start time of the node since the Unix epoch.\n")
+	fmt.Fprintf(w, "# TYPE munin_node_start_time_seconds gauge\n")
+	fmt.Fprintf(w, "munin_node_start_time_seconds %d\n", metricStartTime.Unix())
+	fmt.Fprintf(w, "# HELP munin_node_goroutines Goroutines currently running.\n")
+	fmt.Fprintf(w, "# TYPE munin_node_goroutines gauge\n")
+	fmt.Fprintf(w, "munin_node_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# HELP munin_node_info Version of the node.\n")
+	fmt.Fprintf(w, "# TYPE munin_node_info gauge\n")
+	fmt.Fprintf(w, "munin_node_info{version=%q} 1\n", version)
+}
+
+// listenMetrics opens metrics_listen. It is done before privileges are
+// dropped, serving happens in serveMetrics.
+func listenMetrics(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start metrics server on %s: %w", address, err)
+	}
+
+	logger.Info("metrics server started", "address", address, "path", metricsPath)
+
+	return listener, nil
+}
+
+func (s *Server) serveMetrics(listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+	mux.HandleFunc(healthPath, s.serveHealth)
+
+	if err := http.Serve(listener, mux); err != nil {
+		logger.Error("metrics server stopped", "address", listener.Addr().String(), "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build minimal && !metrics
+// +build minimal,!metrics
+
+package main
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Without the metrics tag a minimal build counts nothing: the metrics are
+// no-ops, stats leaves them out and metrics_listen is refused.
+
+type metricCounter struct{}
+
+func (c *metricCounter) inc(values ...string) {}
+
+func (c *metricCounter) dec(values ...string) {}
+
+func (c *metricCounter) each(fn func(values []string, value float64)) {}
+
+type metricHistogram struct{}
+
+func (h *metricHistogram) since(start time.Time, values ...string) {}
+
+var (
+	metricConnections       = &metricCounter{}
+	metricConnectionsDenied = &metricCounter{}
+	metricConnectionsActive = &metricCounter{}
+	metricCommands          = &metricCounter{}
+	metricCommandDuration   = &metricHistogram{}
+	metricPluginDuration    = &metricHistogram{}
+	metricPluginErrors      = &metricCounter{}
+	metricErrors            = &metricCounter{}
+	metricCacheHits         = &metricCounter{}
+	metricCacheMisses       = &metricCounter{}
+)
+
+func listenMetrics(address string) (net.Listener, error) {
+	return nil, errors.New("metrics_listen needs a build with the metrics tag")
+}
+
+func (s *Server) serveMetrics(listener net.Listener) {}
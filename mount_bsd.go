@@ -0,0 +1,28 @@
+//go:build openbsd || netbsd || darwin
+// +build openbsd netbsd darwin
+
+package main
+
+import (
+	"strings"
+)
+
+// mountPoint is a mounted filesystem with its size in blocks
+type mountPoint struct {
+	device string
+	path   string
+	fstype string
+	blocks uint64
+	bfree  uint64
+	bavail uint64
+}
+
+// fieldName is the munin field name for a mount, derived from the device
+// like the stock df plugin does. Pseudo devices are named after the
+// mountpoint too, as they would collide otherwise.
+func (m mountPoint) fieldName() string {
+	if !strings.HasPrefix(m.device, "/") {
+		return cleanFieldName(m.device + m.path)
+	}
+	return cleanFieldName(m.device)
+}
@@ -0,0 +1,166 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dfDefaultExclude is the fstype exclude list of the stock df plugin
+const dfDefaultExclude = "none unknown rootfs iso9660 squashfs udf romfs ramfs debugfs cgroup_root devtmpfs"
+
+type mountPoint struct {
+	device string
+	path   string
+	fstype string
+}
+
+// fieldName is the munin field name for a mount, derived from the device
+// like the stock df plugin does. Pseudo devices such as tmpfs are named
+// after the mountpoint instead, as they would all collide otherwise.
+func (m mountPoint) fieldName() string {
+	if !strings.HasPrefix(m.device, "/") {
+		return cleanFieldName(m.device + m.path)
+	}
+	return cleanFieldName(m.device)
+}
+
+// unescapeMountField decodes the octal escapes used in /proc/mounts
+// for spaces, tabs, newlines and backslashes.
+func unescapeMountField(field string) string {
+	if !strings.Contains(field, "\\") {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		if field[i] == '\\' && i+3 < len(field) {
+			if c, err := strconv.ParseUint(field[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(field[i])
+	}
+	return b.String()
+}
+
+// discoverMounts lists mounted filesystems, skipping the fstypes in
+// env.exclude and mountpoints matching env.exclude_re.
+func discoverMounts(req *pluginRequest) ([]mountPoint, error) {
+	file, err := os.Open(procPath("self", "mounts"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open mounts: %w", err)
+	}
+	defer file.Close()
+
+	excluded := make(map[string]bool)
+	for _, fstype := range strings.Fields(req.getenv("exclude", dfDefaultExclude)) {
+		excluded[fstype] = true
+	}
+
+	var excludeRe *regexp.Regexp
+	if pattern := req.getenv("exclude_re", ""); pattern != "" {
+		excludeRe, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_re: %w", err)
+		}
+	}
+
+	var mounts []mountPoint
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		mount := mountPoint{
+			device: unescapeMountField(fields[0]),
+			path:   unescapeMountField(fields[1]),
+			fstype: fields[2],
+		}
+
+		// Bind mounts of the same device would report the same figures
+		if excluded[mount.fstype] || seen[mount.fieldName()] {
+			continue
+		}
+		if excludeRe != nil && excludeRe.MatchString(mount.path) {
+			continue
+		}
+
+		seen[mount.fieldName()] = true
+		mounts = append(mounts, mount)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+
+	return mounts, nil
+}
+
+const dfDefaultTimeout = 5 * time.Second
+
+func dfTimeout(req *pluginRequest) time.Duration {
+	if seconds, err := strconv.ParseFloat(req.getenv("timeout", ""), 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return dfDefaultTimeout
+}
+
+// pendingStatfs tracks mountpoints whose statfs call has not returned yet,
+// so a hung NFS server doesn't pile up a goroutine on every poll.
+var pendingStatfs = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// statfsTimeout runs statfs on path but gives up after timeout.
+func statfsTimeout(path string, timeout time.Duration) (*syscall.Statfs_t, error) {
+	pendingStatfs.Lock()
+	if pendingStatfs.paths[path] {
+		pendingStatfs.Unlock()
+		return nil, fmt.Errorf("statfs on %s is still hanging", path)
+	}
+	pendingStatfs.paths[path] = true
+	pendingStatfs.Unlock()
+
+	type result struct {
+		stat syscall.Statfs_t
+		err  error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		var r result
+		r.err = syscall.Statfs(path, &r.stat)
+
+		pendingStatfs.Lock()
+		delete(pendingStatfs.paths, path)
+		pendingStatfs.Unlock()
+
+		done <- r
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &r.stat, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("statfs on %s timed out", path)
+	}
+}
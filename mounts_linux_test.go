@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "testing"
+
+func TestUnescapeMountField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"/mnt/data", "/mnt/data"},
+		{`/mnt/my\040disk`, "/mnt/my disk"},
+		{`/mnt/tab\011here`, "/mnt/tab\there"},
+		{`/mnt/back\134slash`, `/mnt/back\slash`},
+		{`/mnt/end\040`, "/mnt/end "},
+		{`/mnt/short\04`, `/mnt/short\04`},
+		{`/mnt/not\999octal`, `/mnt/not\999octal`},
+		{`\040\040`, "  "},
+	}
+	for _, test := range tests {
+		if got := unescapeMountField(test.field); got != test.want {
+			t.Errorf("unescapeMountField(%q) = %q, want %q", test.field, got, test.want)
+		}
+	}
+}
@@ -2,22 +2,31 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-
-	slog "github.com/OloloevReal/go-simple-log"
+	"time"
 )
 
 const (
 	lineMax        = 2048
 	version        = "1.0.6-go"
 	nodeConfigPath = "node.conf"
+	// pluginWaitDelay bounds how long the output of a killed plugin is
+	// waited for
+	pluginWaitDelay = 5 * time.Second
+	// defaultErrorPluginThreshold is error_plugin_threshold when not set,
+	// kept here as builds without error reports still read the directive
+	defaultErrorPluginThreshold = 3
 )
 
 type NodeConfig struct {
@@ -27,11 +36,100 @@ type NodeConfig struct {
 	Port         string
 	PluginFolder string
 	PluginConfig string
+	EnvWhitelist []string
+	CleanEnv     bool
+	PluginACLs   []PluginACL
+	UnixSocket   string
+	AllowedUIDs  []uint32
+	AllowedGIDs  []uint32
+
+	TLS                  string
+	TLSCertificate       string
+	TLSPrivateKey        string
+	TLSCACertificate     string
+	TLSVerifyCertificate bool
+
+	DropCapabilities bool
+	KeepCapabilities []string
+
+	AllowFile  string
+	AdminAllow []string
+
+	LogLevel          string
+	LogFormat         string
+	LogFile           string
+	LogMaxSize        int64
+	LogRotateInterval time.Duration
+	LogBackups        int
+	LogDestination    string
+	LogFacility       string
+
+	MetricsListen string
+	PprofListen   string
+
+	OtelEndpoint    string
+	OtelServiceName string
+
+	DebugProtocol       []string
+	DebugProtocolRedact []string
+
+	ErrorSentryDSN       string
+	ErrorWebhook         string
+	ErrorPluginThreshold int
+
+	DrainTimeout time.Duration
+	PIDFile      string
+	Background   bool
+
+	Builtins       []string
+	Profile        string
+	PluginCacheTTL time.Duration
+	ConfigCacheTTL time.Duration
+	Prefetch       int
+
+	UpdateURL       string
+	UpdatePublicKey string
 }
 
-var nodeConf = NodeConfig{}
+// defaultPluginPath is handed to plugins when clean_env is enabled and
+// PATH is not set explicitly through plugin config.
+const defaultPluginPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// protectedEnvVars lists variables that plugin config may not override
+// unless they are named by an env_whitelist directive in node.conf.
+var protectedEnvVars = []string{
+	"PATH",
+	"IFS",
+	"ENV",
+	"BASH_ENV",
+	"SHELLOPTS",
+	"PS4",
+	"LD_PRELOAD",
+	"LD_LIBRARY_PATH",
+	"LD_AUDIT",
+	"PERL5LIB",
+	"PERL5OPT",
+	"PYTHONPATH",
+	"PYTHONSTARTUP",
+	"RUBYLIB",
+	"RUBYOPT",
+}
 
-func readNodeConfig(configPath string) error {
+// newNodeConfig returns the configuration before node.conf is read
+func newNodeConfig() *NodeConfig {
+	return &NodeConfig{
+		LogBackups:           defaultLogBackups,
+		LogFacility:          "daemon",
+		OtelServiceName:      "munin-node",
+		ErrorPluginThreshold: defaultErrorPluginThreshold,
+		DrainTimeout:         defaultDrainTimeout,
+		PluginCacheTTL:       -1,
+		TLS:                  tlsDisabled,
+	}
+}
+
+// read applies the directives of a node.conf file
+func (c *NodeConfig) read(configPath string) error {
 	file, err := os.Open(configPath)
 	if err != nil {
 		return fmt.Errorf("could not open configuration file: %w", err)
@@ -51,28 +149,10 @@ func readNodeConfig(configPath string) error {
 			continue
 		}
 
-		key := parts[0]
-		value := parts[1]
-
-		switch key {
-		case "host_name":
-			nodeConf.HostName = value
-		case "allow":
-			nodeConf.AllowedIPs = append(nodeConf.AllowedIPs, value)
-		case "host":
-			if value == "*" {
-				nodeConf.Host = ""
-			} else {
-				nodeConf.Host = value
-			}
-		case "port":
-			nodeConf.Port = value
-		case "plugins":
-			nodeConf.PluginFolder = value
-		case "plugins_config":
-			nodeConf.PluginConfig = value
+		// Directives of munin's own node, such as setsid, are left alone
+		if err := c.apply(parts[0], parts[1]); err != nil && !errors.Is(err, errUnknownDirective) {
+			return err
 		}
-
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -82,11 +162,181 @@ func readNodeConfig(configPath string) error {
 	return nil
 }
 
-func isAllowedIP(clientIP string, allowedPatterns []string) bool {
+// errUnknownDirective is returned by apply for a directive it does not know
+var errUnknownDirective = errors.New("unknown directive")
+
+// apply sets a node.conf directive
+func (c *NodeConfig) apply(key, value string) error {
+	switch key {
+	case "host_name":
+		c.HostName = value
+	case "allow":
+		c.AllowedIPs = append(c.AllowedIPs, value)
+	case "host":
+		if value == "*" {
+			c.Host = ""
+		} else {
+			c.Host = value
+		}
+	case "port":
+		c.Port = value
+	case "plugins":
+		c.PluginFolder = value
+	case "plugins_config":
+		c.PluginConfig = value
+	case "env_whitelist":
+		c.EnvWhitelist = append(c.EnvWhitelist, strings.Fields(value)...)
+	case "clean_env":
+		c.CleanEnv = parseConfigBool(value)
+	case "plugin_acl":
+		acl, err := parsePluginACL(value)
+		if err != nil {
+			return err
+		}
+		c.PluginACLs = append(c.PluginACLs, acl)
+	case "unix_socket":
+		c.UnixSocket = value
+	case "tls":
+		if value != tlsDisabled && value != tlsEnabled && value != tlsParanoid {
+			return fmt.Errorf("invalid tls directive: %s", value)
+		}
+		c.TLS = value
+	case "tls_certificate":
+		c.TLSCertificate = value
+	case "tls_private_key":
+		c.TLSPrivateKey = value
+	case "tls_ca_certificate":
+		c.TLSCACertificate = value
+	case "tls_verify_certificate":
+		c.TLSVerifyCertificate = parseConfigBool(value)
+	case "allow_uid":
+		ids, err := parseIDList(value)
+		if err != nil {
+			return fmt.Errorf("invalid allow_uid directive: %w", err)
+		}
+		c.AllowedUIDs = append(c.AllowedUIDs, ids...)
+	case "allow_gid":
+		ids, err := parseIDList(value)
+		if err != nil {
+			return fmt.Errorf("invalid allow_gid directive: %w", err)
+		}
+		c.AllowedGIDs = append(c.AllowedGIDs, ids...)
+	case "allow_file":
+		c.AllowFile = value
+	case "admin_allow":
+		c.AdminAllow = append(c.AdminAllow, value)
+	case "drop_capabilities":
+		c.DropCapabilities = parseConfigBool(value)
+	case "keep_capabilities":
+		c.KeepCapabilities = append(c.KeepCapabilities, strings.Fields(value)...)
+	case "log_level":
+		c.LogLevel = value
+	case "log_format":
+		c.LogFormat = value
+	case "log_file":
+		c.LogFile = value
+	case "log_destination":
+		c.LogDestination = value
+	case "log_facility":
+		c.LogFacility = value
+	case "metrics_listen":
+		c.MetricsListen = value
+	case "pprof_listen":
+		c.PprofListen = value
+	case "otel_endpoint":
+		c.OtelEndpoint = value
+	case "otel_service_name":
+		c.OtelServiceName = value
+	case "debug_protocol":
+		c.DebugProtocol = append(c.DebugProtocol, strings.Fields(value)...)
+	case "debug_protocol_redact":
+		c.DebugProtocolRedact = append(c.DebugProtocolRedact, strings.Fields(value)...)
+	case "error_sentry_dsn":
+		c.ErrorSentryDSN = value
+	case "error_webhook":
+		c.ErrorWebhook = value
+	case "error_plugin_threshold":
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			return fmt.Errorf("invalid error_plugin_threshold directive: %s", value)
+		}
+		c.ErrorPluginThreshold = threshold
+	case "log_max_size":
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return fmt.Errorf("invalid log_max_size directive: %s", value)
+		}
+		c.LogMaxSize = size * 1024 * 1024
+	case "log_rotate_interval":
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < 0 {
+			return fmt.Errorf("invalid log_rotate_interval directive: %s", value)
+		}
+		c.LogRotateInterval = interval
+	case "profile":
+		if value != profileDefault && value != profileEmbedded {
+			return fmt.Errorf("invalid profile directive: %s", value)
+		}
+		c.Profile = value
+	case "update_url":
+		c.UpdateURL = value
+	case "update_public_key":
+		c.UpdatePublicKey = value
+	case "builtins":
+		c.Builtins = append(c.Builtins, strings.Fields(value)...)
+	case "background":
+		c.Background = parseConfigBool(value)
+	case "pid_file":
+		c.PIDFile = value
+	case "plugin_cache_ttl":
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid plugin_cache_ttl directive: %s", value)
+		}
+		c.PluginCacheTTL = ttl
+	case "config_cache_ttl":
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return fmt.Errorf("invalid config_cache_ttl directive: %s", value)
+		}
+		c.ConfigCacheTTL = ttl
+	case "prefetch":
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 0 {
+			return fmt.Errorf("invalid prefetch directive: %s", value)
+		}
+		c.Prefetch = workers
+	case "drain_timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return fmt.Errorf("invalid drain_timeout directive: %s", value)
+		}
+		c.DrainTimeout = timeout
+	case "log_backups":
+		backups, err := strconv.Atoi(value)
+		if err != nil || backups < 0 {
+			return fmt.Errorf("invalid log_backups directive: %s", value)
+		}
+		c.LogBackups = backups
+	default:
+		return fmt.Errorf("%w %s", errUnknownDirective, key)
+	}
+	return nil
+}
+
+func parseConfigBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "yes", "true", "on":
+		return true
+	}
+	return false
+}
+
+func (s *Server) isAllowedIP(clientIP string, allowedPatterns []string) bool {
 	for _, pattern := range allowedPatterns {
-		match, err := regexp.MatchString(pattern, clientIP)
+		match, err := s.matchPattern(pattern, clientIP)
 		if err != nil {
-			fmt.Printf("Error in IP permission template: %v\n", err)
+			logger.Warn("invalid IP permission pattern", "pattern", pattern, "error", err)
 			continue
 		}
 		if match {
@@ -96,37 +346,71 @@ func isAllowedIP(clientIP string, allowedPatterns []string) bool {
 	return false
 }
 
-func listPlugins() string {
-	files, err := ioutil.ReadDir(nodeConf.PluginFolder)
-	if err != nil {
-		slog.Printf("failed to read directory %s: %w", nodeConf.PluginFolder, err)
-		return ""
+func (s *Server) isProtectedEnvVar(key string) bool {
+	for _, allowed := range s.conf.EnvWhitelist {
+		if key == allowed {
+			return false
+		}
+	}
+
+	for _, protected := range protectedEnvVars {
+		if key == protected {
+			return true
+		}
 	}
 
+	// The dynamic linker honours a whole family of LD_* variables
+	return strings.HasPrefix(key, "LD_")
+}
+
+// listPlugins returns the plugins of node: those from the plugin folder
+// and the local built-in ones for this node, or the built-in plugins
+// reporting for a virtual node.
+func (s *Server) listPlugins(ctx context.Context, node string, patterns []string) []string {
 	var plugins []string
-	for _, file := range files {
-		if !file.IsDir() {
-			plugins = append(plugins, file.Name())
+	seen := make(map[string]bool)
+	if node == s.conf.HostName {
+		for _, file := range s.pluginFiles() {
+			if file.runnable && !file.wildcard && isPluginAllowed(file.name, patterns) {
+				plugins = append(plugins, file.name)
+				seen[file.name] = true
+			}
+		}
+	}
+
+	for _, name := range s.listBuiltins(ctx) {
+		pluginNode := s.builtinNode(name)
+		if pluginNode == "" {
+			pluginNode = s.conf.HostName
+		}
+		if pluginNode != node {
+			continue
+		}
+		if !seen[name] && isPluginAllowed(name, patterns) {
+			plugins = append(plugins, name)
 		}
 	}
 
-	return strings.Join(plugins, " ") + "\n"
+	return plugins
 }
 
-func loadPluginConfig(plugin string) error {
-	absPluginConf, err := filepath.Abs(nodeConf.PluginConfig)
+// loadPluginConfig returns the env.* settings that apply to plugin as
+// KEY=value pairs suitable for exec.Cmd.Env.
+func (s *Server) loadPluginConfig(plugin string) ([]string, error) {
+	absPluginConf, err := filepath.Abs(s.conf.PluginConfig)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path to plugin config: %w", err)
+		return nil, fmt.Errorf("failed to get absolute path to plugin config: %w", err)
 	}
 
 	file, err := os.Open(absPluginConf)
 	if err != nil {
-		return fmt.Errorf("unable to open file: %w", err)
+		return nil, fmt.Errorf("unable to open file: %w", err)
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
 	var currentSection string
+	var env []string
 
 	possibleSections := generatePossibleSections(plugin)
 
@@ -140,6 +424,7 @@ func loadPluginConfig(plugin string) error {
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
 			section := line[1 : len(line)-1]
 
+			currentSection = ""
 			for _, sec := range possibleSections {
 				if section == sec {
 					currentSection = section
@@ -152,27 +437,70 @@ func loadPluginConfig(plugin string) error {
 		if currentSection != "" && strings.HasPrefix(line, "env.") {
 			parts := strings.SplitN(line, " ", 2)
 			if len(parts) != 2 {
-				return fmt.Errorf("invalid string format: %s", line)
+				return nil, fmt.Errorf("invalid string format: %s", line)
 			}
 
 			key := strings.TrimPrefix(parts[0], "env.")
 			value := strings.TrimSpace(parts[1])
 
-			if err := os.Setenv(key, value); err != nil {
-				return fmt.Errorf("failed to set environment variable: %w", err)
+			if s.isProtectedEnvVar(key) {
+				logger.Warn("refusing to set protected env variable", "plugin", plugin, "variable", key)
+				continue
 			}
 
-			slog.Printf("env variable %s with value %s set for plugin %s\n", key, value, plugin)
+			env = append(env, key+"="+value)
+
+			logger.Debug("env variable set", "plugin", plugin, "variable", key, "value", value)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("file read error: %w", err)
+		return nil, fmt.Errorf("file read error: %w", err)
 	}
 
-	slog.Println("env variables successfully set for plugin:", plugin)
+	logger.Debug("plugin config loaded", "plugin", plugin)
 
-	return nil
+	return env, nil
+}
+
+// nodeOnlyEnv are the variables systemd addresses to the node itself,
+// which would let a plugin take over its sockets or notify as the node
+var nodeOnlyEnv = []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", "NOTIFY_SOCKET", "WATCHDOG_PID", "WATCHDOG_USEC"}
+
+// pluginEnvironment builds the full environment for a plugin process. By
+// default the daemon's own environment is inherited; with clean_env only
+// MUNIN_* variables and the configured env.* settings are passed on.
+// Neither includes the node's MUNIN_NODE_* configuration, which holds
+// secrets such as error_sentry_dsn, nor nodeOnlyEnv.
+func (s *Server) pluginEnvironment(configured []string) []string {
+	var env []string
+	if s.conf.CleanEnv {
+		env = append(env, "PATH="+defaultPluginPath)
+	}
+	for _, kv := range inheritableEnviron() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, containerEnvPrefix) || slices.Contains(nodeOnlyEnv, name) {
+			continue
+		}
+		if !s.conf.CleanEnv || strings.HasPrefix(name, "MUNIN_") {
+			env = append(env, kv)
+		}
+	}
+
+	return append(env, configured...)
+}
+
+// inheritableEnviron is the node's environment without the variables
+// that pass file descriptors to this process only
+func inheritableEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !slices.Contains(handoverEnv, name) {
+			env = append(env, kv)
+		}
+	}
+	return env
 }
 
 func generatePossibleSections(plugin string) []string {
@@ -180,24 +508,27 @@ func generatePossibleSections(plugin string) []string {
 
 	// Load global variables from [*] section
 	sections = append(sections, "*")
-	
+
 	parts := strings.Split(plugin, "_")
 
 	for i := len(parts); i > 0; i-- {
 		sections = append(sections, strings.Join(parts[:i], "_")+"_*")
 	}
 
+	// An exact [plugin] section is the most specific one
+	sections = append(sections, plugin)
+
 	return sections
 }
 
-func validatePluginPath(pluginPath string) error {
+func (s *Server) validatePluginPath(pluginPath string) error {
 
 	absPluginPath, err := filepath.Abs(pluginPath)
 	if err != nil {
 		return fmt.Errorf("не вдалося отримати абсолютний шлях до плагіна: %w", err)
 	}
 
-	absAllowedDir, err := filepath.Abs(nodeConf.PluginFolder)
+	absAllowedDir, err := filepath.Abs(s.conf.PluginFolder)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path to allowed folder: %w", err)
 	}
@@ -218,76 +549,357 @@ func validatePluginPath(pluginPath string) error {
 	return nil
 }
 
-func executePlugin(plugin string, option string) (string, error) {
+func (s *Server) executePlugin(ctx context.Context, plugin string, option string) (string, error) {
+	release := s.acquirePluginSlot()
+	defer release()
 
-	pluginPath := filepath.Join(nodeConf.PluginFolder, plugin)
+	start := time.Now()
+	output, cached, err := s.runPlugin(ctx, plugin, option)
 
-	err := validatePluginPath(pluginPath)
-	if err != nil {
+	// Config output served from the cache is no plugin run
+	if cached {
+		return output, nil
+	}
+
+	// A plugin killed because its client is gone or the node stops did not
+	// fail
+	if err != nil && ctx.Err() != nil {
 		return "", err
 	}
 
-	err = loadPluginConfig(plugin)
+	label := s.pluginLabel(ctx, plugin)
+	metricPluginDuration.since(start, label, metricOption(option))
 	if err != nil {
-		return "", err
+		metricPluginErrors.inc(label, metricOption(option))
+	} else if label != "unknown" {
+		s.healthPluginSuccess(plugin)
+	}
+	if label != "unknown" {
+		s.recordPluginRun(plugin, label, option, start, err)
+		reportPluginResult(label, option, err)
 	}
 
-	cmd := exec.Command(pluginPath, option)
+	return output, err
+}
 
-	output, err := cmd.Output()
+// pluginLabel names plugin in metrics, stats and error reports. Names that
+// are no plugin at all share "unknown", and instances of a wildcard
+// built-in plugin that the host does not list share its prefix, so that
+// clients cannot create new series and entries at will.
+func (s *Server) pluginLabel(ctx context.Context, plugin string) string {
+	if _, err := os.Lstat(filepath.Join(s.conf.PluginFolder, plugin)); err == nil {
+		return plugin
+	}
+	builtin, instance := s.findBuiltin(plugin)
+	switch {
+	case builtin == nil:
+		return "unknown"
+	case instance == "" || slices.Contains(s.listBuiltins(ctx), plugin):
+		return plugin
+	}
+	return builtin.name
+}
+
+// runPlugin returns the output of plugin run with option, and whether it
+// is config output taken from the config cache rather than from a run.
+func (s *Server) runPlugin(ctx context.Context, plugin string, option string) (string, bool, error) {
+
+	pluginPath := filepath.Join(s.conf.PluginFolder, plugin)
+
+	// Built-in plugins are used unless shadowed by a file of the same name
+	if _, err := os.Lstat(pluginPath); os.IsNotExist(err) {
+		if builtin, instance := s.findBuiltin(plugin); builtin != nil {
+			output, err := s.executeBuiltin(ctx, builtin, plugin, instance, option)
+			return output, false, err
+		}
+	}
+
+	err := s.validatePluginPath(pluginPath)
 	if err != nil {
-		return "", fmt.Errorf("plugin failed to execute: %w", err)
+		return "", false, err
+	}
+
+	env, err := s.loadPluginConfig(plugin)
+	if err != nil {
+		return "", false, err
+	}
+
+	// config output is reused while neither the plugin nor its settings
+	// changed
+	cacheConfig := option == "config" && s.conf.ConfigCacheTTL > 0
+	var key configKey
+	if cacheConfig {
+		if key, err = newConfigKey(pluginPath, env); err != nil {
+			return "", false, err
+		}
+		if output, ok := s.cachedConfig(plugin, key); ok {
+			return output, true, nil
+		}
+	}
+
+	// A plugin is killed once the node stops waiting for it
+	cmd := exec.CommandContext(ctx, pluginPath, option)
+	cmd.Env = s.pluginEnvironment(env)
+	cmd.WaitDelay = pluginWaitDelay
+	killPluginGroup(cmd)
+
+	stdout := getOutputBuffer()
+	defer putOutputBuffer(stdout)
+	cmd.Stdout = stdout
+	stderr := stderrTail{getOutputBuffer()}
+	defer putOutputBuffer(stderr.buf)
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if line := stderr.lastLine(); line != "" {
+			return "", false, fmt.Errorf("plugin failed to execute: %w: %s", err, line)
+		}
+		return "", false, fmt.Errorf("plugin failed to execute: %w", err)
 	}
 
-	return string(output), nil
+	output := stdout.String()
+	if cacheConfig {
+		s.storeConfig(plugin, key, output)
+	}
+	return output, false, nil
 }
 
-func startNode() error {
-	listenAddr := net.JoinHostPort(nodeConf.Host, nodeConf.Port)
-	listener, err := net.Listen("tcp", listenAddr)
+// startNode serves clients until the server is shut down and its
+// connections are drained. Plugins still running are killed when ctx is
+// done or when drain_timeout runs out.
+func (s *Server) startNode(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	activated, activatedConn, err := activatedSockets()
 	if err != nil {
-		return fmt.Errorf("failed to start server on %s: %w", listenAddr, err)
+		return fmt.Errorf("failed to use sockets passed by systemd: %w", err)
 	}
-	defer listener.Close()
 
-	fmt.Printf("Node started on %s\n", listenAddr)
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return fmt.Errorf("failed to use sockets passed by the previous node: %w", err)
+	}
+	activation := "systemd"
+	if inherited != nil {
+		activated, activation = inherited["munin"], "upgrade"
+	}
+
+	// Sockets from systemd or the node being upgraded replace host, port
+	// and unix_socket
+	var tcpListeners []net.Listener
+	listeners := map[string][]net.Listener{"munin": activated}
+	for _, listener := range activated {
+		logger.Info("node started", "address", listener.Addr().String(), "activation", activation)
+		s.healthListener(listener.Addr().String(), nil)
+
+		if _, ok := listener.Addr().(*net.UnixAddr); ok {
+			go s.serveUnix(ctx, listener)
+		} else {
+			tcpListeners = append(tcpListeners, listener)
+		}
+	}
+
+	if activated == nil && activatedConn == nil {
+		listenAddr := net.JoinHostPort(s.conf.Host, s.conf.Port)
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to start server on %s: %w", listenAddr, err)
+		}
+
+		logger.Info("node started", "address", listenAddr)
+		s.healthListener(listenAddr, nil)
+		tcpListeners = append(tcpListeners, listener)
+		listeners["munin"] = append(listeners["munin"], listener)
+
+		if s.conf.UnixSocket != "" {
+			unixListener, err := s.listenUnix()
+			if err != nil {
+				return err
+			}
+			listeners["munin"] = append(listeners["munin"], unixListener)
+			go s.serveUnix(ctx, unixListener)
+		}
+	}
+
+	// An instance started for a single connection would only race its
+	// siblings for these addresses
+	if s.conf.MetricsListen != "" && activatedConn == nil {
+		var metricsListener net.Listener
+		if inherited["metrics"] != nil {
+			metricsListener = inherited["metrics"][0]
+		} else if metricsListener, err = listenMetrics(s.conf.MetricsListen); err != nil {
+			return err
+		}
+		listeners["metrics"] = []net.Listener{metricsListener}
+		go s.serveMetrics(metricsListener)
+	}
+
+	if s.conf.PprofListen != "" && activatedConn == nil {
+		var pprofListener net.Listener
+		if inherited["pprof"] != nil {
+			pprofListener = inherited["pprof"][0]
+		} else if pprofListener, err = listenPprof(s.conf.PprofListen); err != nil {
+			return err
+		}
+		listeners["pprof"] = []net.Listener{pprofListener}
+		go servePprof(pprofListener)
+	}
+
+	// Everything that may need privileges has happened by now
+	if s.conf.DropCapabilities {
+		if err := dropCapabilities(s.conf.KeepCapabilities); err != nil {
+			return fmt.Errorf("failed to drop capabilities: %w", err)
+		}
+	}
+
+	notifyReady(s)
+	notifyDaemonReady()
+
+	if activatedConn != nil {
+		s.serveActivatedConn(ctx, activatedConn)
+		return nil
+	}
+
+	replaceParent()
+	s.upgradeOnSignal(listeners)
+
+	for _, listener := range tcpListeners {
+		go s.serveTCP(ctx, listener)
+	}
+
+	select {
+	case <-s.shutdown.stopping:
+	case <-ctx.Done():
+		s.beginShutdown()
+	}
+	return s.drainConnections(cancel)
+}
+
+func (s *Server) serveTCP(ctx context.Context, listener net.Listener) {
+	defer listener.Close()
+	s.trackListener(listener)
+	listenAddr := listener.Addr().String()
 
 	for {
 		conn, err := listener.Accept()
+		if s.isShuttingDown() {
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
 		if err != nil {
-			fmt.Printf("Connection reception error: %v\n", err)
+			logger.Error("failed to accept connection", "address", listenAddr, "error", err)
+			metricErrors.inc("accept")
+			s.healthListener(listenAddr, err)
 			continue
 		}
+		s.healthListener(listenAddr, nil)
 
-		clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
-		if !isAllowedIP(clientIP, nodeConf.AllowedIPs) {
-			fmt.Printf("Access denied for IP: %s\n", clientIP)
+		if !s.admitTCP(conn) {
 			conn.Close()
 			continue
 		}
 
 		go func(conn net.Conn) {
 			defer conn.Close()
-			handleConnection(conn)
+			s.handleConnection(ctx, conn)
 		}(conn)
 	}
 }
 
-func handleConnection(conn net.Conn) {
+// admitTCP counts a new TCP connection and tells whether its client is
+// allowed to talk to the node.
+func (s *Server) admitTCP(conn net.Conn) bool {
+	metricConnections.inc("tcp")
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	if !s.isAllowedClient(clientIP) {
+		// Kept to one stable line for fail2ban filters
+		logger.Warn("access denied", "client", clientIP, "listener", "tcp", "count", s.recordDenied(clientIP))
+		metricConnectionsDenied.inc("tcp")
+		return false
+	}
+	return true
+}
+
+// serveActivatedConn serves the one connection systemd started this
+// instance for when its socket unit has Accept=yes.
+func (s *Server) serveActivatedConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	var admitted bool
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		admitted = s.admitUnix(unixConn)
+	} else {
+		admitted = s.admitTCP(conn)
+	}
+	if admitted {
+		s.handleConnection(ctx, conn)
+	}
+}
+
+func (s *Server) handleConnection(ctx context.Context, conn net.Conn) {
+	defer reportPanic()
 	defer conn.Close()
 
-	fmt.Fprintf(conn, "# munin node at %s\n", nodeConf.HostName)
+	if !s.trackConn(conn) {
+		return
+	}
+	defer s.untrackConn(conn)
+
+	metricConnectionsActive.inc()
+	defer metricConnectionsActive.dec()
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	patterns := s.pluginPatternsFor(clientIP, "")
+	_, isTLS := conn.(*tls.Conn)
+
+	// Whatever the client started ends with its connection
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ctx, span := traceConnection(ctx, conn.RemoteAddr().Network(), clientIP)
+	defer span.End()
+
+	// Replies are sent once complete rather than a line at a time, through
+	// the protocol log if debug_protocol covers the client
+	writer := getConnWriter(conn)
+	defer putConnWriter(writer)
+	var out io.Writer = writer
+	var debug *protocolDebug
+	if s.isProtocolDebugClient(clientIP) {
+		debug = newProtocolDebug(writer, conn.RemoteAddr().String(), s.conf.DebugProtocolRedact)
+		out = debug
+	}
+
+	var prefetched *prefetch
+	if s.prefetchSlots != nil {
+		prefetched = newPrefetch()
+	}
+
+	fmt.Fprintf(out, "# munin node at %s\n", s.conf.HostName)
+	if !s.flushReply(writer) {
+		return
+	}
 
 	scanner := bufio.NewScanner(conn)
-	scanner.Buffer(make([]byte, lineMax), lineMax)
+	scanner.Buffer(make([]byte, s.connBufferSize()), lineMax)
 
 	for scanner.Scan() {
 		line := scanner.Text()
+		if debug != nil {
+			debug.received(line)
+		}
 
 		parts := strings.Fields(line)
 
 		if len(parts) == 0 {
-			fmt.Fprintln(conn, "# Unknown command. Try cap, list, nodes, config, fetch, version or quit")
+			fmt.Fprintln(out, s.unknownCommandHelp(conn))
+			if !s.flushReply(writer) {
+				return
+			}
 			continue
 		}
 
@@ -297,72 +909,225 @@ func handleConnection(conn net.Conn) {
 			arg = parts[1]
 		}
 
+		start := time.Now()
+		metricCommands.inc(metricCommand(cmd))
+
+		if s.conf.TLS == tlsParanoid && !isTLS && cmd != "starttls" && cmd != "cap" && cmd != "quit" {
+			fmt.Fprintln(out, "# I require TLS. Closing.")
+			s.flushReply(writer)
+			return
+		}
+
 		switch cmd {
 
 		case "cap":
-			fmt.Fprintln(conn, "cap multigraph")
+			fmt.Fprintln(out, "cap multigraph")
 
 		case "version":
-			fmt.Fprintf(conn, "munin node version: %s\n", version)
+			fmt.Fprintf(out, "munin node version: %s\n", version)
 
 		case "nodes":
-			fmt.Fprintf(conn, "%s\n.\n", nodeConf.HostName)
+			fmt.Fprintf(out, "%s\n", s.conf.HostName)
+			for _, node := range s.virtualNodes(ctx) {
+				fmt.Fprintf(out, "%s\n", node)
+			}
+			fmt.Fprintln(out, ".")
 
 		case "list":
-			fmt.Fprintln(conn, listPlugins())
+			node := s.conf.HostName
+			if arg != "" {
+				node = arg
+			}
+			plugins := s.listPlugins(ctx, node, patterns)
+			fmt.Fprintln(out, strings.Join(plugins, " "))
+			s.prefetchPlugins(ctx, prefetched, plugins)
 
 		case "config":
-			if len(cmd) > 1 {
+			if len(cmd) > 1 && isPluginAllowed(arg, patterns) {
 
-				output, err := executePlugin(arg, "config")
+				output, err := s.pluginOutput(ctx, prefetched, arg, "config")
 				if err != nil {
-					fmt.Fprintln(conn, "# Unknown service\n.")
+					fmt.Fprintln(out, "# Unknown service\n.")
 				} else {
-					fmt.Fprintf(conn, "%s", output)
-					fmt.Fprintln(conn, ".")
+					if debug != nil {
+						debug.plugin(arg)
+					}
+					fmt.Fprintf(out, "%s", output)
+					fmt.Fprintln(out, ".")
 				}
 			} else {
-				fmt.Fprintln(conn, "# Unknown service\n.\n")
+				fmt.Fprintln(out, "# Unknown service\n.")
 			}
 
 		case "fetch":
-			if len(cmd) > 1 {
+			if len(cmd) > 1 && isPluginAllowed(arg, patterns) {
 
-				output, err := executePlugin(arg, "")
+				output, err := s.pluginOutput(ctx, prefetched, arg, "")
 				if err != nil {
-					fmt.Fprintln(conn, "# Unknown service\n.")
+					fmt.Fprintln(out, "# Unknown service\n.")
 				} else {
-					fmt.Fprintf(conn, "%s", output)
-					fmt.Fprintln(conn, ".")
+					if debug != nil {
+						debug.plugin(arg)
+					}
+					fmt.Fprintf(out, "%s", output)
+					fmt.Fprintln(out, ".")
 				}
 
 			} else {
-				fmt.Fprintln(conn, "# Unknown service\n.\n")
+				fmt.Fprintln(out, "# Unknown service\n.")
+			}
+
+		case "starttls":
+			if s.tlsConfig == nil || isTLS {
+				fmt.Fprintln(out, s.unknownCommandHelp(conn))
+				break
+			}
+			tlsConn, err := s.startTLS(ctx, conn, writer)
+			if err != nil {
+				logger.Warn("TLS handshake failed", "client", clientIP, "error", err)
+				metricErrors.inc("tls")
+				return
+			}
+			conn, isTLS = tlsConn, true
+			writer.Reset(conn)
+			scanner = bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, s.connBufferSize()), lineMax)
+			patterns = s.pluginPatternsFor(clientIP, clientCommonName(conn))
+
+		case "stats":
+			if !s.isAdminConn(conn) {
+				fmt.Fprintln(out, s.unknownCommandHelp(conn))
+			} else if arg == "plugins" {
+				s.writePluginRuns(out)
+			} else {
+				s.writeStats(out)
 			}
 
 		case "quit":
 			return
 
 		default:
-			fmt.Fprintln(conn, "# Unknown command. Try cap, list, nodes, config, fetch, version or quit")
+			fmt.Fprintln(out, s.unknownCommandHelp(conn))
+		}
+
+		if !s.flushReply(writer) {
+			return
 		}
+		metricCommandDuration.since(start, metricCommand(cmd))
 	}
 
-	if err := scanner.Err(); err != nil {
-		slog.Printf("Error reading from connection: %v", err)
+	if err := scanner.Err(); err != nil && !s.isShutdownRead(err) {
+		logger.Warn("error reading from connection", "error", err)
+		metricErrors.inc("read")
+	}
+}
+
+// flushReply sends the reply buffered for the client, telling whether it
+// could be sent
+func (s *Server) flushReply(w *bufio.Writer) bool {
+	if err := w.Flush(); err != nil {
+		if !s.isShuttingDown() {
+			logger.Warn("error writing to connection", "error", err)
+			metricErrors.inc("write")
+		}
+		return false
 	}
+	return true
 }
 
 func main() {
 
-	err := readNodeConfig(nodeConfigPath)
-	if err != nil {
-		fmt.Printf("Configuration loading error: %v\n", err)
-		return
+	if len(os.Args) > 1 && (os.Args[1] == "health" || os.Args[1] == "healthcheck") {
+		os.Exit(runHealthCheck())
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "self-update" {
+		os.Exit(runSelfUpdate(os.Args[2:]))
+	}
+
+	// --daemon puts the node in the background like the background
+	// directive
+	daemon := len(os.Args) > 1 && (os.Args[1] == "--daemon" || os.Args[1] == "-d")
+
+	if len(os.Args) > 1 {
+		if code, ok := runServiceCommand(os.Args[1]); ok {
+			os.Exit(code)
+		}
+	}
+
+	if code, ok := runAsService(); ok {
+		os.Exit(code)
 	}
 
-	err = startNode()
+	code := runNode(daemon, nil)
+
+	// Errors that stop the node are reported before it exits, as far as
+	// the error sinks were configured by then
+	flushErrorReports()
+	os.Exit(code)
+}
+
+// runNode loads the configuration and serves clients, returning the exit
+// status. It returns when the node could not start, once it has stopped
+// and drained its connections, or once the connection a per-connection
+// socket-activated instance was started for is done. The server is sent
+// on started, if not nil, before it starts listening.
+func runNode(daemon bool, started chan<- *Server) int {
+	conf, err := loadNodeConfig()
+	configureErrorReports(conf)
 	if err != nil {
-		fmt.Printf("Node startup error: %v\n", err)
+		logger.Error("failed to load configuration", "error", err)
+		reportError("config", err, nil)
+		return 1
+	}
+
+	if conf.Background || daemon {
+		if code, done := daemonize(conf); done {
+			return code
+		}
+	}
+
+	if err := configureLogging(conf); err != nil {
+		logger.Error("failed to configure logging", "error", err)
+		reportError("config", err, nil)
+		return 1
+	}
+	applyProfile(conf)
+
+	if err := configureTracing(conf); err != nil {
+		logger.Error("failed to configure tracing", "error", err)
+		reportError("config", err, nil)
+		return 1
+	}
+	// Spans of the last connections are sent once they are drained
+	defer shutdownTracing()
+
+	if err := lockPIDFile(conf.PIDFile); err != nil {
+		logger.Error("failed to start", "error", err)
+		reportError("config", err, nil)
+		return 1
+	}
+	defer removePIDFile()
+
+	s := newServer(conf)
+	if err := s.configureTLS(); err != nil {
+		logger.Error("failed to start", "error", err)
+		reportError("config", err, nil)
+		return 1
+	}
+	if started != nil {
+		started <- s
+	}
+	stopOnSignal(s)
+
+	if err := s.startNode(context.Background()); err != nil {
+		if s.isShuttingDown() {
+			logger.Error("node stopped before draining connections", "error", err)
+		} else {
+			logger.Error("node startup failed", "error", err)
+			reportError("config", err, nil)
+		}
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPluginServer returns a server running the plugins given by name and
+// shell script from a temporary folder
+func newPluginServer(t *testing.T, plugins map[string]string) *Server {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	dir := t.TempDir()
+	conf := newNodeConfig()
+	conf.PluginFolder = filepath.Join(dir, "plugins")
+	conf.PluginConfig = filepath.Join(dir, "plugin.conf")
+	if err := os.Mkdir(conf.PluginFolder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf.PluginConfig, []byte("[env]\nenv.configured yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range plugins {
+		if err := os.WriteFile(filepath.Join(conf.PluginFolder, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newServer(conf)
+}
+
+func TestPluginEnvironment(t *testing.T) {
+	t.Setenv("MUNIN_PLUGSTATE", "/var/lib/munin-node/plugin-state")
+	t.Setenv("MUNIN_NODE_ERROR_SENTRY_DSN", "https://secret@sentry.example.com/1")
+	t.Setenv("MUNIN_NODE_UPDATE_PUBLIC_KEY", "secret")
+	t.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+	t.Setenv("WATCHDOG_PID", "1")
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "munin")
+	t.Setenv("LANG", "C.UTF-8")
+
+	tests := []struct {
+		cleanEnv bool
+		want     []string
+		wantNot  []string
+	}{
+		{
+			cleanEnv: false,
+			want:     []string{"MUNIN_PLUGSTATE=/var/lib/munin-node/plugin-state", "configured=yes", "LANG=C.UTF-8"},
+		},
+		{
+			cleanEnv: true,
+			want:     []string{"MUNIN_PLUGSTATE=/var/lib/munin-node/plugin-state", "configured=yes", "PATH=" + defaultPluginPath},
+			wantNot:  []string{"LANG"},
+		},
+	}
+	for _, test := range tests {
+		s := newPluginServer(t, map[string]string{"env": "env\n"})
+		s.conf.CleanEnv = test.cleanEnv
+		output, _, err := s.runPlugin(context.Background(), "env", "")
+		if err != nil {
+			t.Fatalf("clean_env %v: %v", test.cleanEnv, err)
+		}
+
+		env := strings.Split(strings.TrimSpace(output), "\n")
+		for _, kv := range test.want {
+			if !slices.Contains(env, kv) {
+				t.Errorf("clean_env %v: plugin did not get %s", test.cleanEnv, kv)
+			}
+		}
+		for _, kv := range env {
+			name, _, _ := strings.Cut(kv, "=")
+			if strings.HasPrefix(name, "MUNIN_NODE_") || slices.Contains(nodeOnlyEnv, name) || slices.Contains(test.wantNot, name) {
+				t.Errorf("clean_env %v: plugin got %s", test.cleanEnv, kv)
+			}
+		}
+	}
+}
+
+func TestPluginStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+		code   int
+	}{
+		{
+			name:   "last line",
+			script: "echo starting >&2\necho 'disk sdb not found' >&2\nexit 2\n",
+			want:   "plugin failed to execute: exit status 2: disk sdb not found",
+			code:   2,
+		},
+		{
+			name:   "long stderr",
+			script: "i=0\nwhile [ $i -lt 2000 ]; do echo \"line $i\" >&2; i=$((i+1)); done\nexit 1\n",
+			want:   "plugin failed to execute: exit status 1: line 1999",
+			code:   1,
+		},
+		{
+			name:   "silent",
+			script: "exit 3\n",
+			want:   "plugin failed to execute: exit status 3",
+			code:   3,
+		},
+	}
+	for _, test := range tests {
+		s := newPluginServer(t, map[string]string{"failing": test.script})
+		if _, err := s.executePlugin(context.Background(), "failing", ""); err == nil {
+			t.Errorf("%s: failing plugin succeeded", test.name)
+			continue
+		}
+
+		run := s.pluginRuns.runs["failing fetch"]
+		if run == nil {
+			t.Errorf("%s: run not recorded", test.name)
+			continue
+		}
+		if run.err != test.want || run.exitCode != test.code {
+			t.Errorf("%s: recorded error %q, exit code %d, want %q, %d", test.name, run.err, run.exitCode, test.want, test.code)
+		}
+	}
+}
+
+func TestPluginLabel(t *testing.T) {
+	registerBuiltin(&builtinPlugin{
+		name:     "labeltest_",
+		wildcard: true,
+		suggest: func(req *pluginRequest) ([]string, error) {
+			return []string{"eth0", "eth1"}, nil
+		},
+		fetch: func(req *pluginRequest) (string, error) {
+			return "value.value 1\n", nil
+		},
+	})
+	defer delete(builtinPlugins, "labeltest_")
+
+	s := newPluginServer(t, map[string]string{"cpu": "echo value.value 1\n"})
+	s.conf.Builtins = []string{"labeltest_"}
+
+	tests := []struct {
+		plugin string
+		want   string
+	}{
+		{"cpu", "cpu"},
+		{"labeltest_eth0", "labeltest_eth0"},
+		{"labeltest_eth1", "labeltest_eth1"},
+		{"labeltest_random1234", "labeltest_"},
+		{"labeltest_", "unknown"},
+		{"nothing", "unknown"},
+	}
+	for _, test := range tests {
+		if got := s.pluginLabel(context.Background(), test.plugin); got != test.want {
+			t.Errorf("pluginLabel(%q) = %q, want %q", test.plugin, got, test.want)
+		}
+	}
+
+	for _, plugin := range []string{"labeltest_a", "labeltest_b", "labeltest_c"} {
+		if _, err := s.executePlugin(context.Background(), plugin, ""); err != nil {
+			t.Fatalf("%s: %v", plugin, err)
+		}
+	}
+	if len(s.pluginRuns.runs) != 1 || s.pluginRuns.runs["labeltest_ fetch"] == nil {
+		t.Errorf("runs of unlisted instances were kept as %v", s.pluginRuns.runs)
+	}
+}
+
+func TestConfigCacheOptIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		cached bool
+	}{
+		{"default", 0, false},
+		{"config_cache_ttl", time.Hour, true},
+	}
+	for _, test := range tests {
+		// Every run lists one more mount, as df would after one appears
+		s := newPluginServer(t, map[string]string{"df": "echo run >> \"$0.runs\"\nwc -l < \"$0.runs\"\n"})
+		if test.ttl != 0 {
+			s.conf.ConfigCacheTTL = test.ttl
+		}
+
+		first, _, err := s.runPlugin(context.Background(), "df", "config")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		second, cached, err := s.runPlugin(context.Background(), "df", "config")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if cached != test.cached || (first == second) != test.cached {
+			t.Errorf("%s: second config cached = %v with output %q after %q, want cached %v", test.name, cached, second, first, test.cached)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Column indexes in /proc/net/dev after the interface name
+const (
+	netDevRxBytes = iota
+	netDevRxPackets
+	netDevRxErrs
+	netDevRxDrop
+	netDevRxFifo
+	netDevRxFrame
+	netDevRxCompressed
+	netDevRxMulticast
+	netDevTxBytes
+	netDevTxPackets
+	netDevTxErrs
+	netDevTxDrop
+	netDevTxFifo
+	netDevTxColls
+	netDevTxCarrier
+	netDevTxCompressed
+)
+
+// readNetDev returns the counters of every interface in /proc/net/dev.
+func readNetDev() (map[string][]uint64, error) {
+	file, err := os.Open(procPath("net", "dev"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open net/dev: %w", err)
+	}
+	defer file.Close()
+
+	result := make(map[string][]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		fields := strings.Fields(parts[1])
+		if len(fields) < 16 {
+			continue
+		}
+
+		counters := make([]uint64, len(fields))
+		for i, field := range fields {
+			counters[i], _ = strconv.ParseUint(field, 10, 64)
+		}
+		result[strings.TrimSpace(parts[0])] = counters
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+
+	return result, nil
+}
+
+// suggestInterfaces lists every interface except loopback.
+func suggestInterfaces(req *pluginRequest) ([]string, error) {
+	netDev, err := readNetDev()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range netDev {
+		if name != "lo" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// interfaceCounters returns the counters for the interface of a wildcard
+// request, failing for interfaces that don't exist.
+func interfaceCounters(req *pluginRequest) ([]uint64, error) {
+	netDev, err := readNetDev()
+	if err != nil {
+		return nil, err
+	}
+
+	counters, ok := netDev[req.instance]
+	if !ok {
+		return nil, fmt.Errorf("no such interface %s", req.instance)
+	}
+	return counters, nil
+}
@@ -0,0 +1,32 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCredentials returns the uid and gid of the process on the other end
+// of conn using SO_PEERCRED.
+func peerCredentials(conn *net.UnixConn) (uint32, uint32, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = rawConn.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if credErr != nil {
+		return 0, 0, credErr
+	}
+
+	return cred.Uid, cred.Gid, nil
+}
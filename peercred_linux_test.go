@@ -0,0 +1,40 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := listener.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	uid, gid, err := peerCredentials(conn)
+	if err != nil {
+		t.Fatalf("peerCredentials failed: %v", err)
+	}
+	if uid != uint32(os.Getuid()) || gid != uint32(os.Getgid()) {
+		t.Errorf("peerCredentials = %d, %d, want %d, %d", uid, gid, os.Getuid(), os.Getgid())
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func peerCredentials(conn *net.UnixConn) (uint32, uint32, error) {
+	return 0, 0, errors.New("peer credentials are not supported on this platform")
+}
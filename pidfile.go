@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLocked is returned by lockFile when another process holds the lock
+var errLocked = errors.New("file is locked")
+
+// pidFile is the open pid_file. It stays open for as long as the node
+// runs, as closing it would release the lock.
+var pidFile *os.File
+
+// lockPIDFile locks the pid file at path, refusing to start while another
+// node holds it, and writes the node's pid to it. The lock goes away with
+// the process, so a file left behind by a node that crashed is taken over
+// rather than mistaken for a running node.
+func lockPIDFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	// A node started by an upgrade shares the lock of the node it
+	// replaces, and writes its pid once it has taken over
+	if file := inheritedPIDFile(path); file != nil {
+		pidFile = file
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open pid file: %w", err)
+	}
+
+	if err := lockFile(file); err != nil {
+		pid := readPID(file)
+		file.Close()
+		if errors.Is(err, errLocked) && pid != 0 {
+			return fmt.Errorf("another node is running as pid %d, holding %s", pid, path)
+		}
+		if errors.Is(err, errLocked) {
+			return fmt.Errorf("another node is running, holding %s", path)
+		}
+		return fmt.Errorf("failed to lock pid file %s: %w", path, err)
+	}
+
+	if pid := readPID(file); pid != 0 {
+		logger.Warn("replacing stale pid file", "path", path, "pid", pid)
+	}
+
+	pidFile = file
+	return writePIDFile()
+}
+
+// writePIDFile writes the node's pid to the locked pid_file
+func writePIDFile() error {
+	if pidFile == nil {
+		return nil
+	}
+
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+	if err := pidFile.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+	if _, err := pidFile.WriteAt([]byte(pid), 0); err != nil {
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+	return nil
+}
+
+// removePIDFile removes the pid file if it still names this node, which it
+// does not once a node started by an upgrade has taken over.
+func removePIDFile() {
+	if pidFile == nil || handingOver.Load() {
+		return
+	}
+	if readPID(pidFile) == os.Getpid() {
+		os.Remove(pidFile.Name())
+	}
+	pidFile.Close()
+	pidFile = nil
+}
+
+// readPID returns the pid in a pid file, 0 if there is none
+func readPID(file *os.File) int {
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 32))
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
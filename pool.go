@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Plugin output buffers and connection writers are reused rather than
+// allocated for every run and connection, as a node polled every minute by
+// several masters would otherwise churn through them. A buffer grown past
+// maxPooledBuffer by an unusually large output is left to the garbage
+// collector instead of being kept.
+const maxPooledBuffer = 1 << 20
+
+// maxStderrTail is how much of a plugin's stderr is kept to explain a
+// failed run
+const maxStderrTail = 4096
+
+var outputBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+var connWriters = sync.Pool{
+	New: func() interface{} { return bufio.NewWriter(nil) },
+}
+
+// getOutputBuffer returns an empty buffer to capture plugin output in
+func getOutputBuffer() *bytes.Buffer {
+	buf := outputBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putOutputBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		outputBuffers.Put(buf)
+	}
+}
+
+// stderrTail keeps the last maxStderrTail bytes written to buf
+type stderrTail struct {
+	buf *bytes.Buffer
+}
+
+func (t stderrTail) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > maxStderrTail {
+		p = p[len(p)-maxStderrTail:]
+	}
+	if over := t.buf.Len() + len(p) - maxStderrTail; over > 0 {
+		t.buf.Next(over)
+	}
+	t.buf.Write(p)
+	return n, nil
+}
+
+// lastLine returns the last line of what a plugin wrote to stderr
+func (t stderrTail) lastLine() string {
+	stderr := strings.TrimSpace(t.buf.String())
+	return stderr[strings.LastIndex(stderr, "\n")+1:]
+}
+
+// getConnWriter returns a writer buffering replies to w
+func getConnWriter(w io.Writer) *bufio.Writer {
+	writer := connWriters.Get().(*bufio.Writer)
+	writer.Reset(w)
+	return writer
+}
+
+// putConnWriter returns writer to the pool, dropping what it did not send
+// and its connection
+func putConnWriter(writer *bufio.Writer) {
+	writer.Reset(nil)
+	connWriters.Put(writer)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// listenPprof opens pprof_listen. Profiles expose memory contents and can
+// be used to load the node, so only loopback addresses are accepted.
+func listenPprof(address string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pprof_listen address %s: %w", address, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("pprof_listen must be a loopback address, not %s", host)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start pprof server on %s: %w", address, err)
+	}
+
+	logger.Info("pprof server started", "address", address, "path", "/debug/pprof/")
+
+	return listener, nil
+}
+
+func servePprof(listener net.Listener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	if err := http.Serve(listener, mux); err != nil {
+		logger.Error("pprof server stopped", "address", listener.Addr().String(), "error", err)
+	}
+}
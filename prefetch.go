@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errPrefetchPanic is the outcome of a prefetched run that panicked
+var errPrefetchPanic = errors.New("prefetched plugin run panicked")
+
+// prefetch holds the plugins run ahead for one connection. A master asks
+// for config and fetch of everything it listed, so with the prefetch
+// directive each listed plugin is run right after the list, by the
+// server's prefetch slots. A result is used once, by the next command for
+// it on the connection, and dropped with the connection.
+type prefetch struct {
+	mu      sync.Mutex
+	results map[prefetchKey]*prefetchResult
+}
+
+type prefetchKey struct {
+	plugin string
+	option string
+}
+
+type prefetchResult struct {
+	// started is set once a slot runs the plugin. A result the master
+	// asks for before that is taken back and run by the connection.
+	started bool
+	done    chan struct{}
+	output  string
+	err     error
+}
+
+// prefetchOptions are run in the order a master asks for them
+var prefetchOptions = []string{"config", ""}
+
+func newPrefetch() *prefetch {
+	return &prefetch{results: map[prefetchKey]*prefetchResult{}}
+}
+
+// take removes the result for plugin and option, returning it if its run
+// has started and nil if the caller should run the plugin itself
+func (p *prefetch) take(plugin, option string) *prefetchResult {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := prefetchKey{plugin, option}
+	result := p.results[key]
+	delete(p.results, key)
+	if result == nil || !result.started {
+		return nil
+	}
+	return result
+}
+
+// begin marks the run for key started, unless it was taken already
+func (p *prefetch) begin(key prefetchKey) *prefetchResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := p.results[key]
+	if result == nil || result.started {
+		return nil
+	}
+	result.started = true
+	return result
+}
+
+// prefetchPlugins runs the listed plugins in the background, as many at
+// once as the prefetch directive allows across all connections. Runs
+// still going when ctx is done are killed.
+func (s *Server) prefetchPlugins(ctx context.Context, p *prefetch, plugins []string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	for _, plugin := range plugins {
+		for _, option := range prefetchOptions {
+			key := prefetchKey{plugin, option}
+			if _, ok := p.results[key]; !ok {
+				p.results[key] = &prefetchResult{done: make(chan struct{})}
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	go func() {
+		for _, plugin := range plugins {
+			select {
+			case s.prefetchSlots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(plugin string) {
+				defer func() { <-s.prefetchSlots }()
+				for _, option := range prefetchOptions {
+					if result := p.begin(prefetchKey{plugin, option}); result != nil {
+						s.runPrefetch(ctx, result, plugin, option)
+					}
+				}
+			}(plugin)
+		}
+	}()
+}
+
+func (s *Server) runPrefetch(ctx context.Context, result *prefetchResult, plugin, option string) {
+	defer close(result.done)
+	defer reportPanic()
+
+	// Left for the client if the run panics
+	result.err = errPrefetchPanic
+	result.output, result.err = s.tracePlugin(ctx, plugin, option)
+}
+
+// pluginOutput runs plugin with option for a client, or waits for the
+// run prefetched for it
+func (s *Server) pluginOutput(ctx context.Context, p *prefetch, plugin, option string) (string, error) {
+	if result := p.take(plugin, option); result != nil {
+		<-result.done
+		return result.output, result.err
+	}
+	return s.tracePlugin(ctx, plugin, option)
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestPrefetchTake(t *testing.T) {
+	key := prefetchKey{"cpu", "config"}
+	tests := []struct {
+		name string
+		// begin marks the run started before the client takes it
+		begin bool
+		// take is whether the client gets the prefetched result
+		take bool
+	}{
+		{"started", true, true},
+		{"pending", false, false},
+	}
+	for _, test := range tests {
+		p := newPrefetch()
+		p.results[key] = &prefetchResult{done: make(chan struct{})}
+		if test.begin && p.begin(key) == nil {
+			t.Errorf("%s: begin returned nil for a pending run", test.name)
+		}
+		if got := p.take(key.plugin, key.option); (got != nil) != test.take {
+			t.Errorf("%s: take = %v, want a result: %v", test.name, got, test.take)
+		}
+		if _, ok := p.results[key]; ok {
+			t.Errorf("%s: take left the result behind", test.name)
+		}
+		if p.begin(key) != nil {
+			t.Errorf("%s: begin after take returned a result", test.name)
+		}
+		if p.take(key.plugin, key.option) != nil {
+			t.Errorf("%s: second take returned a result", test.name)
+		}
+	}
+}
+
+func TestPrefetchBeginOnce(t *testing.T) {
+	p := newPrefetch()
+	key := prefetchKey{"cpu", ""}
+	p.results[key] = &prefetchResult{done: make(chan struct{})}
+	if p.begin(key) == nil {
+		t.Fatal("begin returned nil for a pending run")
+	}
+	if p.begin(key) != nil {
+		t.Error("begin returned a run started already")
+	}
+	if p.begin(prefetchKey{"memory", ""}) != nil {
+		t.Error("begin returned a run never listed")
+	}
+}
+
+func TestPrefetchNil(t *testing.T) {
+	var p *prefetch
+	if p.take("cpu", "") != nil {
+		t.Error("take on a connection without prefetch returned a result")
+	}
+}
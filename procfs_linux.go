@@ -0,0 +1,182 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procRoot and sysRoot are where built-in plugins look for procfs and
+// sysfs
+var (
+	procRoot = "/proc"
+	sysRoot  = "/sys"
+)
+
+func procPath(elem ...string) string {
+	return filepath.Join(append([]string{procRoot}, elem...)...)
+}
+
+func sysPath(elem ...string) string {
+	return filepath.Join(append([]string{sysRoot}, elem...)...)
+}
+
+// readKeyedFields reads a file whose lines start with a key, like
+// /proc/stat or /proc/vmstat, and returns the remaining fields of each line
+// by key.
+func readKeyedFields(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file: %w", err)
+	}
+	defer file.Close()
+
+	result := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		result[strings.TrimSuffix(fields[0], ":")] = fields[1:]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("file read error: %w", err)
+	}
+
+	return result, nil
+}
+
+// readMeminfo returns /proc/meminfo with all values converted to bytes.
+func readMeminfo() (map[string]uint64, error) {
+	fields, err := readKeyedFields(procPath("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+
+	meminfo := make(map[string]uint64, len(fields))
+	for key, values := range fields {
+		if len(values) == 0 {
+			continue
+		}
+		value, err := strconv.ParseUint(values[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(values) > 1 && values[1] == "kB" {
+			value *= 1024
+		}
+		meminfo[key] = value
+	}
+
+	return meminfo, nil
+}
+
+// readUintFile reads a file holding a single unsigned number, as found all
+// over /proc/sys and /sys.
+func readUintFile(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected content in %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// readUintFields reads a file holding a line of whitespace separated
+// unsigned numbers, like /proc/sys/fs/file-nr.
+func readUintFields(path string) ([]uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	var values []uint64
+	for _, field := range strings.Fields(string(data)) {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected content in %s: %w", path, err)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func readSysString(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysScaled reads a sysfs sensor value and scales it to base units,
+// returning "" if the file doesn't exist.
+func readSysScaled(path string, divisor float64) string {
+	value, err := strconv.ParseFloat(readSysString(path), 64)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatFloat(value/divisor, 'f', -1, 64)
+}
+
+func isPid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// walkProcesses calls fn with the /proc/<pid>/stat fields following the
+// command name for every process, starting with the state. Processes that
+// exit while being walked are skipped.
+func walkProcesses(fn func(fields []string)) error {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", procRoot, err)
+	}
+
+	for _, entry := range entries {
+		if !isPid(entry.Name()) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(procPath(entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+
+		// The command name may contain spaces and parentheses, so split
+		// after the last closing one
+		stat := string(data)
+		end := strings.LastIndexByte(stat, ')')
+		if end < 0 {
+			continue
+		}
+
+		fields := strings.Fields(stat[end+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		fn(fields)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// The profile directive tunes the node for the machine it runs on. The
+// embedded profile is meant for OpenWrt-class routers with 64-128 MB of
+// memory, where a poll must not cost the node more than it has to.
+const (
+	profileDefault  = "default"
+	profileEmbedded = "embedded"
+)
+
+// Limits of the embedded profile
+const (
+	// embeddedLineBuffer is the read buffer a connection starts with,
+	// growing up to lineMax for longer lines
+	embeddedLineBuffer = 256
+	// embeddedDeniedClients replaces deniedClientsMax
+	embeddedDeniedClients = 64
+	// embeddedPluginRuns replaces pluginRunsMax
+	embeddedPluginRuns = 128
+	// embeddedErrorReports replaces errorReportsMax
+	embeddedErrorReports = 64
+	// embeddedGCPercent collects garbage at half the usual heap growth
+	embeddedGCPercent = 50
+)
+
+func (c *NodeConfig) isEmbedded() bool {
+	return c.Profile == profileEmbedded
+}
+
+// applyProfile sets up the runtime for the profile of conf. GOGC and
+// GOMAXPROCS in the environment still win.
+func applyProfile(conf *NodeConfig) {
+	if !conf.isEmbedded() {
+		return
+	}
+
+	if os.Getenv("GOMAXPROCS") == "" {
+		runtime.GOMAXPROCS(1)
+	}
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(embeddedGCPercent)
+	}
+
+	logger.Info("using embedded profile")
+}
+
+// acquirePluginSlot waits until a plugin may run and returns the function
+// that gives the slot back
+func (s *Server) acquirePluginSlot() func() {
+	if s.pluginSlots == nil {
+		return func() {}
+	}
+	s.pluginSlots <- struct{}{}
+	return func() { <-s.pluginSlots }
+}
+
+// connBufferSize is the read buffer a connection starts with
+func (s *Server) connBufferSize() int {
+	if s.conf.isEmbedded() {
+		return embeddedLineBuffer
+	}
+	return lineMax
+}
+
+// literalPattern returns the address an allow style pattern such as
+// ^192\.168\.1\.10$ spells out, so the embedded profile can compare it as
+// a string rather than compile it for every connection. Patterns using
+// anything else than escaped dots between the anchors are not literal.
+func literalPattern(pattern string) (string, bool) {
+	if len(pattern) < 2 || pattern[0] != '^' || pattern[len(pattern)-1] != '$' {
+		return "", false
+	}
+
+	var b strings.Builder
+	inner := pattern[1 : len(pattern)-1]
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case c == '\\' && i+1 < len(inner) && inner[i+1] == '.':
+			b.WriteByte('.')
+			i++
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == ':':
+			b.WriteByte(c)
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
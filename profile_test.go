@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestLiteralPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{`^192\.168\.1\.10$`, "192.168.1.10", true},
+		{`^::1$`, "::1", true},
+		{`^fe80::1$`, "fe80::1", true},
+		{`^192\.168\.1\.`, "", false},
+		{`192\.168\.1\.10$`, "", false},
+		{`^192.168.1.10$`, "", false},
+		{`^10\.0\.0\.[0-9]+$`, "", false},
+		{`^$`, "", true},
+		{`^`, "", false},
+	}
+	for _, test := range tests {
+		got, ok := literalPattern(test.pattern)
+		if got != test.want || ok != test.ok {
+			t.Errorf("literalPattern(%q) = %q, %v, want %q, %v", test.pattern, got, ok, test.want, test.ok)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// protocolDebug logs every line of a connection: the lines received as
+// the client sends them and the lines sent as they are written through it.
+// Output of the plugins matched by debug_protocol_redact is logged with
+// everything after the field name replaced, keeping its structure visible.
+type protocolDebug struct {
+	w       io.Writer
+	client  string
+	pending []byte
+	redact  bool
+	// redactPlugins are the debug_protocol_redact globs
+	redactPlugins []string
+}
+
+// isProtocolDebugClient tells whether debug_protocol covers clientIP, by
+// "all" or a CIDR block or regular expression as for allow
+func (s *Server) isProtocolDebugClient(clientIP string) bool {
+	for _, pattern := range s.conf.DebugProtocol {
+		if pattern == "all" || s.matchClient(pattern, clientIP) {
+			return true
+		}
+	}
+	return false
+}
+
+func newProtocolDebug(w io.Writer, client string, redactPlugins []string) *protocolDebug {
+	return &protocolDebug{w: w, client: client, redactPlugins: redactPlugins}
+}
+
+// received logs a line from the client, which starts a new command: the
+// redaction of the previous one ends here.
+func (d *protocolDebug) received(line string) {
+	d.redact = false
+	logger.Info("protocol", "client", d.client, "direction", "recv", "line", line)
+}
+
+// plugin marks the output of the current command as coming from plugin
+func (d *protocolDebug) plugin(name string) {
+	for _, pattern := range d.redactPlugins {
+		if match, _ := filepath.Match(pattern, name); match {
+			d.redact = true
+		}
+	}
+}
+
+func (d *protocolDebug) Write(p []byte) (int, error) {
+	d.pending = append(d.pending, p...)
+	for {
+		i := bytes.IndexByte(d.pending, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(d.pending[:i])
+		d.pending = d.pending[i+1:]
+
+		if d.redact && line != "." {
+			if j := strings.IndexByte(line, ' '); j >= 0 {
+				line = line[:j] + " [redacted]"
+			}
+		}
+		logger.Info("protocol", "client", d.client, "direction", "send", "line", line)
+	}
+
+	return d.w.Write(p)
+}
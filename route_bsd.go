@@ -0,0 +1,42 @@
+//go:build openbsd || netbsd
+// +build openbsd netbsd
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// linkCounters returns the counters of the named interface from the
+// struct if_data the routing socket reports for it.
+func linkCounters(name string) (linkStats, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("no such interface %s", name)
+	}
+
+	rib, err := syscall.RouteRIB(syscall.NET_RT_IFLIST, iface.Index)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("unable to read counters of %s: %w", name, err)
+	}
+	messages, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("unable to read counters of %s: %w", name, err)
+	}
+
+	for _, message := range messages {
+		m, ok := message.(*syscall.InterfaceMessage)
+		if !ok || int(m.Header.Index) != iface.Index {
+			continue
+		}
+		return linkStats{
+			rxBytes:   m.Header.Data.Ibytes,
+			txBytes:   m.Header.Data.Obytes,
+			txPackets: m.Header.Data.Opackets,
+			speed:     m.Header.Data.Baudrate,
+		}, nil
+	}
+	return linkStats{}, fmt.Errorf("no counters for interface %s", name)
+}
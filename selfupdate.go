@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A release at update_url holds a binary per platform, VERSION naming the
+// release, SHA256SUMS listing the checksums of both as written by
+// sha256sum, and SHA256SUMS.sig, the Ed25519 signature of SHA256SUMS by
+// the key update_public_key names. Only the small checksum and version
+// files are held in memory; the binary is hashed as it is written to disk.
+const (
+	updateSums      = "SHA256SUMS"
+	updateSumsSig   = updateSums + ".sig"
+	updateSumsMax   = 1 << 20
+	updateVersion   = "VERSION"
+	updateTimeout   = 10 * time.Minute
+	updateHandover  = 30 * time.Second
+	updateUserAgent = "munin-node-go/" + version
+)
+
+var updateClient = &http.Client{Timeout: updateTimeout}
+
+// updateAsset is the name of this platform's binary in a release
+func updateAsset() string {
+	name := "munin-node-go_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// runSelfUpdate is the self-update subcommand: it replaces the executable
+// with the signed release for this platform and has the running node
+// restart into it. --force installs a release older than this node.
+func runSelfUpdate(args []string) int {
+	force := false
+	for _, arg := range args {
+		if arg != "--force" {
+			fmt.Fprintf(os.Stderr, "unknown self-update option %q\n", arg)
+			return 1
+		}
+		force = true
+	}
+
+	conf, err := loadNodeConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load configuration: %v\n", err)
+		return 1
+	}
+	if isContainerMode() {
+		fmt.Fprintln(os.Stderr, "self-update is not available in a container, pull a new image instead")
+		return 1
+	}
+
+	path, updated, err := selfUpdate(conf, force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "self-update failed: %v\n", err)
+		return 1
+	}
+	if !updated {
+		fmt.Printf("%s is up to date\n", path)
+		return 0
+	}
+	fmt.Printf("updated %s\n", path)
+
+	if err := restartAfterUpdate(conf); err != nil {
+		fmt.Fprintf(os.Stderr, "restart failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// selfUpdate replaces the executable with the release binary, unless they
+// are the same already or, without force, the release is older. It
+// returns the executable's path and whether it was replaced.
+func selfUpdate(conf *NodeConfig, force bool) (string, bool, error) {
+	if conf.UpdateURL == "" || conf.UpdatePublicKey == "" {
+		return "", false, errors.New("update_url and update_public_key must be set")
+	}
+	key, err := parseUpdateKey(conf.UpdatePublicKey)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid update_public_key: %w", err)
+	}
+
+	path, err := os.Executable()
+	if err == nil {
+		path, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to find the executable: %w", err)
+	}
+
+	sums, err := fetchUpdate(conf.UpdateURL, updateSums, updateSumsMax)
+	if err != nil {
+		return "", false, err
+	}
+	sig, err := fetchUpdate(conf.UpdateURL, updateSumsSig, 1024)
+	if err != nil {
+		return "", false, err
+	}
+	if !ed25519.Verify(key, sums, decodeSignature(sig)) {
+		return "", false, fmt.Errorf("%s is not signed by update_public_key", updateSums)
+	}
+
+	asset := updateAsset()
+	want, err := lookupChecksum(sums, asset)
+	if err != nil {
+		return "", false, err
+	}
+	if current, err := fileChecksum(path); err == nil && current == want {
+		return path, false, nil
+	}
+	if !force {
+		if err := checkUpdateVersion(conf.UpdateURL, sums); err != nil {
+			return "", false, err
+		}
+	}
+
+	download, err := downloadUpdate(conf.UpdateURL, asset, path, want)
+	if err != nil {
+		return "", false, err
+	}
+	if err := replaceExecutable(download, path); err != nil {
+		os.Remove(download)
+		return "", false, fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return path, true, nil
+}
+
+// parseUpdateKey reads a base64 Ed25519 public key, either the 32 raw
+// bytes or the DER form openssl pkey -pubout -outform DER writes
+func parseUpdateKey(value string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(der) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(der), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := key.(ed25519.PublicKey); ok {
+		return key, nil
+	}
+	return nil, errors.New("not an Ed25519 key")
+}
+
+// decodeSignature accepts a raw signature as well as a base64 one
+func decodeSignature(sig []byte) []byte {
+	if len(sig) == ed25519.SignatureSize {
+		return sig
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+	if err != nil {
+		return sig
+	}
+	return decoded
+}
+
+// lookupChecksum finds the checksum of asset in a SHA256SUMS file
+func lookupChecksum(sums []byte, asset string) (string, error) {
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("the release has no %s", asset)
+}
+
+// checkUpdateVersion refuses a release older than this node. Its VERSION
+// is trusted only as far as it matches the signed checksum.
+func checkUpdateVersion(base string, sums []byte) error {
+	want, err := lookupChecksum(sums, updateVersion)
+	if err != nil {
+		return fmt.Errorf("the release does not state its version, use --force to install it anyway")
+	}
+	data, err := fetchUpdate(base, updateVersion, 256)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("%s does not match its checksum", updateVersion)
+	}
+
+	release := strings.TrimSpace(string(data))
+	if compareVersions(release, version) < 0 {
+		return fmt.Errorf("the release is version %s, older than %s, use --force to downgrade", release, version)
+	}
+	return nil
+}
+
+// compareVersions orders dotted versions such as 1.0.6-go numerically,
+// ignoring anything after a dash. It returns -1, 0 or 1 as a is older
+// than, the same as or newer than b.
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.SplitN(a, "-", 2)[0], ".")
+	bs := strings.Split(strings.SplitN(b, "-", 2)[0], ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// getUpdate requests name from the release at base
+func getUpdate(base string, name string) (*http.Response, error) {
+	url := strings.TrimSuffix(base, "/") + "/" + name
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", updateUserAgent)
+
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: unexpected HTTP status %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// fetchUpdate downloads a small release file into memory
+func fetchUpdate(base string, name string, max int64) ([]byte, error) {
+	resp, err := getUpdate(base, name)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, max)
+	}
+	return data, nil
+}
+
+// downloadUpdate writes asset next to the executable at path, so it can
+// be renamed over it, and checks it against its signed checksum
+func downloadUpdate(base string, asset string, path string, want string) (string, error) {
+	resp, err := getUpdate(base, asset)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".update-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %w", err)
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if err == nil {
+		err = file.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to download %s: %w", asset, err)
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("checksum of %s is %s, expected %s", asset, got, want)
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLookupChecksum(t *testing.T) {
+	sums := "0123ABCD  munin-node-go_linux_amd64\n" +
+		"4567cdef *munin-node-go_windows_amd64.exe\n" +
+		"89ab  VERSION\n" +
+		"broken line without name\n"
+	tests := []struct {
+		asset string
+		want  string
+		err   bool
+	}{
+		{"munin-node-go_linux_amd64", "0123abcd", false},
+		{"munin-node-go_windows_amd64.exe", "4567cdef", false},
+		{"VERSION", "89ab", false},
+		{"munin-node-go_linux", "", true},
+		{"munin-node-go_darwin_arm64", "", true},
+	}
+	for _, test := range tests {
+		got, err := lookupChecksum([]byte(sums), test.asset)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("lookupChecksum(%q) = %q, %v, want %q", test.asset, got, err, test.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.6-go", "1.0.6-go", 0},
+		{"1.0.6", "1.0.6-go", 0},
+		{"1.0.7-go", "1.0.6-go", 1},
+		{"1.0.5-go", "1.0.6-go", -1},
+		{"1.0.10-go", "1.0.9-go", 1},
+		{"1.1", "1.0.6", 1},
+		{"1.0", "1.0.0", 0},
+		{"1.0", "1.0.1", -1},
+		{"2.0.0-rc1", "1.9.9", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestParseUpdateKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		err   bool
+	}{
+		{"raw", base64.StdEncoding.EncodeToString(public), false},
+		{"der", base64.StdEncoding.EncodeToString(der), false},
+		{"not base64", "not a key!", true},
+		{"short", base64.StdEncoding.EncodeToString(public[:16]), true},
+	}
+	for _, test := range tests {
+		key, err := parseUpdateKey(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("%s: parseUpdateKey error = %v", test.name, err)
+			continue
+		}
+		if err == nil && !key.Equal(public) {
+			t.Errorf("%s: parseUpdateKey returned another key", test.name)
+		}
+	}
+
+	sums := []byte("0123abcd  munin-node-go_linux_amd64\n")
+	sig := ed25519.Sign(private, sums)
+	signatures := []struct {
+		name string
+		sig  []byte
+		ok   bool
+	}{
+		{"raw", sig, true},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), true},
+		{"other data", ed25519.Sign(private, []byte("other")), false},
+		{"garbage", []byte("garbage"), false},
+	}
+	for _, test := range signatures {
+		if ok := ed25519.Verify(public, sums, decodeSignature(test.sig)); ok != test.ok {
+			t.Errorf("%s: signature verified = %v, want %v", test.name, ok, test.ok)
+		}
+	}
+}
+
+func TestCheckUpdateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		release string
+		listed  string
+		err     string
+	}{
+		{"newer", "1.0.7-go\n", "", ""},
+		{"same", version + "\n", "", ""},
+		{"older", "1.0.5-go\n", "", "older than " + version},
+		{"unlisted", "1.0.7-go\n", "-", "does not state its version"},
+		{"mismatch", "1.0.7-go\n", "1.0.5-go\n", "does not match its checksum"},
+	}
+	for _, test := range tests {
+		release := test.release
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/"+updateVersion {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(release))
+		}))
+
+		var sums string
+		switch test.listed {
+		case "-":
+		case "":
+			sum := sha256.Sum256([]byte(release))
+			sums = hex.EncodeToString(sum[:]) + "  " + updateVersion + "\n"
+		default:
+			sum := sha256.Sum256([]byte(test.listed))
+			sums = hex.EncodeToString(sum[:]) + "  " + updateVersion + "\n"
+		}
+
+		err := checkUpdateVersion(server.URL, []byte(sums))
+		server.Close()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: checkUpdateVersion failed: %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: checkUpdateVersion error = %v, want %q", test.name, err, test.err)
+		}
+	}
+}
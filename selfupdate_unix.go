@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// replaceExecutable renames the downloaded binary over the executable,
+// which running nodes keep open under its old inode
+func replaceExecutable(download string, path string) error {
+	return os.Rename(download, path)
+}
+
+// restartAfterUpdate sends the node named by pid_file SIGUSR2, the upgrade
+// without downtime, and waits until the new node has written its pid.
+func restartAfterUpdate(conf *NodeConfig) error {
+	pid := readPIDPath(conf.PIDFile)
+	if pid == 0 {
+		fmt.Println("no running node found through pid_file, restart the node to run the new version")
+		return nil
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGUSR2); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			fmt.Println("no running node found through pid_file, restart the node to run the new version")
+			return nil
+		}
+		return fmt.Errorf("failed to signal node %d: %w", pid, err)
+	}
+
+	deadline := time.Now().Add(updateHandover)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if current := readPIDPath(conf.PIDFile); current != 0 && current != pid {
+			fmt.Printf("node %d replaced by %d\n", pid, current)
+			return nil
+		}
+	}
+	return fmt.Errorf("node %d did not hand over to the new version within %s, see its log", pid, updateHandover)
+}
+
+// readPIDPath returns the pid in the pid file at path, 0 if there is none
+func readPIDPath(path string) int {
+	if path == "" {
+		return 0
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	return readPID(file)
+}
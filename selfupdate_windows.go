@@ -0,0 +1,51 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// replaceExecutable moves the running executable aside, as Windows does
+// not allow replacing it, and the downloaded binary into its place. The
+// old one is left as <path>.old until the next update.
+func replaceExecutable(download string, path string) error {
+	old := path + ".old"
+	os.Remove(old)
+	if err := os.Rename(path, old); err != nil {
+		return err
+	}
+	if err := os.Rename(download, path); err != nil {
+		os.Rename(old, path)
+		return err
+	}
+	return nil
+}
+
+// restartAfterUpdate restarts the service if it is running. Windows has no
+// upgrade without downtime, so polls during the restart are refused.
+func restartAfterUpdate(conf *NodeConfig) error {
+	return controlService(func(s *mgr.Service) error {
+		status, err := s.Query()
+		if err != nil {
+			return err
+		}
+		if status.State != svc.Running {
+			fmt.Printf("service %s is not running\n", serviceName)
+			return nil
+		}
+		if err := stopService(s); err != nil {
+			return err
+		}
+		if err := s.Start(); err != nil {
+			return err
+		}
+		fmt.Printf("service %s restarted\n", serviceName)
+		return nil
+	})
+}
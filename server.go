@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// Server is a munin node serving one configuration. It owns that
+// configuration and everything tracked while serving it, so servers are
+// independent of each other. Logging, tracing, internal metrics, error
+// reporting, signals, the pid file and upgrades belong to the process and
+// are set up by runNode.
+type Server struct {
+	// conf is not changed once the server is created
+	conf *NodeConfig
+
+	shutdown      shutdownState
+	health        healthState
+	allowFile     accessFile
+	plugins       pluginInventory
+	pluginRuns    pluginRunTable
+	configCache   configCacheTable
+	deniedClients deniedClientTable
+
+	// pluginSlots limits how many plugins run at once, no limit when nil
+	pluginSlots chan struct{}
+	// prefetchSlots limits how many plugins are run ahead of the master's
+	// commands, nil without prefetch
+	prefetchSlots chan struct{}
+
+	// tlsConfig serves starttls, nil with tls disabled
+	tlsConfig *tls.Config
+}
+
+func newServer(conf *NodeConfig) *Server {
+	s := &Server{
+		conf: conf,
+		shutdown: shutdownState{
+			stopping: make(chan struct{}),
+			conns:    map[net.Conn]struct{}{},
+		},
+		health:        healthState{listeners: map[string]string{}},
+		pluginRuns:    pluginRunTable{runs: map[string]*pluginRun{}},
+		configCache:   configCacheTable{configs: map[string]*configOutput{}},
+		deniedClients: deniedClientTable{clients: map[string]*deniedClient{}},
+	}
+	if conf.isEmbedded() {
+		s.pluginSlots = make(chan struct{}, 1)
+	}
+	if conf.Prefetch > 0 {
+		s.prefetchSlots = make(chan struct{}, conf.Prefetch)
+	}
+	return s
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// runServiceCommand handles no subcommands outside Windows, where service
+// registration is left to the init system.
+func runServiceCommand(command string) (code int, ok bool) {
+	return 0, false
+}
+
+func runAsService() (code int, ok bool) {
+	return 0, false
+}
@@ -0,0 +1,197 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const (
+	serviceName        = "munin-node"
+	serviceDisplayName = "Munin Node"
+	serviceStopTimeout = 10 * time.Second
+)
+
+// runServiceCommand runs the install, remove, start and stop subcommands
+// managing the Windows service. ok is false for any other argument.
+func runServiceCommand(command string) (code int, ok bool) {
+	var err error
+	switch command {
+	case "install":
+		err = installService()
+	case "remove":
+		err = removeService()
+	case "start":
+		err = controlService(func(s *mgr.Service) error { return s.Start() })
+	case "stop":
+		err = controlService(stopService)
+	default:
+		return 0, false
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", command, err)
+		return 1, true
+	}
+	return 0, true
+}
+
+func installService() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the executable: %w", err)
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", serviceName)
+	}
+
+	s, err := m.CreateService(serviceName, exePath, mgr.Config{
+		DisplayName: serviceDisplayName,
+		Description: "Answers Munin master requests with plugin data",
+		StartType:   mgr.StartAutomatic,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	// Restart after a crash, as systemd would with Restart=on-failure
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}
+	if err := s.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+
+	return nil
+}
+
+func removeService() error {
+	return controlService(func(s *mgr.Service) error {
+		if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+			if err := stopService(s); err != nil {
+				return err
+			}
+		}
+		return s.Delete()
+	})
+}
+
+// stopService asks the service to stop and waits until it has
+func stopService(s *mgr.Service) error {
+	status, err := s.Control(svc.Stop)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(serviceStopTimeout)
+	for status.State != svc.Stopped {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the service to stop")
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// controlService opens the installed service and calls action with it
+func controlService(action func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", serviceName, err)
+	}
+	defer s.Close()
+
+	return action(s)
+}
+
+// runAsService runs the node under the service control manager when it
+// was started by it. ok is false when running as a console process.
+func runAsService() (code int, ok bool) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return 0, false
+	}
+
+	// Services start in the system directory, while node.conf and the
+	// paths in it are relative to the node's own
+	if exePath, err := os.Executable(); err == nil {
+		os.Chdir(filepath.Dir(exePath))
+	}
+
+	if err := svc.Run(serviceName, nodeService{}); err != nil {
+		logger.Error("failed to run as a service", "error", err)
+		return 1, true
+	}
+	return 0, true
+}
+
+// nodeService runs the node for the service control manager
+type nodeService struct{}
+
+func (nodeService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	started := make(chan *Server, 1)
+	stopped := make(chan int, 1)
+	go func() {
+		stopped <- runNode(false, started)
+	}()
+
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	// A stop requested while the node is still loading its configuration
+	// is carried out once its server exists
+	var server *Server
+	var stopRequested bool
+	for {
+		select {
+		case code := <-stopped:
+			flushErrorReports()
+			return false, uint32(code)
+		case server = <-started:
+			if stopRequested {
+				server.beginShutdown()
+			}
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				drainTimeout := defaultDrainTimeout
+				if server != nil {
+					drainTimeout = server.conf.DrainTimeout
+				}
+				logger.Info("node stopping", "request", "service control", "drain_timeout", drainTimeout.String())
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32((drainTimeout + 5*time.Second) / time.Millisecond)}
+				stopRequested = true
+				if server != nil {
+					server.beginShutdown()
+				}
+			}
+		}
+	}
+}
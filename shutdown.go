@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultDrainTimeout bounds how long a stopping node waits for the
+// connections it is serving to finish
+const defaultDrainTimeout = 30 * time.Second
+
+// shutdownState tracks what a stopping server has to close and wait for.
+// Connections are only added while the server is not stopping, so the
+// wait group never grows once drainConnections waits on it.
+type shutdownState struct {
+	mu        sync.Mutex
+	stopping  chan struct{}
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	active    sync.WaitGroup
+}
+
+// handingOver is set while a node started by an upgrade takes over the
+// listeners, so that stopping for it is no stop of the service
+var handingOver atomic.Bool
+
+// isShuttingDown tells whether beginShutdown has been called
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.shutdown.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// trackListener registers a listener to be closed on shutdown
+func (s *Server) trackListener(listener net.Listener) {
+	s.shutdown.mu.Lock()
+	defer s.shutdown.mu.Unlock()
+
+	if s.isShuttingDown() {
+		listener.Close()
+		return
+	}
+	s.shutdown.listeners = append(s.shutdown.listeners, listener)
+}
+
+// trackConn registers a connection being served. It returns false once
+// the node is stopping, in which case the connection should be closed
+// without a greeting.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.shutdown.mu.Lock()
+	defer s.shutdown.mu.Unlock()
+
+	if s.isShuttingDown() {
+		return false
+	}
+	s.shutdown.conns[conn] = struct{}{}
+	s.shutdown.active.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.shutdown.mu.Lock()
+	defer s.shutdown.mu.Unlock()
+
+	delete(s.shutdown.conns, conn)
+	s.shutdown.active.Done()
+}
+
+// beginShutdown stops accepting connections and has the open ones end
+// after the command they are running: the read deadline fails the next
+// read, but leaves the reply being written alone.
+func (s *Server) beginShutdown() {
+	s.shutdown.mu.Lock()
+	defer s.shutdown.mu.Unlock()
+
+	if s.isShuttingDown() {
+		return
+	}
+	close(s.shutdown.stopping)
+
+	for _, listener := range s.shutdown.listeners {
+		listener.Close()
+	}
+	for conn := range s.shutdown.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+}
+
+// drainConnections waits up to drain_timeout for the connections open at
+// shutdown, then closes those still left and cancels the plugins they
+// are waiting for.
+func (s *Server) drainConnections(cancel context.CancelFunc) error {
+	drained := make(chan struct{})
+	go func() {
+		s.shutdown.active.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logger.Info("node stopped")
+		return nil
+	case <-time.After(s.conf.DrainTimeout):
+	}
+
+	s.shutdown.mu.Lock()
+	left := len(s.shutdown.conns)
+	for conn := range s.shutdown.conns {
+		conn.Close()
+	}
+	s.shutdown.mu.Unlock()
+
+	// Killed plugins are waited for, so that none outlives the node
+	cancel()
+	select {
+	case <-drained:
+	case <-time.After(pluginWaitDelay):
+	}
+	return fmt.Errorf("%d connections still open after %s", left, s.conf.DrainTimeout)
+}
+
+// isShutdownRead tells whether a read failed because beginShutdown set
+// the connection's deadline, or drainConnections closed it
+func (s *Server) isShutdownRead(err error) bool {
+	return s.isShuttingDown() && (errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, net.ErrClosed))
+}
+
+// stopOnSignal begins the shutdown of s on SIGTERM or SIGINT. A second
+// signal stops the node at once, without waiting for the drain.
+func stopOnSignal(s *Server) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		logger.Info("node stopping", "signal", sig.String(), "drain_timeout", s.conf.DrainTimeout.String())
+		if !handingOver.Load() {
+			notifyStopping()
+		}
+		s.beginShutdown()
+
+		sig = <-signals
+		logger.Warn("node stopped without draining connections", "signal", sig.String())
+		removePIDFile()
+		flushErrorReports()
+		os.Exit(1)
+	}()
+}
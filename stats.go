@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// isAdminConn tells whether conn may use admin commands such as stats:
+// clients on the unix socket, which already passed allow_uid/allow_gid,
+// and TCP clients matching admin_allow. Loopback alone is not enough, as
+// a TLS proxy such as stunnel connects from there on behalf of anyone.
+func (s *Server) isAdminConn(conn net.Conn) bool {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		return s.isAllowedIP(addr.IP.String(), s.conf.AdminAllow)
+	}
+	return false
+}
+
+// unknownCommandHelp is the reply to an unknown command, listing stats
+// only to the clients allowed to use it
+func (s *Server) unknownCommandHelp(conn net.Conn) string {
+	if s.isAdminConn(conn) {
+		return "# Unknown command. Try cap, list, nodes, config, fetch, version, stats or quit"
+	}
+	return "# Unknown command. Try cap, list, nodes, config, fetch, version or quit"
+}
+
+// metricStartTime is when the node started, for the uptime reported by
+// stats, /healthz and the metrics
+var metricStartTime = time.Now()
+
+// metricCommand returns the command label for cmd, folding anything that
+// is not a protocol command into "unknown" so clients cannot create series.
+func metricCommand(cmd string) string {
+	switch cmd {
+	case "cap", "version", "nodes", "list", "config", "fetch", "starttls", "stats", "quit":
+		return cmd
+	}
+	return "unknown"
+}
+
+// metricOption returns the option label for a plugin run
+func metricOption(option string) string {
+	if option == "" {
+		return "fetch"
+	}
+	return option
+}
+
+// writeStats answers the stats command with one "key value" line per
+// figure, dotted keys carrying the labels, and a closing ".".
+func (s *Server) writeStats(w io.Writer) {
+	fmt.Fprintf(w, "uptime %.0f\n", time.Since(metricStartTime).Seconds())
+	fmt.Fprintf(w, "goroutines %d\n", runtime.NumGoroutine())
+
+	active := 0.0
+	metricConnectionsActive.each(func(values []string, value float64) {
+		active = value
+	})
+	fmt.Fprintf(w, "connections.active %.0f\n", active)
+
+	writeStatsCounter(w, "connections.total", metricConnections)
+	writeStatsCounter(w, "connections.denied", metricConnectionsDenied)
+	writeStatsCounter(w, "commands", metricCommands)
+	writeStatsCounter(w, "plugin_errors", metricPluginErrors)
+	writeStatsCounter(w, "errors", metricErrors)
+	writeStatsCounter(w, "cache.hits", metricCacheHits)
+	writeStatsCounter(w, "cache.misses", metricCacheMisses)
+	s.writeCacheEntries(w)
+	s.writeDenied(w)
+
+	fmt.Fprintln(w, ".")
+}
+
+// writeCacheEntries reports how many entries each cache holds
+func (s *Server) writeCacheEntries(w io.Writer) {
+	s.configCache.Lock()
+	configs := len(s.configCache.configs)
+	s.configCache.Unlock()
+	fmt.Fprintf(w, "cache.entries.config %d\n", configs)
+
+	s.plugins.mu.Lock()
+	plugins := len(s.plugins.files)
+	s.plugins.mu.Unlock()
+	fmt.Fprintf(w, "cache.entries.plugins %d\n", plugins)
+
+	s.plugins.builtinMu.Lock()
+	builtins := len(s.plugins.builtins)
+	s.plugins.builtinMu.Unlock()
+	fmt.Fprintf(w, "cache.entries.builtins %d\n", builtins)
+}
+
+func writeStatsCounter(w io.Writer, prefix string, counter *metricCounter) {
+	counter.each(func(values []string, value float64) {
+		key := strings.Join(append([]string{prefix}, values...), ".")
+		fmt.Fprintf(w, "%s %s\n", key, strconv.FormatFloat(value, 'f', -1, 64))
+	})
+}
+
+// pluginRun is the outcome of the last run of a plugin with one option
+type pluginRun struct {
+	plugin   string
+	option   string
+	last     time.Time
+	duration time.Duration
+	exitCode int
+	err      string
+}
+
+// pluginRunsMax bounds the runs kept by recordPluginRun
+const pluginRunsMax = 1024
+
+// pluginRunTable holds the last pluginRun by plugin and option
+type pluginRunTable struct {
+	sync.Mutex
+	runs map[string]*pluginRun
+}
+
+// recordPluginRun keeps the outcome of a plugin run under label for stats
+// plugins. When the table is full the run longest ago makes room.
+func (s *Server) recordPluginRun(plugin, label, option string, start time.Time, err error) {
+	run := &pluginRun{
+		plugin:   label,
+		option:   metricOption(option),
+		last:     start,
+		duration: time.Since(start),
+	}
+
+	if err != nil {
+		run.exitCode = s.pluginExitCode(plugin, err)
+		run.err = strings.ReplaceAll(err.Error(), "\n", " ")
+	}
+
+	s.pluginRuns.Lock()
+	defer s.pluginRuns.Unlock()
+
+	key := run.plugin + " " + run.option
+	if _, ok := s.pluginRuns.runs[key]; !ok {
+		limit := pluginRunsMax
+		if s.conf.isEmbedded() {
+			limit = embeddedPluginRuns
+		}
+		if len(s.pluginRuns.runs) >= limit {
+			var oldest string
+			for name, r := range s.pluginRuns.runs {
+				if oldest == "" || r.last.Before(s.pluginRuns.runs[oldest].last) {
+					oldest = name
+				}
+			}
+			delete(s.pluginRuns.runs, oldest)
+		}
+	}
+	s.pluginRuns.runs[key] = run
+}
+
+// pluginExitCode returns the exit code of a plugin run that returned err:
+// the process's for external plugins, -1 if none was started, and 0 or 1
+// for built-in plugins.
+func (s *Server) pluginExitCode(plugin string, err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if s.isBuiltinPlugin(plugin) {
+		return 1
+	}
+	return -1
+}
+
+// isBuiltinPlugin tells whether plugin is run by a built-in rather than a
+// file in the plugins directory
+func (s *Server) isBuiltinPlugin(plugin string) bool {
+	if _, err := os.Lstat(filepath.Join(s.conf.PluginFolder, plugin)); err == nil {
+		return false
+	}
+	builtin, _ := s.findBuiltin(plugin)
+	return builtin != nil
+}
+
+// writePluginRuns answers stats plugins with the last run of every plugin
+// and option, as plugin.<name>.<option>.<key> value lines and a closing ".".
+func (s *Server) writePluginRuns(w io.Writer) {
+	s.pluginRuns.Lock()
+	runs := make([]*pluginRun, 0, len(s.pluginRuns.runs))
+	for _, run := range s.pluginRuns.runs {
+		runs = append(runs, run)
+	}
+	s.pluginRuns.Unlock()
+
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].plugin != runs[j].plugin {
+			return runs[i].plugin < runs[j].plugin
+		}
+		return runs[i].option < runs[j].option
+	})
+
+	for _, run := range runs {
+		prefix := "plugin." + run.plugin + "." + run.option
+		fmt.Fprintf(w, "%s.last_run %d\n", prefix, run.last.Unix())
+		fmt.Fprintf(w, "%s.duration %.6f\n", prefix, run.duration.Seconds())
+		fmt.Fprintf(w, "%s.exit_code %d\n", prefix, run.exitCode)
+		if run.err != "" {
+			fmt.Fprintf(w, "%s.error %s\n", prefix, run.err)
+		}
+	}
+
+	fmt.Fprintln(w, ".")
+}
+
+// deniedClientsMax bounds the clients counted by recordDenied, so a scan
+// from many addresses cannot grow the table without limit
+const deniedClientsMax = 1024
+
+type deniedClient struct {
+	count uint64
+	last  time.Time
+}
+
+type deniedClientTable struct {
+	sync.Mutex
+	clients map[string]*deniedClient
+}
+
+// recordDenied counts a rejected connection from client and returns how
+// many there have been. When the table is full the client denied longest
+// ago makes room.
+func (s *Server) recordDenied(client string) uint64 {
+	s.deniedClients.Lock()
+	defer s.deniedClients.Unlock()
+
+	denied := s.deniedClients.clients[client]
+	if denied == nil {
+		limit := deniedClientsMax
+		if s.conf.isEmbedded() {
+			limit = embeddedDeniedClients
+		}
+		if len(s.deniedClients.clients) >= limit {
+			var oldest string
+			for name, c := range s.deniedClients.clients {
+				if oldest == "" || c.last.Before(s.deniedClients.clients[oldest].last) {
+					oldest = name
+				}
+			}
+			delete(s.deniedClients.clients, oldest)
+		}
+		denied = &deniedClient{}
+		s.deniedClients.clients[client] = denied
+	}
+	denied.count++
+	denied.last = time.Now()
+
+	return denied.count
+}
+
+// writeDenied adds the denied.<client> lines to stats
+func (s *Server) writeDenied(w io.Writer) {
+	s.deniedClients.Lock()
+	defer s.deniedClients.Unlock()
+
+	clients := make([]string, 0, len(s.deniedClients.clients))
+	for client := range s.deniedClients.clients {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		fmt.Fprintf(w, "denied.%s %d\n", client, s.deniedClients.clients[client].count)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsAdminAllow(t *testing.T) {
+	tests := []struct {
+		adminAllow []string
+		admin      bool
+	}{
+		{nil, false},
+		{[]string{`^10\.0\.0\.1$`}, false},
+		{[]string{`^10\.0\.0\.1$`, `^127\.0\.0\.1$`}, true},
+	}
+	for _, test := range tests {
+		s := newPluginServer(t, nil)
+		s.conf.Builtins = []string{"none"}
+		s.conf.AdminAllow = test.adminAllow
+
+		conn, r := dialNode(t, s)
+		reply := command(t, conn, r, "stats")
+		if admin := strings.HasPrefix(reply, "uptime "); admin != test.admin {
+			t.Errorf("admin_allow %q: stats answered %q", test.adminAllow, reply)
+		}
+		if !test.admin && strings.Contains(reply, "stats") {
+			t.Errorf("admin_allow %q: help %q lists stats", test.adminAllow, reply)
+		}
+	}
+}
+
+func TestRecordPluginRunLimit(t *testing.T) {
+	tests := []struct {
+		profile string
+		limit   int
+	}{
+		{"", pluginRunsMax},
+		{profileEmbedded, embeddedPluginRuns},
+	}
+	for _, test := range tests {
+		conf := newNodeConfig()
+		conf.Profile = test.profile
+		s := newServer(conf)
+
+		start := time.Now()
+		for i := 0; i < test.limit+10; i++ {
+			plugin := fmt.Sprintf("plugin%d", i)
+			s.recordPluginRun(plugin, plugin, "", start.Add(time.Duration(i)*time.Second), nil)
+		}
+		// Running a kept plugin again replaces its run rather than
+		// another plugin's
+		s.recordPluginRun("plugin20", "plugin20", "", start.Add(time.Hour), nil)
+
+		if got := len(s.pluginRuns.runs); got != test.limit {
+			t.Errorf("profile %q: kept %d runs, want %d", test.profile, got, test.limit)
+		}
+		for i, want := range map[int]bool{0: false, 9: false, 10: true, 20: true, test.limit + 9: true} {
+			if _, ok := s.pluginRuns.runs[fmt.Sprintf("plugin%d fetch", i)]; ok != want {
+				t.Errorf("profile %q: run of plugin%d kept = %v, want %v", test.profile, i, ok, want)
+			}
+		}
+	}
+}
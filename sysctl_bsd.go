@@ -0,0 +1,90 @@
+//go:build freebsd || openbsd || netbsd || darwin
+// +build freebsd openbsd netbsd darwin
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The BSDs have no /proc worth reading, so native collectors ask the
+// kernel through sysctl(3) instead.
+
+// linkStats are the counters of a network interface
+type linkStats struct {
+	rxBytes   uint64
+	txBytes   uint64
+	txPackets uint64
+	// speed is the link speed in bit/s, 0 if unknown
+	speed uint64
+}
+
+// sysctlLongs reads a sysctl holding an array of C longs, such as
+// kern.cp_time
+func sysctlLongs(name string) ([]uint64, error) {
+	data, err := unix.SysctlRaw(name)
+	if err != nil {
+		return nil, fmt.Errorf("sysctl %s: %w", name, err)
+	}
+
+	size := int(unsafe.Sizeof(uintptr(0)))
+	values := make([]uint64, 0, len(data)/size)
+	for i := 0; i+size <= len(data); i += size {
+		if size == 8 {
+			values = append(values, binary.NativeEndian.Uint64(data[i:]))
+		} else {
+			values = append(values, uint64(binary.NativeEndian.Uint32(data[i:])))
+		}
+	}
+	return values, nil
+}
+
+// sysctlUint64s reads a sysctl holding an array of 64 bit integers, such
+// as kern.cp_time on NetBSD
+func sysctlUint64s(name string) ([]uint64, error) {
+	data, err := unix.SysctlRaw(name)
+	if err != nil {
+		return nil, fmt.Errorf("sysctl %s: %w", name, err)
+	}
+
+	values := make([]uint64, 0, len(data)/8)
+	for i := 0; i+8 <= len(data); i += 8 {
+		values = append(values, binary.NativeEndian.Uint64(data[i:]))
+	}
+	return values, nil
+}
+
+// sysctlCounter reads a numeric sysctl of any width, as the vm.stats
+// counters changed from 32 to 64 bits between releases
+func sysctlCounter(name string) (uint64, error) {
+	data, err := unix.SysctlRaw(name)
+	if err != nil {
+		return 0, fmt.Errorf("sysctl %s: %w", name, err)
+	}
+
+	switch len(data) {
+	case 4:
+		return uint64(binary.NativeEndian.Uint32(data)), nil
+	case 8:
+		return binary.NativeEndian.Uint64(data), nil
+	}
+	return 0, fmt.Errorf("sysctl %s: unexpected size %d", name, len(data))
+}
+
+// sysctlCounters reads several numeric sysctls sharing a prefix, keyed by
+// the rest of their name
+func sysctlCounters(prefix string, names ...string) (map[string]uint64, error) {
+	values := make(map[string]uint64, len(names))
+	for _, name := range names {
+		value, err := sysctlCounter(prefix + name)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,145 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// swapUsage is vm.swapusage, the dynamically sized swap files macOS
+// keeps in /private/var/vm
+type swapUsage struct {
+	used  uint64
+	total uint64
+}
+
+// readSwapUsage returns vm.swapusage, a struct xsw_usage starting with
+// the 64 bit xsu_total, xsu_avail and xsu_used
+func readSwapUsage() (swapUsage, error) {
+	data, err := unix.SysctlRaw("vm.swapusage")
+	if err != nil {
+		return swapUsage{}, fmt.Errorf("sysctl vm.swapusage: %w", err)
+	}
+	if len(data) < 24 {
+		return swapUsage{}, fmt.Errorf("sysctl vm.swapusage: unexpected size %d", len(data))
+	}
+	return swapUsage{
+		total: binary.NativeEndian.Uint64(data),
+		used:  binary.NativeEndian.Uint64(data[16:]),
+	}, nil
+}
+
+// readMounts returns the mounted filesystems with their statistics.
+// MNT_NOWAIT keeps a hung NFS server from stalling the poll.
+func readMounts() ([]mountPoint, error) {
+	count, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+	stats := make([]unix.Statfs_t, count)
+	count, err = unix.Getfsstat(stats, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+
+	mounts := make([]mountPoint, 0, count)
+	for _, stat := range stats[:count] {
+		mounts = append(mounts, mountPoint{
+			device: unix.ByteSliceToString(stat.Mntfromname[:]),
+			path:   unix.ByteSliceToString(stat.Mntonname[:]),
+			fstype: unix.ByteSliceToString(stat.Fstypename[:]),
+			blocks: stat.Blocks,
+			bfree:  stat.Bfree,
+			bavail: stat.Bavail,
+		})
+	}
+	return mounts, nil
+}
+
+// linkCounters returns the counters of the named interface. The struct
+// if_data of NET_RT_IFLIST only has 32 bit counters, so this asks for
+// the RTM_IFINFO2 messages of NET_RT_IFLIST2 and their struct if_data64.
+func linkCounters(name string) (linkStats, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("no such interface %s", name)
+	}
+
+	rib, err := syscall.RouteRIB(unix.NET_RT_IFLIST2, iface.Index)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("unable to read counters of %s: %w", name, err)
+	}
+
+	for len(rib) >= unix.SizeofIfMsghdr2 {
+		m := (*unix.IfMsghdr2)(unsafe.Pointer(&rib[0]))
+		if m.Msglen == 0 || int(m.Msglen) > len(rib) {
+			break
+		}
+		if m.Type == unix.RTM_IFINFO2 && int(m.Index) == iface.Index {
+			return linkStats{
+				rxBytes:   m.Data.Ibytes,
+				txBytes:   m.Data.Obytes,
+				txPackets: m.Data.Opackets,
+				speed:     m.Data.Baudrate,
+			}, nil
+		}
+		rib = rib[m.Msglen:]
+	}
+	return linkStats{}, fmt.Errorf("no counters for interface %s", name)
+}
+
+// vmStatPageSize finds the page size in the header of vm_stat's output,
+// 16384 on Apple silicon and 4096 on Intel
+var vmStatPageSize = regexp.MustCompile(`page size of (\d+) bytes`)
+
+// readVMStat runs vm_stat, which reports the Mach host_statistics64
+// counters, and returns its lines keyed by label. Page counts are
+// converted to bytes, the other counters are returned as is.
+func readVMStat(ctx context.Context) (map[string]uint64, error) {
+	output, err := runCommand(ctx, 5*time.Second, "vm_stat")
+	if err != nil {
+		return nil, fmt.Errorf("vm_stat: %w", err)
+	}
+
+	var pageSize uint64 = 4096
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := vmStatPageSize.FindStringSubmatch(line); m != nil {
+			pageSize, _ = strconv.ParseUint(m[1], 10, 64)
+			continue
+		}
+
+		label, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		count, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), "."), 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[strings.Trim(label, `"`)] = count
+	}
+
+	for label, count := range counters {
+		if strings.HasPrefix(label, "Pages ") {
+			counters[label] = count * pageSize
+		}
+	}
+	return counters, nil
+}
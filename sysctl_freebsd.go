@@ -0,0 +1,88 @@
+//go:build freebsd
+// +build freebsd
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// xswdevVersion is the struct xswdev layout read from vm.swap_info, the
+// one used since FreeBSD 12
+const xswdevVersion = 2
+
+type swapUsage struct {
+	used  uint64
+	total uint64
+}
+
+// readSwapUsage adds up the swap devices in vm.swap_info, which has one
+// struct xswdev per device.
+func readSwapUsage() (swapUsage, error) {
+	pageSize, err := sysctlCounter("vm.stats.vm.v_page_size")
+	if err != nil {
+		return swapUsage{}, err
+	}
+
+	var usage swapUsage
+	for i := 0; ; i++ {
+		data, err := unix.SysctlRaw("vm.swap_info", i)
+		if err == unix.ENOENT {
+			break
+		}
+		if err != nil {
+			return swapUsage{}, fmt.Errorf("sysctl vm.swap_info: %w", err)
+		}
+		if len(data) < 28 || binary.NativeEndian.Uint32(data) != xswdevVersion {
+			return swapUsage{}, fmt.Errorf("sysctl vm.swap_info: unsupported xswdev layout")
+		}
+
+		// xsw_nblks and xsw_used, in pages, follow the 64 bit xsw_dev
+		// and the xsw_flags int
+		usage.total += uint64(binary.NativeEndian.Uint32(data[20:])) * pageSize
+		usage.used += uint64(binary.NativeEndian.Uint32(data[24:])) * pageSize
+	}
+	return usage, nil
+}
+
+// ifDataGeneral selects the struct ifmibdata of an interface under
+// net.link.generic.ifdata, see ifmib(4)
+const ifDataGeneral = 1
+
+// Offsets into struct ifmibdata on 64-bit FreeBSD: the name, five ints
+// and four fillers come before the embedded struct if_data.
+const (
+	ifmibDataOffset     = 56
+	ifDataBaudrate      = ifmibDataOffset + 16
+	ifDataInputBytes    = ifmibDataOffset + 64
+	ifDataOutputBytes   = ifmibDataOffset + 72
+	ifDataOutputPackets = ifmibDataOffset + 40
+)
+
+// linkCounters returns the counters of the named interface from its
+// struct ifmibdata under net.link.generic.ifdata.
+func linkCounters(name string) (linkStats, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("no such interface %s", name)
+	}
+
+	data, err := unix.SysctlRaw("net.link.generic.ifdata", iface.Index, ifDataGeneral)
+	if err != nil {
+		return linkStats{}, fmt.Errorf("unable to read counters of %s: %w", name, err)
+	}
+	if len(data) < ifDataOutputBytes+8 {
+		return linkStats{}, fmt.Errorf("unable to read counters of %s: unexpected size %d", name, len(data))
+	}
+
+	return linkStats{
+		rxBytes:   binary.NativeEndian.Uint64(data[ifDataInputBytes:]),
+		txBytes:   binary.NativeEndian.Uint64(data[ifDataOutputBytes:]),
+		txPackets: binary.NativeEndian.Uint64(data[ifDataOutputPackets:]),
+		speed:     binary.NativeEndian.Uint64(data[ifDataBaudrate:]),
+	}, nil
+}
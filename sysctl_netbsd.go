@@ -0,0 +1,106 @@
+//go:build netbsd
+// +build netbsd
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuFields are the kern.cp_time columns in kernel order
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"user", "CPU time spent by normal programs and daemons"},
+	{"nice", "CPU time spent by nice(1)d programs"},
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"interrupt", "CPU time spent by the kernel processing interrupts"},
+	{"idle", "Idle CPU time"},
+}
+
+// Indexes of the struct uvmexp_sysctl int64s read from vm.uvmexp2
+const (
+	uvmPageSize  = 0
+	uvmPages     = 3
+	uvmFree      = 4
+	uvmActive    = 5
+	uvmInactive  = 6
+	uvmWired     = 8
+	uvmSwapPages = 17
+	uvmSwapInUse = 18
+)
+
+// NetBSD's cp_time counters are 64 bit on every platform
+func readCPUTimes() ([]uint64, error) {
+	return sysctlUint64s("kern.cp_time")
+}
+
+// statClockRate returns the rate kern.cp_time ticks at, the stathz
+// member of kern.clockrate's struct clockinfo
+func statClockRate() (uint64, error) {
+	data, err := unix.SysctlRaw("kern.clockrate")
+	if err != nil {
+		return 0, fmt.Errorf("sysctl kern.clockrate: %w", err)
+	}
+	if len(data) < 16 {
+		return 0, fmt.Errorf("sysctl kern.clockrate: unexpected size %d", len(data))
+	}
+	return uint64(binary.NativeEndian.Uint32(data[12:])), nil
+}
+
+// readUVM returns the page counts of vm.uvmexp2 in bytes
+func readUVM() (uvmStats, error) {
+	values, err := sysctlUint64s("vm.uvmexp2")
+	if err != nil {
+		return uvmStats{}, err
+	}
+	if len(values) <= uvmSwapInUse {
+		return uvmStats{}, fmt.Errorf("sysctl vm.uvmexp2: unexpected size %d", len(values)*8)
+	}
+
+	pageSize := values[uvmPageSize]
+	return uvmStats{
+		total:     values[uvmPages] * pageSize,
+		free:      values[uvmFree] * pageSize,
+		active:    values[uvmActive] * pageSize,
+		inactive:  values[uvmInactive] * pageSize,
+		wired:     values[uvmWired] * pageSize,
+		swapTotal: values[uvmSwapPages] * pageSize,
+		swapUsed:  values[uvmSwapInUse] * pageSize,
+	}, nil
+}
+
+// readMounts returns the mounted filesystems with their statistics.
+// MNT_NOWAIT keeps a hung NFS server from stalling the poll.
+func readMounts() ([]mountPoint, error) {
+	count, _, errno := unix.Syscall(unix.SYS_GETVFSSTAT, 0, 0, unix.MNT_NOWAIT)
+	if errno != 0 {
+		return nil, fmt.Errorf("unable to list mounts: %w", errno)
+	}
+	stats := make([]unix.Statvfs_t, count)
+	if count > 0 {
+		size := uintptr(len(stats)) * unsafe.Sizeof(stats[0])
+		count, _, errno = unix.Syscall(unix.SYS_GETVFSSTAT, uintptr(unsafe.Pointer(&stats[0])), size, unix.MNT_NOWAIT)
+		if errno != 0 {
+			return nil, fmt.Errorf("unable to list mounts: %w", errno)
+		}
+	}
+
+	mounts := make([]mountPoint, 0, count)
+	for _, stat := range stats[:count] {
+		mounts = append(mounts, mountPoint{
+			device: unix.ByteSliceToString(stat.Mntfromname[:]),
+			path:   unix.ByteSliceToString(stat.Mntonname[:]),
+			fstype: unix.ByteSliceToString(stat.Fstypename[:]),
+			blocks: stat.Blocks,
+			bfree:  stat.Bfree,
+			bavail: stat.Bavail,
+		})
+	}
+	return mounts, nil
+}
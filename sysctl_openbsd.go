@@ -0,0 +1,108 @@
+//go:build openbsd
+// +build openbsd
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuFields are the kern.cp_time columns in kernel order
+var cpuFields = []struct {
+	name string
+	info string
+}{
+	{"user", "CPU time spent by normal programs and daemons"},
+	{"nice", "CPU time spent by nice(1)d programs"},
+	{"system", "CPU time spent by the kernel in system activities"},
+	{"spin", "CPU time spent spinning on kernel locks"},
+	{"interrupt", "CPU time spent by the kernel processing interrupts"},
+	{"idle", "Idle CPU time"},
+}
+
+// Indexes of the struct uvmexp ints read from vm.uvmexp
+const (
+	uvmPageSize  = 0
+	uvmPages     = 3
+	uvmFree      = 4
+	uvmActive    = 5
+	uvmInactive  = 6
+	uvmWired     = 8
+	uvmSwapPages = 26
+	uvmSwapInUse = 27
+)
+
+func readCPUTimes() ([]uint64, error) {
+	return sysctlLongs("kern.cp_time")
+}
+
+// statClockRate returns the rate kern.cp_time ticks at, the stathz
+// member of kern.clockrate's struct clockinfo
+func statClockRate() (uint64, error) {
+	data, err := unix.SysctlRaw("kern.clockrate")
+	if err != nil {
+		return 0, fmt.Errorf("sysctl kern.clockrate: %w", err)
+	}
+	if len(data) < 12 {
+		return 0, fmt.Errorf("sysctl kern.clockrate: unexpected size %d", len(data))
+	}
+	return uint64(binary.NativeEndian.Uint32(data[8:])), nil
+}
+
+// readUVM returns the page counts of vm.uvmexp in bytes
+func readUVM() (uvmStats, error) {
+	data, err := unix.SysctlRaw("vm.uvmexp")
+	if err != nil {
+		return uvmStats{}, fmt.Errorf("sysctl vm.uvmexp: %w", err)
+	}
+	if len(data) < 4*(uvmSwapInUse+1) {
+		return uvmStats{}, fmt.Errorf("sysctl vm.uvmexp: unexpected size %d", len(data))
+	}
+
+	field := func(i int) uint64 {
+		return uint64(binary.NativeEndian.Uint32(data[4*i:]))
+	}
+	pageSize := field(uvmPageSize)
+	return uvmStats{
+		total:     field(uvmPages) * pageSize,
+		free:      field(uvmFree) * pageSize,
+		active:    field(uvmActive) * pageSize,
+		inactive:  field(uvmInactive) * pageSize,
+		wired:     field(uvmWired) * pageSize,
+		swapTotal: field(uvmSwapPages) * pageSize,
+		swapUsed:  field(uvmSwapInUse) * pageSize,
+	}, nil
+}
+
+// readMounts returns the mounted filesystems with their statistics.
+// MNT_NOWAIT keeps a hung NFS server from stalling the poll.
+func readMounts() ([]mountPoint, error) {
+	count, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+	stats := make([]unix.Statfs_t, count)
+	count, err = unix.Getfsstat(stats, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list mounts: %w", err)
+	}
+
+	mounts := make([]mountPoint, 0, count)
+	for _, stat := range stats[:count] {
+		mount := mountPoint{
+			device: unix.ByteSliceToString(stat.F_mntfromname[:]),
+			path:   unix.ByteSliceToString(stat.F_mntonname[:]),
+			fstype: unix.ByteSliceToString(stat.F_fstypename[:]),
+			blocks: stat.F_blocks,
+			bfree:  stat.F_bfree,
+		}
+		if stat.F_bavail > 0 {
+			mount.bavail = uint64(stat.F_bavail)
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
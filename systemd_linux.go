@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// activatedSockets returns the sockets systemd passed through LISTEN_FDS:
+// listening sockets from a plain .socket unit, or, with Accept=yes, the
+// one connection this instance was started for. Both are nil when the
+// node was not socket-activated.
+func activatedSockets() ([]net.Listener, net.Conn, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil, nil
+	}
+
+	var listeners []net.Listener
+	var conn net.Conn
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		// The net package works on a duplicate that is closed on exec, so
+		// closing the original keeps it away from plugins
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+
+		listening, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("file descriptor %d is no socket: %w", fd, err)
+		}
+
+		if listening == 1 {
+			listener, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				return nil, nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+			}
+			listeners = append(listeners, listener)
+			continue
+		}
+
+		c, err := net.FileConn(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+		if conn != nil {
+			c.Close()
+			continue
+		}
+		conn = c
+	}
+
+	return listeners, conn, nil
+}
+
+// sdNotify sends state, such as READY=1, to the service manager on
+// NOTIFY_SOCKET. Without one, i.e. outside a Type=notify unit, it does
+// nothing.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// A leading @ names an abstract socket, which the net package handles
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", socket, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify %s: %w", socket, err)
+	}
+	return nil
+}
+
+// notifyReady tells systemd the node is serving and starts the watchdog
+// keepalives if the unit sets WatchdogSec. A keepalive is skipped while a
+// listener is failing, so that systemd restarts a node that no longer
+// accepts connections.
+func notifyReady(s *Server) {
+	// MAINPID tells systemd which process to watch once an upgraded node
+	// has replaced the one it started
+	state := fmt.Sprintf("READY=1\nMAINPID=%d\nSTATUS=Serving munin clients", os.Getpid())
+	if err := sdNotify(state); err != nil {
+		logger.Warn("failed to notify systemd", "error", err)
+		return
+	}
+
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	logger.Debug("systemd watchdog enabled", "interval", interval)
+
+	go func() {
+		for range time.Tick(interval) {
+			if !s.listenersHealthy() {
+				logger.Warn("skipping systemd watchdog keepalive while a listener is failing")
+				continue
+			}
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				logger.Warn("failed to notify systemd", "error", err)
+			}
+		}
+	}()
+}
+
+// watchdogInterval returns how often to send keepalives, half the timeout
+// systemd passed in WATCHDOG_USEC, or 0 if the watchdog is not meant for
+// this process.
+func watchdogInterval() time.Duration {
+	if !isWatchdogPID(os.Getenv("WATCHDOG_PID")) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// notifyStopping tells systemd the node is shutting down
+func notifyStopping() {
+	if err := sdNotify("STOPPING=1"); err != nil {
+		logger.Warn("failed to notify systemd", "error", err)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestUpgradeWatchdog upgrades to the test binary itself, which, started as
+// the replacement, notifies systemd as a node would
+func TestUpgradeWatchdog(t *testing.T) {
+	if os.Getenv(upgradeParentEnv) != "" {
+		notifyReady(newServer(newNodeConfig()))
+		time.Sleep(time.Second)
+		os.Exit(0)
+	}
+
+	socket := filepath.Join(t.TempDir(), "notify")
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer notify.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	t.Setenv("WATCHDOG_USEC", "200000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgradeWatchdog$"}
+	defer func() { os.Args = args }()
+	defer handingOver.Store(false)
+
+	if err := newServer(newNodeConfig()).startReplacement(map[string][]net.Listener{"munin": {listener}}); err != nil {
+		t.Fatal(err)
+	}
+
+	notify.SetReadDeadline(time.Now().Add(10 * time.Second))
+	mainPID := ""
+	buf := make([]byte, 4096)
+	for {
+		n, err := notify.Read(buf)
+		if err != nil {
+			t.Fatalf("no watchdog keepalive from the replacement: %v", err)
+		}
+		state := string(buf[:n])
+		if state == "WATCHDOG=1" {
+			break
+		}
+		for _, line := range strings.Split(state, "\n") {
+			if pid, ok := strings.CutPrefix(line, "MAINPID="); ok {
+				mainPID = pid
+			}
+		}
+	}
+	pid, err := strconv.Atoi(mainPID)
+	if err != nil || pid == os.Getpid() {
+		t.Fatalf("replacement sent keepalives with MAINPID %q", mainPID)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+func TestHandoverWatchdog(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		name   string
+		parent string
+		pid    string
+		want   string
+	}{
+		{"own", "", self, self},
+		{"inherited", "4242", "4242", self},
+		{"other process", "", "4242", "4242"},
+		{"other than parent", "4242", "4343", "4343"},
+	}
+	for _, test := range tests {
+		t.Setenv(upgradeParentEnv, test.parent)
+		env := handoverWatchdog([]string{"PATH=/bin", "WATCHDOG_PID=" + test.pid, "WATCHDOG_USEC=30000000"})
+		if got := env[1]; got != "WATCHDOG_PID="+test.want {
+			t.Errorf("%s: handed over %s, want WATCHDOG_PID=%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "net"
+
+// activatedSockets reports no sockets, systemd only running on Linux
+func activatedSockets() ([]net.Listener, net.Conn, error) {
+	return nil, nil, nil
+}
+
+func notifyReady(s *Server) {}
+
+func notifyStopping() {}
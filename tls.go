@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLS works as in Munin: the master sends starttls, the node answers
+// "TLS OK" and the connection carries on as the server side of a TLS
+// session. With tls paranoid the node closes a connection that uses any
+// other command first.
+const (
+	tlsDisabled = "disabled"
+	tlsEnabled  = "enabled"
+	tlsParanoid = "paranoid"
+
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+// configureTLS loads tls_certificate, tls_private_key and
+// tls_ca_certificate for starttls. Client certificates are verified
+// against tls_ca_certificate, and with tls_verify_certificate required.
+func (s *Server) configureTLS() error {
+	if s.conf.TLS == tlsDisabled {
+		if s.hasCommonNameACL() {
+			return errors.New("plugin_acl cn: rules need tls and tls_ca_certificate")
+		}
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.conf.TLSCertificate, s.conf.TLSPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to load tls_certificate and tls_private_key: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.conf.TLSCACertificate != "" {
+		data, err := os.ReadFile(s.conf.TLSCACertificate)
+		if err != nil {
+			return fmt.Errorf("failed to read tls_ca_certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificate found in %s", s.conf.TLSCACertificate)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if s.conf.TLSVerifyCertificate {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if s.conf.TLSVerifyCertificate {
+		return errors.New("tls_verify_certificate needs tls_ca_certificate")
+	} else if s.hasCommonNameACL() {
+		return errors.New("plugin_acl cn: rules need tls_ca_certificate")
+	}
+
+	s.tlsConfig = config
+	return nil
+}
+
+func (s *Server) hasCommonNameACL() bool {
+	for _, acl := range s.conf.PluginACLs {
+		if strings.HasPrefix(acl.Client, "cn:") {
+			return true
+		}
+	}
+	return false
+}
+
+// startTLS answers starttls and returns conn as the server side of a TLS
+// session
+func (s *Server) startTLS(ctx context.Context, conn net.Conn, w *bufio.Writer) (*tls.Conn, error) {
+	fmt.Fprintln(w, "TLS OK")
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+
+	tlsConn := tls.Server(conn, s.tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// clientCommonName returns the common name of the verified certificate the
+// client on conn showed, or "" if it showed none
+func clientCommonName(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	return chains[0][0].Subject.CommonName
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "munin test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate for commonName as PEM certificate and key
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newTLSServer returns a server with tls mode, a certificate for
+// localhost from ca and the billing_queue and cpu plugins, the first of
+// which is all billing-poller may use
+func newTLSServer(t *testing.T, ca *testCA, mode string) *Server {
+	s := newPluginServer(t, map[string]string{
+		"billing_queue": "echo queue.value 3\n",
+		"cpu":           "echo user.value 1\n",
+	})
+	dir := t.TempDir()
+	cert, key := ca.issue(t, "localhost", x509.ExtKeyUsageServerAuth)
+	files := map[string][]byte{"node.pem": cert, "node.key": key, "ca.pem": ca.pem}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.conf.Builtins = []string{"none"}
+	s.conf.TLS = mode
+	s.conf.TLSCertificate = filepath.Join(dir, "node.pem")
+	s.conf.TLSPrivateKey = filepath.Join(dir, "node.key")
+	s.conf.TLSCACertificate = filepath.Join(dir, "ca.pem")
+	s.conf.PluginACLs = []PluginACL{{Client: "cn:billing-poller", Plugins: []string{"billing_*"}}}
+	if err := s.configureTLS(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// dialNode connects to a connection served by s and reads the greeting
+func dialNode(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			s.handleConnection(context.Background(), conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	if greeting, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(greeting, "# munin node at") {
+		t.Fatalf("greeting %q, %v", greeting, err)
+	}
+	return conn, r
+}
+
+// command sends line and returns the first line of the reply
+func command(t *testing.T, conn net.Conn, r *bufio.Reader, line string) string {
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("%s: %v", line, err)
+	}
+	return strings.TrimSuffix(reply, "\n")
+}
+
+// startClientTLS sends starttls and returns the connection as the client
+// side of a TLS session with the node's certificate from ca, showing the
+// certificate issuer gives for commonName, if any
+func startClientTLS(t *testing.T, conn net.Conn, r *bufio.Reader, ca, issuer *testCA, commonName string) (*tls.Conn, *bufio.Reader, error) {
+	if reply := command(t, conn, r, "starttls"); reply != "TLS OK" {
+		t.Fatalf("starttls answered %q", reply)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if commonName != "" {
+		certPEM, keyPEM := issuer.issue(t, commonName, x509.ExtKeyUsageClientAuth)
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	return tlsConn, bufio.NewReader(tlsConn), nil
+}
+
+func TestStartTLSCommonNameACL(t *testing.T) {
+	ca := newTestCA(t)
+	tests := []struct {
+		name       string
+		tls        bool
+		commonName string
+		list       string
+		cpu        string
+	}{
+		{"plain", false, "", "billing_queue cpu", "user.value 1"},
+		{"no certificate", true, "", "billing_queue cpu", "user.value 1"},
+		{"billing-poller", true, "billing-poller", "billing_queue", "# Unknown service"},
+		{"other poller", true, "other-poller", "billing_queue cpu", "user.value 1"},
+	}
+	for _, test := range tests {
+		s := newTLSServer(t, ca, tlsEnabled)
+		conn, r := dialNode(t, s)
+		if test.tls {
+			tlsConn, tlsReader, err := startClientTLS(t, conn, r, ca, ca, test.commonName)
+			if err != nil {
+				t.Fatalf("%s: handshake failed: %v", test.name, err)
+			}
+			conn, r = tlsConn, tlsReader
+		}
+
+		if got := command(t, conn, r, "list"); got != test.list {
+			t.Errorf("%s: list = %q, want %q", test.name, got, test.list)
+		}
+		if got := command(t, conn, r, "fetch billing_queue"); got != "queue.value 3" {
+			t.Errorf("%s: fetch billing_queue = %q", test.name, got)
+		}
+		r.ReadString('\n')
+		if got := command(t, conn, r, "fetch cpu"); got != test.cpu {
+			t.Errorf("%s: fetch cpu = %q, want %q", test.name, got, test.cpu)
+		}
+	}
+}
+
+func TestStartTLSUntrustedCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	s := newTLSServer(t, ca, tlsEnabled)
+	conn, r := dialNode(t, s)
+
+	// The handshake fails on the node's side once the client has sent
+	// its certificate, which with TLS 1.3 the client sees on first read
+	otherConn, otherReader, err := startClientTLS(t, conn, r, ca, newTestCA(t), "billing-poller")
+	if err == nil {
+		otherConn.Write([]byte("list\n"))
+		_, err = otherReader.ReadString('\n')
+	}
+	if err == nil {
+		t.Error("node accepted a certificate from another CA")
+	}
+}
+
+func TestTLSParanoid(t *testing.T) {
+	ca := newTestCA(t)
+	s := newTLSServer(t, ca, tlsParanoid)
+
+	conn, r := dialNode(t, s)
+	if got := command(t, conn, r, "cap"); got != "cap multigraph" {
+		t.Errorf("cap before starttls = %q", got)
+	}
+	if got := command(t, conn, r, "list"); got != "# I require TLS. Closing." {
+		t.Errorf("list before starttls = %q", got)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("connection still open after refusing plain list")
+	}
+
+	conn, r = dialNode(t, s)
+	tlsConn, tlsReader, err := startClientTLS(t, conn, r, ca, ca, "billing-poller")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := command(t, tlsConn, tlsReader, "list"); got != "billing_queue" {
+		t.Errorf("list after starttls = %q", got)
+	}
+}
+
+func TestConfigureTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		tls    string
+		ca     bool
+		verify bool
+		acl    bool
+		err    string
+	}{
+		{"disabled", tlsDisabled, false, false, false, ""},
+		{"cn without tls", tlsDisabled, false, false, true, "plugin_acl cn: rules need tls and tls_ca_certificate"},
+		{"cn without ca", tlsEnabled, false, false, true, "plugin_acl cn: rules need tls_ca_certificate"},
+		{"verify without ca", tlsEnabled, false, true, false, "tls_verify_certificate needs tls_ca_certificate"},
+		{"server only", tlsEnabled, false, false, false, ""},
+		{"verify", tlsParanoid, true, true, true, ""},
+	}
+	ca := newTestCA(t)
+	for _, test := range tests {
+		s := newTLSServer(t, ca, tlsEnabled)
+		s.tlsConfig = nil
+		s.conf.TLS = test.tls
+		s.conf.TLSVerifyCertificate = test.verify
+		if !test.ca {
+			s.conf.TLSCACertificate = ""
+		}
+		if !test.acl {
+			s.conf.PluginACLs = nil
+		}
+
+		err := s.configureTLS()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: configureTLS failed: %v", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: configureTLS error = %v, want %q", test.name, err, test.err)
+		case err == nil && (s.tlsConfig != nil) != (test.tls != tlsDisabled):
+			t.Errorf("%s: tls config set = %v", test.name, s.tlsConfig != nil)
+		}
+		if test.verify && err == nil && s.tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Errorf("%s: client certificates not required", test.name)
+		}
+	}
+}
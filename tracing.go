@@ -0,0 +1,128 @@
+//go:build !minimal || tracing
+// +build !minimal tracing
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the connection and plugin spans. Until configureTracing
+// installs an exporter it is the global no-op tracer.
+var tracer = otel.Tracer("munin-node")
+
+// tracerProvider batches the spans for the exporter, nil without tracing
+var tracerProvider *sdktrace.TracerProvider
+
+// traceShutdownTimeout bounds how long a stopping node tries to export
+// the spans still batched
+const traceShutdownTimeout = 5 * time.Second
+
+// configureTracing exports spans over OTLP/HTTP to the otel_endpoint of
+// conf, if set.
+// The exporter's OTEL_EXPORTER_OTLP_* environment variables, e.g. for
+// headers or certificates, apply as usual.
+func configureTracing(conf *NodeConfig) error {
+	if conf.OtelEndpoint == "" {
+		return nil
+	}
+
+	// A URL is used as is, except that a collector's base URL gets the
+	// standard traces path; a bare host:port means plain HTTP
+	var options []otlptracehttp.Option
+	if strings.Contains(conf.OtelEndpoint, "://") {
+		endpoint := conf.OtelEndpoint
+		if u, err := url.Parse(endpoint); err == nil && strings.Trim(u.Path, "/") == "" {
+			endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+		}
+		options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+	} else {
+		options = append(options, otlptracehttp.WithEndpoint(conf.OtelEndpoint), otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(conf.OtelServiceName),
+		semconv.ServiceVersion(version),
+		semconv.HostName(conf.HostName),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	tracerProvider = provider
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logger.Warn("failed to export traces", "endpoint", conf.OtelEndpoint, "error", err)
+	}))
+	tracer = provider.Tracer("munin-node")
+
+	logger.Info("tracing enabled", "endpoint", conf.OtelEndpoint)
+
+	return nil
+}
+
+// shutdownTracing exports the spans still batched and stops the exporter,
+// for use once the node has stopped serving
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		logger.Warn("failed to flush traces", "error", err)
+	}
+	tracerProvider = nil
+}
+
+// traceConnection starts the span covering a whole client connection
+func traceConnection(ctx context.Context, network, client string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "munin.connection",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("network.transport", network),
+			attribute.String("client.address", client),
+		))
+}
+
+// tracePlugin runs a plugin inside a span of its own, recording its name,
+// option and exit status.
+func (s *Server) tracePlugin(ctx context.Context, plugin, option string) (string, error) {
+	ctx, span := tracer.Start(ctx, "munin.plugin", trace.WithAttributes(
+		attribute.String("munin.plugin", plugin),
+		attribute.String("munin.option", metricOption(option)),
+	))
+	defer span.End()
+
+	output, err := s.executePlugin(ctx, plugin, option)
+
+	span.SetAttributes(attribute.Int("munin.exit_code", s.pluginExitCode(plugin, err)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return output, err
+}
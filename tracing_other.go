@@ -0,0 +1,33 @@
+//go:build minimal && !tracing
+// +build minimal,!tracing
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// Without the tracing tag a minimal build leaves OpenTelemetry out, which
+// is most of what it would weigh, and refuses otel_endpoint.
+
+type noopSpan struct{}
+
+func (noopSpan) End() {}
+
+func configureTracing(conf *NodeConfig) error {
+	if conf.OtelEndpoint != "" {
+		return errors.New("otel_endpoint needs a build with the tracing tag")
+	}
+	return nil
+}
+
+func shutdownTracing() {}
+
+func traceConnection(ctx context.Context, network, client string) (context.Context, noopSpan) {
+	return ctx, noopSpan{}
+}
+
+func (s *Server) tracePlugin(ctx context.Context, plugin, option string) (string, error) {
+	return s.executePlugin(ctx, plugin, option)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseIDList parses a space separated list of numeric uids or gids.
+func parseIDList(value string) ([]uint32, error) {
+	var ids []uint32
+	for _, field := range strings.Fields(value) {
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", field, err)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedPeer checks the credentials of a Unix socket client against
+// allow_uid and allow_gid. Without either directive only root and the
+// user the node runs as are accepted.
+func (s *Server) isAllowedPeer(uid, gid uint32) bool {
+	if len(s.conf.AllowedUIDs) == 0 && len(s.conf.AllowedGIDs) == 0 {
+		return uid == 0 || uid == uint32(os.Getuid())
+	}
+	return containsID(s.conf.AllowedUIDs, uid) || containsID(s.conf.AllowedGIDs, gid)
+}
+
+func (s *Server) listenUnix() (net.Listener, error) {
+	// A socket file left behind by a previous run would make Listen fail
+	if fileInfo, err := os.Lstat(s.conf.UnixSocket); err == nil && fileInfo.Mode()&os.ModeSocket != 0 {
+		os.Remove(s.conf.UnixSocket)
+	}
+
+	listener, err := net.Listen("unix", s.conf.UnixSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start server on %s: %w", s.conf.UnixSocket, err)
+	}
+
+	// Access is decided by peer credentials, so let anyone connect
+	if err := os.Chmod(s.conf.UnixSocket, 0666); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", s.conf.UnixSocket, err)
+	}
+
+	logger.Info("node started", "socket", s.conf.UnixSocket)
+	s.healthListener(s.conf.UnixSocket, nil)
+
+	return listener, nil
+}
+
+func (s *Server) serveUnix(ctx context.Context, listener net.Listener) {
+	defer listener.Close()
+	s.trackListener(listener)
+	socket := listener.Addr().String()
+
+	for {
+		conn, err := listener.Accept()
+		if s.isShuttingDown() {
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			logger.Error("failed to accept connection", "socket", socket, "error", err)
+			metricErrors.inc("accept")
+			s.healthListener(socket, err)
+			continue
+		}
+		s.healthListener(socket, nil)
+
+		if !s.admitUnix(conn.(*net.UnixConn)) {
+			conn.Close()
+			continue
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			s.handleConnection(ctx, conn)
+		}(conn)
+	}
+}
+
+// admitUnix counts a new Unix socket connection and tells whether its
+// peer credentials allow it to talk to the node.
+func (s *Server) admitUnix(conn *net.UnixConn) bool {
+	metricConnections.inc("unix")
+
+	uid, gid, err := peerCredentials(conn)
+	if err != nil {
+		logger.Error("failed to get peer credentials", "error", err)
+		metricErrors.inc("peer_credentials")
+		return false
+	}
+
+	if !s.isAllowedPeer(uid, gid) {
+		client := fmt.Sprintf("uid:%d", uid)
+		logger.Warn("access denied", "client", client, "listener", "unix", "gid", gid, "count", s.recordDenied(client))
+		metricConnectionsDenied.inc("unix")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseIDList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []uint32
+		wantErr bool
+	}{
+		{"0 1000  1001", []uint32{0, 1000, 1001}, false},
+		{"", nil, false},
+		{"4294967295", []uint32{4294967295}, false},
+		{"4294967296", nil, true},
+		{"-1", nil, true},
+		{"munin", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseIDList(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseIDList(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseIDList(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestIsAllowedPeer(t *testing.T) {
+	self := uint32(os.Getuid())
+	other := self + 4242
+
+	tests := []struct {
+		name     string
+		uids     []uint32
+		gids     []uint32
+		uid, gid uint32
+		want     bool
+	}{
+		{"root by default", nil, nil, 0, 0, true},
+		{"own user by default", nil, nil, self, 4242, true},
+		{"other user by default", nil, nil, other, 0, false},
+		{"listed uid", []uint32{other}, nil, other, 4242, true},
+		{"listed gid", nil, []uint32{4242}, other, 4242, true},
+		{"root not listed", []uint32{other}, nil, 0, 0, false},
+		{"neither listed", []uint32{1000}, []uint32{1000}, other, 4242, false},
+	}
+	for _, test := range tests {
+		conf := newNodeConfig()
+		conf.AllowedUIDs, conf.AllowedGIDs = test.uids, test.gids
+		s := newServer(conf)
+		if got := s.isAllowedPeer(test.uid, test.gid); got != test.want {
+			t.Errorf("%s: isAllowedPeer(%d, %d) = %v, want %v", test.name, test.uid, test.gid, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// On SIGUSR2 the node starts its executable anew, which after a package
+// upgrade is the new version, and hands it the listening sockets. Once the
+// new node serves them it sends the old one SIGTERM, which then drains its
+// connections as on any stop. Clients connecting in between are accepted
+// by one or the other, so no poll is refused.
+const (
+	// upgradeListenersEnv lists what the sockets passed from fd 3 on are:
+	// "munin", "metrics" or "pprof", comma separated
+	upgradeListenersEnv = "MUNIN_NODE_LISTENERS"
+	// upgradeParentEnv is the pid of the node being replaced
+	upgradeParentEnv = "MUNIN_NODE_PARENT"
+	// upgradePIDFileEnv is the file descriptor of the locked pid_file
+	upgradePIDFileEnv = "MUNIN_NODE_PID_FD"
+)
+
+// handoverEnv are the variables passing file descriptors to this process,
+// which are not to be inherited by the processes it starts
+var handoverEnv = []string{upgradeListenersEnv, upgradeParentEnv, upgradePIDFileEnv, daemonReadyEnv}
+
+// inheritedListeners returns the sockets the node being replaced passed
+// on, by what they are for, or nil when this node was started normally.
+func inheritedListeners() (map[string][]net.Listener, error) {
+	kinds := os.Getenv(upgradeListenersEnv)
+	if kinds == "" || os.Getenv(upgradeParentEnv) == "" {
+		return nil, nil
+	}
+
+	listeners := make(map[string][]net.Listener)
+	for i, kind := range strings.Split(kinds, ",") {
+		fd := 3 + i
+		file := os.NewFile(uintptr(fd), kind)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+		listeners[kind] = append(listeners[kind], listener)
+	}
+
+	// The socket file is this node's to remove now
+	setUnlinkOnClose(listeners["munin"], true)
+	return listeners, nil
+}
+
+// inheritedPIDFile returns the pid file at path the node being replaced
+// locked, or nil when this node was started normally
+func inheritedPIDFile(path string) *os.File {
+	fd, err := strconv.Atoi(os.Getenv(upgradePIDFileEnv))
+	if err != nil || os.Getenv(upgradeParentEnv) == "" {
+		return nil
+	}
+	return os.NewFile(uintptr(fd), path)
+}
+
+// replaceParent stops the node this one was started to replace, now that
+// its sockets are served here.
+func replaceParent() {
+	parent := os.Getenv(upgradeParentEnv)
+	if parent == "" {
+		return
+	}
+
+	pid, err := strconv.Atoi(parent)
+	if err != nil {
+		return
+	}
+	logger.Info("node upgraded", "previous_pid", pid)
+	if err := writePIDFile(); err != nil {
+		logger.Warn("failed to update pid file", "path", pidFile.Name(), "error", err)
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		logger.Warn("failed to stop previous node", "pid", pid, "error", err)
+	}
+}
+
+// upgradeOnSignal starts a replacement node whenever SIGUSR2 arrives
+func (s *Server) upgradeOnSignal(listeners map[string][]net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	go func() {
+		for range signals {
+			if handingOver.Load() {
+				logger.Warn("node upgrade already in progress")
+				continue
+			}
+			if err := s.startReplacement(listeners); err != nil {
+				logger.Error("node upgrade failed", "error", err)
+			}
+		}
+	}()
+}
+
+// startReplacement starts the node's executable with the listeners. If it
+// exits before taking over, this node carries on serving.
+func (s *Server) startReplacement(listeners map[string][]net.Listener) error {
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	var kinds []string
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, kind := range []string{"munin", "metrics", "pprof"} {
+		for _, listener := range listeners[kind] {
+			filer, ok := listener.(interface{ File() (*os.File, error) })
+			if !ok {
+				return fmt.Errorf("cannot pass on listener %s", listener.Addr())
+			}
+			file, err := filer.File()
+			if err != nil {
+				return fmt.Errorf("cannot pass on listener %s: %w", listener.Addr(), err)
+			}
+			kinds = append(kinds, kind)
+			files = append(files, file)
+		}
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(handoverWatchdog(inheritableEnviron()),
+		upgradeListenersEnv+"="+strings.Join(kinds, ","),
+		upgradeParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	cmd.ExtraFiles = files
+	if pidFile != nil {
+		cmd.Env = append(cmd.Env, upgradePIDFileEnv+"="+strconv.Itoa(3+len(files)))
+		cmd.ExtraFiles = append(cmd.ExtraFiles, pidFile)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// The socket file has to outlive this node's listener now
+	setUnlinkOnClose(listeners["munin"], false)
+	handingOver.Store(true)
+
+	if err := cmd.Start(); err != nil {
+		handingOver.Store(false)
+		setUnlinkOnClose(listeners["munin"], true)
+		return fmt.Errorf("failed to start %s: %w", path, err)
+	}
+	logger.Info("node upgrade started", "path", path, "pid", cmd.Process.Pid)
+
+	go func() {
+		err := cmd.Wait()
+		if s.isShuttingDown() {
+			return
+		}
+		handingOver.Store(false)
+		setUnlinkOnClose(listeners["munin"], true)
+		logger.Error("node upgrade failed, replacement exited", "pid", cmd.Process.Pid, "error", err)
+	}()
+	return nil
+}
+
+// handoverWatchdog points WATCHDOG_PID in env at this node if the systemd
+// watchdog is this node's. systemd expects the keepalives from this node
+// until the replacement sends MAINPID, and the replacement takes the
+// watchdog of its parent as its own.
+func handoverWatchdog(env []string) []string {
+	for i, kv := range env {
+		if pid, ok := strings.CutPrefix(kv, "WATCHDOG_PID="); ok && isWatchdogPID(pid) {
+			env[i] = "WATCHDOG_PID=" + strconv.Itoa(os.Getpid())
+		}
+	}
+	return env
+}
+
+// isWatchdogPID tells whether WATCHDOG_PID, which systemd sets to the
+// unit's main pid, names this node or the node it was started to replace
+func isWatchdogPID(pid string) bool {
+	if pid == "" || pid == strconv.Itoa(os.Getpid()) {
+		return true
+	}
+	parent := os.Getenv(upgradeParentEnv)
+	return parent != "" && pid == parent
+}
+
+func setUnlinkOnClose(listeners []net.Listener, unlink bool) {
+	for _, listener := range listeners {
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(unlink)
+		}
+	}
+}
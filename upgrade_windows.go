@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// handoverEnv is empty, as no file descriptors are passed on Windows
+var handoverEnv []string
+
+// inheritedListeners reports no sockets, as Windows has no SIGUSR2 to
+// start an upgrade with
+func inheritedListeners() (map[string][]net.Listener, error) {
+	return nil, nil
+}
+
+func inheritedPIDFile(path string) *os.File {
+	return nil
+}
+
+func replaceParent() {}
+
+func (s *Server) upgradeOnSignal(listeners map[string][]net.Listener) {}
@@ -0,0 +1,15 @@
+//go:build openbsd || netbsd
+// +build openbsd netbsd
+
+package main
+
+// uvmStats are the UVM page counts the memory plugin graphs, in bytes
+type uvmStats struct {
+	total     uint64
+	free      uint64
+	active    uint64
+	inactive  uint64
+	wired     uint64
+	swapTotal uint64
+	swapUsed  uint64
+}